@@ -0,0 +1,181 @@
+package alerting_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sfr-backend/alerting"
+	"sfr-backend/mocks"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sfn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type recordingNotifier struct {
+	name   string
+	alerts []alerting.Alert
+	err    error
+}
+
+func (notifier *recordingNotifier) Name() string {
+	if notifier.name == "" {
+		return "recording"
+	}
+	return notifier.name
+}
+
+func (notifier *recordingNotifier) Notify(alert alerting.Alert) error {
+	notifier.alerts = append(notifier.alerts, alert)
+	return notifier.err
+}
+
+func TestWebhookNotifierSignature(t *testing.T) {
+	secret := "secret"
+	var receivedAlert alerting.Alert
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		expectedSignature := "sha256=" + alerting.Sign(secret, r.Header.Get(alerting.TimestampHeader), body)
+		if r.Header.Get(alerting.SignatureHeader) != expectedSignature {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.Unmarshal(body, &receivedAlert)
+	}))
+	defer server.Close()
+
+	notifier := &alerting.WebhookNotifier{URL: server.URL, Secret: secret}
+	err := notifier.Notify(alerting.Alert{ExecutionArn: "executionArn", Status: "FAILED"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "executionArn", receivedAlert.ExecutionArn)
+
+	badNotifier := &alerting.WebhookNotifier{URL: server.URL, Secret: "other"}
+	assert.NotNil(t, badNotifier.Notify(alerting.Alert{ExecutionArn: "executionArn"}))
+}
+
+func TestSlackNotifier(t *testing.T) {
+	var payload map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&payload)
+	}))
+	defer server.Close()
+
+	notifier := &alerting.SlackNotifier{URL: server.URL}
+	err := notifier.Notify(alerting.Alert{
+		Machine:       "arn:aws:states:us-east-1:123456789012:stateMachine:Machine",
+		ExecutionName: "execution",
+		Status:        "FAILED",
+	})
+
+	assert.Nil(t, err)
+	assert.Contains(t, payload["text"], "Execution execution of Machine ended with status FAILED")
+}
+
+func TestStatePersistence(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "alerting")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.json")
+	now := time.Now().UTC().Truncate(time.Second)
+
+	state, err := alerting.LoadState(path)
+	assert.Nil(t, err)
+	state.MarkAlerted("old", now.Add(-48*time.Hour))
+	state.MarkAlerted("new", now)
+	state.MarkDelivered("partial", "webhook", now)
+	state.MarkDelivered("partial", "slack", now.Add(-48*time.Hour))
+	state.MarkChecked("machine", now)
+	state.Prune(now.Add(-24 * time.Hour))
+	assert.Nil(t, state.Save())
+
+	loaded, err := alerting.LoadState(path)
+	assert.Nil(t, err)
+	assert.True(t, loaded.WasAlerted("new"))
+	assert.False(t, loaded.WasAlerted("old"))
+	assert.True(t, loaded.WasDelivered("partial", "webhook"))
+	assert.False(t, loaded.WasDelivered("partial", "slack"))
+	checked, ok := loaded.LastChecked("machine")
+	assert.True(t, ok)
+	assert.True(t, now.Equal(checked))
+}
+
+func TestWatcherPollDeduplicates(t *testing.T) {
+	mockAwsProvider := &mocks.AwsStepFunctionsProvider{}
+	mockStepFunction := &mocks.AwsStepFunctionInterface{}
+	mockAwsProvider.On("New", mock.Anything).Return(mockStepFunction, nil)
+
+	now := time.Now()
+	mockStepFunction.On("ListExecutions", mock.MatchedBy(func(input *sfn.ListExecutionsInput) bool {
+		return *input.StatusFilter == sfn.ExecutionStatusFailed
+	})).Return(&sfn.ListExecutionsOutput{Executions: []*sfn.ExecutionListItem{
+		{ExecutionArn: aws.String("failed"), Name: aws.String("failed"), Status: aws.String("FAILED"), StartDate: aws.Time(now.Add(-time.Minute)), StopDate: aws.Time(now.Add(-time.Second))},
+		{ExecutionArn: aws.String("long-running"), Name: aws.String("long-running"), Status: aws.String("FAILED"), StartDate: aws.Time(now.Add(-5 * time.Hour)), StopDate: aws.Time(now.Add(-time.Minute))},
+		{ExecutionArn: aws.String("stopped-before"), Name: aws.String("stopped-before"), Status: aws.String("FAILED"), StartDate: aws.Time(now.Add(-6 * time.Hour)), StopDate: aws.Time(now.Add(-2 * time.Hour))},
+		{ExecutionArn: aws.String("too-old"), Name: aws.String("too-old"), Status: aws.String("FAILED"), StartDate: aws.Time(now.Add(-48 * time.Hour)), StopDate: aws.Time(now.Add(-time.Minute))},
+	}}, nil)
+	mockStepFunction.On("ListExecutions", mock.Anything).Return(&sfn.ListExecutionsOutput{}, nil)
+
+	state, _ := alerting.LoadState("")
+	notifier := &recordingNotifier{}
+	watcher := &alerting.Watcher{
+		Provider:  mockAwsProvider,
+		Machines:  []string{"arn:aws:states:eu-west-1:123456789012:stateMachine:Machine"},
+		Interval:  time.Minute,
+		Lookback:  time.Hour,
+		Retention: 24 * time.Hour,
+		Notifiers: []alerting.Notifier{notifier},
+		State:     state,
+	}
+
+	watcher.Poll(now)
+	watcher.Poll(now.Add(time.Minute))
+
+	assert.Equal(t, 2, len(notifier.alerts))
+	assert.Equal(t, "failed", notifier.alerts[0].ExecutionArn)
+	assert.Equal(t, "eu-west-1", notifier.alerts[0].Region)
+	assert.Equal(t, "long-running", notifier.alerts[1].ExecutionArn)
+}
+
+func TestWatcherRetriesFailedNotifications(t *testing.T) {
+	mockAwsProvider := &mocks.AwsStepFunctionsProvider{}
+	mockStepFunction := &mocks.AwsStepFunctionInterface{}
+	mockAwsProvider.On("New", mock.Anything).Return(mockStepFunction, nil)
+
+	now := time.Now()
+	mockStepFunction.On("ListExecutions", mock.MatchedBy(func(input *sfn.ListExecutionsInput) bool {
+		return *input.StatusFilter == sfn.ExecutionStatusAborted
+	})).Return(&sfn.ListExecutionsOutput{Executions: []*sfn.ExecutionListItem{
+		{ExecutionArn: aws.String("aborted"), Status: aws.String("ABORTED"), StartDate: aws.Time(now), StopDate: aws.Time(now)},
+	}}, nil)
+	mockStepFunction.On("ListExecutions", mock.Anything).Return(&sfn.ListExecutionsOutput{}, nil)
+
+	state, _ := alerting.LoadState("")
+	delivering := &recordingNotifier{name: "delivering"}
+	notifier := &recordingNotifier{err: errors.New("unavailable")}
+	watcher := &alerting.Watcher{
+		Provider:  mockAwsProvider,
+		Machines:  []string{"machine"},
+		Lookback:  time.Hour,
+		Retention: 24 * time.Hour,
+		Notifiers: []alerting.Notifier{delivering, notifier},
+		State:     state,
+	}
+
+	watcher.Poll(now)
+	assert.False(t, state.WasAlerted("aborted"))
+	assert.True(t, state.WasDelivered("aborted", "delivering"))
+	notifier.err = nil
+	watcher.Poll(now.Add(time.Minute))
+	watcher.Poll(now.Add(2 * time.Minute))
+
+	assert.Equal(t, 1, len(delivering.alerts))
+	assert.Equal(t, 2, len(notifier.alerts))
+	assert.True(t, state.WasAlerted("aborted"))
+}
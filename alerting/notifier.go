@@ -0,0 +1,156 @@
+package alerting
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"sfr-backend/mailer"
+)
+
+// SignatureHeader - header carrying HMAC signature of webhook payload
+const SignatureHeader = "X-Signature"
+
+// TimestampHeader - header carrying unix timestamp included in the signature
+const TimestampHeader = "X-Timestamp"
+
+// Alert - failed execution reported to notifiers
+type Alert struct {
+	Machine       string    `json:"machine"`
+	Region        string    `json:"region"`
+	ExecutionArn  string    `json:"executionArn"`
+	ExecutionName string    `json:"executionName"`
+	Status        string    `json:"status"`
+	StartDate     time.Time `json:"startDate"`
+	StopDate      time.Time `json:"stopDate"`
+}
+
+// Summary - one line description of alert
+func (alert Alert) Summary() string {
+	return fmt.Sprintf("Execution %s of %s ended with status %s", alert.ExecutionName, machineName(alert.Machine), alert.Status)
+}
+
+// Notifier - sends alerts to external systems
+type Notifier interface {
+	Name() string
+	Notify(alert Alert) error
+}
+
+// WebhookNotifier - posts alert as JSON signed with HMAC SHA256 of timestamp and body
+type WebhookNotifier struct {
+	URL    string
+	Secret string
+	Client *http.Client
+}
+
+// Name - returns notifier name
+func (notifier *WebhookNotifier) Name() string {
+	return "webhook"
+}
+
+// Notify - posts alert to webhook
+func (notifier *WebhookNotifier) Notify(alert Alert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	headers := map[string]string{}
+	if notifier.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		headers[TimestampHeader] = timestamp
+		headers[SignatureHeader] = "sha256=" + Sign(notifier.Secret, timestamp, body)
+	}
+	return postJSON(notifier.Client, notifier.URL, body, headers)
+}
+
+// Sign - returns hex encoded HMAC SHA256 of timestamp and body joined with a dot
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SlackNotifier - posts alert to Slack compatible incoming webhook
+type SlackNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+// Name - returns notifier name
+func (notifier *SlackNotifier) Name() string {
+	return "slack"
+}
+
+// Notify - posts alert as Slack message
+func (notifier *SlackNotifier) Notify(alert Alert) error {
+	body, err := json.Marshal(map[string]string{
+		"text": fmt.Sprintf(":rotating_light: %s\n<%s|%s>", alert.Summary(), consoleURL(alert), alert.ExecutionArn),
+	})
+	if err != nil {
+		return err
+	}
+	return postJSON(notifier.Client, notifier.URL, body, nil)
+}
+
+// EmailNotifier - sends alert by email
+type EmailNotifier struct {
+	To     []string
+	Mailer mailer.Mailer
+}
+
+// Name - returns notifier name
+func (notifier *EmailNotifier) Name() string {
+	return "email"
+}
+
+// Notify - sends alert email to all recipients
+func (notifier *EmailNotifier) Notify(alert Alert) error {
+	body := fmt.Sprintf("%s\n\nExecution: %s\nStatus: %s\nStarted: %s\nStopped: %s\nConsole: %s\n",
+		alert.Summary(), alert.ExecutionArn, alert.Status,
+		alert.StartDate.Format(time.RFC3339), alert.StopDate.Format(time.RFC3339), consoleURL(alert))
+	return notifier.Mailer.Send(mailer.Message{
+		To:      notifier.To,
+		Subject: "[Step Functions] " + alert.Summary(),
+		Body:    body,
+	})
+}
+
+func postJSON(client *http.Client, url string, body []byte, headers map[string]string) error {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("notification to %s failed with status %d", url, resp.StatusCode)
+	}
+	return nil
+}
+
+func consoleURL(alert Alert) string {
+	return fmt.Sprintf("https://%s.console.aws.amazon.com/states/home?region=%s#/executions/details/%s", alert.Region, alert.Region, alert.ExecutionArn)
+}
+
+func machineName(arn string) string {
+	return arn[strings.LastIndex(arn, ":")+1:]
+}
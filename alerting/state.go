@@ -0,0 +1,149 @@
+package alerting
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// State - deduplication state of watcher persisted between restarts
+type State struct {
+	path string
+	mu   sync.Mutex
+	// Alerted - execution ARNs already notified by all notifiers with time of notification
+	Alerted map[string]time.Time `json:"alerted"`
+	// Delivered - per execution ARN notifiers which already sent alert while others failed
+	Delivered map[string]map[string]time.Time `json:"delivered"`
+	// CheckedUntil - per machine time of last successful poll
+	CheckedUntil map[string]time.Time `json:"checkedUntil"`
+}
+
+// LoadState - loads state from file, missing file results in empty state
+func LoadState(path string) (*State, error) {
+	state := &State{
+		path:         path,
+		Alerted:      map[string]time.Time{},
+		Delivered:    map[string]map[string]time.Time{},
+		CheckedUntil: map[string]time.Time{},
+	}
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, state); err != nil {
+		return nil, err
+	}
+	if state.Alerted == nil {
+		state.Alerted = map[string]time.Time{}
+	}
+	if state.Delivered == nil {
+		state.Delivered = map[string]map[string]time.Time{}
+	}
+	if state.CheckedUntil == nil {
+		state.CheckedUntil = map[string]time.Time{}
+	}
+	return state, nil
+}
+
+// WasAlerted - checks whether execution was already notified
+func (state *State) WasAlerted(executionArn string) bool {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	_, ok := state.Alerted[executionArn]
+	return ok
+}
+
+// MarkAlerted - remembers execution as notified by all notifiers
+func (state *State) MarkAlerted(executionArn string, at time.Time) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	state.Alerted[executionArn] = at
+	delete(state.Delivered, executionArn)
+}
+
+// WasDelivered - checks whether notifier already sent alert about execution
+func (state *State) WasDelivered(executionArn string, notifier string) bool {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	_, ok := state.Delivered[executionArn][notifier]
+	return ok
+}
+
+// MarkDelivered - remembers that notifier sent alert about execution
+func (state *State) MarkDelivered(executionArn string, notifier string, at time.Time) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if state.Delivered[executionArn] == nil {
+		state.Delivered[executionArn] = map[string]time.Time{}
+	}
+	state.Delivered[executionArn][notifier] = at
+}
+
+// LastChecked - returns time of last poll of machine
+func (state *State) LastChecked(machine string) (time.Time, bool) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	checked, ok := state.CheckedUntil[machine]
+	return checked, ok
+}
+
+// MarkChecked - remembers time of last poll of machine
+func (state *State) MarkChecked(machine string, at time.Time) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	state.CheckedUntil[machine] = at
+}
+
+// Prune - forgets notifications older than retention
+func (state *State) Prune(before time.Time) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	for executionArn, at := range state.Alerted {
+		if at.Before(before) {
+			delete(state.Alerted, executionArn)
+		}
+	}
+	for executionArn, notifiers := range state.Delivered {
+		for notifier, at := range notifiers {
+			if at.Before(before) {
+				delete(notifiers, notifier)
+			}
+		}
+		if len(notifiers) == 0 {
+			delete(state.Delivered, executionArn)
+		}
+	}
+}
+
+// Save - writes state atomically to its file
+func (state *State) Save() error {
+	state.mu.Lock()
+	content, err := json.Marshal(state)
+	state.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if state.path == "" {
+		return nil
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(state.path), filepath.Base(state.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), state.path)
+}
@@ -0,0 +1,217 @@
+package alerting
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	awsprovider "sfr-backend/awsProvider"
+	"sfr-backend/awssession"
+	"sfr-backend/mailer"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sfn"
+	log "github.com/sirupsen/logrus"
+)
+
+// alertedStatuses - execution statuses reported by watcher
+var alertedStatuses = []string{sfn.ExecutionStatusFailed, sfn.ExecutionStatusTimedOut, sfn.ExecutionStatusAborted}
+
+// Watcher - periodically lists executions of configured machines and notifies about failures
+type Watcher struct {
+	Provider  awsprovider.AwsStepFunctionsProvider
+	Machines  []string
+	Interval  time.Duration
+	Lookback  time.Duration
+	Retention time.Duration
+	Notifiers []Notifier
+	State     *State
+}
+
+// NewWatcherFromEnv - creates watcher configured with ALERT_* variables, returns nil when
+// no machines or notifiers are configured
+func NewWatcherFromEnv(provider awsprovider.AwsStepFunctionsProvider) (*Watcher, error) {
+	machines := splitList(os.Getenv("ALERT_MACHINES"))
+	if len(machines) == 0 {
+		return nil, nil
+	}
+	notifiers := []Notifier{}
+	if url := os.Getenv("ALERT_WEBHOOK_URL"); url != "" {
+		notifiers = append(notifiers, &WebhookNotifier{URL: url, Secret: os.Getenv("ALERT_WEBHOOK_SECRET")})
+	}
+	if url := os.Getenv("ALERT_SLACK_WEBHOOK_URL"); url != "" {
+		notifiers = append(notifiers, &SlackNotifier{URL: url})
+	}
+	if recipients := splitList(os.Getenv("ALERT_EMAIL_TO")); len(recipients) > 0 {
+		if smtpMailer := mailer.NewSMTPMailerFromEnv(); smtpMailer != nil {
+			notifiers = append(notifiers, &EmailNotifier{To: recipients, Mailer: smtpMailer})
+		} else {
+			log.Warn("ALERT_EMAIL_TO is set but SMTP_HOST is missing, email alerts are disabled")
+		}
+	}
+	if len(notifiers) == 0 {
+		return nil, nil
+	}
+	statePath := os.Getenv("ALERT_STATE_FILE")
+	if statePath == "" {
+		statePath = "alert_state.json"
+	}
+	state, err := LoadState(statePath)
+	if err != nil {
+		return nil, err
+	}
+	return &Watcher{
+		Provider:  provider,
+		Machines:  machines,
+		Interval:  durationFromEnv("ALERT_INTERVAL", 60),
+		Lookback:  durationFromEnv("ALERT_LOOKBACK", 3600),
+		Retention: durationFromEnv("ALERT_RETENTION", 7*24*3600),
+		Notifiers: notifiers,
+		State:     state,
+	}, nil
+}
+
+// Run - polls machines every interval until context is cancelled
+func (watcher *Watcher) Run(ctx context.Context) {
+	log.WithFields(log.Fields{"machines": watcher.Machines, "interval": watcher.Interval}).Info("Starting failure alerting watcher")
+	ticker := time.NewTicker(watcher.Interval)
+	defer ticker.Stop()
+	for {
+		watcher.Poll(time.Now())
+		select {
+		case <-ctx.Done():
+			log.Info("Stopping failure alerting watcher")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll - checks all machines once and persists state
+func (watcher *Watcher) Poll(now time.Time) {
+	for _, machine := range watcher.Machines {
+		if err := watcher.pollMachine(machine, now); err != nil {
+			log.WithFields(log.Fields{"machine": machine}).Error("Failure alerting poll failed: ", err)
+		}
+	}
+	watcher.State.Prune(now.Add(-watcher.Retention))
+	if err := watcher.State.Save(); err != nil {
+		log.Error("Failed to save failure alerting state: ", err)
+	}
+}
+
+func (watcher *Watcher) pollMachine(machine string, now time.Time) error {
+	region := regionFromArn(machine)
+	sfv, err := awssession.CreateStepFunctionSessionForRegion(region, watcher.Provider)
+	if err != nil {
+		return err
+	}
+	// executions may fail long after they were started, so always look back from last check,
+	// but never further than notifications are remembered to avoid repeated alerts
+	since := now.Add(-watcher.Lookback)
+	if checked, ok := watcher.State.LastChecked(machine); ok && checked.Add(-watcher.Lookback).Before(since) {
+		since = checked.Add(-watcher.Lookback)
+	}
+	oldest := now.Add(-watcher.Retention)
+	if since.Before(oldest) {
+		since = oldest
+	}
+	failedNotifications := false
+	for _, status := range alertedStatuses {
+		input := &sfn.ListExecutionsInput{
+			StateMachineArn: aws.String(machine),
+			StatusFilter:    aws.String(status),
+		}
+		for {
+			executions, err := sfv.ListExecutions(input)
+			if err != nil {
+				return err
+			}
+			// executions are listed newest started first, ones started earlier may still have ended
+			// within window, so filter by stop date and stop listing only past remembered notifications
+			reachedOldest := false
+			for _, execution := range executions.Executions {
+				if aws.TimeValue(execution.StartDate).Before(oldest) {
+					reachedOldest = true
+					break
+				}
+				if aws.TimeValue(execution.StopDate).Before(since) {
+					continue
+				}
+				executionArn := aws.StringValue(execution.ExecutionArn)
+				if watcher.State.WasAlerted(executionArn) {
+					continue
+				}
+				alert := Alert{
+					Machine:       machine,
+					Region:        region,
+					ExecutionArn:  executionArn,
+					ExecutionName: aws.StringValue(execution.Name),
+					Status:        aws.StringValue(execution.Status),
+					StartDate:     aws.TimeValue(execution.StartDate),
+					StopDate:      aws.TimeValue(execution.StopDate),
+				}
+				if watcher.notify(alert, now) {
+					watcher.State.MarkAlerted(executionArn, now)
+				} else {
+					failedNotifications = true
+				}
+			}
+			if reachedOldest || executions.NextToken == nil {
+				break
+			}
+			input.NextToken = executions.NextToken
+		}
+	}
+	// keep window open so failed notifications are retried on next poll
+	if !failedNotifications {
+		watcher.State.MarkChecked(machine, now)
+	}
+	return nil
+}
+
+// notify - sends alert through notifiers which didn't send it yet, returns false when any of them failed
+func (watcher *Watcher) notify(alert Alert, now time.Time) bool {
+	delivered := true
+	for _, notifier := range watcher.Notifiers {
+		if watcher.State.WasDelivered(alert.ExecutionArn, notifier.Name()) {
+			continue
+		}
+		if err := notifier.Notify(alert); err != nil {
+			log.WithFields(log.Fields{"notifier": notifier.Name(), "execution": alert.ExecutionArn}).Error("Failed to send alert: ", err)
+			delivered = false
+			continue
+		}
+		watcher.State.MarkDelivered(alert.ExecutionArn, notifier.Name(), now)
+	}
+	return delivered
+}
+
+// regionFromArn - returns region part of ARN or default region
+func regionFromArn(arn string) string {
+	parts := strings.Split(arn, ":")
+	if len(parts) > 3 && parts[3] != "" {
+		return parts[3]
+	}
+	return "us-east-1"
+}
+
+func splitList(value string) []string {
+	values := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+	return values
+}
+
+func durationFromEnv(name string, defaultSeconds int) time.Duration {
+	seconds, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || seconds <= 0 {
+		seconds = defaultSeconds
+	}
+	return time.Second * time.Duration(seconds)
+}
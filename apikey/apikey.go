@@ -0,0 +1,250 @@
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"sfr-backend/rbac"
+)
+
+// Header - request header carrying API key of service account
+const Header = "X-API-Key"
+
+// keyPrefix - marks API keys, so leaked keys are easy to find in logs and repositories
+const keyPrefix = "sfr"
+
+// scopes of routes service accounts can call
+const (
+	// ScopeRead - machines, executions, failures, regions and approvals
+	ScopeRead = "read"
+	// ScopeExecute - start and restart of single execution
+	ScopeExecute = "execute"
+	// ScopeBatch - batch restart
+	ScopeBatch = "batch"
+)
+
+var scopes = map[string]bool{ScopeRead: true, ScopeExecute: true, ScopeBatch: true}
+
+// defaultRotationGrace - how long previous key works after rotation when API_KEY_ROTATION_GRACE is not set
+const defaultRotationGrace = time.Hour
+
+var (
+	// ErrInvalidKey - key is malformed, unknown, revoked or doesn't match
+	ErrInvalidKey = errors.New("invalid API key")
+	// ErrExists - service account with the name already exists
+	ErrExists = errors.New("service account already exists")
+	// ErrRevoked - service account was revoked and its key can't be rotated
+	ErrRevoked = errors.New("service account is revoked")
+)
+
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// ServiceAccount - non human principal authenticated by API key, only hashes of keys are stored
+type ServiceAccount struct {
+	Name        string       `json:"name" dynamodbav:"name"`
+	Description string       `json:"description,omitempty" dynamodbav:"description,omitempty"`
+	Scopes      []string     `json:"scopes" dynamodbav:"scopes"`
+	Grants      []rbac.Grant `json:"grants" dynamodbav:"grants"`
+	// KeyFingerprint - identifies current key in logs and listings without revealing it
+	KeyFingerprint string `json:"keyFingerprint,omitempty" dynamodbav:"keyFingerprint,omitempty"`
+	KeyHash        string `json:"-" dynamodbav:"keyHash,omitempty"`
+	// PreviousKeyHash - key replaced by rotation, accepted until PreviousKeyExpiresAt
+	PreviousKeyHash      string     `json:"-" dynamodbav:"previousKeyHash,omitempty"`
+	PreviousKeyExpiresAt *time.Time `json:"previousKeyExpiresAt,omitempty" dynamodbav:"previousKeyExpiresAt,omitempty"`
+	CreatedBy            string     `json:"createdBy" dynamodbav:"createdBy"`
+	CreatedAt            time.Time  `json:"createdAt" dynamodbav:"createdAt"`
+	RotatedAt            *time.Time `json:"rotatedAt,omitempty" dynamodbav:"rotatedAt,omitempty"`
+	RevokedBy            string     `json:"revokedBy,omitempty" dynamodbav:"revokedBy,omitempty"`
+	RevokedAt            *time.Time `json:"revokedAt,omitempty" dynamodbav:"revokedAt,omitempty"`
+}
+
+// Store - storage of service accounts
+type Store interface {
+	// Get - returns nil when service account doesn't exist
+	Get(ctx context.Context, name string) (*ServiceAccount, error)
+	List(ctx context.Context) ([]ServiceAccount, error)
+	// Create - returns ErrExists when name is taken
+	Create(ctx context.Context, account ServiceAccount) error
+	// Update - returns ErrRevoked when account was revoked meanwhile
+	Update(ctx context.Context, account ServiceAccount) error
+}
+
+var store Store
+var now = time.Now
+
+// authenticatedTTL - how long key is rate limited by itself after it was last authenticated
+const authenticatedTTL = 10 * time.Minute
+
+// authenticated - hashes of keys authenticated recently and when it stops counting
+var authenticated = struct {
+	sync.Mutex
+	until map[string]time.Time
+}{until: map[string]time.Time{}}
+
+// SetStore - sets storage of service accounts
+func SetStore(accountStore Store) {
+	store = accountStore
+}
+
+// Principal - name of service account in audit log, approvals and rate limits
+func (account ServiceAccount) Principal() string {
+	return Principal(account.Name)
+}
+
+// Principal - prefixes service account name, so it never collides with user names
+func Principal(name string) string {
+	return "service:" + name
+}
+
+// HasScope - checks if account can call routes of scope, empty scope is never allowed
+func (account ServiceAccount) HasScope(scope string) bool {
+	if scope == "" {
+		return false
+	}
+	for _, accountScope := range account.Scopes {
+		if accountScope == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Revoked - checks if account was revoked
+func (account ServiceAccount) Revoked() bool {
+	return account.RevokedAt != nil
+}
+
+// Authenticate - returns service account of key, ErrInvalidKey for unknown, revoked and mismatching keys
+func Authenticate(ctx context.Context, key string) (*ServiceAccount, error) {
+	if store == nil {
+		return nil, ErrInvalidKey
+	}
+	name, ok := nameOfKey(key)
+	if !ok {
+		return nil, ErrInvalidKey
+	}
+	account, err := store.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if account == nil || account.Revoked() {
+		return nil, ErrInvalidKey
+	}
+	hash := hashKey(key)
+	if sameHash(hash, account.KeyHash) ||
+		(account.PreviousKeyExpiresAt != nil && now().Before(*account.PreviousKeyExpiresAt) && sameHash(hash, account.PreviousKeyHash)) {
+		rememberAuthenticated(hash)
+		return account, nil
+	}
+	return nil, ErrInvalidKey
+}
+
+// Authenticated - checks without looking key up if it was authenticated recently, other keys are rate limited
+// by client address, so random keys can't get own rate limit buckets
+func Authenticated(key string) bool {
+	hash := hashKey(key)
+	authenticated.Lock()
+	defer authenticated.Unlock()
+	return now().Before(authenticated.until[hash])
+}
+
+// rememberAuthenticated - records successful authentication of key with hash, drops expired records
+func rememberAuthenticated(hash string) {
+	authenticated.Lock()
+	defer authenticated.Unlock()
+	current := now()
+	for stored, until := range authenticated.until {
+		if !current.Before(until) {
+			delete(authenticated.until, stored)
+		}
+	}
+	authenticated.until[hash] = current.Add(authenticatedTTL)
+}
+
+// Fingerprint - short hash of key, safe to log and to use as rate limit key
+func Fingerprint(key string) string {
+	return hashKey(key)[:16]
+}
+
+// newKey - generates key in form sfr.<name>.<secret>, name lets authentication find account without scan
+func newKey(name string) string {
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	return strings.Join([]string{keyPrefix, name, hex.EncodeToString(secret)}, ".")
+}
+
+// setKey - stores hash of new key, previous key keeps working for grace period
+func (account *ServiceAccount) setKey(key string, grace time.Duration) {
+	if account.KeyHash != "" && grace > 0 {
+		expires := now().UTC().Add(grace)
+		account.PreviousKeyHash = account.KeyHash
+		account.PreviousKeyExpiresAt = &expires
+	} else {
+		account.PreviousKeyHash = ""
+		account.PreviousKeyExpiresAt = nil
+	}
+	account.KeyHash = hashKey(key)
+	account.KeyFingerprint = Fingerprint(key)
+}
+
+func nameOfKey(key string) (string, bool) {
+	parts := strings.Split(key, ".")
+	if len(parts) != 3 || parts[0] != keyPrefix || !namePattern.MatchString(parts[1]) {
+		return "", false
+	}
+	return parts[1], true
+}
+
+// hashKey - keys are random 256 bit secrets, so plain SHA-256 is enough and cheap to check on every request
+func hashKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+func sameHash(hash string, stored string) bool {
+	return stored != "" && subtle.ConstantTimeCompare([]byte(hash), []byte(stored)) == 1
+}
+
+// rotationGrace - reads API_KEY_ROTATION_GRACE, 0 makes previous key invalid immediately
+func rotationGrace() time.Duration {
+	grace, err := time.ParseDuration(os.Getenv("API_KEY_ROTATION_GRACE"))
+	if err != nil || grace < 0 {
+		return defaultRotationGrace
+	}
+	return grace
+}
+
+// validScopes - checks all scopes are known, at least one is required
+func validScopes(accountScopes []string) bool {
+	if len(accountScopes) == 0 {
+		return false
+	}
+	for _, scope := range accountScopes {
+		if !scopes[scope] {
+			return false
+		}
+	}
+	return true
+}
+
+// validGrants - checks all roles are known, service accounts never get default role, so one grant is required
+func validGrants(grants []rbac.Grant) bool {
+	if len(grants) == 0 {
+		return false
+	}
+	for _, grant := range grants {
+		if !rbac.ValidRole(grant.Role) {
+			return false
+		}
+	}
+	return true
+}
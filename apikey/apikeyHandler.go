@@ -0,0 +1,192 @@
+package apikey
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"sfr-backend/audit"
+	errHandler "sfr-backend/error"
+	"sfr-backend/rbac"
+	"sfr-backend/requestbody"
+	"sfr-backend/response"
+	"sfr-backend/user"
+
+	"github.com/gorilla/mux"
+)
+
+// KeyResponse - service account with its key, the key is returned only by create and rotate
+type KeyResponse struct {
+	Account ServiceAccount `json:"account"`
+	Key     string         `json:"key"`
+}
+
+// GetServiceAccountsHandler - returns all service accounts without their keys
+func GetServiceAccountsHandler(w http.ResponseWriter, r *http.Request) {
+	if store == nil {
+		response.WriteResponse(w, []ServiceAccount{})
+		return
+	}
+	accounts, err := store.List(r.Context())
+	if err != nil {
+		errHandler.HandleError(w, err)
+		return
+	}
+	response.WriteResponse(w, accounts)
+}
+
+// ServiceAccountBody - JSON body of POST /service-accounts
+type ServiceAccountBody struct {
+	Name        string       `json:"name"`
+	Description string       `json:"description,omitempty"`
+	Scopes      []string     `json:"scopes"`
+	Grants      []rbac.Grant `json:"grants"`
+}
+
+// NewServiceAccountBody - returns empty JSON body of POST /service-accounts
+func NewServiceAccountBody() requestbody.Body {
+	return &ServiceAccountBody{}
+}
+
+// Form - returns form values of PostServiceAccountHandler, which validates them
+func (body *ServiceAccountBody) Form() (url.Values, error) {
+	grants, err := json.Marshal(body.Grants)
+	if err != nil {
+		return nil, err
+	}
+	return url.Values{
+		"name":        {body.Name},
+		"description": {body.Description},
+		"scopes":      {strings.Join(body.Scopes, ",")},
+		"grants":      {string(grants)},
+	}, nil
+}
+
+// PostServiceAccountHandler - creates service account from name, description, comma separated scopes
+// and JSON list of grants, responds with its key
+func PostServiceAccountHandler(w http.ResponseWriter, r *http.Request) {
+	if store == nil {
+		errHandler.HandleError(w, errHandler.New(http.StatusServiceUnavailable, errHandler.CodeNotConfigured, "service account store is not configured"))
+		return
+	}
+	account := ServiceAccount{
+		Name:        r.FormValue("name"),
+		Description: r.FormValue("description"),
+		Scopes:      splitScopes(r.FormValue("scopes")),
+		CreatedBy:   user.UsernameFromContext(r.Context()),
+		CreatedAt:   now().UTC(),
+	}
+	if !namePattern.MatchString(account.Name) {
+		http.Error(w, "Name has to be lowercase letters, digits and dashes", http.StatusBadRequest)
+		return
+	}
+	if !validScopes(account.Scopes) {
+		http.Error(w, "Scopes have to be comma separated list of read, execute and batch", http.StatusBadRequest)
+		return
+	}
+	err := json.Unmarshal([]byte(r.FormValue("grants")), &account.Grants)
+	if err != nil || !validGrants(account.Grants) {
+		http.Error(w, "Grants have to be JSON list with at least one grant of known role", http.StatusBadRequest)
+		return
+	}
+	key := newKey(account.Name)
+	account.setKey(key, 0)
+
+	err = store.Create(r.Context(), account)
+	audit.Record(r, audit.Event{Action: audit.ActionCreateServiceAccount, Target: account.Principal(), Outcome: audit.Outcome(err)})
+	if err == ErrExists {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		errHandler.HandleError(w, err)
+		return
+	}
+	response.WriteResponseWithStatus(w, http.StatusCreated, KeyResponse{Account: account, Key: key})
+}
+
+// PostRotateKeyHandler - replaces key of service account, previous key works until API_KEY_ROTATION_GRACE passes
+func PostRotateKeyHandler(w http.ResponseWriter, r *http.Request) {
+	account, ok := loadActiveAccount(w, r)
+	if !ok {
+		return
+	}
+	key := newKey(account.Name)
+	rotated := now().UTC()
+	account.setKey(key, rotationGrace())
+	account.RotatedAt = &rotated
+
+	err := store.Update(r.Context(), *account)
+	audit.Record(r, audit.Event{Action: audit.ActionRotateAPIKey, Target: account.Principal(), Outcome: audit.Outcome(err)})
+	if !handleUpdateError(w, err) {
+		return
+	}
+	response.WriteResponse(w, KeyResponse{Account: *account, Key: key})
+}
+
+// PostRevokeHandler - revokes service account, its current and previous keys stop working immediately
+func PostRevokeHandler(w http.ResponseWriter, r *http.Request) {
+	account, ok := loadActiveAccount(w, r)
+	if !ok {
+		return
+	}
+	revoked := now().UTC()
+	account.RevokedBy = user.UsernameFromContext(r.Context())
+	account.RevokedAt = &revoked
+	account.KeyHash = ""
+	account.PreviousKeyHash = ""
+	account.PreviousKeyExpiresAt = nil
+
+	err := store.Update(r.Context(), *account)
+	audit.Record(r, audit.Event{Action: audit.ActionRevokeAPIKey, Target: account.Principal(), Outcome: audit.Outcome(err)})
+	if !handleUpdateError(w, err) {
+		return
+	}
+	response.WriteResponse(w, account)
+}
+
+// loadActiveAccount - reads service account from name path variable, responds with 404 when it doesn't exist
+// and with 409 when it was revoked
+func loadActiveAccount(w http.ResponseWriter, r *http.Request) (*ServiceAccount, bool) {
+	if store == nil {
+		errHandler.HandleError(w, errHandler.New(http.StatusServiceUnavailable, errHandler.CodeNotConfigured, "service account store is not configured"))
+		return nil, false
+	}
+	account, err := store.Get(r.Context(), mux.Vars(r)["name"])
+	if err != nil {
+		errHandler.HandleError(w, err)
+		return nil, false
+	}
+	if account == nil {
+		http.Error(w, "Service account not found", http.StatusNotFound)
+		return nil, false
+	}
+	if account.Revoked() {
+		http.Error(w, ErrRevoked.Error(), http.StatusConflict)
+		return nil, false
+	}
+	return account, true
+}
+
+func handleUpdateError(w http.ResponseWriter, err error) bool {
+	if err == ErrRevoked {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return false
+	}
+	if err != nil {
+		errHandler.HandleError(w, err)
+		return false
+	}
+	return true
+}
+
+func splitScopes(value string) []string {
+	accountScopes := []string{}
+	for _, scope := range strings.Split(value, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			accountScopes = append(accountScopes, scope)
+		}
+	}
+	return accountScopes
+}
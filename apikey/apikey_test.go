@@ -0,0 +1,155 @@
+package apikey_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"sfr-backend/apikey"
+	"sfr-backend/rbac"
+	"sfr-backend/user"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+type memoryStore struct {
+	accounts map[string]apikey.ServiceAccount
+}
+
+func (store *memoryStore) Get(ctx context.Context, name string) (*apikey.ServiceAccount, error) {
+	account, ok := store.accounts[name]
+	if !ok {
+		return nil, nil
+	}
+	return &account, nil
+}
+
+func (store *memoryStore) List(ctx context.Context) ([]apikey.ServiceAccount, error) {
+	accounts := []apikey.ServiceAccount{}
+	for _, account := range store.accounts {
+		accounts = append(accounts, account)
+	}
+	return accounts, nil
+}
+
+func (store *memoryStore) Create(ctx context.Context, account apikey.ServiceAccount) error {
+	if _, ok := store.accounts[account.Name]; ok {
+		return apikey.ErrExists
+	}
+	store.accounts[account.Name] = account
+	return nil
+}
+
+func (store *memoryStore) Update(ctx context.Context, account apikey.ServiceAccount) error {
+	if store.accounts[account.Name].Revoked() {
+		return apikey.ErrRevoked
+	}
+	store.accounts[account.Name] = account
+	return nil
+}
+
+func adminRequest(method string, path string, vars map[string]string, form url.Values) *http.Request {
+	req, _ := http.NewRequest(method, path, strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req = req.WithContext(user.WithUsername(req.Context(), "admin"))
+	return mux.SetURLVars(req, vars)
+}
+
+func createAccount(form url.Values) (*httptest.ResponseRecorder, apikey.KeyResponse) {
+	rr := httptest.NewRecorder()
+	apikey.PostServiceAccountHandler(rr, adminRequest("POST", "/service-accounts", nil, form))
+	var created apikey.KeyResponse
+	json.Unmarshal(rr.Body.Bytes(), &created)
+	return rr, created
+}
+
+func TestCreateServiceAccountValidation(t *testing.T) {
+	apikey.SetStore(&memoryStore{accounts: map[string]apikey.ServiceAccount{}})
+	defer apikey.SetStore(nil)
+	grants := `[{"role": "operator", "machine": "arn:aws:states:*:*:stateMachine:deploy-*"}]`
+	testTable := []struct {
+		form           url.Values
+		expectedStatus int
+	}{
+		{url.Values{"name": {"CI pipeline"}, "scopes": {"read"}, "grants": {grants}}, http.StatusBadRequest},
+		{url.Values{"name": {"ci"}, "scopes": {"read,admin"}, "grants": {grants}}, http.StatusBadRequest},
+		{url.Values{"name": {"ci"}, "scopes": {""}, "grants": {grants}}, http.StatusBadRequest},
+		{url.Values{"name": {"ci"}, "scopes": {"read"}, "grants": {"[]"}}, http.StatusBadRequest},
+		{url.Values{"name": {"ci"}, "scopes": {"read"}, "grants": {`[{"role": "owner"}]`}}, http.StatusBadRequest},
+		{url.Values{"name": {"ci"}, "scopes": {"read, execute"}, "grants": {grants}}, http.StatusCreated},
+		{url.Values{"name": {"ci"}, "scopes": {"read"}, "grants": {grants}}, http.StatusConflict},
+	}
+
+	for _, testCase := range testTable {
+		rr, _ := createAccount(testCase.form)
+
+		assert.Equal(t, testCase.expectedStatus, rr.Code, testCase.form.Encode())
+	}
+}
+
+func TestServiceAccountKeyLifecycle(t *testing.T) {
+	store := &memoryStore{accounts: map[string]apikey.ServiceAccount{}}
+	apikey.SetStore(store)
+	defer apikey.SetStore(nil)
+	vars := map[string]string{"name": "ci"}
+
+	rr, created := createAccount(url.Values{"name": {"ci"}, "scopes": {"execute"}, "grants": {`[{"role": "operator"}]`}})
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.True(t, strings.HasPrefix(created.Key, "sfr.ci."))
+	assert.NotContains(t, rr.Body.String(), store.accounts["ci"].KeyHash)
+	assert.Equal(t, "admin", created.Account.CreatedBy)
+
+	account, err := apikey.Authenticate(context.Background(), created.Key)
+	assert.Nil(t, err)
+	assert.Equal(t, "service:ci", account.Principal())
+	assert.True(t, account.HasScope(apikey.ScopeExecute))
+	assert.False(t, account.HasScope(apikey.ScopeBatch))
+	assert.Equal(t, []rbac.Grant{{Role: rbac.RoleOperator}}, account.Grants)
+	_, err = apikey.Authenticate(context.Background(), created.Key+"0")
+	assert.Equal(t, apikey.ErrInvalidKey, err)
+	_, err = apikey.Authenticate(context.Background(), "sfr.other."+strings.TrimPrefix(created.Key, "sfr.ci."))
+	assert.Equal(t, apikey.ErrInvalidKey, err)
+	assert.True(t, apikey.Authenticated(created.Key))
+	assert.False(t, apikey.Authenticated(created.Key+"0"))
+
+	// previous key keeps working during grace period
+	rr = httptest.NewRecorder()
+	apikey.PostRotateKeyHandler(rr, adminRequest("POST", "/service-accounts/ci/rotate", vars, nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var rotated apikey.KeyResponse
+	json.Unmarshal(rr.Body.Bytes(), &rotated)
+	assert.NotEqual(t, created.Key, rotated.Key)
+	_, err = apikey.Authenticate(context.Background(), rotated.Key)
+	assert.Nil(t, err)
+	_, err = apikey.Authenticate(context.Background(), created.Key)
+	assert.Nil(t, err)
+
+	// without grace period only the newest key works
+	os.Setenv("API_KEY_ROTATION_GRACE", "0s")
+	defer os.Unsetenv("API_KEY_ROTATION_GRACE")
+	rr = httptest.NewRecorder()
+	apikey.PostRotateKeyHandler(rr, adminRequest("POST", "/service-accounts/ci/rotate", vars, nil))
+	var rotatedAgain apikey.KeyResponse
+	json.Unmarshal(rr.Body.Bytes(), &rotatedAgain)
+	_, err = apikey.Authenticate(context.Background(), rotated.Key)
+	assert.Equal(t, apikey.ErrInvalidKey, err)
+
+	rr = httptest.NewRecorder()
+	apikey.PostRevokeHandler(rr, adminRequest("POST", "/service-accounts/ci/revoke", vars, nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	_, err = apikey.Authenticate(context.Background(), rotatedAgain.Key)
+	assert.Equal(t, apikey.ErrInvalidKey, err)
+
+	rr = httptest.NewRecorder()
+	apikey.PostRotateKeyHandler(rr, adminRequest("POST", "/service-accounts/ci/rotate", vars, nil))
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	rr = httptest.NewRecorder()
+	apikey.PostRevokeHandler(rr, adminRequest("POST", "/service-accounts/missing/revoke", map[string]string{"name": "missing"}, nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
@@ -0,0 +1,149 @@
+package approval
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"sfr-backend/execution"
+	"sfr-backend/rbac"
+)
+
+// change request statuses
+const (
+	StatusPending  = "pending"
+	StatusApproved = "approved"
+	StatusExecuted = "executed"
+	StatusFailed   = "failed"
+	StatusRejected = "rejected"
+)
+
+// defaultApprovalTTL - how long change request waits for approval when APPROVAL_TTL_HOURS is not set
+const defaultApprovalTTL = 72 * time.Hour
+
+// ErrNotPending - returned by store when change request was already decided
+var ErrNotPending = errors.New("change request is not pending")
+
+// ChangeRequest - start of protected machine waiting for approval of second user
+type ChangeRequest struct {
+	ID          string                 `json:"id" dynamodbav:"id"`
+	Status      string                 `json:"status" dynamodbav:"status"`
+	Request     execution.StartRequest `json:"request" dynamodbav:"request"`
+	RequestedBy string                 `json:"requestedBy" dynamodbav:"requestedBy"`
+	CreatedAt   time.Time              `json:"createdAt" dynamodbav:"createdAt"`
+	ExpiresAt   time.Time              `json:"expiresAt" dynamodbav:"expiresAt"`
+	DecidedBy   string                 `json:"decidedBy,omitempty" dynamodbav:"decidedBy,omitempty"`
+	DecidedAt   *time.Time             `json:"decidedAt,omitempty" dynamodbav:"decidedAt,omitempty"`
+	Reason      string                 `json:"reason,omitempty" dynamodbav:"reason,omitempty"`
+	Executions  []string               `json:"executions,omitempty" dynamodbav:"executions,omitempty"`
+	Errors      []string               `json:"errors,omitempty" dynamodbav:"errors,omitempty"`
+}
+
+// ProtectedMachine - machine which executions need approval
+type ProtectedMachine struct {
+	Machine     string    `json:"machine" dynamodbav:"machine"`
+	ProtectedBy string    `json:"protectedBy" dynamodbav:"protectedBy"`
+	ProtectedAt time.Time `json:"protectedAt" dynamodbav:"protectedAt"`
+}
+
+// Store - storage of protected machines and change requests
+type Store interface {
+	IsProtected(ctx context.Context, machine string) (bool, error)
+	ProtectedMachines(ctx context.Context) ([]ProtectedMachine, error)
+	Protect(ctx context.Context, machine ProtectedMachine) error
+	Unprotect(ctx context.Context, machine string) error
+	Create(ctx context.Context, changeRequest ChangeRequest) error
+	// Get - returns nil when change request doesn't exist
+	Get(ctx context.Context, id string) (*ChangeRequest, error)
+	List(ctx context.Context, status string) ([]ChangeRequest, error)
+	// Decide - moves pending change request to status, returns ErrNotPending when it was decided already
+	Decide(ctx context.Context, id string, status string, decidedBy string, decidedAt time.Time, reason string) error
+	Complete(ctx context.Context, changeRequest ChangeRequest) error
+}
+
+var store Store
+var now = time.Now
+
+// SetStore - sets storage of protected machines and change requests
+func SetStore(approvalStore Store) {
+	store = approvalStore
+}
+
+// isProtected - machines are never protected without configured store
+func isProtected(ctx context.Context, machine string) (bool, error) {
+	if store == nil {
+		return false, nil
+	}
+	return store.IsProtected(ctx, machine)
+}
+
+// approvalTTL - reads APPROVAL_TTL_HOURS
+func approvalTTL() time.Duration {
+	hours, err := strconv.Atoi(os.Getenv("APPROVAL_TTL_HOURS"))
+	if err != nil || hours <= 0 {
+		return defaultApprovalTTL
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// canExecute - checks grants allow starting machine of request and reading its source executions,
+// missing grants mean permissions are not checked
+func canExecute(grants []rbac.Grant, checked bool, request execution.StartRequest) bool {
+	if !checked {
+		return true
+	}
+	if !rbac.Allowed(grants, rbac.PermissionExecute, request.Machine, arnRegion(request.Machine, request.Region)) {
+		return false
+	}
+	for _, item := range request.Items {
+		if item.Execution == "" {
+			continue
+		}
+		machine := rbac.MachineOfExecution(item.Execution)
+		if !rbac.Allowed(grants, rbac.PermissionRead, machine, arnRegion(machine, request.Region)) {
+			return false
+		}
+	}
+	return true
+}
+
+// canRead - checks grants allow reading machine of request and its source executions, whose inputs the request
+// contains, missing grants mean permissions are not checked
+func canRead(grants []rbac.Grant, checked bool, request execution.StartRequest) bool {
+	if !checked {
+		return true
+	}
+	if !rbac.Allowed(grants, rbac.PermissionRead, request.Machine, arnRegion(request.Machine, request.Region)) {
+		return false
+	}
+	for _, item := range request.Items {
+		if item.Execution == "" {
+			continue
+		}
+		machine := rbac.MachineOfExecution(item.Execution)
+		if !rbac.Allowed(grants, rbac.PermissionRead, machine, arnRegion(machine, request.Region)) {
+			return false
+		}
+	}
+	return true
+}
+
+// arnRegion - returns region of ARN or fallback when value is not an ARN
+func arnRegion(arn string, fallback string) string {
+	parts := strings.Split(arn, ":")
+	if len(parts) > 3 && parts[0] == "arn" {
+		return parts[3]
+	}
+	return fallback
+}
+
+func newID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
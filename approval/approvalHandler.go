@@ -0,0 +1,298 @@
+package approval
+
+import (
+	"net/http"
+	"net/url"
+
+	"sfr-backend/audit"
+	awsprovider "sfr-backend/awsProvider"
+	"sfr-backend/awssession"
+	errHandler "sfr-backend/error"
+	"sfr-backend/execution"
+	"sfr-backend/rbac"
+	"sfr-backend/requestbody"
+	"sfr-backend/response"
+	"sfr-backend/user"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/gorilla/mux"
+)
+
+// DecisionBody - JSON body of approve and reject requests
+type DecisionBody struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// NewDecisionBody - returns empty JSON body of approve and reject requests
+func NewDecisionBody() requestbody.Body {
+	return &DecisionBody{}
+}
+
+// Form - returns form values of approve and reject handlers
+func (body *DecisionBody) Form() (url.Values, error) {
+	return url.Values{"reason": {body.Reason}}, nil
+}
+
+// Guard - creates change request instead of calling handler when machine in form is protected
+func Guard(action string, providerInterface awsprovider.AwsStepFunctionsProvider,
+	handler func(http.ResponseWriter, *http.Request, awsprovider.AwsStepFunctionsProvider)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// qualified ARNs run the same machine, so version or alias must not bypass protection
+		protected, err := isProtected(r.Context(), rbac.BaseMachine(r.FormValue("machine")))
+		if err != nil {
+			errHandler.HandleError(w, err)
+			return
+		}
+		if !protected {
+			handler(w, r, providerInterface)
+			return
+		}
+		createChangeRequest(w, r, providerInterface, action)
+	}
+}
+
+// createChangeRequest - stores request with inputs of all executions, so approver sees exactly what will run
+func createChangeRequest(w http.ResponseWriter, r *http.Request, providerInterface awsprovider.AwsStepFunctionsProvider, action string) {
+	sfv, err := awssession.CreateStepFunctionSession(w, r, providerInterface)
+	if err != nil {
+		errHandler.HandleError(w, err)
+		return
+	}
+	request, err := execution.ParseStartRequest(r, action)
+	if err != nil {
+		errHandler.HandleError(w, err)
+		return
+	}
+	err = execution.ResolveInputs(sfv, &request)
+	if err != nil {
+		errHandler.HandleError(w, err)
+		return
+	}
+	created := now().UTC()
+	changeRequest := ChangeRequest{
+		ID:          newID(),
+		Status:      StatusPending,
+		Request:     request,
+		RequestedBy: user.UsernameFromContext(r.Context()),
+		CreatedAt:   created,
+		ExpiresAt:   created.Add(approvalTTL()),
+	}
+	err = store.Create(r.Context(), changeRequest)
+	audit.Record(r, audit.Event{
+		Action:   audit.ActionRequestApproval,
+		Target:   request.Machine,
+		Approval: changeRequest.ID,
+		Outcome:  audit.Outcome(err),
+	})
+	if err != nil {
+		errHandler.HandleError(w, err)
+		return
+	}
+	response.WriteResponseWithStatus(w, http.StatusAccepted, changeRequest)
+}
+
+// GetApprovalsHandler - returns change requests with status, pending by default, only of machines caller can read
+func GetApprovalsHandler(w http.ResponseWriter, r *http.Request) {
+	if store == nil {
+		errHandler.HandleError(w, errHandler.New(http.StatusServiceUnavailable, errHandler.CodeNotConfigured, "approval store is not configured"))
+		return
+	}
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = StatusPending
+	}
+	changeRequests, err := store.List(r.Context(), status)
+	if err != nil {
+		errHandler.HandleError(w, err)
+		return
+	}
+	grants, checked := rbac.GrantsFromContext(r.Context())
+	visible := []ChangeRequest{}
+	for _, changeRequest := range changeRequests {
+		if canRead(grants, checked, changeRequest.Request) {
+			visible = append(visible, changeRequest)
+		}
+	}
+	response.WriteResponse(w, visible)
+}
+
+// GetApprovalHandler - returns single change request, requests caller can't read are not found
+func GetApprovalHandler(w http.ResponseWriter, r *http.Request) {
+	changeRequest, ok := loadChangeRequest(w, r)
+	if !ok {
+		return
+	}
+	response.WriteResponse(w, changeRequest)
+}
+
+// PostApproveHandler - approves pending change request of another user and starts its executions
+func PostApproveHandler(w http.ResponseWriter, r *http.Request, providerInterface awsprovider.AwsStepFunctionsProvider) {
+	changeRequest, ok := loadChangeRequest(w, r)
+	if !ok {
+		return
+	}
+	approver := user.UsernameFromContext(r.Context())
+	if approver == "" || approver == changeRequest.RequestedBy {
+		http.Error(w, "Change request has to be approved by another authenticated user", http.StatusForbidden)
+		return
+	}
+	if !checkDecision(w, r, changeRequest) {
+		return
+	}
+	sfv, err := awssession.CreateStepFunctionSessionForRegion(changeRequest.Request.Region, providerInterface)
+	if err != nil {
+		errHandler.HandleError(w, err)
+		return
+	}
+	decided := now().UTC()
+	err = store.Decide(r.Context(), changeRequest.ID, StatusApproved, approver, decided, r.FormValue("reason"))
+	audit.Record(r, audit.Event{Action: audit.ActionApprove, Target: changeRequest.Request.Machine, Approval: changeRequest.ID, Outcome: audit.Outcome(err)})
+	if err != nil {
+		handleDecisionError(w, err)
+		return
+	}
+
+	changeRequest.Request.ApprovalID = changeRequest.ID
+	results := execution.ExecuteStartRequest(r, sfv, changeRequest.Request)
+	changeRequest.Status = StatusExecuted
+	changeRequest.DecidedBy = approver
+	changeRequest.DecidedAt = &decided
+	changeRequest.Reason = r.FormValue("reason")
+	for _, result := range results {
+		switch {
+		case result.Existing != nil:
+			changeRequest.Executions = append(changeRequest.Executions, aws.StringValue(result.Existing.ExecutionArn))
+		case result.Err != nil:
+			changeRequest.Status = StatusFailed
+			changeRequest.Errors = append(changeRequest.Errors, result.Err.Error())
+		default:
+			changeRequest.Executions = append(changeRequest.Executions, aws.StringValue(result.Output.ExecutionArn))
+		}
+	}
+	err = store.Complete(r.Context(), *changeRequest)
+	if err != nil {
+		errHandler.HandleError(w, err)
+		return
+	}
+	response.WriteResponse(w, changeRequest)
+}
+
+// PostRejectHandler - rejects pending change request, requester can reject own request to cancel it
+func PostRejectHandler(w http.ResponseWriter, r *http.Request) {
+	changeRequest, ok := loadChangeRequest(w, r)
+	if !ok {
+		return
+	}
+	if !checkDecision(w, r, changeRequest) {
+		return
+	}
+	decided := now().UTC()
+	rejecter := user.UsernameFromContext(r.Context())
+	err := store.Decide(r.Context(), changeRequest.ID, StatusRejected, rejecter, decided, r.FormValue("reason"))
+	audit.Record(r, audit.Event{Action: audit.ActionReject, Target: changeRequest.Request.Machine, Approval: changeRequest.ID, Outcome: audit.Outcome(err)})
+	if err != nil {
+		handleDecisionError(w, err)
+		return
+	}
+	changeRequest.Status = StatusRejected
+	changeRequest.DecidedBy = rejecter
+	changeRequest.DecidedAt = &decided
+	changeRequest.Reason = r.FormValue("reason")
+	response.WriteResponse(w, changeRequest)
+}
+
+// checkDecision - checks change request can still be decided and user can execute it
+func checkDecision(w http.ResponseWriter, r *http.Request, changeRequest *ChangeRequest) bool {
+	if changeRequest.Status != StatusPending {
+		http.Error(w, ErrNotPending.Error(), http.StatusConflict)
+		return false
+	}
+	if now().After(changeRequest.ExpiresAt) {
+		http.Error(w, "Change request expired", http.StatusConflict)
+		return false
+	}
+	grants, checked := rbac.GrantsFromContext(r.Context())
+	if !canExecute(grants, checked, changeRequest.Request) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+func handleDecisionError(w http.ResponseWriter, err error) {
+	if err == ErrNotPending {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	errHandler.HandleError(w, err)
+}
+
+// loadChangeRequest - reads change request from id path variable, responds with 404 when it doesn't exist
+// or grants of caller don't allow reading it, so its existence isn't revealed
+func loadChangeRequest(w http.ResponseWriter, r *http.Request) (*ChangeRequest, bool) {
+	if store == nil {
+		errHandler.HandleError(w, errHandler.New(http.StatusServiceUnavailable, errHandler.CodeNotConfigured, "approval store is not configured"))
+		return nil, false
+	}
+	changeRequest, err := store.Get(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		errHandler.HandleError(w, err)
+		return nil, false
+	}
+	grants, checked := rbac.GrantsFromContext(r.Context())
+	if changeRequest == nil || !canRead(grants, checked, changeRequest.Request) {
+		http.Error(w, "Change request not found", http.StatusNotFound)
+		return nil, false
+	}
+	return changeRequest, true
+}
+
+// GetProtectedMachinesHandler - returns machines which executions need approval
+func GetProtectedMachinesHandler(w http.ResponseWriter, r *http.Request) {
+	if store == nil {
+		response.WriteResponse(w, []ProtectedMachine{})
+		return
+	}
+	machines, err := store.ProtectedMachines(r.Context())
+	if err != nil {
+		errHandler.HandleError(w, err)
+		return
+	}
+	response.WriteResponse(w, machines)
+}
+
+// PutProtectedMachineHandler - marks machine in path as protected
+func PutProtectedMachineHandler(w http.ResponseWriter, r *http.Request) {
+	if store == nil {
+		errHandler.HandleError(w, errHandler.New(http.StatusServiceUnavailable, errHandler.CodeNotConfigured, "approval store is not configured"))
+		return
+	}
+	machine := ProtectedMachine{
+		Machine:     rbac.BaseMachine(mux.Vars(r)["machine"]),
+		ProtectedBy: user.UsernameFromContext(r.Context()),
+		ProtectedAt: now().UTC(),
+	}
+	err := store.Protect(r.Context(), machine)
+	audit.Record(r, audit.Event{Action: audit.ActionProtectMachine, Target: machine.Machine, Outcome: audit.Outcome(err)})
+	if err != nil {
+		errHandler.HandleError(w, err)
+		return
+	}
+	response.WriteResponse(w, machine)
+}
+
+// DeleteProtectedMachineHandler - removes protection of machine in path
+func DeleteProtectedMachineHandler(w http.ResponseWriter, r *http.Request) {
+	if store == nil {
+		errHandler.HandleError(w, errHandler.New(http.StatusServiceUnavailable, errHandler.CodeNotConfigured, "approval store is not configured"))
+		return
+	}
+	machine := rbac.BaseMachine(mux.Vars(r)["machine"])
+	err := store.Unprotect(r.Context(), machine)
+	audit.Record(r, audit.Event{Action: audit.ActionUnprotectMachine, Target: machine, Outcome: audit.Outcome(err)})
+	if err != nil {
+		errHandler.HandleError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
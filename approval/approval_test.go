@@ -0,0 +1,270 @@
+package approval_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"sfr-backend/approval"
+	"sfr-backend/audit"
+	awsprovider "sfr-backend/awsProvider"
+	"sfr-backend/execution"
+	"sfr-backend/mocks"
+	"sfr-backend/rbac"
+	"sfr-backend/user"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sfn"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+const machineArn = "arn:aws:states:us-east-1:123456789012:stateMachine:repair"
+const sourceArn = "arn:aws:states:us-east-1:123456789012:execution:repair:previous"
+
+type memoryStore struct {
+	protected      map[string]approval.ProtectedMachine
+	changeRequests map[string]approval.ChangeRequest
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{protected: map[string]approval.ProtectedMachine{}, changeRequests: map[string]approval.ChangeRequest{}}
+}
+
+func (store *memoryStore) IsProtected(ctx context.Context, machine string) (bool, error) {
+	_, ok := store.protected[machine]
+	return ok, nil
+}
+
+func (store *memoryStore) ProtectedMachines(ctx context.Context) ([]approval.ProtectedMachine, error) {
+	machines := []approval.ProtectedMachine{}
+	for _, machine := range store.protected {
+		machines = append(machines, machine)
+	}
+	return machines, nil
+}
+
+func (store *memoryStore) Protect(ctx context.Context, machine approval.ProtectedMachine) error {
+	store.protected[machine.Machine] = machine
+	return nil
+}
+
+func (store *memoryStore) Unprotect(ctx context.Context, machine string) error {
+	delete(store.protected, machine)
+	return nil
+}
+
+func (store *memoryStore) Create(ctx context.Context, changeRequest approval.ChangeRequest) error {
+	store.changeRequests[changeRequest.ID] = changeRequest
+	return nil
+}
+
+func (store *memoryStore) Get(ctx context.Context, id string) (*approval.ChangeRequest, error) {
+	changeRequest, ok := store.changeRequests[id]
+	if !ok {
+		return nil, nil
+	}
+	return &changeRequest, nil
+}
+
+func (store *memoryStore) List(ctx context.Context, status string) ([]approval.ChangeRequest, error) {
+	changeRequests := []approval.ChangeRequest{}
+	for _, changeRequest := range store.changeRequests {
+		if changeRequest.Status == status {
+			changeRequests = append(changeRequests, changeRequest)
+		}
+	}
+	return changeRequests, nil
+}
+
+func (store *memoryStore) Decide(ctx context.Context, id string, status string, decidedBy string, decidedAt time.Time, reason string) error {
+	changeRequest := store.changeRequests[id]
+	if changeRequest.Status != approval.StatusPending {
+		return approval.ErrNotPending
+	}
+	changeRequest.Status = status
+	changeRequest.DecidedBy = decidedBy
+	store.changeRequests[id] = changeRequest
+	return nil
+}
+
+func (store *memoryStore) Complete(ctx context.Context, changeRequest approval.ChangeRequest) error {
+	store.changeRequests[changeRequest.ID] = changeRequest
+	return nil
+}
+
+func requestAs(username string, method string, path string, body string) *http.Request {
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	return req.WithContext(user.WithUsername(req.Context(), username))
+}
+
+func guardedRestart(provider awsprovider.AwsStepFunctionsProvider) http.HandlerFunc {
+	return approval.Guard(audit.ActionRestartExecution, provider, func(w http.ResponseWriter, r *http.Request, p awsprovider.AwsStepFunctionsProvider) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+}
+
+func TestGuardUnprotectedMachine(t *testing.T) {
+	approval.SetStore(newMemoryStore())
+	defer approval.SetStore(nil)
+	rr := httptest.NewRecorder()
+
+	guardedRestart(&mocks.AwsStepFunctionsProvider{})(rr, requestAs("requester", "POST", "/aws/execution/restart", "machine="+machineArn+"&execution="+sourceArn))
+
+	assert.Equal(t, http.StatusTeapot, rr.Code)
+}
+
+func TestGuardQualifiedMachine(t *testing.T) {
+	store := newMemoryStore()
+	store.Protect(context.Background(), approval.ProtectedMachine{Machine: machineArn})
+	approval.SetStore(store)
+	defer approval.SetStore(nil)
+	mockAwsProvider := &mocks.AwsStepFunctionsProvider{}
+	mockStepFunction := &mocks.AwsStepFunctionInterface{}
+	mockAwsProvider.On("New", mock.Anything).Return(mockStepFunction, nil)
+	guardedStart := approval.Guard(audit.ActionStartExecution, mockAwsProvider, func(w http.ResponseWriter, r *http.Request, p awsprovider.AwsStepFunctionsProvider) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	for _, qualified := range []string{machineArn + ":3", machineArn + ":prod"} {
+		rr := httptest.NewRecorder()
+		guardedStart(rr, requestAs("requester", "POST", "/aws/execution", "machine="+qualified+"&input={}"))
+		assert.Equal(t, http.StatusAccepted, rr.Code, qualified)
+		var created approval.ChangeRequest
+		json.Unmarshal(rr.Body.Bytes(), &created)
+		assert.Equal(t, machineArn, created.Request.Machine, qualified)
+	}
+	mockStepFunction.AssertNotCalled(t, "StartExecution", mock.Anything)
+}
+
+func TestApprovalFlow(t *testing.T) {
+	store := newMemoryStore()
+	store.Protect(context.Background(), approval.ProtectedMachine{Machine: machineArn})
+	approval.SetStore(store)
+	defer approval.SetStore(nil)
+	mockAwsProvider := &mocks.AwsStepFunctionsProvider{}
+	mockStepFunction := &mocks.AwsStepFunctionInterface{}
+	mockAwsProvider.On("New", mock.Anything).Return(mockStepFunction, nil)
+	mockStepFunction.On("DescribeExecution", mock.Anything).Return(&sfn.DescribeExecutionOutput{Input: aws.String(`{"fix": true}`)}, nil).Once()
+	startedArn := "arn:aws:states:us-east-1:123456789012:execution:repair:started"
+	mockStepFunction.On("StartExecution", mock.MatchedBy(func(input *sfn.StartExecutionInput) bool {
+		return *input.Input == `{"fix": true}` && *input.StateMachineArn == machineArn
+	})).Return(&sfn.StartExecutionOutput{ExecutionArn: &startedArn}, nil).Once()
+
+	// protected restart creates change request with resolved input instead of starting execution
+	rr := httptest.NewRecorder()
+	guardedRestart(mockAwsProvider)(rr, requestAs("requester", "POST", "/aws/execution/restart", "machine="+machineArn+"&execution="+sourceArn))
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+	var created approval.ChangeRequest
+	json.Unmarshal(rr.Body.Bytes(), &created)
+	assert.Equal(t, approval.StatusPending, created.Status)
+	assert.Equal(t, "requester", created.RequestedBy)
+	assert.Equal(t, `{"fix": true}`, created.Request.Items[0].Input)
+	mockStepFunction.AssertNotCalled(t, "StartExecution", mock.Anything)
+
+	approve := func(username string, grants []rbac.Grant) *httptest.ResponseRecorder {
+		req := requestAs(username, "POST", "/approvals/"+created.ID+"/approve", "")
+		if grants != nil {
+			req = req.WithContext(rbac.WithGrants(req.Context(), grants))
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": created.ID})
+		rr := httptest.NewRecorder()
+		approval.PostApproveHandler(rr, req, mockAwsProvider)
+		return rr
+	}
+
+	assert.Equal(t, http.StatusForbidden, approve("requester", nil).Code)
+	assert.Equal(t, http.StatusForbidden, approve("viewer", []rbac.Grant{{Role: rbac.RoleViewer}}).Code)
+
+	rr = approve("approver", []rbac.Grant{{Role: rbac.RoleOperator}})
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var approved approval.ChangeRequest
+	json.Unmarshal(rr.Body.Bytes(), &approved)
+	assert.Equal(t, approval.StatusExecuted, approved.Status)
+	assert.Equal(t, "approver", approved.DecidedBy)
+	assert.Equal(t, []string{startedArn}, approved.Executions)
+	assert.Equal(t, approval.StatusExecuted, store.changeRequests[created.ID].Status)
+
+	assert.Equal(t, http.StatusConflict, approve("other", nil).Code)
+	mockStepFunction.AssertNumberOfCalls(t, "StartExecution", 1)
+}
+
+func TestRejectExpired(t *testing.T) {
+	store := newMemoryStore()
+	store.Create(context.Background(), approval.ChangeRequest{ID: "expired", Status: approval.StatusPending, ExpiresAt: time.Now().Add(-time.Minute)})
+	store.Create(context.Background(), approval.ChangeRequest{ID: "pending", Status: approval.StatusPending, ExpiresAt: time.Now().Add(time.Hour)})
+	approval.SetStore(store)
+	defer approval.SetStore(nil)
+	testTable := []struct {
+		id             string
+		expectedStatus int
+	}{
+		{"expired", http.StatusConflict},
+		{"pending", http.StatusOK},
+		{"pending", http.StatusConflict},
+		{"missing", http.StatusNotFound},
+	}
+
+	for _, testCase := range testTable {
+		req := mux.SetURLVars(requestAs("requester", "POST", "/approvals/"+testCase.id+"/reject", "reason=typo"), map[string]string{"id": testCase.id})
+		rr := httptest.NewRecorder()
+
+		approval.PostRejectHandler(rr, req)
+
+		assert.Equal(t, testCase.expectedStatus, rr.Code, testCase.id)
+	}
+	assert.Equal(t, approval.StatusRejected, store.changeRequests["pending"].Status)
+}
+
+func TestApprovalsVisibleToReaders(t *testing.T) {
+	store := newMemoryStore()
+	billing := "arn:aws:states:us-east-1:123456789012:stateMachine:billing"
+	store.Create(context.Background(), approval.ChangeRequest{ID: "repair", Status: approval.StatusPending,
+		Request: execution.StartRequest{Machine: machineArn, Region: "us-east-1", Items: []execution.StartItem{{Execution: sourceArn, Input: `{"fix": true}`}}}})
+	store.Create(context.Background(), approval.ChangeRequest{ID: "billing", Status: approval.StatusPending,
+		Request: execution.StartRequest{Machine: billing, Region: "us-east-1"}})
+	approval.SetStore(store)
+	defer approval.SetStore(nil)
+	grants := []rbac.Grant{{Role: rbac.RoleViewer, Machine: "arn:aws:states:*:*:stateMachine:repair"}}
+	withGrants := func(req *http.Request) *http.Request {
+		return req.WithContext(rbac.WithGrants(req.Context(), grants))
+	}
+
+	rr := httptest.NewRecorder()
+	approval.GetApprovalsHandler(rr, withGrants(requestAs("viewer", "GET", "/approvals", "")))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var listed []approval.ChangeRequest
+	json.Unmarshal(rr.Body.Bytes(), &listed)
+	assert.Len(t, listed, 1)
+	assert.Equal(t, "repair", listed[0].ID)
+
+	// requests of machines caller can't read look like missing ones
+	for id, expectedStatus := range map[string]int{"repair": http.StatusOK, "billing": http.StatusNotFound} {
+		rr = httptest.NewRecorder()
+		approval.GetApprovalHandler(rr, mux.SetURLVars(withGrants(requestAs("viewer", "GET", "/approvals/"+id, "")), map[string]string{"id": id}))
+		assert.Equal(t, expectedStatus, rr.Code, id)
+	}
+}
+
+func TestProtectedMachines(t *testing.T) {
+	store := newMemoryStore()
+	approval.SetStore(store)
+	defer approval.SetStore(nil)
+	vars := map[string]string{"machine": machineArn}
+
+	rr := httptest.NewRecorder()
+	approval.PutProtectedMachineHandler(rr, mux.SetURLVars(requestAs("admin", "PUT", "/protected-machines/"+machineArn, ""), vars))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "admin", store.protected[machineArn].ProtectedBy)
+
+	rr = httptest.NewRecorder()
+	approval.DeleteProtectedMachineHandler(rr, mux.SetURLVars(requestAs("admin", "DELETE", "/protected-machines/"+machineArn, ""), vars))
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Empty(t, store.protected)
+}
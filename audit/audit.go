@@ -0,0 +1,162 @@
+package audit
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"time"
+
+	"sfr-backend/metrics"
+	"sfr-backend/tid"
+	"sfr-backend/user"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// audited actions
+const (
+	ActionLogin                = "login"
+	ActionLogout               = "logout"
+	ActionLockout              = "lockout"
+	ActionUnlock               = "unlock"
+	ActionRefreshTokenReuse    = "refresh_token_reuse"
+	ActionRevokeSession        = "revoke_session"
+	ActionRevokeSessions       = "revoke_sessions"
+	ActionCreateUser           = "create_user"
+	ActionUpdateUser           = "update_user"
+	ActionSetGrants            = "set_grants"
+	ActionDisableUser          = "disable_user"
+	ActionEnableUser           = "enable_user"
+	ActionDeleteUser           = "delete_user"
+	ActionLinkIdentity         = "link_identity"
+	ActionInviteUser           = "invite_user"
+	ActionRevokeInvite         = "revoke_invite"
+	ActionAcceptInvite         = "accept_invite"
+	ActionChangePassword       = "change_password"
+	ActionRequestPasswordReset = "request_password_reset"
+	ActionResetPassword        = "reset_password"
+	ActionEnrollMFA            = "enroll_mfa"
+	ActionEnableMFA            = "enable_mfa"
+	ActionDisableMFA           = "disable_mfa"
+	ActionResetMFA             = "reset_mfa"
+	ActionUseRecoveryCode      = "use_recovery_code"
+	ActionStartExecution       = "start_execution"
+	ActionRestartExecution     = "restart_execution"
+	ActionBatchRestart         = "batch_restart"
+	ActionStopExecution        = "stop_execution"
+	ActionRequestApproval      = "request_approval"
+	ActionApprove              = "approve"
+	ActionReject               = "reject"
+	ActionProtectMachine       = "protect_machine"
+	ActionUnprotectMachine     = "unprotect_machine"
+	ActionCreateServiceAccount = "create_service_account"
+	ActionRotateAPIKey         = "rotate_api_key"
+	ActionRevokeAPIKey         = "revoke_api_key"
+)
+
+// outcomes of audited actions
+const (
+	OutcomeSuccess  = "success"
+	OutcomeFailure  = "failure"
+	OutcomeConflict = "conflict"
+)
+
+// Event - single audited action, Day and ID form the key in audit table
+type Event struct {
+	Day           string `json:"-" dynamodbav:"day"`
+	ID            string `json:"id" dynamodbav:"id"`
+	Time          string `json:"time" dynamodbav:"time"`
+	User          string `json:"user" dynamodbav:"user"`
+	Action        string `json:"action" dynamodbav:"action"`
+	SourceIP      string `json:"sourceIp" dynamodbav:"sourceIp"`
+	ForwardedFor  string `json:"forwardedFor,omitempty" dynamodbav:"forwardedFor,omitempty"`
+	TransactionID string `json:"transactionId" dynamodbav:"transactionId"`
+	Target        string `json:"target,omitempty" dynamodbav:"target,omitempty"`
+	Execution     string `json:"execution,omitempty" dynamodbav:"execution,omitempty"`
+	InputHash     string `json:"inputHash,omitempty" dynamodbav:"inputHash,omitempty"`
+	Outcome       string `json:"outcome" dynamodbav:"outcome"`
+	Error         string `json:"error,omitempty" dynamodbav:"error,omitempty"`
+	Approval      string `json:"approval,omitempty" dynamodbav:"approval,omitempty"`
+}
+
+// Filter - audit events query, empty User and Action match everything
+type Filter struct {
+	User   string
+	Action string
+	From   time.Time
+	To     time.Time
+	Limit  int
+}
+
+// Store - append only storage of audit events
+type Store interface {
+	Append(ctx context.Context, event Event) error
+	Query(ctx context.Context, filter Filter) ([]Event, error)
+}
+
+// TimeLayout - fixed width UTC timestamp, so IDs starting with it sort chronologically
+const TimeLayout = "2006-01-02T15:04:05.000000000Z"
+
+var store Store
+var now = time.Now
+
+// SetStore - sets storage used by Record and audit endpoint
+func SetStore(auditStore Store) {
+	store = auditStore
+}
+
+// HashInput - returns sha256 of execution input, inputs themselves are not stored as they may contain sensitive data
+func HashInput(input string) string {
+	if input == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(input))
+	return hex.EncodeToString(sum[:])
+}
+
+// Outcome - returns outcome matching error of audited action
+func Outcome(err error) string {
+	if err != nil {
+		return OutcomeFailure
+	}
+	return OutcomeSuccess
+}
+
+// Record - completes event with request details and appends it to audit store,
+// failures are logged so audited action itself is never blocked by audit storage
+func Record(r *http.Request, event Event) {
+	recorded := now().UTC()
+	event.Day = recorded.Format("2006-01-02")
+	event.Time = recorded.Format(TimeLayout)
+	event.ID = event.Time + "#" + randomSuffix()
+	if event.User == "" {
+		event.User = user.UsernameFromContext(r.Context())
+	}
+	event.SourceIP = r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		event.SourceIP = host
+	}
+	event.ForwardedFor = r.Header.Get("X-Forwarded-For")
+	event.TransactionID = tid.GetTid(r)
+	if event.Action == ActionLogin {
+		metrics.RecordLogin(event.Outcome)
+	}
+
+	logger := log.WithFields(log.Fields{"transaction_id": event.TransactionID, "audit_action": event.Action, "audit_user": event.User})
+	if store == nil {
+		logger.Warn("Audit store is not configured, audit event is only logged")
+		return
+	}
+	if err := store.Append(r.Context(), event); err != nil {
+		logger.Error("Failed to store audit event: ", err)
+	}
+}
+
+func randomSuffix() string {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return hex.EncodeToString(suffix)
+}
@@ -0,0 +1,93 @@
+package audit
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	errHandler "sfr-backend/error"
+	"sfr-backend/response"
+)
+
+// defaultAuditWindow - time window used when from is not provided
+const defaultAuditWindow = 24 * time.Hour
+
+// maxAuditWindow - longest time window, as every day of window is a separate query
+const maxAuditWindow = 31 * 24 * time.Hour
+
+// defaultAuditLimit - max number of events returned by default
+const defaultAuditLimit = 100
+
+// maxAuditLimit - upper bound for limit param
+const maxAuditLimit = 1000
+
+// EventsResponse - response of audit endpoint, newest events first
+type EventsResponse struct {
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	Events []Event   `json:"events"`
+}
+
+// GetAuditHandler - returns audit events filtered by user, action and time window
+func GetAuditHandler(w http.ResponseWriter, r *http.Request) {
+	urlParams := r.URL.Query()
+
+	to, err := parseTimeParam(urlParams.Get("to"), now())
+	if err != nil {
+		errHandler.HandleError(w, err)
+		return
+	}
+	from, err := parseTimeParam(urlParams.Get("from"), to.Add(-defaultAuditWindow))
+	if err != nil {
+		errHandler.HandleError(w, err)
+		return
+	}
+	if from.After(to) {
+		errHandler.HandleError(w, fmt.Errorf("from %s is after to %s", from.Format(time.RFC3339), to.Format(time.RFC3339)))
+		return
+	}
+	if to.Sub(from) > maxAuditWindow {
+		errHandler.HandleError(w, fmt.Errorf("time window can't be longer than %d days", int(maxAuditWindow.Hours()/24)))
+		return
+	}
+	limit := defaultAuditLimit
+	if len(urlParams.Get("limit")) > 0 {
+		parsedLimit, err := strconv.Atoi(urlParams.Get("limit"))
+		if err == nil && parsedLimit > 0 {
+			limit = parsedLimit
+		}
+	}
+	if limit > maxAuditLimit {
+		limit = maxAuditLimit
+	}
+	if store == nil {
+		errHandler.HandleError(w, errHandler.New(http.StatusServiceUnavailable, errHandler.CodeNotConfigured, "audit store is not configured"))
+		return
+	}
+
+	events, err := store.Query(r.Context(), Filter{
+		User:   urlParams.Get("user"),
+		Action: urlParams.Get("action"),
+		From:   from,
+		To:     to,
+		Limit:  limit,
+	})
+	if err != nil {
+		errHandler.HandleError(w, err)
+		return
+	}
+	response.WriteResponse(w, EventsResponse{From: from, To: to, Events: events})
+}
+
+// parseTimeParam - parses RFC3339 query param, empty value returns fallback
+func parseTimeParam(value string, fallback time.Time) (time.Time, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, expected RFC3339 format", value)
+	}
+	return parsed, nil
+}
@@ -0,0 +1,111 @@
+package audit_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"sfr-backend/audit"
+	"sfr-backend/user"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeStore struct {
+	events  []audit.Event
+	filters []audit.Filter
+	err     error
+}
+
+func (store *fakeStore) Append(ctx context.Context, event audit.Event) error {
+	store.events = append(store.events, event)
+	return store.err
+}
+
+func (store *fakeStore) Query(ctx context.Context, filter audit.Filter) ([]audit.Event, error) {
+	store.filters = append(store.filters, filter)
+	return store.events, store.err
+}
+
+func TestRecord(t *testing.T) {
+	store := &fakeStore{}
+	audit.SetStore(store)
+	defer audit.SetStore(nil)
+
+	req, _ := http.NewRequest("POST", "/aws/execution", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Request-ID", "tid")
+	req.Header.Set("X-Forwarded-For", "192.168.1.1")
+	req = req.WithContext(user.WithUsername(req.Context(), "operator"))
+
+	audit.Record(req, audit.Event{Action: audit.ActionStartExecution, Target: "machine", InputHash: audit.HashInput("{}"), Outcome: audit.Outcome(nil)})
+
+	assert.Len(t, store.events, 1)
+	event := store.events[0]
+	assert.Equal(t, "operator", event.User)
+	assert.Equal(t, "10.0.0.1", event.SourceIP)
+	assert.Equal(t, "192.168.1.1", event.ForwardedFor)
+	assert.Equal(t, "tid", event.TransactionID)
+	assert.Equal(t, "machine", event.Target)
+	assert.Equal(t, audit.OutcomeSuccess, event.Outcome)
+	assert.Equal(t, "44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a", event.InputHash)
+	assert.Equal(t, event.Time[:10], event.Day)
+	assert.Contains(t, event.ID, event.Time+"#")
+}
+
+func TestRecordIgnoresStoreFailure(t *testing.T) {
+	store := &fakeStore{err: errors.New("unavailable")}
+	audit.SetStore(store)
+	defer audit.SetStore(nil)
+	req, _ := http.NewRequest("POST", "/login", nil)
+
+	audit.Record(req, audit.Event{Action: audit.ActionLogin, User: "user", Outcome: audit.Outcome(errors.New("invalid"))})
+
+	assert.Equal(t, audit.OutcomeFailure, store.events[0].Outcome)
+	assert.Equal(t, "user", store.events[0].User)
+}
+
+func TestGetAuditHandler(t *testing.T) {
+	store := &fakeStore{events: []audit.Event{{ID: "id", Action: audit.ActionLogin}}}
+	audit.SetStore(store)
+	defer audit.SetStore(nil)
+
+	testTable := []struct {
+		query          string
+		expectedStatus int
+		expectedFilter audit.Filter
+	}{
+		{"?user=admin&action=login&from=2021-01-01T00:00:00Z&to=2021-01-02T00:00:00Z&limit=5000", http.StatusOK, audit.Filter{
+			User:   "admin",
+			Action: audit.ActionLogin,
+			From:   time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+			To:     time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC),
+			Limit:  1000,
+		}},
+		{"?from=yesterday", http.StatusBadRequest, audit.Filter{}},
+		{"?from=2021-01-02T00:00:00Z&to=2021-01-01T00:00:00Z", http.StatusBadRequest, audit.Filter{}},
+		{"?from=2021-01-01T00:00:00Z&to=2021-03-01T00:00:00Z", http.StatusBadRequest, audit.Filter{}},
+	}
+
+	for _, testCase := range testTable {
+		store.filters = nil
+		req, _ := http.NewRequest("GET", "/audit"+testCase.query, nil)
+		rr := httptest.NewRecorder()
+
+		audit.GetAuditHandler(rr, req)
+
+		assert.Equal(t, testCase.expectedStatus, rr.Code, testCase.query)
+		if testCase.expectedStatus == http.StatusOK {
+			var result audit.EventsResponse
+			json.Unmarshal(rr.Body.Bytes(), &result)
+			assert.Equal(t, []audit.Filter{testCase.expectedFilter}, store.filters)
+			assert.Len(t, result.Events, 1)
+		} else {
+			assert.Empty(t, store.filters)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package authentication
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"os"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/mux"
+
+	"sfr-backend/audit"
+	"sfr-backend/invite"
+	"sfr-backend/logging"
+	"sfr-backend/mailer"
+	"sfr-backend/password"
+	"sfr-backend/rbac"
+	"sfr-backend/response"
+	"sfr-backend/revocation"
+	"sfr-backend/user"
+)
+
+// inviteTokenType - typ claim of signed invite links, they have no family so they are never accepted as access tokens
+const inviteTokenType = "invite"
+
+var errInvalidInvite = errors.New("invite is invalid, expired or was already accepted")
+
+// CreateInviteRequest - body of POST /invites
+type CreateInviteRequest struct {
+	Email string `json:"email"`
+	// Username - username of new account, email by default
+	Username string       `json:"username"`
+	Grants   []rbac.Grant `json:"grants"`
+	// ExpiresIn - duration like 72h, INVITE_TTL by default
+	ExpiresIn string `json:"expiresIn"`
+}
+
+// InviteResponse - created invite, id revokes it
+type InviteResponse struct {
+	ID        string    `json:"id"`
+	Username  string    `json:"username"`
+	Email     string    `json:"email"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// AcceptInviteRequest - body of POST /invites/{token}/accept
+type AcceptInviteRequest struct {
+	Password  string `json:"password"`
+	Firstname string `json:"firstname"`
+	Lastname  string `json:"lastname"`
+}
+
+// CreateInviteHandler - creates invite with grants of new user and emails signed link accepting it
+func CreateInviteHandler(w http.ResponseWriter, r *http.Request) {
+	if passwordLoginDisabled() {
+		http.Error(w, "Password login is disabled, users are provisioned by single sign-on", http.StatusForbidden)
+		return
+	}
+	var request CreateInviteRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if address, err := mail.ParseAddress(request.Email); err != nil || address.Address != request.Email {
+		http.Error(w, "Invalid email address", http.StatusBadRequest)
+		return
+	}
+	if request.Username == "" {
+		request.Username = request.Email
+	}
+	if err := validateGrants(request.Grants); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ttl := invite.DefaultTTL()
+	if request.ExpiresIn != "" {
+		parsed, err := time.ParseDuration(request.ExpiresIn)
+		if err != nil || parsed <= 0 || parsed > invite.MaxTTL {
+			http.Error(w, fmt.Sprintf("expiresIn has to be duration up to %s", invite.MaxTTL), http.StatusBadRequest)
+			return
+		}
+		ttl = parsed
+	}
+	if getUserDetailsFunction(r.Context(), request.Username).Username != "" {
+		http.Error(w, "User already exists", http.StatusConflict)
+		return
+	}
+
+	created, err := sendInvite(r.Context(), invite.Invite{
+		ID:        revocation.NewID(),
+		Username:  request.Username,
+		Email:     request.Email,
+		Grants:    request.Grants,
+		InvitedBy: user.UsernameFromContext(r.Context()),
+	}, ttl)
+	audit.Record(r, audit.Event{Action: audit.ActionInviteUser, Target: request.Username, Outcome: audit.Outcome(err)})
+	if err != nil {
+		logging.FromRequest(r).Error("Unable to send invite: ", err)
+		http.Error(w, "Unable to send invite", http.StatusInternalServerError)
+		return
+	}
+	response.WriteResponseWithStatus(w, http.StatusCreated, InviteResponse{
+		ID:        created.ID,
+		Username:  created.Username,
+		Email:     created.Email,
+		ExpiresAt: time.Unix(created.ExpiresAt, 0).UTC(),
+	})
+}
+
+// RevokeInviteHandler - deletes invite in path, its link stops working
+func RevokeInviteHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	revoked, err := invite.Consume(r.Context(), id)
+	if err == nil && revoked == nil {
+		err = errInvalidInvite
+	}
+	audit.Record(r, audit.Event{Action: audit.ActionRevokeInvite, Target: id, Outcome: audit.Outcome(err)})
+	if err == errInvalidInvite {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logging.FromRequest(r).Error("Unable to revoke invite: ", err)
+		http.Error(w, "Unable to revoke invite", http.StatusInternalServerError)
+		return
+	}
+	response.WriteResponse(w, "Invite of "+revoked.Username+" was revoked")
+}
+
+// AcceptInviteHandler - creates user from invite with password chosen by invitee, email is verified by the link
+func AcceptInviteHandler(w http.ResponseWriter, r *http.Request) {
+	if passwordLoginDisabled() {
+		http.Error(w, "Password login is disabled, users are provisioned by single sign-on", http.StatusForbidden)
+		return
+	}
+	claims, ok := parseInviteToken(mux.Vars(r)["token"])
+	if !ok {
+		audit.Record(r, audit.Event{Action: audit.ActionAcceptInvite, Outcome: audit.OutcomeFailure, Error: errInvalidInvite.Error()})
+		http.Error(w, errInvalidInvite.Error(), http.StatusBadRequest)
+		return
+	}
+	var request AcceptInviteRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	username := claims["user"].(string)
+	// everything is checked before invite is consumed, so rejected request doesn't spend it
+	if err := password.Validate(request.Password, username); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if getUserDetailsFunction(r.Context(), username).Username != "" {
+		http.Error(w, "User already exists", http.StatusConflict)
+		return
+	}
+	accepted, err := invite.Consume(r.Context(), claims["jti"].(string))
+	if err != nil {
+		logging.FromRequest(r).Error("Unable to consume invite: ", err)
+		http.Error(w, "Unable to accept invite", http.StatusInternalServerError)
+		return
+	}
+	if accepted == nil {
+		audit.Record(r, audit.Event{Action: audit.ActionAcceptInvite, User: username, Target: username, Outcome: audit.OutcomeFailure, Error: errInvalidInvite.Error()})
+		http.Error(w, errInvalidInvite.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userDetails := user.UserDetails{
+		Username:      accepted.Username,
+		Firstname:     request.Firstname,
+		Lastname:      request.Lastname,
+		Email:         accepted.Email,
+		Password:      hashAndSaltPassword(request.Password),
+		Grants:        accepted.Grants,
+		EmailVerified: true,
+	}
+	status := createUserFunction(r.Context(), userDetails)
+	if status == "exists" {
+		audit.Record(r, audit.Event{Action: audit.ActionAcceptInvite, User: username, Target: username, Outcome: audit.OutcomeFailure, Error: "user already exists"})
+		http.Error(w, "User already exists", http.StatusConflict)
+		return
+	}
+	if status == "error" || status == "" {
+		audit.Record(r, audit.Event{Action: audit.ActionAcceptInvite, User: username, Target: username, Outcome: audit.OutcomeFailure, Error: "Error creating user"})
+		http.Error(w, "Error creating user", http.StatusInternalServerError)
+		return
+	}
+	audit.Record(r, audit.Event{Action: audit.ActionAcceptInvite, User: username, Target: username, Outcome: audit.OutcomeSuccess})
+	response.WriteResponseWithStatus(w, http.StatusCreated, newUserResponse(userDetails))
+}
+
+// sendInvite - stores invite and mails link with token signed by current signing key
+func sendInvite(ctx context.Context, pending invite.Invite, ttl time.Duration) (invite.Invite, error) {
+	if accountMailer == nil {
+		return pending, errors.New("mailer is not configured")
+	}
+	created, err := invite.Create(ctx, pending, ttl)
+	if err != nil {
+		return created, err
+	}
+	token, err := keyManager.Sign(jwt.MapClaims{
+		"typ":  inviteTokenType,
+		"jti":  created.ID,
+		"user": created.Username,
+		"exp":  created.ExpiresAt,
+	})
+	if err != nil {
+		return created, err
+	}
+	return created, accountMailer.Send(mailer.Message{
+		To:      []string{created.Email},
+		Subject: "Invitation",
+		Body: fmt.Sprintf("%s invited you to create account %s.\n\nOpen the link below to choose your password, it works once until %s:\n\n%s\n",
+			created.InvitedBy, created.Username, time.Unix(created.ExpiresAt, 0).UTC().Format(time.RFC1123), inviteLink(token)),
+	})
+}
+
+// parseInviteToken - returns claims of invite token with valid signature which didn't expire
+func parseInviteToken(tokenString string) (jwt.MapClaims, bool) {
+	token, err := keyManager.Parse(tokenString)
+	if err != nil || !token.Valid {
+		return nil, false
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["typ"] != inviteTokenType {
+		return nil, false
+	}
+	username, _ := claims["user"].(string)
+	id, _ := claims["jti"].(string)
+	return claims, username != "" && id != ""
+}
+
+// inviteLink - frontend page from INVITE_URL, BASE_URL/accept-invite by default, with token in query
+func inviteLink(token string) string {
+	link := os.Getenv("INVITE_URL")
+	if link == "" {
+		link = os.Getenv("BASE_URL") + "/accept-invite"
+	}
+	return link + "?token=" + url.QueryEscape(token)
+}
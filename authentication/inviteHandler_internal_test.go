@@ -0,0 +1,122 @@
+package authentication
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"sfr-backend/invite"
+	"sfr-backend/lockout"
+	"sfr-backend/rbac"
+	"sfr-backend/user"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+var inviteTokenPattern = regexp.MustCompile(`token=(\S+)`)
+
+// acceptInvite - posts body to accept link with token
+func acceptInvite(token string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/invites/"+token+"/accept", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	AcceptInviteHandler(rr, mux.SetURLVars(req, map[string]string{"token": token}))
+	return rr
+}
+
+func TestCreateInviteHandler(t *testing.T) {
+	passwordUsers(user.UserDetails{Username: "jdoe", Password: hashed("password")})
+	invite.SetStore(invite.NewMemoryStore())
+	testTable := []struct {
+		body           string
+		expectedStatus int
+	}{
+		{`{"email": "new@example.com", "grants": [{"role": "operator"}], "expiresIn": "24h"}`, http.StatusCreated},
+		{`{"email": "John <new@example.com>"}`, http.StatusBadRequest},
+		{`{"email": "new@example.com", "grants": [{"role": "superuser"}]}`, http.StatusBadRequest},
+		{`{"email": "new@example.com", "expiresIn": "1000h"}`, http.StatusBadRequest},
+		{`{"email": "jdoe@example.com", "username": "jdoe"}`, http.StatusConflict},
+	}
+
+	recorder := &recordingMailer{}
+	SetMailer(recorder)
+	defer SetMailer(nil)
+	for _, testCase := range testTable {
+		rr := httptest.NewRecorder()
+		CreateInviteHandler(rr, asUser(httptest.NewRequest("POST", "/invites", strings.NewReader(testCase.body)), "admin"))
+		assert.Equal(t, testCase.expectedStatus, rr.Code, testCase.body)
+	}
+	assert.Len(t, recorder.messages, 1)
+	assert.Equal(t, []string{"new@example.com"}, recorder.messages[0].To)
+
+	// invite is not stored without mailer
+	SetMailer(nil)
+	rr := httptest.NewRecorder()
+	CreateInviteHandler(rr, asUser(httptest.NewRequest("POST", "/invites", strings.NewReader(`{"email": "other@example.com"}`)), "admin"))
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+}
+
+func TestAcceptInvite(t *testing.T) {
+	stored := passwordUsers()
+	invite.SetStore(invite.NewMemoryStore())
+	lockout.SetStore(lockout.NewMemoryStore())
+	defer lockout.SetStore(lockout.NewMemoryStore())
+	lockout.SetConfig(lockout.Config{})
+	defer lockout.SetConfig(lockout.DefaultConfig)
+	recorder := &recordingMailer{}
+	SetMailer(recorder)
+	defer SetMailer(nil)
+
+	rr := httptest.NewRecorder()
+	CreateInviteHandler(rr, asUser(httptest.NewRequest("POST", "/invites", strings.NewReader(`{"email": "new@example.com", "username": "new", "grants": [{"role": "operator", "region": "us-east-1"}]}`)), "admin"))
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var created InviteResponse
+	json.NewDecoder(rr.Body).Decode(&created)
+	assert.Equal(t, "new", created.Username)
+	token, _ := url.QueryUnescape(inviteTokenPattern.FindStringSubmatch(recorder.messages[0].Body)[1])
+
+	assert.Equal(t, http.StatusBadRequest, acceptInvite("invalid", `{"password": "new-password"}`).Code)
+	// rejected password doesn't spend the invite
+	assert.Equal(t, http.StatusBadRequest, acceptInvite(token, `{"password": "short"}`).Code)
+	rr = acceptInvite(token, `{"password": "new-password", "firstname": "New"}`)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.NotContains(t, rr.Body.String(), "$2a$")
+	assert.True(t, stored["new"].EmailVerified)
+	assert.Equal(t, "new@example.com", stored["new"].Email)
+	assert.Equal(t, "New", stored["new"].Firstname)
+	assert.Equal(t, []rbac.Grant{{Role: rbac.RoleOperator, Region: "us-east-1"}}, stored["new"].Grants)
+
+	rr = httptest.NewRecorder()
+	LoginHandler(rr, httptest.NewRequest("POST", "/login", strings.NewReader(`{"username": "new", "password": "new-password"}`)))
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// invite works once, even after the user is deleted
+	delete(stored, "new")
+	assert.Equal(t, http.StatusBadRequest, acceptInvite(token, `{"password": "new-password"}`).Code)
+}
+
+func TestRevokeInviteHandler(t *testing.T) {
+	passwordUsers()
+	invite.SetStore(invite.NewMemoryStore())
+	recorder := &recordingMailer{}
+	SetMailer(recorder)
+	defer SetMailer(nil)
+	rr := httptest.NewRecorder()
+	CreateInviteHandler(rr, asUser(httptest.NewRequest("POST", "/invites", strings.NewReader(`{"email": "new@example.com"}`)), "admin"))
+	var created InviteResponse
+	json.NewDecoder(rr.Body).Decode(&created)
+	token, _ := url.QueryUnescape(inviteTokenPattern.FindStringSubmatch(recorder.messages[0].Body)[1])
+	revoke := func() int {
+		rr := httptest.NewRecorder()
+		RevokeInviteHandler(rr, mux.SetURLVars(asUser(httptest.NewRequest("DELETE", "/invites/"+created.ID, nil), "admin"), map[string]string{"id": created.ID}))
+		return rr.Code
+	}
+
+	assert.Equal(t, http.StatusOK, revoke())
+	assert.Equal(t, http.StatusNotFound, revoke())
+	assert.Equal(t, http.StatusBadRequest, acceptInvite(token, `{"password": "new-password"}`).Code)
+}
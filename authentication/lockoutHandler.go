@@ -0,0 +1,106 @@
+package authentication
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+
+	"sfr-backend/audit"
+	"sfr-backend/lockout"
+	"sfr-backend/logging"
+	"sfr-backend/response"
+	"sfr-backend/user"
+)
+
+var clientIP = remoteIP
+
+// SetClientIP - sets function returning client address failed logins are counted for,
+// it has to match the address rate limits use behind proxy
+func SetClientIP(clientIPFunction func(r *http.Request) string) {
+	clientIP = clientIPFunction
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// loginAllowed - rejects login while username or address waits after failed logins or is locked out
+func loginAllowed(w http.ResponseWriter, r *http.Request, username string, ip string) bool {
+	wait, err := lockout.Check(r.Context(), username, ip)
+	if err != nil {
+		logging.FromRequest(r).Error("Unable to check failed logins: ", err)
+		http.Error(w, "Unable to check failed logins", http.StatusInternalServerError)
+		return false
+	}
+	if wait > 0 {
+		audit.Record(r, audit.Event{Action: audit.ActionLogin, User: username, Outcome: audit.OutcomeFailure, Error: "too many failed logins"})
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		http.Error(w, "Too many failed logins, try again later", http.StatusTooManyRequests)
+		return false
+	}
+	return true
+}
+
+// loginUser - reads user logging in, users can't be read during outage of user store,
+// which answers 503 and doesn't count as failed login
+func loginUser(w http.ResponseWriter, r *http.Request, username string) (user.UserDetails, bool) {
+	userDetails, err := loadUserDetailsFunction(r.Context(), username)
+	if err != nil {
+		logging.FromRequest(r).Error("Unable to get user details: ", err)
+		http.Error(w, "Unable to get user details, try again later", http.StatusServiceUnavailable)
+		return user.UserDetails{}, false
+	}
+	return userDetails, true
+}
+
+// loginFailed - counts failed login and records lockout of username or address it caused
+func loginFailed(r *http.Request, username string, ip string) {
+	locked, err := lockout.Failure(r.Context(), username, ip)
+	if err != nil {
+		logging.FromRequest(r).Error("Unable to count failed login: ", err)
+	}
+	for _, key := range locked {
+		logging.FromRequest(r).Warn("Too many failed logins, locked out ", key)
+		audit.Record(r, audit.Event{Action: audit.ActionLockout, User: username, Target: key, Outcome: audit.OutcomeSuccess})
+	}
+}
+
+// loginSucceeded - forgets failed logins of user, users with MFA get here only after second factor
+// so correct password alone doesn't reset failed codes
+func loginSucceeded(ctx context.Context, username string) {
+	if err := lockout.Success(ctx, username); err != nil {
+		log.Error("Unable to reset failed logins: ", err)
+	}
+}
+
+// upgradePasswordHash - stores new hash of password whose hash was created with lower cost
+func upgradePasswordHash(ctx context.Context, usr user.User, userDetails user.UserDetails) {
+	if cost, err := bcrypt.Cost([]byte(userDetails.Password)); err == nil && cost < passwordCost {
+		if err := updatePasswordFunction(ctx, usr.Username, hashAndSaltPassword(usr.Password)); err != nil {
+			log.Error("Unable to upgrade password hash: ", err)
+		}
+	}
+}
+
+// UnlockUserHandler - forgets failed logins and lockout of user in path
+func UnlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+	err := lockout.Unlock(r.Context(), username)
+	audit.Record(r, audit.Event{Action: audit.ActionUnlock, Target: lockout.UserKey(username), Outcome: audit.Outcome(err)})
+	if err != nil {
+		logging.FromRequest(r).Error("Unable to unlock user: ", err)
+		http.Error(w, "Unable to unlock user", http.StatusInternalServerError)
+		return
+	}
+	response.WriteResponse(w, "User "+username+" was unlocked")
+}
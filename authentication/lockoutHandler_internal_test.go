@@ -0,0 +1,90 @@
+package authentication
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"sfr-backend/lockout"
+	"sfr-backend/user"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoginLockout(t *testing.T) {
+	passwordUsers(user.UserDetails{Username: "jdoe", Password: hashed("password")})
+	lockout.SetStore(lockout.NewMemoryStore())
+	defer lockout.SetStore(lockout.NewMemoryStore())
+	lockout.SetConfig(lockout.Config{UserThreshold: 2, IPThreshold: 10, Window: time.Minute, Duration: time.Minute})
+	defer lockout.SetConfig(lockout.DefaultConfig)
+	login := func(password string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		LoginHandler(rr, httptest.NewRequest("POST", "/login", strings.NewReader(`{"username": "jdoe", "password": "`+password+`"}`)))
+		return rr
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, login("wrong").Code)
+	assert.Equal(t, http.StatusUnauthorized, login("wrong").Code)
+	// correct password is rejected too until lockout ends
+	rr := login("password")
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "60", rr.Header().Get("Retry-After"))
+
+	req := mux.SetURLVars(httptest.NewRequest("DELETE", "/users/jdoe/lockout", nil), map[string]string{"username": "jdoe"})
+	rr = httptest.NewRecorder()
+	UnlockUserHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	assert.Equal(t, http.StatusOK, login("password").Code)
+}
+
+func TestLoginUserStoreOutage(t *testing.T) {
+	passwordUsers(user.UserDetails{Username: "jdoe", Password: hashed("password")})
+	lockout.SetStore(lockout.NewMemoryStore())
+	defer lockout.SetStore(lockout.NewMemoryStore())
+	lockout.SetConfig(lockout.Config{UserThreshold: 1, IPThreshold: 1, Window: time.Minute, Duration: time.Minute})
+	defer lockout.SetConfig(lockout.DefaultConfig)
+	load := loadUserDetailsFunction
+	loadUserDetailsFunction = func(context.Context, string) (user.UserDetails, error) {
+		return user.UserDetails{}, errors.New("throttled")
+	}
+	login := func(password string) int {
+		rr := httptest.NewRecorder()
+		LoginHandler(rr, httptest.NewRequest("POST", "/login", strings.NewReader(`{"username": "jdoe", "password": "`+password+`"}`)))
+		return rr.Code
+	}
+
+	assert.Equal(t, http.StatusServiceUnavailable, login("password"))
+	assert.Equal(t, http.StatusServiceUnavailable, login("wrong"))
+	// outage is not counted as failed login
+	loadUserDetailsFunction = load
+	assert.Equal(t, http.StatusOK, login("password"))
+}
+
+func TestLoginProgressiveDelay(t *testing.T) {
+	passwordUsers(user.UserDetails{Username: "jdoe", Password: hashed("password")})
+	lockout.SetStore(lockout.NewMemoryStore())
+	defer lockout.SetStore(lockout.NewMemoryStore())
+	lockout.SetConfig(lockout.Config{Window: time.Minute, BaseDelay: time.Hour, MaxDelay: time.Hour})
+	defer lockout.SetConfig(lockout.DefaultConfig)
+	SetClientIP(func(r *http.Request) string { return r.Header.Get("X-Forwarded-For") })
+	defer SetClientIP(remoteIP)
+	login := func(username string, ip string) int {
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(`{"username": "`+username+`", "password": "wrong"}`))
+		req.Header.Set("X-Forwarded-For", ip)
+		rr := httptest.NewRecorder()
+		LoginHandler(rr, req)
+		return rr.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, login("jdoe", "192.0.2.1"))
+	// both username and address wait after failure
+	assert.Equal(t, http.StatusTooManyRequests, login("jdoe", "192.0.2.2"))
+	assert.Equal(t, http.StatusTooManyRequests, login("other", "192.0.2.1"))
+	assert.Equal(t, http.StatusUnauthorized, login("other", "192.0.2.2"))
+}
@@ -3,49 +3,88 @@ package authentication
 import (
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
 	"os"
 	"time"
 
 	jwt "github.com/dgrijalva/jwt-go"
+	log "github.com/sirupsen/logrus"
 	"golang.org/x/crypto/bcrypt"
 
+	"sfr-backend/apikey"
+	"sfr-backend/audit"
 	"sfr-backend/database"
+	"sfr-backend/logging"
 	"sfr-backend/models"
+	"sfr-backend/password"
+	"sfr-backend/rbac"
+	"sfr-backend/requestbody"
 	"sfr-backend/response"
+	"sfr-backend/revocation"
+	"sfr-backend/session"
+	"sfr-backend/signing"
 	"sfr-backend/user"
 )
 
-var signinKey = []byte("singinKey")
+var keyManager = signing.NewEphemeralManager()
 var getUserDetailsFunction = database.GetUserDetails
+var loadUserDetailsFunction = database.LoadUserDetails
 var createUserFunction = database.CreateUser
 
-// generateToken Function used to generate JWT token for checkAuthentication
-func generateToken(userDetails user.User) (models.ResponseObject, error) {
-	token := jwt.New(jwt.SigningMethodHS256)
+// SetKeyManager - sets keys signing and verifying tokens
+func SetKeyManager(manager *signing.Manager) {
+	keyManager = manager
+}
+
+// JWKSHandler - publishes public keys verifying our tokens
+func JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	keyManager.JWKSHandler(w, r)
+}
+
+// token lifetimes, revoked families are kept for refreshTokenLifetime as no token of the family outlives it
+const (
+	accessTokenLifetime  = 2 * time.Minute
+	refreshTokenLifetime = 24 * time.Hour
+)
+
+// typ claims of tokens issued on login, refresh tokens are never accepted as bearer tokens and the other way round
+const (
+	accessTokenType  = "access"
+	refreshTokenType = "refresh"
+)
+
+// generateToken Function used to generate JWT token for checkAuthentication, tokens of one login share family
+// so all of them can be revoked together, mfa marks login which passed second factor and is kept on refresh
+func generateToken(userDetails user.User, grants []rbac.Grant, family string, mfa bool) (models.ResponseObject, error) {
 	var responseObject models.ResponseObject
 
-	claims := token.Claims.(jwt.MapClaims)
+	claims := jwt.MapClaims{}
 
-	var expiration = time.Now().Add(time.Minute * 2).Unix()
+	var expiration = time.Now().Add(accessTokenLifetime).Unix()
+	claims["typ"] = accessTokenType
 	claims["authorized"] = true
 	claims["user"] = userDetails.Username
+	claims["grants"] = grants
 	claims["exp"] = expiration
+	claims["jti"] = revocation.NewID()
+	claims["fam"] = family
+	claims["mfa"] = mfa
 
-	tokenString, err := token.SignedString(signinKey)
+	tokenString, err := keyManager.Sign(claims)
 
 	if err != nil {
-		log.Println("Error Occurred")
+		log.Error("Unable to sign access token: ", err)
 		return responseObject, err
 	}
 
-	refreshToken := jwt.New(jwt.SigningMethodHS256)
-	rtClaims := refreshToken.Claims.(jwt.MapClaims)
-	rtClaims["sub"] = 1
+	rtClaims := jwt.MapClaims{}
+	rtClaims["typ"] = refreshTokenType
 	rtClaims["user"] = userDetails.Username
-	rtClaims["exp"] = time.Now().Add(time.Hour * 24).Unix()
-	rt, err := refreshToken.SignedString(signinKey)
+	rtClaims["exp"] = time.Now().Add(refreshTokenLifetime).Unix()
+	rtClaims["jti"] = revocation.NewID()
+	rtClaims["fam"] = family
+	rtClaims["mfa"] = mfa
+	rt, err := keyManager.Sign(rtClaims)
 	if err != nil {
 		return responseObject, err
 	}
@@ -57,31 +96,45 @@ func generateToken(userDetails user.User) (models.ResponseObject, error) {
 	return responseObject, nil
 }
 
+// tokenIDs - returns jti and fam claims, tokens issued before revocation was introduced have none
+func tokenIDs(claims jwt.MapClaims) (string, string, bool) {
+	id, _ := claims["jti"].(string)
+	family, _ := claims["fam"].(string)
+	return id, family, id != "" && family != ""
+}
+
+// expiresAt - returns exp claim as time
+func expiresAt(claims jwt.MapClaims) time.Time {
+	expiration, _ := claims["exp"].(float64)
+	return time.Unix(int64(expiration), 0)
+}
+
 func comparePasswords(usr user.User, userCreds user.UserDetails) bool {
-	log.Println("Comparing Passwords")
+	log.Debug("Comparing Passwords")
 
 	// Since we'll be getting the hashed password from the DB it
 	// will be a string so we'll need to convert it to a byte slice
 	byteHash := []byte(userCreds.Password)
 	err := bcrypt.CompareHashAndPassword(byteHash, []byte(usr.Password))
 	if err != nil {
-		log.Println(err)
+		log.Debug("Passwords don't match: ", err)
 		return false
 	}
-	log.Println("Compared Passwords")
+	log.Debug("Compared Passwords")
 	return true
 }
 
+// passwordCost - bcrypt cost of new password hashes
+const passwordCost = bcrypt.DefaultCost
+
 func hashAndSaltPassword(pwd string) string {
 
 	// Use GenerateFromPassword to hash & salt pwd
-	// MinCost is just an integer constant provided by the bcrypt
-	// package along with DefaultCost & MaxCost.
-	// The cost can be any value you want provided it isn't lower
-	// than the MinCost (4)
-	hash, err := bcrypt.GenerateFromPassword([]byte(pwd), bcrypt.MinCost)
+	// passwordCost makes every guess against leaked hash slow,
+	// hashes with lower cost are upgraded on next login
+	hash, err := bcrypt.GenerateFromPassword([]byte(pwd), passwordCost)
 	if err != nil {
-		log.Println(err)
+		log.Error("Unable to hash password: ", err)
 	}
 	// GenerateFromPassword returns a byte slice so we need to
 	// convert the bytes to a string and return it
@@ -89,16 +142,10 @@ func hashAndSaltPassword(pwd string) string {
 }
 
 func getTokenFromTokenString(tokenString string) *jwt.Token {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("There was an error")
-		}
-		return signinKey, nil
-	})
+	token, err := keyManager.Parse(tokenString)
 
 	if err != nil {
-		log.Println("Unable to retrieve token from tokenString")
-		log.Println(err.Error())
+		log.Debug("Unable to retrieve token from tokenString: ", err)
 		return nil
 	}
 	return token
@@ -106,22 +153,58 @@ func getTokenFromTokenString(tokenString string) *jwt.Token {
 
 //LoginHandler - Handles user login
 func LoginHandler(w http.ResponseWriter, r *http.Request) {
+	if passwordLoginDisabled() {
+		http.Error(w, "Password login is disabled, use single sign-on", http.StatusForbidden)
+		return
+	}
 	var usr user.User
-	log.Println(r.Body)
 	error := json.NewDecoder(r.Body).Decode(&usr)
 	if error != nil {
 		http.Error(w, error.Error(), http.StatusBadRequest)
 		return
 	}
-	userDetails := getUserDetailsFunction(usr.Username)
+	ip := clientIP(r)
+	if !loginAllowed(w, r, usr.Username, ip) {
+		return
+	}
+	userDetails, ok := loginUser(w, r, usr.Username)
+	if !ok {
+		return
+	}
 	if !comparePasswords(usr, userDetails) {
+		audit.Record(r, audit.Event{Action: audit.ActionLogin, User: usr.Username, Outcome: audit.OutcomeFailure, Error: "invalid credentials"})
+		loginFailed(r, usr.Username, ip)
 		http.Error(w, "error", http.StatusUnauthorized)
 		return
 	}
-	token, err := generateToken(usr)
+	if userDetails.Disabled {
+		audit.Record(r, audit.Event{Action: audit.ActionLogin, User: usr.Username, Outcome: audit.OutcomeFailure, Error: "user is disabled"})
+		http.Error(w, "User is disabled", http.StatusForbidden)
+		return
+	}
+	upgradePasswordHash(r.Context(), usr, userDetails)
+	if userDetails.MFAEnabled() {
+		challenge, err := issueMFAChallenge(userDetails.Username)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		response.WriteResponse(w, challenge)
+		return
+	}
+	audit.Record(r, audit.Event{Action: audit.ActionLogin, User: usr.Username, Outcome: audit.OutcomeSuccess})
+	loginSucceeded(r.Context(), usr.Username)
+	family := revocation.NewID()
+	token, err := generateToken(usr, sessionGrants(userDetails.Username, userDetails.AllGrants(), false), family, false)
 	if err != nil {
-		log.Println("Error Occurred")
+		logging.FromRequest(r).Error("Unable to generate token: ", err)
 		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err := startSession(r, userDetails.Username, family); err != nil {
+		logging.FromRequest(r).Error("Unable to record session: ", err)
+		http.Error(w, "Unable to start session", http.StatusInternalServerError)
+		return
 	}
 	userDto := models.UserDetailsDto{}
 	userDto.Username = userDetails.Username
@@ -137,41 +220,142 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 
 //CheckAuthentication - Checks authentication for user
 func CheckAuthentication(endpoint func(http.ResponseWriter, *http.Request)) http.Handler {
+	return CheckPermission(nil, endpoint)
+}
+
+//CheckPermission - Checks authentication for user and permissions on targets returned by resolver,
+//nil resolver only requires authentication. API keys are not accepted.
+func CheckPermission(resolver rbac.Resolver, endpoint func(http.ResponseWriter, *http.Request)) http.Handler {
+	return CheckScopedPermission("", resolver, endpoint)
+}
+
+//CheckScopedPermission - Checks permissions like CheckPermission, service accounts can call endpoint
+//with API key in X-API-Key header when their key has scope
+func CheckScopedPermission(scope string, resolver rbac.Resolver, endpoint func(http.ResponseWriter, *http.Request)) http.Handler {
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if os.Getenv("DISABLE_AUTH") == "true" {
 			endpoint(w, r)
 			return
 		}
+		if key := r.Header.Get(apikey.Header); key != "" {
+			account, err := apikey.Authenticate(r.Context(), key)
+			if err == apikey.ErrInvalidKey {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			if err != nil {
+				logging.FromRequest(r).Error("Unable to verify API key "+apikey.Fingerprint(key)+": ", err)
+				http.Error(w, "Unable to verify API key", http.StatusInternalServerError)
+				return
+			}
+			if !account.HasScope(scope) {
+				http.Error(w, "API key scope doesn't allow this route", http.StatusForbidden)
+				return
+			}
+			authorize(w, r, account.Principal(), account.Grants, resolver, endpoint)
+			return
+		}
 		tokenString := r.Header.Get("Authorization")
 		if tokenString == "" {
 			http.Error(w, "Header Not Found", http.StatusUnauthorized)
-			fmt.Printf("Cant find cookie :/\r\n")
+			logging.FromRequest(r).Debug("Authorization header not found")
 			return
 		}
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("There was an error")
-			}
-			return signinKey, nil
-		})
+		token, err := keyManager.Parse(tokenString)
 
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusUnauthorized)
-			fmt.Println("Invalid token. Unable to retrieve token claims")
-			fmt.Println(err.Error())
+			logging.FromRequest(r).Info("Invalid token. Unable to retrieve token claims: ", err)
 			return
 		}
 
 		if token.Valid {
-			endpoint(w, r)
+			claims, _ := token.Claims.(jwt.MapClaims)
+			if claims["typ"] != accessTokenType {
+				http.Error(w, "Not an access token", http.StatusUnauthorized)
+				return
+			}
+			id, family, ok := tokenIDs(claims)
+			if !ok {
+				http.Error(w, "Token can't be revoked, log in again", http.StatusUnauthorized)
+				return
+			}
+			err := revocation.Check(r.Context(), id, family)
+			if err == revocation.ErrRevoked {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			if err != nil {
+				logging.FromRequest(r).Error("Unable to check token revocation: ", err)
+				http.Error(w, "Unable to verify token", http.StatusInternalServerError)
+				return
+			}
+			username, _ := claims["user"].(string)
+			authorize(w, r, username, rbac.GrantsFromClaim(claims["grants"]), resolver, endpoint)
+		}
+	})
+}
+
+//CheckPermissionWithBody - Checks permissions like CheckPermission for endpoint with body decoded by requestbody.Decode
+func CheckPermissionWithBody(newBody func() requestbody.Body, resolver rbac.Resolver, endpoint func(http.ResponseWriter, *http.Request)) http.Handler {
+	return CheckScopedPermissionWithBody("", newBody, resolver, endpoint)
+}
+
+//CheckScopedPermissionWithBody - Checks permissions like CheckScopedPermission, but caller is authenticated before
+//body is decoded, so unauthenticated clients never get body parsed or validated. Resolver runs after decoding
+//and reads decoded form values.
+func CheckScopedPermissionWithBody(scope string, newBody func() requestbody.Body, resolver rbac.Resolver,
+	endpoint func(http.ResponseWriter, *http.Request)) http.Handler {
+	authorized := requirePermission(resolver, endpoint)
+	return CheckScopedPermission(scope, nil, func(w http.ResponseWriter, r *http.Request) {
+		requestbody.Decode(newBody, authorized).ServeHTTP(w, r)
+	})
+}
+
+// requirePermission - calls endpoint when grants in context of authenticated request allow targets of resolver,
+// requests without grants in context are only possible with DISABLE_AUTH
+func requirePermission(resolver rbac.Resolver, endpoint func(http.ResponseWriter, *http.Request)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if grants, ok := rbac.GrantsFromContext(r.Context()); ok && !permitted(grants, resolver(r)) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
 		}
+		endpoint(w, r)
 	})
 }
 
-//CreateUser - function to create a user
+// authorize - calls endpoint with user and grants in context when grants allow targets of resolver
+func authorize(w http.ResponseWriter, r *http.Request, username string, grants []rbac.Grant,
+	resolver rbac.Resolver, endpoint func(http.ResponseWriter, *http.Request)) {
+	if resolver != nil && !permitted(grants, resolver(r)) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	ctx := rbac.WithGrants(user.WithUsername(r.Context(), username), grants)
+	endpoint(w, r.WithContext(ctx))
+}
+
+// permitted - checks grants allow all targets, request without targets is never permitted
+func permitted(grants []rbac.Grant, targets []rbac.Target) bool {
+	if len(targets) == 0 {
+		return false
+	}
+	for _, target := range targets {
+		if !rbac.Allowed(grants, target.Permission, target.Machine, target.Region) {
+			return false
+		}
+	}
+	return true
+}
+
+//CreateUser - function to create a user, only admins can call it and existing users are never overwritten
 func CreateUser(w http.ResponseWriter, r *http.Request) {
+	if passwordLoginDisabled() {
+		http.Error(w, "Password login is disabled, users are provisioned by single sign-on", http.StatusForbidden)
+		return
+	}
 	var user user.UserDetails
 
 	error := json.NewDecoder(r.Body).Decode(&user)
@@ -180,21 +364,35 @@ func CreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := password.Validate(user.Password, user.Username); err != nil {
+		audit.Record(r, audit.Event{Action: audit.ActionCreateUser, Target: user.Username, Outcome: audit.OutcomeFailure, Error: err.Error()})
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	user.Password = hashAndSaltPassword(user.Password)
-	status := createUserFunction(user)
-
+	// grants are assigned with PUT /users/{username}/grants
+	user.Grants = nil
+	user.GroupGrants = nil
+	status := createUserFunction(r.Context(), user)
+
+	if status == "exists" {
+		audit.Record(r, audit.Event{Action: audit.ActionCreateUser, Target: user.Username, Outcome: audit.OutcomeFailure, Error: "user already exists"})
+		http.Error(w, "User already exists", http.StatusConflict)
+		return
+	}
 	if status == "error" || status == "" {
+		audit.Record(r, audit.Event{Action: audit.ActionCreateUser, Target: user.Username, Outcome: audit.OutcomeFailure, Error: "Error creating user"})
 		http.Error(w, "Error creating user", http.StatusInternalServerError)
 		return
 	}
+	audit.Record(r, audit.Event{Action: audit.ActionCreateUser, Target: user.Username, Outcome: audit.OutcomeSuccess})
 
-	response.WriteResponse(w, user)
+	response.WriteResponse(w, newUserResponse(user))
 }
 
 // RefreshTokenCheck - Refreshes the access token with the Refresh token once the token is expired
 func RefreshTokenCheck(w http.ResponseWriter, r *http.Request) {
 
-	log.Println(r.Body)
 	var requestObj models.RefreshToken
 
 	err := json.NewDecoder(r.Body).Decode(&requestObj)
@@ -203,78 +401,134 @@ func RefreshTokenCheck(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := jwt.Parse(requestObj.RefreshToken, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
-		}
-		return signinKey, nil
-	})
+	token, err := keyManager.Parse(requestObj.RefreshToken)
 
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusUnauthorized)
-		fmt.Println("Invalid token. Unable to retrieve token claims")
-		fmt.Println(err.Error())
+		logging.FromRequest(r).Info("Invalid token. Unable to retrieve token claims: ", err)
 		return
 	}
 
-	fmt.Println(token)
-
 	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
 		userDetails := claims["user"]
 		var usr user.User
 		usr.Username = userDetails.(string)
 
-		if int(claims["sub"].(float64)) == 1 {
+		if claims["typ"] == refreshTokenType {
+			id, family, ok := tokenIDs(claims)
+			if !ok {
+				http.Error(w, "Refresh token can't be rotated, log in again", http.StatusUnauthorized)
+				return
+			}
+			// every refresh token is exchanged once, reuse means it was stolen and logs out the whole family
+			err := revocation.UseRefreshToken(r.Context(), id, family, expiresAt(claims), time.Now().Add(refreshTokenLifetime))
+			if err == revocation.ErrReused {
+				audit.Record(r, audit.Event{Action: audit.ActionRefreshTokenReuse, User: usr.Username, Outcome: audit.OutcomeFailure, Error: err.Error()})
+				session.Delete(r.Context(), usr.Username, family)
+			}
+			if err == revocation.ErrReused || err == revocation.ErrRevoked {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			if err != nil {
+				logging.FromRequest(r).Error("Unable to rotate refresh token: ", err)
+				http.Error(w, "Unable to rotate refresh token", http.StatusInternalServerError)
+				return
+			}
 
-			newTokenPair, err := generateToken(usr)
+			// grants are read again, so changed permissions apply on next refresh
+			userDetails := getUserDetailsFunction(r.Context(), usr.Username)
+			if userDetails.Username == "" || userDetails.Disabled {
+				http.Error(w, "User is disabled or was deleted", http.StatusUnauthorized)
+				return
+			}
+			mfa, _ := claims["mfa"].(bool)
+			newTokenPair, err := generateToken(usr, sessionGrants(usr.Username, userDetails.AllGrants(), mfa), family, mfa)
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusUnauthorized)
-				fmt.Println("Error while retrieving new Token")
-				fmt.Println(err.Error())
+				logging.FromRequest(r).Error("Error while retrieving new Token: ", err)
 				return
 			}
+			// sessions of logins from before sessions were recorded are created on first refresh
+			if err := startSession(r, usr.Username, family); err != nil {
+				logging.FromRequest(r).Error("Unable to update session: ", err)
+			}
 
 			response.WriteResponse(w, newTokenPair)
 			return
 
 		}
 		http.Error(w, "Unauthorized User Access", http.StatusUnauthorized)
-		fmt.Println("Unauthorized User Access")
+		logging.FromRequest(r).Info("Unauthorized User Access")
 		return
 	}
 }
 
-//Logout - Function to logout
+//Logout - Revokes access token and all tokens of its family, expired access tokens are accepted
+//so users can log out after access token expired
 func Logout(w http.ResponseWriter, r *http.Request) {
 	tokenString := r.Header.Get("Authorization")
 	if tokenString == "" {
 		http.Error(w, "Header Not Found", http.StatusUnauthorized)
-		fmt.Printf("Cant find cookie :/\r\n")
+		logging.FromRequest(r).Debug("Authorization header not found")
 		return
 	}
 
-	token := getTokenFromTokenString(tokenString)
-	if token == nil {
+	parser := jwt.Parser{SkipClaimsValidation: true}
+	token, err := parser.Parse(tokenString, keyManager.Keyfunc)
+	if err != nil {
 		http.Error(w, "Authorization token not found on the request", http.StatusUnauthorized)
-		fmt.Printf("Cant find Auth token :/\r\n")
+		logging.FromRequest(r).Info("Invalid token. Unable to retrieve token claims: ", err)
 		return
 	}
 
-	claims := token.Claims.(jwt.MapClaims)
-	claims["exp"] = time.Now().Unix()
-
-	if claimsCheck, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		log.Println(claimsCheck["exp"])
-		var claimsExp = int64(claimsCheck["exp"].(int64))
-		unixTimeUTC := time.Unix(claimsExp, 0) //gives unix time stamp in utc
-		log.Println("checking token exxpiry time")
-		log.Println(unixTimeUTC.Sub(time.Now()))
-		log.Println("rewritten token exxpiry time")
-	} else {
+	claims, _ := token.Claims.(jwt.MapClaims)
+	id, family, ok := tokenIDs(claims)
+	if !ok {
 		http.Error(w, "Invalid JWT Token Found", http.StatusUnauthorized)
-		log.Printf("Invalid JWT Token")
+		logging.FromRequest(r).Info("Invalid JWT Token")
+		return
+	}
+	err = revocation.RevokeToken(r.Context(), id, expiresAt(claims))
+	if err == nil {
+		err = revocation.RevokeFamily(r.Context(), family, time.Now().Add(refreshTokenLifetime))
+	}
+	username, _ := claims["user"].(string)
+	if err == nil {
+		err = session.Delete(r.Context(), username, family)
+	}
+	audit.Record(r, audit.Event{Action: audit.ActionLogout, User: username, Outcome: audit.Outcome(err)})
+	if err != nil {
+		logging.FromRequest(r).Error("Unable to revoke tokens: ", err)
+		http.Error(w, "Unable to revoke tokens", http.StatusInternalServerError)
 		return
 	}
 
 	response.WriteResponse(w, "Successfully logged out user")
 }
+
+// UserFromRequest - returns user claim of valid token sent in Authorization header,
+// requests with API key are identified by fingerprint of the key only after the key was authenticated,
+// until then they count against client address like anonymous requests
+func UserFromRequest(r *http.Request) (string, bool) {
+	if key := r.Header.Get(apikey.Header); key != "" {
+		if !apikey.Authenticated(key) {
+			return "", false
+		}
+		return "apikey:" + apikey.Fingerprint(key), true
+	}
+	tokenString := r.Header.Get("Authorization")
+	if tokenString == "" {
+		return "", false
+	}
+	token := getTokenFromTokenString(tokenString)
+	if token == nil || !token.Valid {
+		return "", false
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return "", false
+	}
+	username, ok := claims["user"].(string)
+	return username, ok && username != ""
+}
@@ -1,11 +1,20 @@
 package authentication
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"sfr-backend/apikey"
+	"sfr-backend/lockout"
 	"sfr-backend/models"
+	"sfr-backend/rbac"
+	"sfr-backend/requestbody"
+	"sfr-backend/revocation"
 	"sfr-backend/user"
 	"strings"
 	"testing"
@@ -20,25 +29,29 @@ func TestGenerateToken(t *testing.T) {
 	username := "userName"
 	rval, _ := generateToken(user.User{
 		Username: username,
-	})
+	}, []rbac.Grant{{Role: rbac.RoleViewer}}, "family", true)
 
 	// access token decoding
 	tokenString := rval.AccessToken
 	accessTokenClaims := jwt.MapClaims{}
-	jwt.ParseWithClaims(tokenString, accessTokenClaims, func(token *jwt.Token) (interface{}, error) {
-		return signinKey, nil
-	})
+	jwt.ParseWithClaims(tokenString, accessTokenClaims, keyManager.Keyfunc)
 
 	tokenString = rval.RefreshToken
 	refreshTokenCalims := jwt.MapClaims{}
-	jwt.ParseWithClaims(tokenString, refreshTokenCalims, func(token *jwt.Token) (interface{}, error) {
-		return signinKey, nil
-	})
+	jwt.ParseWithClaims(tokenString, refreshTokenCalims, keyManager.Keyfunc)
 
 	assert.Equal(t, username, accessTokenClaims["user"])
 	assert.Equal(t, true, accessTokenClaims["authorized"])
+	assert.Equal(t, []rbac.Grant{{Role: rbac.RoleViewer}}, rbac.GrantsFromClaim(accessTokenClaims["grants"]))
 	assert.Equal(t, username, refreshTokenCalims["user"])
-	assert.Equal(t, float64(1), refreshTokenCalims["sub"])
+	assert.Equal(t, accessTokenType, accessTokenClaims["typ"])
+	assert.Equal(t, refreshTokenType, refreshTokenCalims["typ"])
+	assert.Equal(t, "family", accessTokenClaims["fam"])
+	assert.Equal(t, "family", refreshTokenCalims["fam"])
+	assert.NotEmpty(t, accessTokenClaims["jti"])
+	assert.NotEqual(t, accessTokenClaims["jti"], refreshTokenCalims["jti"])
+	assert.Equal(t, true, accessTokenClaims["mfa"])
+	assert.Equal(t, true, refreshTokenCalims["mfa"])
 }
 
 func TestComparePasswords(t *testing.T) {
@@ -80,9 +93,17 @@ func TestLoginHandler(t *testing.T) {
 	payloadBadPassword := strings.NewReader(
 		fmt.Sprintf(`{"username": "%s", "password": "%s"}`,
 			username, username))
-	getUserDetailsFunction = func(string) user.UserDetails {
-		return preparedUserDetails
+	loadUserDetailsFunction = func(context.Context, string) (user.UserDetails, error) {
+		return preparedUserDetails, nil
 	}
+	var upgradedHash string
+	updatePasswordFunction = func(ctx context.Context, username string, passwordHash string) error {
+		upgradedHash = passwordHash
+		return nil
+	}
+	// without delays after failed login
+	lockout.SetConfig(lockout.Config{})
+	defer lockout.SetConfig(lockout.DefaultConfig)
 	testTable := []struct {
 		requestPayload       *strings.Reader
 		expectedResponseCode int
@@ -103,6 +124,9 @@ func TestLoginHandler(t *testing.T) {
 			assert.Equal(t, username, rval.Username)
 		}
 	}
+	// hash created with minimal cost is replaced on login
+	cost, _ := bcrypt.Cost([]byte(upgradedHash))
+	assert.Equal(t, passwordCost, cost)
 }
 
 func TestCheckAuthentication(t *testing.T) {
@@ -116,7 +140,7 @@ func TestCreateUserSuccess(t *testing.T) {
 	userPayload := strings.NewReader(
 		fmt.Sprintf(`{"username": "%s", "password": "%s"}`,
 			username, userPassword))
-	correctUserCreationFunction := func(userDetails user.UserDetails) string {
+	correctUserCreationFunction := func(ctx context.Context, userDetails user.UserDetails) string {
 		return "success"
 	}
 	createUserFunction = correctUserCreationFunction
@@ -147,7 +171,7 @@ func TestCreateUserFail(t *testing.T) {
 	userPayload := strings.NewReader(
 		fmt.Sprintf(`{"username": "%s", "password": "%s"}`,
 			username, userPassword))
-	errorUserCreationFunction := func(userDetails user.UserDetails) string {
+	errorUserCreationFunction := func(ctx context.Context, userDetails user.UserDetails) string {
 		return "error"
 	}
 	createUserFunction = errorUserCreationFunction
@@ -166,19 +190,29 @@ func TestCreateUserFail(t *testing.T) {
 }
 
 func TestRefreshTokenCheck(t *testing.T) {
+	getUserDetailsFunction = func(context.Context, string) user.UserDetails {
+		return user.UserDetails{Username: "username"}
+	}
 	expirationTime := time.Now().Add(time.Hour * 24).Unix()
 	refreshToken := jwt.New(jwt.SigningMethodHS256)
 	rtClaims := refreshToken.Claims.(jwt.MapClaims)
-	rtClaims["sub"] = 1
+	rtClaims["typ"] = refreshTokenType
 	rtClaims["user"] = "username"
 	rtClaims["exp"] = expirationTime
-	autorizedRefreshToken, _ := refreshToken.SignedString(signinKey)
-	rtClaims["sub"] = 0
-	notAutorizedRefreshToken, _ := refreshToken.SignedString(signinKey)
+	rtClaims["jti"] = revocation.NewID()
+	rtClaims["fam"] = revocation.NewID()
+	autorizedRefreshToken, _ := keyManager.Sign(rtClaims)
+	rtClaims["typ"] = accessTokenType
+	notAutorizedRefreshToken, _ := keyManager.Sign(rtClaims)
+	delete(rtClaims, "jti")
+	rtClaims["typ"] = refreshTokenType
+	withoutIDRefreshToken, _ := keyManager.Sign(rtClaims)
 	autorizedPayload := strings.NewReader(
 		fmt.Sprintf(`{"RefreshToken": "%s"}`, autorizedRefreshToken))
 	notAutorizedPayload := strings.NewReader(
 		fmt.Sprintf(`{"RefreshToken": "%s"}`, notAutorizedRefreshToken))
+	withoutIDPayload := strings.NewReader(
+		fmt.Sprintf(`{"RefreshToken": "%s"}`, withoutIDRefreshToken))
 	emptyPayload := strings.NewReader("")
 	badTokenPayload := strings.NewReader(fmt.Sprintf(`{"RefreshToken": "%s"}`, "asd"))
 	testTable := []struct {
@@ -188,6 +222,7 @@ func TestRefreshTokenCheck(t *testing.T) {
 		{emptyPayload, http.StatusBadRequest},
 		{badTokenPayload, http.StatusUnauthorized},
 		{notAutorizedPayload, http.StatusUnauthorized},
+		{withoutIDPayload, http.StatusUnauthorized},
 		{autorizedPayload, http.StatusOK},
 	}
 	for _, testCase := range testTable {
@@ -199,15 +234,11 @@ func TestRefreshTokenCheck(t *testing.T) {
 }
 
 func TestLogout(t *testing.T) {
-	username := "username"
-	token := jwt.New(jwt.SigningMethodHS256)
-	claims := token.Claims.(jwt.MapClaims)
-	var expiration = time.Now().Add(time.Minute * 2).Unix()
-	claims["authorized"] = true
-	claims["user"] = username
-	claims["exp"] = expiration
-
-	tokenString, _ := token.SignedString(signinKey)
+	revocation.SetStore(revocation.NewMemoryStore())
+	tokenPair, _ := generateToken(user.User{Username: "username"}, nil, revocation.NewID(), false)
+	expired := jwt.MapClaims{"user": "username", "exp": time.Now().Add(-time.Minute).Unix(), "jti": "expired", "fam": "expired"}
+	expiredToken, _ := keyManager.Sign(expired)
+	withoutID, _ := keyManager.Sign(jwt.MapClaims{"user": "username", "exp": time.Now().Add(time.Minute).Unix()})
 	badToken := "token"
 	testTable := []struct {
 		autorizationHeaderContent string
@@ -215,7 +246,9 @@ func TestLogout(t *testing.T) {
 	}{
 		{"", http.StatusUnauthorized},
 		{badToken, http.StatusUnauthorized},
-		{tokenString, http.StatusOK},
+		{withoutID, http.StatusUnauthorized},
+		{tokenPair.AccessToken, http.StatusOK},
+		{expiredToken, http.StatusOK},
 	}
 	for _, testCase := range testTable {
 		req, _ := http.NewRequest("POST", "/", nil)
@@ -224,4 +257,254 @@ func TestLogout(t *testing.T) {
 		Logout(rr, req)
 		assert.Equal(t, testCase.expectedResponseCode, rr.Code)
 	}
+
+	// access and refresh token of logged out family are rejected
+	req, _ := http.NewRequest("GET", "/aws/machines", nil)
+	req.Header.Set("Authorization", tokenPair.AccessToken)
+	rr := httptest.NewRecorder()
+	CheckAuthentication(func(w http.ResponseWriter, r *http.Request) {}).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	rr = refresh(tokenPair.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+func refresh(refreshToken string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/refreshtoken", strings.NewReader(fmt.Sprintf(`{"RefreshToken": "%s"}`, refreshToken)))
+	rr := httptest.NewRecorder()
+	RefreshTokenCheck(rr, req)
+	return rr
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	revocation.SetStore(revocation.NewMemoryStore())
+	getUserDetailsFunction = func(context.Context, string) user.UserDetails {
+		return user.UserDetails{Username: "username"}
+	}
+	first, _ := generateToken(user.User{Username: "username"}, nil, revocation.NewID(), false)
+
+	rr := refresh(first.RefreshToken)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var second models.ResponseObject
+	json.Unmarshal(rr.Body.Bytes(), &second)
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+
+	// replayed refresh token revokes tokens issued by rotation too
+	rr = refresh(first.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	rr = refresh(second.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	req, _ := http.NewRequest("GET", "/aws/machines", nil)
+	req.Header.Set("Authorization", second.AccessToken)
+	rr = httptest.NewRecorder()
+	CheckAuthentication(func(w http.ResponseWriter, r *http.Request) {}).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+func TestUserFromRequest(t *testing.T) {
+	token, _ := generateToken(user.User{Username: "userName"}, nil, "family", false)
+	testTable := []struct {
+		authorization string
+		expectedUser  string
+		expectedOk    bool
+	}{
+		{token.AccessToken, "userName", true},
+		{"", "", false},
+		{"invalid", "", false},
+	}
+
+	for _, testCase := range testTable {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", testCase.authorization)
+
+		username, ok := UserFromRequest(req)
+
+		assert.Equal(t, testCase.expectedUser, username)
+		assert.Equal(t, testCase.expectedOk, ok)
+	}
+}
+
+func TestCheckPermission(t *testing.T) {
+	endpoint := func(w http.ResponseWriter, r *http.Request) {
+		grants, _ := rbac.GrantsFromContext(r.Context())
+		assert.NotEmpty(t, grants)
+	}
+	orders := "arn:aws:states:eu-west-1:123456789012:stateMachine:orders-import"
+	billing := "arn:aws:states:eu-west-1:123456789012:stateMachine:billing"
+	operator := []rbac.Grant{{Role: rbac.RoleOperator, Machine: "arn:aws:states:*:*:stateMachine:orders-*"}, {Role: rbac.RoleViewer}}
+	testTable := []struct {
+		grants         []rbac.Grant
+		resolver       rbac.Resolver
+		machine        string
+		expectedStatus int
+	}{
+		{operator, rbac.MachineForm(rbac.PermissionExecute, "machine"), orders, http.StatusOK},
+		{operator, rbac.MachineForm(rbac.PermissionExecute, "machine"), billing, http.StatusForbidden},
+		{operator, rbac.MachineForm(rbac.PermissionRead, "machine"), billing, http.StatusOK},
+		{operator, rbac.AnyRegion(rbac.PermissionAdmin), "", http.StatusForbidden},
+		{[]rbac.Grant{{Role: rbac.RoleAdmin}}, rbac.AnyRegion(rbac.PermissionAdmin), "", http.StatusOK},
+		{operator, rbac.All(), "", http.StatusForbidden},
+	}
+
+	for _, testCase := range testTable {
+		token, _ := generateToken(user.User{Username: "username"}, testCase.grants, "family", false)
+		req, _ := http.NewRequest("POST", "/aws/execution", strings.NewReader("machine="+testCase.machine))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Authorization", token.AccessToken)
+		rr := httptest.NewRecorder()
+
+		CheckPermission(testCase.resolver, endpoint).ServeHTTP(rr, req)
+
+		assert.Equal(t, testCase.expectedStatus, rr.Code)
+	}
+
+	// refresh tokens are not bearer tokens
+	token, _ := generateToken(user.User{Username: "username"}, operator, "family", false)
+	req, _ := http.NewRequest("GET", "/me/sessions", nil)
+	req.Header.Set("Authorization", token.RefreshToken)
+	rr := httptest.NewRecorder()
+	CheckAuthentication(endpoint).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+type machineBody struct {
+	Machine string `json:"machine"`
+}
+
+func (body *machineBody) Form() (url.Values, error) {
+	return url.Values{"machine": {body.Machine}}, nil
+}
+
+func TestCheckPermissionWithBody(t *testing.T) {
+	var machine string
+	endpoint := func(w http.ResponseWriter, r *http.Request) {
+		machine = r.FormValue("machine")
+	}
+	newBody := func() requestbody.Body { return &machineBody{} }
+	orders := "arn:aws:states:eu-west-1:123456789012:stateMachine:orders-import"
+	billing := "arn:aws:states:eu-west-1:123456789012:stateMachine:billing"
+	token, _ := generateToken(user.User{Username: "username"}, []rbac.Grant{{Role: rbac.RoleOperator, Machine: orders}}, "family", false)
+	testTable := []struct {
+		authorization  string
+		body           string
+		expectedStatus int
+	}{
+		{token.AccessToken, `{"machine": "` + orders + `"}`, http.StatusOK},
+		{token.AccessToken, `{"machine": "` + billing + `"}`, http.StatusForbidden},
+		{token.AccessToken, `{"unknown": true}`, http.StatusBadRequest},
+		// body of unauthenticated client is never parsed
+		{"", `{"unknown": true}`, http.StatusUnauthorized},
+		{"", `{"machine": "` + orders + `"}`, http.StatusUnauthorized},
+	}
+
+	for _, testCase := range testTable {
+		machine = ""
+		req, _ := http.NewRequest("POST", "/aws/execution", strings.NewReader(testCase.body))
+		req.Header.Set("Content-Type", "application/json")
+		if testCase.authorization != "" {
+			req.Header.Set("Authorization", testCase.authorization)
+		}
+		rr := httptest.NewRecorder()
+
+		CheckPermissionWithBody(newBody, rbac.MachineForm(rbac.PermissionExecute, "machine"), endpoint).ServeHTTP(rr, req)
+
+		assert.Equal(t, testCase.expectedStatus, rr.Code)
+		if testCase.expectedStatus == http.StatusOK {
+			assert.Equal(t, orders, machine)
+		}
+	}
+}
+
+func TestCreateUserIgnoresGrants(t *testing.T) {
+	var created user.UserDetails
+	createUserFunction = func(ctx context.Context, userDetails user.UserDetails) string {
+		created = userDetails
+		return "success"
+	}
+	payload := strings.NewReader(`{"username": "username", "password": "password", "grants": [{"role": "admin"}]}`)
+	req, _ := http.NewRequest("POST", "/createuser", payload)
+	rr := httptest.NewRecorder()
+
+	CreateUser(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, created.Grants)
+}
+
+type apiKeyStore struct {
+	account apikey.ServiceAccount
+}
+
+func (store *apiKeyStore) Get(ctx context.Context, name string) (*apikey.ServiceAccount, error) {
+	if name != store.account.Name {
+		return nil, nil
+	}
+	return &store.account, nil
+}
+
+func (store *apiKeyStore) List(ctx context.Context) ([]apikey.ServiceAccount, error) {
+	return []apikey.ServiceAccount{store.account}, nil
+}
+
+func (store *apiKeyStore) Create(ctx context.Context, account apikey.ServiceAccount) error {
+	return nil
+}
+
+func (store *apiKeyStore) Update(ctx context.Context, account apikey.ServiceAccount) error {
+	return nil
+}
+
+func TestCheckScopedPermissionWithAPIKey(t *testing.T) {
+	key := "sfr.ci.0123456789abcdef"
+	hash := sha256.Sum256([]byte(key))
+	apikey.SetStore(&apiKeyStore{account: apikey.ServiceAccount{
+		Name:    "ci",
+		Scopes:  []string{apikey.ScopeExecute},
+		Grants:  []rbac.Grant{{Role: rbac.RoleOperator, Machine: "arn:aws:states:*:*:stateMachine:deploy-*"}},
+		KeyHash: hex.EncodeToString(hash[:]),
+	}})
+	defer apikey.SetStore(nil)
+	deploy := "arn:aws:states:eu-west-1:123456789012:stateMachine:deploy-api"
+	billing := "arn:aws:states:eu-west-1:123456789012:stateMachine:billing"
+	var principal string
+	endpoint := func(w http.ResponseWriter, r *http.Request) {
+		principal = user.UsernameFromContext(r.Context())
+	}
+	testTable := []struct {
+		key            string
+		scope          string
+		machine        string
+		expectedStatus int
+	}{
+		{key, apikey.ScopeExecute, deploy, http.StatusOK},
+		{key, apikey.ScopeExecute, billing, http.StatusForbidden},
+		{key, apikey.ScopeBatch, deploy, http.StatusForbidden},
+		{key, "", deploy, http.StatusForbidden},
+		{"sfr.ci.fedcba9876543210", apikey.ScopeExecute, deploy, http.StatusUnauthorized},
+	}
+
+	for _, testCase := range testTable {
+		principal = ""
+		req, _ := http.NewRequest("POST", "/aws/execution", strings.NewReader("machine="+testCase.machine))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set(apikey.Header, testCase.key)
+		rr := httptest.NewRecorder()
+
+		CheckScopedPermission(testCase.scope, rbac.MachineForm(rbac.PermissionExecute, "machine"), endpoint).ServeHTTP(rr, req)
+
+		assert.Equal(t, testCase.expectedStatus, rr.Code)
+		if testCase.expectedStatus == http.StatusOK {
+			assert.Equal(t, "service:ci", principal)
+		}
+	}
+	withKey := func(key string) *http.Request {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set(apikey.Header, key)
+		return req
+	}
+	username, ok := UserFromRequest(withKey(key))
+	assert.True(t, ok)
+	assert.Equal(t, "apikey:"+apikey.Fingerprint(key), username)
+	// keys which were never authenticated are rate limited by client address
+	_, ok = UserFromRequest(withKey("sfr.ci.fedcba9876543210"))
+	assert.False(t, ok)
 }
@@ -0,0 +1,358 @@
+package authentication
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/mux"
+
+	"sfr-backend/audit"
+	"sfr-backend/database"
+	"sfr-backend/logging"
+	"sfr-backend/mfa"
+	"sfr-backend/models"
+	"sfr-backend/rbac"
+	"sfr-backend/response"
+	"sfr-backend/revocation"
+	"sfr-backend/user"
+)
+
+// mfaChallengeLifetime - time user has to enter second factor after password was accepted
+const mfaChallengeLifetime = 5 * time.Minute
+
+// mfaChallengeType - typ claim of challenge tokens, they have no family so they are never accepted as access tokens
+const mfaChallengeType = "mfa_challenge"
+
+var updateMFAFunction = database.UpdateMFA
+var mfaCipher *mfa.Cipher
+
+var errInvalidCode = errors.New("invalid code")
+var errMFANotConfigured = errors.New("multi-factor authentication is not configured")
+
+// SetMFACipher - enables enrollment of TOTP second factor, secrets are encrypted with cipher
+func SetMFACipher(cipher *mfa.Cipher) {
+	mfaCipher = cipher
+}
+
+// MFAChallengeResponse - response of LoginHandler for users with second factor, challenge token is exchanged
+// for access and refresh tokens at /login/mfa
+type MFAChallengeResponse struct {
+	MFARequired    bool   `json:"mfaRequired"`
+	ChallengeToken string `json:"challengeToken"`
+	ExpiresAt      string `json:"expiresAt"`
+}
+
+// MFALoginRequest - body of POST /login/mfa, either code from authenticator app or recovery code
+type MFALoginRequest struct {
+	ChallengeToken string `json:"challengeToken"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recoveryCode"`
+}
+
+// MFACodeRequest - body of POST /me/mfa/confirm and POST /me/mfa/disable
+type MFACodeRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+}
+
+// MFAEnrollmentResponse - secret to be added to authenticator app, recovery codes are shown only once
+type MFAEnrollmentResponse struct {
+	Secret        string   `json:"secret"`
+	URI           string   `json:"uri"`
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// sessionGrants - effective grants of user, grants requiring MFA are kept only for sessions which passed it
+func sessionGrants(username string, grants []rbac.Grant, mfaPassed bool) []rbac.Grant {
+	effective := rbac.EffectiveGrants(username, grants)
+	if mfaPassed {
+		return effective
+	}
+	return rbac.WithoutMFA(effective)
+}
+
+// issueMFAChallenge - signs short-lived token proving password of user was accepted
+func issueMFAChallenge(username string) (MFAChallengeResponse, error) {
+	expiration := time.Now().Add(mfaChallengeLifetime).Unix()
+	challenge, err := keyManager.Sign(jwt.MapClaims{
+		"typ":  mfaChallengeType,
+		"user": username,
+		"exp":  expiration,
+		"jti":  revocation.NewID(),
+	})
+	return MFAChallengeResponse{MFARequired: true, ChallengeToken: challenge, ExpiresAt: fmt.Sprint(expiration)}, err
+}
+
+// parseMFAChallenge - returns claims of valid challenge token
+func parseMFAChallenge(challenge string) (jwt.MapClaims, bool) {
+	token, err := keyManager.Parse(challenge)
+	if err != nil || !token.Valid {
+		return nil, false
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["typ"] != mfaChallengeType {
+		return nil, false
+	}
+	username, _ := claims["user"].(string)
+	id, _ := claims["jti"].(string)
+	return claims, username != "" && id != ""
+}
+
+// verifySecondFactor - checks TOTP code or recovery code, returns enrollment with the code marked as used
+// which has to be stored before the code is accepted
+func verifySecondFactor(username string, enrollment user.MFA, code string, recoveryCode string) (*user.MFA, error) {
+	if recoveryCode != "" {
+		remaining, ok := mfa.UseRecoveryCode(enrollment.RecoveryCodes, recoveryCode)
+		if !ok {
+			return nil, errInvalidCode
+		}
+		enrollment.RecoveryCodes = remaining
+		return &enrollment, nil
+	}
+	if mfaCipher == nil {
+		return nil, errMFANotConfigured
+	}
+	secret, err := mfaCipher.Decrypt(enrollment.Secret, username)
+	if err != nil {
+		return nil, err
+	}
+	step, ok := mfa.Verify(secret, code, time.Now(), enrollment.LastUsedStep)
+	if !ok {
+		return nil, errInvalidCode
+	}
+	enrollment.LastUsedStep = step
+	return &enrollment, nil
+}
+
+// MFALoginHandler - second step of login of users with MFA, exchanges challenge token and code for tokens
+func MFALoginHandler(w http.ResponseWriter, r *http.Request) {
+	var request MFALoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	claims, ok := parseMFAChallenge(request.ChallengeToken)
+	if !ok {
+		http.Error(w, "Invalid or expired challenge, log in again", http.StatusUnauthorized)
+		return
+	}
+	username := claims["user"].(string)
+	ip := clientIP(r)
+	if !loginAllowed(w, r, username, ip) {
+		return
+	}
+	userDetails, ok := loginUser(w, r, username)
+	if !ok {
+		return
+	}
+	if userDetails.Disabled {
+		http.Error(w, "User is disabled", http.StatusForbidden)
+		return
+	}
+	if !userDetails.MFAEnabled() {
+		http.Error(w, "Multi-factor authentication is not enabled, log in again", http.StatusUnauthorized)
+		return
+	}
+	enrollment, err := verifySecondFactor(username, *userDetails.MFA, request.Code, request.RecoveryCode)
+	if err == errInvalidCode {
+		audit.Record(r, audit.Event{Action: audit.ActionLogin, User: username, Outcome: audit.OutcomeFailure, Error: "invalid second factor"})
+		loginFailed(r, username, ip)
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		logging.FromRequest(r).Error("Unable to verify second factor: ", err)
+		http.Error(w, "Unable to verify second factor", http.StatusInternalServerError)
+		return
+	}
+	// challenge is used only after code matched, so mistyped code can be entered again
+	err = revocation.UseToken(r.Context(), claims["jti"].(string), expiresAt(claims))
+	if err == revocation.ErrRevoked {
+		http.Error(w, "Challenge was already used, log in again", http.StatusUnauthorized)
+		return
+	}
+	if err == nil {
+		err = updateMFAFunction(r.Context(), username, enrollment)
+	}
+	if err != nil {
+		logging.FromRequest(r).Error("Unable to store used second factor: ", err)
+		http.Error(w, "Unable to verify second factor", http.StatusInternalServerError)
+		return
+	}
+	if request.RecoveryCode != "" {
+		audit.Record(r, audit.Event{Action: audit.ActionUseRecoveryCode, User: username, Target: username, Outcome: audit.OutcomeSuccess})
+	}
+	audit.Record(r, audit.Event{Action: audit.ActionLogin, User: username, Outcome: audit.OutcomeSuccess})
+	loginSucceeded(r.Context(), username)
+	family := revocation.NewID()
+	token, err := generateToken(user.User{Username: username}, sessionGrants(username, userDetails.AllGrants(), true), family, true)
+	if err == nil {
+		err = startSession(r, username, family)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	response.WriteResponse(w, models.UserDetailsDto{
+		Username:       userDetails.Username,
+		Email:          userDetails.Email,
+		Firstname:      userDetails.Firstname,
+		Lastname:       userDetails.Lastname,
+		AccessToken:    token.AccessToken,
+		RefreshToken:   token.RefreshToken,
+		TokenExpiresAt: token.TokenExpiryTime,
+	})
+}
+
+// EnrollMFAHandler - generates TOTP secret and recovery codes for authenticated user,
+// second factor is required only after enrollment is confirmed with first code
+func EnrollMFAHandler(w http.ResponseWriter, r *http.Request) {
+	if mfaCipher == nil {
+		http.Error(w, "Multi-factor authentication is not configured", http.StatusNotFound)
+		return
+	}
+	username := user.UsernameFromContext(r.Context())
+	userDetails := getUserDetailsFunction(r.Context(), username)
+	if userDetails.Username == "" {
+		http.Error(w, user.ErrNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	if userDetails.Password == user.DisabledPassword {
+		http.Error(w, "Users of single sign-on use multi-factor authentication of identity provider", http.StatusForbidden)
+		return
+	}
+	if userDetails.MFAEnabled() {
+		http.Error(w, "Multi-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+	secret, err := mfa.GenerateSecret()
+	if err != nil {
+		logging.FromRequest(r).Error("Unable to generate MFA secret: ", err)
+		http.Error(w, "Unable to enroll second factor", http.StatusInternalServerError)
+		return
+	}
+	encrypted, err := mfaCipher.Encrypt(secret, username)
+	if err != nil {
+		logging.FromRequest(r).Error("Unable to encrypt MFA secret: ", err)
+		http.Error(w, "Unable to enroll second factor", http.StatusInternalServerError)
+		return
+	}
+	codes, hashes, err := mfa.GenerateRecoveryCodes()
+	if err != nil {
+		logging.FromRequest(r).Error("Unable to generate recovery codes: ", err)
+		http.Error(w, "Unable to enroll second factor", http.StatusInternalServerError)
+		return
+	}
+	err = updateMFAFunction(r.Context(), username, &user.MFA{Secret: encrypted, RecoveryCodes: hashes})
+	audit.Record(r, audit.Event{Action: audit.ActionEnrollMFA, Target: username, Outcome: audit.Outcome(err)})
+	if err != nil {
+		logging.FromRequest(r).Error("Unable to store MFA enrollment: ", err)
+		http.Error(w, "Unable to enroll second factor", http.StatusInternalServerError)
+		return
+	}
+	response.WriteResponse(w, MFAEnrollmentResponse{Secret: secret, URI: mfa.URI(mfaIssuer(), username, secret), RecoveryCodes: codes})
+}
+
+// ConfirmMFAHandler - enables second factor enrolled by EnrollMFAHandler once user proves authenticator app works
+func ConfirmMFAHandler(w http.ResponseWriter, r *http.Request) {
+	var request MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	username := user.UsernameFromContext(r.Context())
+	userDetails := getUserDetailsFunction(r.Context(), username)
+	if userDetails.MFA == nil || userDetails.MFA.Enabled {
+		http.Error(w, "No pending multi-factor enrollment", http.StatusConflict)
+		return
+	}
+	enrollment, err := verifySecondFactor(username, *userDetails.MFA, request.Code, "")
+	if err == errInvalidCode {
+		audit.Record(r, audit.Event{Action: audit.ActionEnableMFA, Target: username, Outcome: audit.OutcomeFailure, Error: err.Error()})
+		http.Error(w, "Invalid code", http.StatusBadRequest)
+		return
+	}
+	if err == nil {
+		enrollment.Enabled = true
+		err = updateMFAFunction(r.Context(), username, enrollment)
+		audit.Record(r, audit.Event{Action: audit.ActionEnableMFA, Target: username, Outcome: audit.Outcome(err)})
+	}
+	if err != nil {
+		logging.FromRequest(r).Error("Unable to enable second factor: ", err)
+		http.Error(w, "Unable to enable second factor", http.StatusInternalServerError)
+		return
+	}
+	response.WriteResponse(w, "Multi-factor authentication enabled")
+}
+
+// DisableMFAHandler - removes second factor of authenticated user, enabled second factor requires valid code
+// counted like failed logins, so stolen access token can't be used to guess it
+func DisableMFAHandler(w http.ResponseWriter, r *http.Request) {
+	var request MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	username := user.UsernameFromContext(r.Context())
+	userDetails := getUserDetailsFunction(r.Context(), username)
+	if userDetails.MFA == nil {
+		http.Error(w, "Multi-factor authentication is not enabled", http.StatusConflict)
+		return
+	}
+	if userDetails.MFA.Enabled {
+		ip := clientIP(r)
+		if !loginAllowed(w, r, username, ip) {
+			return
+		}
+		_, err := verifySecondFactor(username, *userDetails.MFA, request.Code, request.RecoveryCode)
+		if err == errInvalidCode {
+			audit.Record(r, audit.Event{Action: audit.ActionDisableMFA, Target: username, Outcome: audit.OutcomeFailure, Error: err.Error()})
+			loginFailed(r, username, ip)
+			http.Error(w, "Invalid code", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			logging.FromRequest(r).Error("Unable to verify second factor: ", err)
+			http.Error(w, "Unable to verify second factor", http.StatusInternalServerError)
+			return
+		}
+	}
+	err := updateMFAFunction(r.Context(), username, nil)
+	audit.Record(r, audit.Event{Action: audit.ActionDisableMFA, Target: username, Outcome: audit.Outcome(err)})
+	if err != nil {
+		logging.FromRequest(r).Error("Unable to disable second factor: ", err)
+		http.Error(w, "Unable to disable second factor", http.StatusInternalServerError)
+		return
+	}
+	response.WriteResponse(w, "Multi-factor authentication disabled")
+}
+
+// ResetMFAHandler - removes second factor of user in path who lost authenticator app and recovery codes
+func ResetMFAHandler(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+	err := updateMFAFunction(r.Context(), username, nil)
+	audit.Record(r, audit.Event{Action: audit.ActionResetMFA, Target: username, Outcome: audit.Outcome(err)})
+	if err == user.ErrNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logging.FromRequest(r).Error("Unable to reset second factor: ", err)
+		http.Error(w, "Unable to reset second factor", http.StatusInternalServerError)
+		return
+	}
+	response.WriteResponse(w, "Multi-factor authentication of "+username+" was reset")
+}
+
+// mfaIssuer - name shown by authenticator apps, MFA_ISSUER or SFR by default
+func mfaIssuer() string {
+	if issuer := os.Getenv("MFA_ISSUER"); issuer != "" {
+		return issuer
+	}
+	return "SFR"
+}
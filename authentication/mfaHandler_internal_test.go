@@ -0,0 +1,214 @@
+package authentication
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"sfr-backend/lockout"
+	"sfr-backend/mfa"
+	"sfr-backend/models"
+	"sfr-backend/rbac"
+	"sfr-backend/revocation"
+	"sfr-backend/user"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// mfaUsers - fakes user table like passwordUsers and stores MFA enrollments in it
+func mfaUsers(users ...user.UserDetails) map[string]user.UserDetails {
+	stored := passwordUsers(users...)
+	updateMFAFunction = func(ctx context.Context, username string, enrollment *user.MFA) error {
+		userDetails, ok := stored[username]
+		if !ok {
+			return user.ErrNotFound
+		}
+		userDetails.MFA = enrollment
+		stored[username] = userDetails
+		return nil
+	}
+	cipher, _ := mfa.NewCipher([]byte("0123456789abcdef0123456789abcdef"))
+	SetMFACipher(cipher)
+	return stored
+}
+
+func asUser(req *http.Request, username string) *http.Request {
+	return req.WithContext(user.WithUsername(req.Context(), username))
+}
+
+// enroll - enrolls and confirms second factor of user, returns its secret and recovery codes
+func enroll(t *testing.T, username string) MFAEnrollmentResponse {
+	rr := httptest.NewRecorder()
+	EnrollMFAHandler(rr, asUser(httptest.NewRequest("POST", "/me/mfa", nil), username))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var enrollment MFAEnrollmentResponse
+	json.NewDecoder(rr.Body).Decode(&enrollment)
+
+	code, _ := mfa.Code(enrollment.Secret, time.Now())
+	rr = httptest.NewRecorder()
+	ConfirmMFAHandler(rr, asUser(httptest.NewRequest("POST", "/me/mfa/confirm", strings.NewReader(`{"code": "`+code+`"}`)), username))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	return enrollment
+}
+
+func TestMFALogin(t *testing.T) {
+	stored := mfaUsers(user.UserDetails{Username: "jdoe", Password: hashed("password"),
+		Grants: []rbac.Grant{{Role: rbac.RoleViewer}, {Role: rbac.RoleOperator, Region: "us-east-1", RequireMFA: true}}})
+	defer SetMFACipher(nil)
+	lockout.SetConfig(lockout.Config{})
+	defer lockout.SetConfig(lockout.DefaultConfig)
+	defer lockout.SetStore(lockout.NewMemoryStore())
+	revocation.SetStore(revocation.NewMemoryStore())
+
+	enrollment := enroll(t, "jdoe")
+	assert.True(t, stored["jdoe"].MFAEnabled())
+	assert.NotEqual(t, enrollment.Secret, stored["jdoe"].MFA.Secret)
+	assert.Contains(t, enrollment.URI, "otpauth://totp/SFR:jdoe")
+
+	rr := httptest.NewRecorder()
+	LoginHandler(rr, httptest.NewRequest("POST", "/login", strings.NewReader(`{"username": "jdoe", "password": "password"}`)))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var challenge MFAChallengeResponse
+	json.NewDecoder(rr.Body).Decode(&challenge)
+	assert.True(t, challenge.MFARequired)
+
+	// challenge is not accepted as access token
+	rr = httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", challenge.ChallengeToken)
+	CheckAuthentication(func(w http.ResponseWriter, r *http.Request) {}).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	secondFactor := func(body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		MFALoginHandler(rr, httptest.NewRequest("POST", "/login/mfa", strings.NewReader(body)))
+		return rr
+	}
+	assert.Equal(t, http.StatusUnauthorized, secondFactor(`{"challengeToken": "`+challenge.ChallengeToken+`", "code": "000000x"}`).Code)
+	// code used to confirm enrollment can't be replayed
+	code, _ := mfa.Code(enrollment.Secret, time.Unix(stored["jdoe"].MFA.LastUsedStep*30, 0))
+	assert.Equal(t, http.StatusUnauthorized, secondFactor(`{"challengeToken": "`+challenge.ChallengeToken+`", "code": "`+code+`"}`).Code)
+
+	rr = secondFactor(`{"challengeToken": "` + challenge.ChallengeToken + `", "recoveryCode": "` + enrollment.RecoveryCodes[0] + `"}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var userDto models.UserDetailsDto
+	json.NewDecoder(rr.Body).Decode(&userDto)
+	claims := jwt.MapClaims{}
+	jwt.ParseWithClaims(userDto.AccessToken, claims, keyManager.Keyfunc)
+	assert.Equal(t, true, claims["mfa"])
+	assert.True(t, rbac.Allowed(rbac.GrantsFromClaim(claims["grants"]), rbac.PermissionExecute, "", "us-east-1"))
+	assert.Len(t, stored["jdoe"].MFA.RecoveryCodes, 9)
+
+	// challenge and recovery code work once
+	assert.Equal(t, http.StatusUnauthorized, secondFactor(`{"challengeToken": "`+challenge.ChallengeToken+`", "recoveryCode": "`+enrollment.RecoveryCodes[1]+`"}`).Code)
+	assert.Len(t, stored["jdoe"].MFA.RecoveryCodes, 9)
+	assert.Equal(t, http.StatusUnauthorized, secondFactor(`{"challengeToken": "nonsense", "recoveryCode": "`+enrollment.RecoveryCodes[1]+`"}`).Code)
+
+	// refreshed tokens keep grants requiring MFA
+	rr = refresh(userDto.RefreshToken)
+	var tokenPair models.ResponseObject
+	json.NewDecoder(rr.Body).Decode(&tokenPair)
+	claims = jwt.MapClaims{}
+	jwt.ParseWithClaims(tokenPair.AccessToken, claims, keyManager.Keyfunc)
+	assert.True(t, rbac.Allowed(rbac.GrantsFromClaim(claims["grants"]), rbac.PermissionExecute, "", "us-east-1"))
+}
+
+func TestMFALoginUserStoreOutage(t *testing.T) {
+	mfaUsers(user.UserDetails{Username: "jdoe", Password: hashed("password")})
+	defer SetMFACipher(nil)
+	lockout.SetStore(lockout.NewMemoryStore())
+	defer lockout.SetStore(lockout.NewMemoryStore())
+	lockout.SetConfig(lockout.Config{UserThreshold: 1, IPThreshold: 1, Window: time.Minute, Duration: time.Minute})
+	defer lockout.SetConfig(lockout.DefaultConfig)
+	revocation.SetStore(revocation.NewMemoryStore())
+
+	enroll(t, "jdoe")
+	rr := httptest.NewRecorder()
+	LoginHandler(rr, httptest.NewRequest("POST", "/login", strings.NewReader(`{"username": "jdoe", "password": "password"}`)))
+	var challenge MFAChallengeResponse
+	json.NewDecoder(rr.Body).Decode(&challenge)
+
+	load := loadUserDetailsFunction
+	loadUserDetailsFunction = func(context.Context, string) (user.UserDetails, error) {
+		return user.UserDetails{}, errors.New("throttled")
+	}
+	rr = httptest.NewRecorder()
+	MFALoginHandler(rr, httptest.NewRequest("POST", "/login/mfa", strings.NewReader(`{"challengeToken": "`+challenge.ChallengeToken+`", "code": "000000"}`)))
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	loadUserDetailsFunction = load
+	wait, _ := lockout.Check(context.Background(), "jdoe", "")
+	assert.Zero(t, wait)
+}
+
+func TestGrantsRequiringMFA(t *testing.T) {
+	mfaUsers(user.UserDetails{Username: "jdoe", Password: hashed("password"),
+		Grants: []rbac.Grant{{Role: rbac.RoleOperator, Region: "us-east-1", RequireMFA: true}}})
+	defer SetMFACipher(nil)
+	lockout.SetStore(lockout.NewMemoryStore())
+	defer lockout.SetStore(lockout.NewMemoryStore())
+	lockout.SetConfig(lockout.Config{})
+	defer lockout.SetConfig(lockout.DefaultConfig)
+
+	// user without second factor logs in without grants requiring it and without default role
+	rr := httptest.NewRecorder()
+	LoginHandler(rr, httptest.NewRequest("POST", "/login", strings.NewReader(`{"username": "jdoe", "password": "password"}`)))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var userDto models.UserDetailsDto
+	json.NewDecoder(rr.Body).Decode(&userDto)
+	claims := jwt.MapClaims{}
+	jwt.ParseWithClaims(userDto.AccessToken, claims, keyManager.Keyfunc)
+	assert.Equal(t, false, claims["mfa"])
+	assert.Empty(t, rbac.GrantsFromClaim(claims["grants"]))
+}
+
+func TestDisableMFA(t *testing.T) {
+	stored := mfaUsers(user.UserDetails{Username: "jdoe", Password: hashed("password")})
+	defer SetMFACipher(nil)
+	lockout.SetConfig(lockout.Config{})
+	defer lockout.SetConfig(lockout.DefaultConfig)
+	defer lockout.SetStore(lockout.NewMemoryStore())
+	disable := func(body string) int {
+		rr := httptest.NewRecorder()
+		DisableMFAHandler(rr, asUser(httptest.NewRequest("POST", "/me/mfa/disable", strings.NewReader(body)), "jdoe"))
+		return rr.Code
+	}
+
+	assert.Equal(t, http.StatusConflict, disable(`{}`))
+	enrollment := enroll(t, "jdoe")
+	rr := httptest.NewRecorder()
+	EnrollMFAHandler(rr, asUser(httptest.NewRequest("POST", "/me/mfa", nil), "jdoe"))
+	assert.Equal(t, http.StatusConflict, rr.Code)
+
+	assert.Equal(t, http.StatusBadRequest, disable(`{"code": "123"}`))
+	assert.Equal(t, http.StatusOK, disable(`{"recoveryCode": "`+enrollment.RecoveryCodes[0]+`"}`))
+	assert.Nil(t, stored["jdoe"].MFA)
+
+	enroll(t, "jdoe")
+	req := mux.SetURLVars(httptest.NewRequest("DELETE", "/users/jdoe/mfa", nil), map[string]string{"username": "jdoe"})
+	rr = httptest.NewRecorder()
+	ResetMFAHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Nil(t, stored["jdoe"].MFA)
+
+	req = mux.SetURLVars(httptest.NewRequest("DELETE", "/users/nobody/mfa", nil), map[string]string{"username": "nobody"})
+	rr = httptest.NewRecorder()
+	ResetMFAHandler(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestEnrollMFANotConfigured(t *testing.T) {
+	mfaUsers(user.UserDetails{Username: "jdoe", Password: hashed("password")})
+	SetMFACipher(nil)
+
+	rr := httptest.NewRecorder()
+	EnrollMFAHandler(rr, asUser(httptest.NewRequest("POST", "/me/mfa", nil), "jdoe"))
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
@@ -0,0 +1,224 @@
+package authentication
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+
+	"github.com/gorilla/mux"
+
+	"sfr-backend/audit"
+	"sfr-backend/database"
+	"sfr-backend/logging"
+	"sfr-backend/models"
+	"sfr-backend/oidc"
+	"sfr-backend/rbac"
+	"sfr-backend/response"
+	"sfr-backend/revocation"
+	"sfr-backend/user"
+)
+
+var oidcProvider *oidc.Provider
+
+var getUserByIdentityFunction = database.GetUserByIdentity
+
+// errAccountNotLinked - username of identity belongs to account single sign-on must not take over
+var errAccountNotLinked = errors.New("Account is not linked to single sign-on, an admin has to link it")
+
+// SetOIDCProvider - enables single sign-on with identity provider
+func SetOIDCProvider(provider *oidc.Provider) {
+	oidcProvider = provider
+}
+
+// passwordLoginDisabled - PASSWORD_LOGIN_DISABLED leaves single sign-on as the only way to log in
+func passwordLoginDisabled() bool {
+	return os.Getenv("PASSWORD_LOGIN_DISABLED") == "true"
+}
+
+// OIDCLoginResponse - where frontend sends user to log in and state it has to keep until callback
+type OIDCLoginResponse struct {
+	AuthorizationURL string `json:"authorizationUrl"`
+	LoginState       string `json:"loginState"`
+}
+
+// OIDCCallbackRequest - code and state identity provider redirected user with and login state from OIDCLoginResponse
+type OIDCCallbackRequest struct {
+	Code       string `json:"code"`
+	State      string `json:"state"`
+	LoginState string `json:"loginState"`
+}
+
+// OIDCLoginHandler - starts single sign-on, frontend redirects user to returned authorization URL
+func OIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if oidcProvider == nil {
+		http.Error(w, "Single sign-on is not configured", http.StatusNotFound)
+		return
+	}
+	authorizationURL, loginState, err := oidcProvider.Start()
+	if err != nil {
+		logging.FromRequest(r).Error("Unable to start single sign-on: ", err)
+		http.Error(w, "Identity provider is not available", http.StatusBadGateway)
+		return
+	}
+	response.WriteResponse(w, OIDCLoginResponse{AuthorizationURL: authorizationURL, LoginState: loginState})
+}
+
+// OIDCCallbackHandler - finishes single sign-on, provisions user on first login and responds like LoginHandler
+func OIDCCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if oidcProvider == nil {
+		http.Error(w, "Single sign-on is not configured", http.StatusNotFound)
+		return
+	}
+	var callback OIDCCallbackRequest
+	err := json.NewDecoder(r.Body).Decode(&callback)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	identity, err := oidcProvider.Finish(callback.Code, callback.State, callback.LoginState)
+	if err != nil {
+		logging.FromRequest(r).Warn("Single sign-on failed: ", err)
+		audit.Record(r, audit.Event{Action: audit.ActionLogin, Outcome: audit.OutcomeFailure, Error: err.Error()})
+		var tokenErr *oidc.TokenError
+		if errors.Is(err, oidc.ErrInvalidState) || errors.Is(err, oidc.ErrInvalidToken) || errors.As(err, &tokenErr) {
+			http.Error(w, "Single sign-on failed", http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, "Identity provider is not available", http.StatusBadGateway)
+		return
+	}
+
+	userDetails, err := provisionUser(r, identity)
+	if err != nil {
+		audit.Record(r, audit.Event{Action: audit.ActionLogin, User: identity.Username, Outcome: audit.OutcomeFailure, Error: err.Error()})
+		if errors.Is(err, errAccountNotLinked) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if userDetails.Disabled {
+		audit.Record(r, audit.Event{Action: audit.ActionLogin, User: identity.Username, Outcome: audit.OutcomeFailure, Error: "user is disabled"})
+		http.Error(w, "User is disabled", http.StatusForbidden)
+		return
+	}
+	audit.Record(r, audit.Event{Action: audit.ActionLogin, User: identity.Username, Outcome: audit.OutcomeSuccess})
+	// grants requiring MFA apply when identity provider reports second factor
+	family := revocation.NewID()
+	token, err := generateToken(user.User{Username: userDetails.Username}, sessionGrants(userDetails.Username, userDetails.AllGrants(), identity.MFA),
+		family, identity.MFA)
+	if err == nil {
+		err = startSession(r, userDetails.Username, family)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	response.WriteResponse(w, models.UserDetailsDto{
+		Username:       userDetails.Username,
+		Email:          userDetails.Email,
+		Firstname:      userDetails.Firstname,
+		Lastname:       userDetails.Lastname,
+		AccessToken:    token.AccessToken,
+		RefreshToken:   token.RefreshToken,
+		TokenExpiresAt: token.TokenExpiryTime,
+	})
+}
+
+// provisionUser - creates user on first single sign-on and refreshes profile and group grants on every next one,
+// grants managed by admins are kept. Users are matched by issuer and subject, username only links accounts
+// provisioned by single sign-on before, accounts with password have to be linked by admins.
+func provisionUser(r *http.Request, identity *oidc.Identity) (user.UserDetails, error) {
+	groupGrants := oidcProvider.Grants(identity.Groups)
+	userDetails, err := getUserByIdentityFunction(r.Context(), identity.Issuer, identity.Subject)
+	if err != nil {
+		logging.FromRequest(r).Error("Unable to find user linked to single sign-on: ", err)
+		return userDetails, errors.New("Error provisioning user")
+	}
+	if userDetails.Username == "" {
+		userDetails = getUserDetailsFunction(r.Context(), identity.Username)
+		if userDetails.Username == "" {
+			return createProvisionedUser(r, identity, groupGrants)
+		}
+		if userDetails.OIDCSubject != "" || userDetails.Password != user.DisabledPassword {
+			logging.FromRequest(r).Warn("Single sign-on refused to take over account ", userDetails.Username)
+			return userDetails, errAccountNotLinked
+		}
+	}
+
+	// only changed attributes are written, so concurrent changes of admins are kept
+	update := user.Update{GroupGrants: &groupGrants, OIDCIssuer: &identity.Issuer, OIDCSubject: &identity.Subject}
+	if identity.Email != "" {
+		update.Email = &identity.Email
+	}
+	if identity.Firstname != "" {
+		update.Firstname = &identity.Firstname
+	}
+	if identity.Lastname != "" {
+		update.Lastname = &identity.Lastname
+	}
+	updated, err := updateUserFunction(r.Context(), userDetails.Username, update)
+	if err != nil {
+		logging.FromRequest(r).Error("Unable to update user provisioned by single sign-on: ", err)
+		return userDetails, errors.New("Error provisioning user")
+	}
+	return updated, nil
+}
+
+// createProvisionedUser - creates user without password linked to identity
+func createProvisionedUser(r *http.Request, identity *oidc.Identity, groupGrants []rbac.Grant) (user.UserDetails, error) {
+	userDetails := user.UserDetails{
+		Username:    identity.Username,
+		Password:    user.DisabledPassword,
+		Email:       identity.Email,
+		Firstname:   identity.Firstname,
+		Lastname:    identity.Lastname,
+		GroupGrants: groupGrants,
+		OIDCIssuer:  identity.Issuer,
+		OIDCSubject: identity.Subject,
+	}
+	status := createUserFunction(r.Context(), userDetails)
+	if status == "error" || status == "" || status == "exists" {
+		audit.Record(r, audit.Event{Action: audit.ActionCreateUser, Target: identity.Username, Outcome: audit.OutcomeFailure, Error: "Error creating user"})
+		return userDetails, errors.New("Error provisioning user")
+	}
+	audit.Record(r, audit.Event{Action: audit.ActionCreateUser, Target: identity.Username, Outcome: audit.OutcomeSuccess})
+	return userDetails, nil
+}
+
+// LinkIdentityRequest - body of PUT /users/{username}/identity, subject of account at configured identity provider
+type LinkIdentityRequest struct {
+	Subject string `json:"subject"`
+}
+
+// LinkIdentityHandler - links user in path to account at identity provider, so single sign-on logs in as the user
+// even when it has password or other username
+func LinkIdentityHandler(w http.ResponseWriter, r *http.Request) {
+	if oidcProvider == nil {
+		http.Error(w, "Single sign-on is not configured", http.StatusNotFound)
+		return
+	}
+	var request LinkIdentityRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.Subject == "" {
+		http.Error(w, "Subject is required", http.StatusBadRequest)
+		return
+	}
+	issuer := oidcProvider.Issuer()
+	linked, err := getUserByIdentityFunction(r.Context(), issuer, request.Subject)
+	if err != nil {
+		logging.FromRequest(r).Error("Unable to find user linked to single sign-on: ", err)
+		http.Error(w, "Unable to update user", http.StatusInternalServerError)
+		return
+	}
+	if linked.Username != "" && linked.Username != mux.Vars(r)["username"] {
+		http.Error(w, "Identity is already linked to user "+linked.Username, http.StatusConflict)
+		return
+	}
+	updateUser(w, r, audit.ActionLinkIdentity, user.Update{OIDCIssuer: &issuer, OIDCSubject: &request.Subject})
+}
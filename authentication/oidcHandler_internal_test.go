@@ -0,0 +1,142 @@
+package authentication
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"sfr-backend/models"
+	"sfr-backend/oidc"
+	"sfr-backend/oidc/oidctest"
+	"sfr-backend/rbac"
+	"sfr-backend/user"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func singleSignOn(t *testing.T, identityProvider *oidctest.IdentityProvider, claims map[string]interface{}) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	OIDCLoginHandler(rr, httptest.NewRequest("GET", "/oidc/login", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var login OIDCLoginResponse
+	json.Unmarshal(rr.Body.Bytes(), &login)
+	code, state, err := identityProvider.Login(login.AuthorizationURL, claims)
+	assert.Nil(t, err)
+
+	body, _ := json.Marshal(OIDCCallbackRequest{Code: code, State: state, LoginState: login.LoginState})
+	rr = httptest.NewRecorder()
+	OIDCCallbackHandler(rr, httptest.NewRequest("POST", "/oidc/callback", strings.NewReader(string(body))))
+	return rr
+}
+
+func TestOIDCCallbackProvisionsUser(t *testing.T) {
+	identityProvider := oidctest.NewIdentityProvider("sfr", "")
+	defer identityProvider.Close()
+	SetOIDCProvider(oidc.NewProvider(oidc.Config{
+		Issuer:        identityProvider.URL,
+		ClientID:      "sfr",
+		RedirectURL:   "https://sfr.example.com/sso",
+		UsernameClaim: "preferred_username",
+		GroupsClaim:   "groups",
+		GroupGrants:   map[string][]rbac.Grant{"sfr-viewers": {{Role: rbac.RoleViewer}}},
+		StateSecret:   []byte("secret"),
+	}))
+	defer SetOIDCProvider(nil)
+	stored := passwordUsers()
+
+	rr := singleSignOn(t, identityProvider, map[string]interface{}{"sub": "1234", "preferred_username": "jdoe", "given_name": "John", "groups": []string{"sfr-viewers"}})
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var dto models.UserDetailsDto
+	json.Unmarshal(rr.Body.Bytes(), &dto)
+	assert.Equal(t, "jdoe", dto.Username)
+	assert.Equal(t, "John", dto.Firstname)
+	assert.Equal(t, user.DisabledPassword, stored["jdoe"].Password)
+	assert.Equal(t, identityProvider.URL, stored["jdoe"].OIDCIssuer)
+	assert.Equal(t, "1234", stored["jdoe"].OIDCSubject)
+	assert.Equal(t, []rbac.Grant{{Role: rbac.RoleViewer}}, stored["jdoe"].GroupGrants)
+	claims := jwt.MapClaims{}
+	jwt.ParseWithClaims(dto.AccessToken, claims, keyManager.Keyfunc)
+	assert.Equal(t, []rbac.Grant{{Role: rbac.RoleViewer}}, rbac.GrantsFromClaim(claims["grants"]))
+
+	// grants managed by admins are kept, group grants follow identity provider
+	jdoe := stored["jdoe"]
+	jdoe.Grants = []rbac.Grant{{Role: rbac.RoleOperator, Machine: "arn:aws:states:*:*:stateMachine:deploy"}}
+	stored["jdoe"] = jdoe
+	rr = singleSignOn(t, identityProvider, map[string]interface{}{"sub": "1234", "preferred_username": "jdoe", "groups": []string{}})
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, jdoe.Grants, stored["jdoe"].Grants)
+	assert.Empty(t, stored["jdoe"].GroupGrants)
+	assert.Equal(t, "John", stored["jdoe"].Firstname)
+
+	// provisioned users can't log in with password
+	rr = httptest.NewRecorder()
+	LoginHandler(rr, httptest.NewRequest("POST", "/login", strings.NewReader(`{"username": "jdoe", "password": ""}`)))
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+func TestOIDCCallbackMatchesIdentity(t *testing.T) {
+	identityProvider := oidctest.NewIdentityProvider("sfr", "")
+	defer identityProvider.Close()
+	SetOIDCProvider(oidc.NewProvider(oidc.Config{
+		Issuer:        identityProvider.URL,
+		ClientID:      "sfr",
+		RedirectURL:   "https://sfr.example.com/sso",
+		UsernameClaim: "preferred_username",
+		StateSecret:   []byte("secret"),
+	}))
+	defer SetOIDCProvider(nil)
+	stored := passwordUsers(
+		user.UserDetails{Username: "jdoe", Password: hashed("password")},
+		user.UserDetails{Username: "asmith", Password: user.DisabledPassword, OIDCIssuer: identityProvider.URL, OIDCSubject: "1111"},
+	)
+
+	// accounts with password and accounts linked to other identity are not taken over by username
+	rr := singleSignOn(t, identityProvider, map[string]interface{}{"sub": "1234", "preferred_username": "jdoe"})
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	rr = singleSignOn(t, identityProvider, map[string]interface{}{"sub": "2222", "preferred_username": "asmith"})
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Equal(t, "1111", stored["asmith"].OIDCSubject)
+
+	// linked by admin, identity logs in as the user even after its username changed
+	rr = httptest.NewRecorder()
+	LinkIdentityHandler(rr, adminRequest("PUT", "/users/jdoe/identity", "jdoe", `{"subject": "1234"}`))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	rr = singleSignOn(t, identityProvider, map[string]interface{}{"sub": "1234", "preferred_username": "john.doe"})
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var dto models.UserDetailsDto
+	json.Unmarshal(rr.Body.Bytes(), &dto)
+	assert.Equal(t, "jdoe", dto.Username)
+	_, created := stored["john.doe"]
+	assert.False(t, created)
+
+	// identity can be linked to one user only
+	rr = httptest.NewRecorder()
+	LinkIdentityHandler(rr, adminRequest("PUT", "/users/asmith/identity", "asmith", `{"subject": "1234"}`))
+	assert.Equal(t, http.StatusConflict, rr.Code)
+}
+
+func TestOIDCNotConfigured(t *testing.T) {
+	rr := httptest.NewRecorder()
+
+	OIDCLoginHandler(rr, httptest.NewRequest("GET", "/oidc/login", nil))
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestPasswordLoginDisabled(t *testing.T) {
+	os.Setenv("PASSWORD_LOGIN_DISABLED", "true")
+	defer os.Unsetenv("PASSWORD_LOGIN_DISABLED")
+
+	rr := httptest.NewRecorder()
+	LoginHandler(rr, httptest.NewRequest("POST", "/login", strings.NewReader(`{"username": "jdoe", "password": "password"}`)))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	rr = httptest.NewRecorder()
+	CreateUser(rr, httptest.NewRequest("POST", "/createuser", strings.NewReader(`{"username": "jdoe", "password": "password"}`)))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+}
@@ -0,0 +1,212 @@
+package authentication
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"sfr-backend/audit"
+	"sfr-backend/database"
+	"sfr-backend/logging"
+	"sfr-backend/mailer"
+	"sfr-backend/password"
+	"sfr-backend/response"
+	"sfr-backend/user"
+)
+
+var updatePasswordFunction = database.UpdatePassword
+var accountMailer mailer.Mailer
+
+// SetMailer - sets mailer delivering password reset links and invitations
+func SetMailer(passwordMailer mailer.Mailer) {
+	accountMailer = passwordMailer
+}
+
+// ChangePasswordRequest - body of POST /me/password
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+// PasswordResetRequest - body of POST /password-reset
+type PasswordResetRequest struct {
+	Username string `json:"username"`
+}
+
+// ResetPasswordRequest - body of POST /password-reset/confirm, token comes from reset email
+type ResetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"newPassword"`
+}
+
+// ChangePasswordHandler - changes password of authenticated user, current password is required
+func ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	if passwordLoginDisabled() {
+		http.Error(w, "Password login is disabled, use single sign-on", http.StatusForbidden)
+		return
+	}
+	var request ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	username := user.UsernameFromContext(r.Context())
+	userDetails := getUserDetailsFunction(r.Context(), username)
+	if !comparePasswords(user.User{Username: username, Password: request.CurrentPassword}, userDetails) {
+		audit.Record(r, audit.Event{Action: audit.ActionChangePassword, Target: username, Outcome: audit.OutcomeFailure, Error: "invalid credentials"})
+		http.Error(w, "Current password doesn't match", http.StatusUnauthorized)
+		return
+	}
+	if !setPassword(w, r, audit.ActionChangePassword, username, request.NewPassword) {
+		return
+	}
+	// other sessions may belong to whoever knew the old password, the caller stays signed in
+	if _, err := revokeOtherSessions(r.Context(), username, requestFamily(r)); err != nil {
+		logging.FromRequest(r).Error("Unable to revoke sessions after password change: ", err)
+		http.Error(w, "Password was changed, but other sessions could not be revoked", http.StatusInternalServerError)
+		return
+	}
+	response.WriteResponse(w, "Password changed")
+}
+
+// RequestPasswordResetHandler - sends reset link to email of user, response doesn't reveal whether user exists
+func RequestPasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	if passwordLoginDisabled() {
+		http.Error(w, "Password login is disabled, use single sign-on", http.StatusForbidden)
+		return
+	}
+	var request PasswordResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err := sendResetLink(r.Context(), request.Username, request.Username)
+	audit.Record(r, audit.Event{Action: audit.ActionRequestPasswordReset, User: request.Username, Target: request.Username, Outcome: audit.Outcome(err)})
+	if err != nil && !errors.Is(err, user.ErrNotFound) {
+		logging.FromRequest(r).Error("Unable to send password reset link: ", err)
+	}
+	response.WriteResponseWithStatus(w, http.StatusAccepted, "If the user exists and has email address, reset link was sent to it")
+}
+
+// AdminPasswordResetHandler - sends reset link to email of user in path on behalf of admin
+func AdminPasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	if passwordLoginDisabled() {
+		http.Error(w, "Password login is disabled, use single sign-on", http.StatusForbidden)
+		return
+	}
+	username := mux.Vars(r)["username"]
+	err := sendResetLink(r.Context(), username, user.UsernameFromContext(r.Context()))
+	audit.Record(r, audit.Event{Action: audit.ActionRequestPasswordReset, Target: username, Outcome: audit.Outcome(err)})
+	switch {
+	case errors.Is(err, user.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, errNoEmail):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case err != nil:
+		logging.FromRequest(r).Error("Unable to send password reset link: ", err)
+		http.Error(w, "Unable to send password reset link", http.StatusInternalServerError)
+	default:
+		response.WriteResponseWithStatus(w, http.StatusAccepted, "Reset link was sent")
+	}
+}
+
+// ResetPasswordHandler - sets new password with token from reset link, token works only once
+func ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	if passwordLoginDisabled() {
+		http.Error(w, "Password login is disabled, use single sign-on", http.StatusForbidden)
+		return
+	}
+	var request ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// rules not depending on username are checked first, so rejected password doesn't spend the token
+	if err := password.Validate(request.NewPassword, ""); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	username, err := password.RedeemResetToken(r.Context(), request.Token)
+	if err == password.ErrInvalidToken {
+		audit.Record(r, audit.Event{Action: audit.ActionResetPassword, Outcome: audit.OutcomeFailure, Error: err.Error()})
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		logging.FromRequest(r).Error("Unable to redeem password reset token: ", err)
+		http.Error(w, "Unable to reset password", http.StatusInternalServerError)
+		return
+	}
+	if !setPassword(w, r, audit.ActionResetPassword, username, request.NewPassword) {
+		return
+	}
+	if _, err := revokeAllSessions(r.Context(), username); err != nil {
+		logging.FromRequest(r).Error("Unable to revoke sessions after password reset: ", err)
+		http.Error(w, "Password was changed, but sessions could not be revoked", http.StatusInternalServerError)
+		return
+	}
+	response.WriteResponse(w, "Password changed")
+}
+
+var errNoEmail = errors.New("user has no email address to send reset link to")
+
+// sendResetLink - issues reset token for user with password and mails link with it
+func sendResetLink(ctx context.Context, username string, requestedBy string) error {
+	userDetails := getUserDetailsFunction(ctx, username)
+	if username == "" || userDetails.Username == "" || userDetails.Password == user.DisabledPassword {
+		return user.ErrNotFound
+	}
+	if userDetails.Email == "" {
+		return errNoEmail
+	}
+	if accountMailer == nil {
+		return errors.New("mailer is not configured")
+	}
+	token, expiresAt, err := password.IssueResetToken(ctx, username, requestedBy)
+	if err != nil {
+		return err
+	}
+	return accountMailer.Send(mailer.Message{
+		To:      []string{userDetails.Email},
+		Subject: "Password reset",
+		Body: fmt.Sprintf("Password reset was requested for user %s.\n\nOpen the link below to set a new password, it works once until %s:\n\n%s\n\nIf you didn't request it, ignore this email.\n",
+			username, expiresAt.UTC().Format(time.RFC1123), resetLink(token)),
+	})
+}
+
+// resetLink - frontend page from PASSWORD_RESET_URL, BASE_URL/reset-password by default, with token in query
+func resetLink(token string) string {
+	link := os.Getenv("PASSWORD_RESET_URL")
+	if link == "" {
+		link = os.Getenv("BASE_URL") + "/reset-password"
+	}
+	return link + "?token=" + url.QueryEscape(token)
+}
+
+// setPassword - validates new password against policy and stores its hash, writes error response when it fails
+func setPassword(w http.ResponseWriter, r *http.Request, action string, username string, newPassword string) bool {
+	if err := password.Validate(newPassword, username); err != nil {
+		audit.Record(r, audit.Event{Action: action, Target: username, Outcome: audit.OutcomeFailure, Error: err.Error()})
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	err := updatePasswordFunction(r.Context(), username, hashAndSaltPassword(newPassword))
+	audit.Record(r, audit.Event{Action: action, Target: username, Outcome: audit.Outcome(err)})
+	if err == user.ErrNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return false
+	}
+	if err != nil {
+		logging.FromRequest(r).Error("Unable to update password: ", err)
+		http.Error(w, "Unable to update password", http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,210 @@
+package authentication
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"sfr-backend/mailer"
+	"sfr-backend/password"
+	"sfr-backend/user"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type recordingMailer struct {
+	messages []mailer.Message
+}
+
+func (recorder *recordingMailer) Send(message mailer.Message) error {
+	recorder.messages = append(recorder.messages, message)
+	return nil
+}
+
+// passwordUsers - fakes user table, returns users by name and their current password hashes
+func passwordUsers(users ...user.UserDetails) map[string]user.UserDetails {
+	stored := map[string]user.UserDetails{}
+	for _, userDetails := range users {
+		stored[userDetails.Username] = userDetails
+	}
+	getUserDetailsFunction = func(ctx context.Context, username string) user.UserDetails {
+		return stored[username]
+	}
+	loadUserDetailsFunction = func(ctx context.Context, username string) (user.UserDetails, error) {
+		return stored[username], nil
+	}
+	updatePasswordFunction = func(ctx context.Context, username string, passwordHash string) error {
+		userDetails, ok := stored[username]
+		if !ok {
+			return user.ErrNotFound
+		}
+		userDetails.Password = passwordHash
+		stored[username] = userDetails
+		return nil
+	}
+	createUserFunction = func(ctx context.Context, userDetails user.UserDetails) string {
+		if _, ok := stored[userDetails.Username]; ok {
+			return "exists"
+		}
+		stored[userDetails.Username] = userDetails
+		return "success"
+	}
+	updateUserFunction = func(ctx context.Context, username string, update user.Update) (user.UserDetails, error) {
+		userDetails, ok := stored[username]
+		if !ok {
+			return userDetails, user.ErrNotFound
+		}
+		if update.Firstname != nil {
+			userDetails.Firstname = *update.Firstname
+		}
+		if update.Lastname != nil {
+			userDetails.Lastname = *update.Lastname
+		}
+		if update.Email != nil {
+			userDetails.Email = *update.Email
+		}
+		if update.EmailVerified != nil {
+			userDetails.EmailVerified = *update.EmailVerified
+		}
+		if update.Grants != nil {
+			userDetails.Grants = *update.Grants
+		}
+		if update.GroupGrants != nil {
+			userDetails.GroupGrants = *update.GroupGrants
+		}
+		if update.Disabled != nil {
+			userDetails.Disabled = *update.Disabled
+		}
+		if update.OIDCIssuer != nil {
+			userDetails.OIDCIssuer = *update.OIDCIssuer
+		}
+		if update.OIDCSubject != nil {
+			userDetails.OIDCSubject = *update.OIDCSubject
+		}
+		stored[username] = userDetails
+		return userDetails, nil
+	}
+	getUserByIdentityFunction = func(ctx context.Context, issuer string, subject string) (user.UserDetails, error) {
+		for _, userDetails := range stored {
+			if userDetails.OIDCIssuer == issuer && userDetails.OIDCSubject == subject {
+				return userDetails, nil
+			}
+		}
+		return user.UserDetails{}, nil
+	}
+	deleteUserFunction = func(ctx context.Context, username string) error {
+		if _, ok := stored[username]; !ok {
+			return user.ErrNotFound
+		}
+		delete(stored, username)
+		return nil
+	}
+	return stored
+}
+
+func hashed(plain string) string {
+	hash, _ := bcrypt.GenerateFromPassword([]byte(plain), bcrypt.MinCost)
+	return string(hash)
+}
+
+func TestChangePasswordHandler(t *testing.T) {
+	stored := passwordUsers(user.UserDetails{Username: "jdoe", Password: hashed("old-password")})
+	testTable := []struct {
+		body           string
+		expectedStatus int
+	}{
+		{`{"currentPassword": "wrong", "newPassword": "new-password"}`, http.StatusUnauthorized},
+		{`{"currentPassword": "old-password", "newPassword": "short"}`, http.StatusBadRequest},
+		{`{"currentPassword": "old-password", "newPassword": "new-password"}`, http.StatusOK},
+		{`{"currentPassword": "old-password", "newPassword": "new-password"}`, http.StatusUnauthorized},
+	}
+
+	for _, testCase := range testTable {
+		req := httptest.NewRequest("POST", "/me/password", strings.NewReader(testCase.body))
+		req = req.WithContext(user.WithUsername(req.Context(), "jdoe"))
+		rr := httptest.NewRecorder()
+
+		ChangePasswordHandler(rr, req)
+
+		assert.Equal(t, testCase.expectedStatus, rr.Code, testCase.body)
+	}
+	assert.True(t, comparePasswords(user.User{Password: "new-password"}, stored["jdoe"]))
+}
+
+func TestPasswordReset(t *testing.T) {
+	stored := passwordUsers(
+		user.UserDetails{Username: "jdoe", Password: hashed("old-password"), Email: "jdoe@example.com"},
+		user.UserDetails{Username: "sso", Password: user.DisabledPassword, Email: "sso@example.com"},
+	)
+	recorder := &recordingMailer{}
+	SetMailer(recorder)
+	defer SetMailer(nil)
+	password.SetStore(password.NewMemoryStore())
+
+	// unknown users and users of single sign-on get the same response without email
+	for _, username := range []string{"jdoe", "unknown", "sso"} {
+		rr := httptest.NewRecorder()
+		RequestPasswordResetHandler(rr, httptest.NewRequest("POST", "/password-reset", strings.NewReader(`{"username": "`+username+`"}`)))
+		assert.Equal(t, http.StatusAccepted, rr.Code)
+	}
+	assert.Len(t, recorder.messages, 1)
+	assert.Equal(t, []string{"jdoe@example.com"}, recorder.messages[0].To)
+	token := regexp.MustCompile(`token=([0-9a-f]+)`).FindStringSubmatch(recorder.messages[0].Body)[1]
+
+	reset := func(body string) int {
+		rr := httptest.NewRecorder()
+		ResetPasswordHandler(rr, httptest.NewRequest("POST", "/password-reset/confirm", strings.NewReader(body)))
+		return rr.Code
+	}
+	assert.Equal(t, http.StatusBadRequest, reset(`{"token": "`+token+`", "newPassword": "short"}`))
+	assert.Equal(t, http.StatusBadRequest, reset(`{"token": "forged", "newPassword": "new-password"}`))
+	assert.Equal(t, http.StatusOK, reset(`{"token": "`+token+`", "newPassword": "new-password"}`))
+	assert.Equal(t, http.StatusBadRequest, reset(`{"token": "`+token+`", "newPassword": "other-password"}`))
+	assert.True(t, comparePasswords(user.User{Password: "new-password"}, stored["jdoe"]))
+}
+
+func TestAdminPasswordResetHandler(t *testing.T) {
+	passwordUsers(
+		user.UserDetails{Username: "jdoe", Password: hashed("old-password"), Email: "jdoe@example.com"},
+		user.UserDetails{Username: "noemail", Password: hashed("old-password")},
+	)
+	recorder := &recordingMailer{}
+	SetMailer(recorder)
+	defer SetMailer(nil)
+	testTable := []struct {
+		username       string
+		expectedStatus int
+	}{
+		{"jdoe", http.StatusAccepted},
+		{"unknown", http.StatusNotFound},
+		{"noemail", http.StatusConflict},
+	}
+
+	for _, testCase := range testTable {
+		req := httptest.NewRequest("POST", "/users/"+testCase.username+"/password-reset", nil)
+		req = mux.SetURLVars(req, map[string]string{"username": testCase.username})
+		req = req.WithContext(user.WithUsername(req.Context(), "admin"))
+		rr := httptest.NewRecorder()
+
+		AdminPasswordResetHandler(rr, req)
+
+		assert.Equal(t, testCase.expectedStatus, rr.Code, testCase.username)
+	}
+	assert.Len(t, recorder.messages, 1)
+}
+
+func TestCreateUserEnforcesPolicy(t *testing.T) {
+	createUserFunction = func(ctx context.Context, userDetails user.UserDetails) string {
+		return "success"
+	}
+	rr := httptest.NewRecorder()
+
+	CreateUser(rr, httptest.NewRequest("POST", "/createuser", strings.NewReader(`{"username": "username", "password": "short"}`)))
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
@@ -0,0 +1,140 @@
+package authentication
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/mux"
+
+	"sfr-backend/audit"
+	"sfr-backend/logging"
+	"sfr-backend/response"
+	"sfr-backend/revocation"
+	"sfr-backend/session"
+	"sfr-backend/user"
+)
+
+// SessionResponse - session of user, current is the session of the calling token
+type SessionResponse struct {
+	session.Session
+	Current bool `json:"current"`
+}
+
+// RevokedSessionsResponse - number of sessions ended by sign out everywhere
+type RevokedSessionsResponse struct {
+	Revoked int `json:"revoked"`
+}
+
+// ListSessionsHandler - returns sessions of authenticated user, most recently used first
+func ListSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	listSessions(w, r, user.UsernameFromContext(r.Context()))
+}
+
+// RevokeSessionHandler - signs authenticated user out of session in path, its tokens stop working immediately
+func RevokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	username := user.UsernameFromContext(r.Context())
+	id := mux.Vars(r)["id"]
+	found, err := session.Get(r.Context(), username, id)
+	if err == nil && found == nil {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if err == nil {
+		err = revokeSession(r.Context(), username, id)
+	}
+	audit.Record(r, audit.Event{Action: audit.ActionRevokeSession, Target: username, Outcome: audit.Outcome(err)})
+	if err != nil {
+		logging.FromRequest(r).Error("Unable to revoke session: ", err)
+		http.Error(w, "Unable to revoke session", http.StatusInternalServerError)
+		return
+	}
+	response.WriteResponse(w, "Session was revoked")
+}
+
+// ListUserSessionsHandler - returns sessions of user in path
+func ListUserSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	listSessions(w, r, mux.Vars(r)["username"])
+}
+
+// RevokeUserSessionsHandler - signs user in path out everywhere, tokens of all sessions stop working immediately
+func RevokeUserSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+	revoked, err := revokeAllSessions(r.Context(), username)
+	audit.Record(r, audit.Event{Action: audit.ActionRevokeSessions, Target: username, Outcome: audit.Outcome(err)})
+	if err != nil {
+		logging.FromRequest(r).Error("Unable to revoke sessions: ", err)
+		http.Error(w, "Unable to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+	response.WriteResponse(w, RevokedSessionsResponse{Revoked: revoked})
+}
+
+// startSession - records login or refresh of token family from client of request
+func startSession(r *http.Request, username string, family string) error {
+	return session.Use(r.Context(), username, family, r.UserAgent(), clientIP(r), time.Now().Add(refreshTokenLifetime))
+}
+
+// revokeSession - revokes all tokens of session and removes its record
+func revokeSession(ctx context.Context, username string, id string) error {
+	if err := revocation.RevokeFamily(ctx, id, time.Now().Add(refreshTokenLifetime)); err != nil {
+		return err
+	}
+	return session.Delete(ctx, username, id)
+}
+
+// revokeAllSessions - revokes every session of user, returns how many were revoked
+func revokeAllSessions(ctx context.Context, username string) (int, error) {
+	return revokeOtherSessions(ctx, username, "")
+}
+
+// revokeOtherSessions - revokes every session of user except session keep, returns how many were revoked
+func revokeOtherSessions(ctx context.Context, username string, keep string) (int, error) {
+	sessions, err := session.List(ctx, username)
+	if err != nil {
+		return 0, err
+	}
+	revoked := 0
+	for _, listed := range sessions {
+		if listed.ID == keep {
+			continue
+		}
+		if err := revokeSession(ctx, username, listed.ID); err != nil {
+			return revoked, err
+		}
+		revoked++
+	}
+	return revoked, nil
+}
+
+// listSessions - responds with sessions of user, marking the one of token in Authorization header
+func listSessions(w http.ResponseWriter, r *http.Request, username string) {
+	sessions, err := session.List(r.Context(), username)
+	if err != nil {
+		logging.FromRequest(r).Error("Unable to list sessions: ", err)
+		http.Error(w, "Unable to list sessions", http.StatusInternalServerError)
+		return
+	}
+	current := requestFamily(r)
+	listed := []SessionResponse{}
+	for _, found := range sessions {
+		listed = append(listed, SessionResponse{Session: found, Current: found.ID == current})
+	}
+	response.WriteResponse(w, listed)
+}
+
+// requestFamily - fam claim of valid token in Authorization header, empty without it
+func requestFamily(r *http.Request) string {
+	tokenString := r.Header.Get("Authorization")
+	if tokenString == "" {
+		return ""
+	}
+	token, err := keyManager.Parse(tokenString)
+	if err != nil || !token.Valid {
+		return ""
+	}
+	claims, _ := token.Claims.(jwt.MapClaims)
+	_, family, _ := tokenIDs(claims)
+	return family
+}
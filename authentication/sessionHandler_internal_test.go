@@ -0,0 +1,151 @@
+package authentication
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"sfr-backend/lockout"
+	"sfr-backend/models"
+	"sfr-backend/password"
+	"sfr-backend/revocation"
+	"sfr-backend/session"
+	"sfr-backend/user"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// loginFrom - logs jdoe in from browser with userAgent, returns its tokens
+func loginFrom(t *testing.T, userAgent string) models.UserDetailsDto {
+	req := httptest.NewRequest("POST", "/login", strings.NewReader(`{"username": "jdoe", "password": "password"}`))
+	req.Header.Set("User-Agent", userAgent)
+	rr := httptest.NewRecorder()
+	LoginHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var userDto models.UserDetailsDto
+	json.NewDecoder(rr.Body).Decode(&userDto)
+	return userDto
+}
+
+// listSessionsWith - lists sessions of jdoe with access token
+func listSessionsWith(accessToken string) []SessionResponse {
+	req := httptest.NewRequest("GET", "/me/sessions", nil)
+	req.Header.Set("Authorization", accessToken)
+	rr := httptest.NewRecorder()
+	CheckAuthentication(ListSessionsHandler).ServeHTTP(rr, req)
+	sessions := []SessionResponse{}
+	json.NewDecoder(rr.Body).Decode(&sessions)
+	return sessions
+}
+
+func TestSessions(t *testing.T) {
+	passwordUsers(user.UserDetails{Username: "jdoe", Password: hashed("password")})
+	lockout.SetStore(lockout.NewMemoryStore())
+	defer lockout.SetStore(lockout.NewMemoryStore())
+	lockout.SetConfig(lockout.Config{})
+	defer lockout.SetConfig(lockout.DefaultConfig)
+	revocation.SetStore(revocation.NewMemoryStore())
+	session.SetStore(session.NewMemoryStore())
+
+	laptop := loginFrom(t, "laptop")
+	phone := loginFrom(t, "phone")
+	sessions := listSessionsWith(laptop.AccessToken)
+	assert.Len(t, sessions, 2)
+	current := map[string]bool{}
+	for _, listed := range sessions {
+		current[listed.UserAgent] = listed.Current
+	}
+	assert.Equal(t, map[string]bool{"laptop": true, "phone": false}, current)
+
+	// refresh records last use from new client
+	req := httptest.NewRequest("POST", "/refreshtoken", strings.NewReader(`{"RefreshToken": "`+phone.RefreshToken+`"}`))
+	req.Header.Set("User-Agent", "phone/2")
+	rr := httptest.NewRecorder()
+	RefreshTokenCheck(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var phoneTokens models.ResponseObject
+	json.NewDecoder(rr.Body).Decode(&phoneTokens)
+	sessions = listSessionsWith(laptop.AccessToken)
+	assert.Equal(t, "phone/2", sessions[0].UserAgent)
+
+	revoke := func(id string) int {
+		req := httptest.NewRequest("DELETE", "/me/sessions/"+id, nil)
+		rr := httptest.NewRecorder()
+		RevokeSessionHandler(rr, mux.SetURLVars(asUser(req, "jdoe"), map[string]string{"id": id}))
+		return rr.Code
+	}
+	assert.Equal(t, http.StatusNotFound, revoke("unknown"))
+	assert.Equal(t, http.StatusOK, revoke(sessions[0].ID))
+	assert.Equal(t, http.StatusUnauthorized, refresh(phoneTokens.RefreshToken).Code)
+	req = httptest.NewRequest("GET", "/me/sessions", nil)
+	req.Header.Set("Authorization", phoneTokens.AccessToken)
+	rr = httptest.NewRecorder()
+	CheckAuthentication(ListSessionsHandler).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Len(t, listSessionsWith(laptop.AccessToken), 1)
+}
+
+func TestRevokeUserSessionsHandler(t *testing.T) {
+	passwordUsers(user.UserDetails{Username: "jdoe", Password: hashed("password")})
+	lockout.SetStore(lockout.NewMemoryStore())
+	defer lockout.SetStore(lockout.NewMemoryStore())
+	lockout.SetConfig(lockout.Config{})
+	defer lockout.SetConfig(lockout.DefaultConfig)
+	revocation.SetStore(revocation.NewMemoryStore())
+	session.SetStore(session.NewMemoryStore())
+	laptop := loginFrom(t, "laptop")
+	phone := loginFrom(t, "phone")
+
+	rr := httptest.NewRecorder()
+	ListUserSessionsHandler(rr, adminRequest("GET", "/users/jdoe/sessions", "jdoe", ""))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "laptop")
+	rr = httptest.NewRecorder()
+	RevokeUserSessionsHandler(rr, adminRequest("DELETE", "/users/jdoe/sessions", "jdoe", ""))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var revoked RevokedSessionsResponse
+	json.NewDecoder(rr.Body).Decode(&revoked)
+	assert.Equal(t, 2, revoked.Revoked)
+
+	for _, tokens := range []models.UserDetailsDto{laptop, phone} {
+		assert.Equal(t, http.StatusUnauthorized, refresh(tokens.RefreshToken).Code)
+		assert.Empty(t, listSessionsWith(tokens.AccessToken))
+	}
+}
+
+func TestPasswordChangeRevokesSessions(t *testing.T) {
+	passwordUsers(user.UserDetails{Username: "jdoe", Password: hashed("password")})
+	lockout.SetStore(lockout.NewMemoryStore())
+	defer lockout.SetStore(lockout.NewMemoryStore())
+	lockout.SetConfig(lockout.Config{})
+	defer lockout.SetConfig(lockout.DefaultConfig)
+	revocation.SetStore(revocation.NewMemoryStore())
+	session.SetStore(session.NewMemoryStore())
+	password.SetStore(password.NewMemoryStore())
+	laptop := loginFrom(t, "laptop")
+	phone := loginFrom(t, "phone")
+
+	// change keeps session of the caller only
+	req := httptest.NewRequest("POST", "/me/password", strings.NewReader(`{"currentPassword": "password", "newPassword": "new-password"}`))
+	req.Header.Set("Authorization", laptop.AccessToken)
+	rr := httptest.NewRecorder()
+	CheckAuthentication(ChangePasswordHandler).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, http.StatusUnauthorized, refresh(phone.RefreshToken).Code)
+	sessions := listSessionsWith(laptop.AccessToken)
+	assert.Len(t, sessions, 1)
+	assert.True(t, sessions[0].Current)
+
+	// reset signs out everywhere
+	token, _, err := password.IssueResetToken(context.Background(), "jdoe", "jdoe")
+	assert.Nil(t, err)
+	rr = httptest.NewRecorder()
+	ResetPasswordHandler(rr, httptest.NewRequest("POST", "/password-reset/confirm", strings.NewReader(`{"token": "`+token+`", "newPassword": "other-password"}`)))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, http.StatusUnauthorized, refresh(laptop.RefreshToken).Code)
+	assert.Empty(t, listSessionsWith(laptop.AccessToken))
+}
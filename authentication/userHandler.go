@@ -0,0 +1,229 @@
+package authentication
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"sfr-backend/audit"
+	"sfr-backend/database"
+	"sfr-backend/logging"
+	"sfr-backend/rbac"
+	"sfr-backend/response"
+	"sfr-backend/user"
+)
+
+// defaultUsersLimit - users on one page by default
+const defaultUsersLimit = 50
+
+// maxUsersLimit - upper bound for limit param
+const maxUsersLimit = 100
+
+var listUsersFunction = database.ListUsers
+var updateUserFunction = database.UpdateUser
+var deleteUserFunction = database.DeleteUser
+
+// UserResponse - user as shown to admins, password hash and MFA secret are never returned
+type UserResponse struct {
+	Username  string `json:"username"`
+	Firstname string `json:"firstname"`
+	Lastname  string `json:"lastname"`
+	Email     string `json:"email"`
+	// EmailVerified - user accepted invite sent to email
+	EmailVerified bool         `json:"emailVerified"`
+	Grants        []rbac.Grant `json:"grants"`
+	GroupGrants   []rbac.Grant `json:"groupGrants"`
+	Disabled      bool         `json:"disabled"`
+	MFAEnabled    bool         `json:"mfaEnabled"`
+	// SingleSignOn - user was provisioned by identity provider and has no password
+	SingleSignOn bool `json:"singleSignOn"`
+}
+
+// UsersResponse - page of users, nextToken is sent as query param to get next page
+type UsersResponse struct {
+	Users     []UserResponse `json:"users"`
+	NextToken string         `json:"nextToken,omitempty"`
+}
+
+// UpdateUserRequest - body of PATCH /users/{username}, omitted fields are kept
+type UpdateUserRequest struct {
+	Firstname *string `json:"firstname"`
+	Lastname  *string `json:"lastname"`
+	Email     *string `json:"email"`
+}
+
+// newUserResponse - returns user without secrets
+func newUserResponse(userDetails user.UserDetails) UserResponse {
+	return UserResponse{
+		Username:      userDetails.Username,
+		Firstname:     userDetails.Firstname,
+		Lastname:      userDetails.Lastname,
+		Email:         userDetails.Email,
+		EmailVerified: userDetails.EmailVerified,
+		Grants:        append([]rbac.Grant{}, userDetails.Grants...),
+		GroupGrants:   append([]rbac.Grant{}, userDetails.GroupGrants...),
+		Disabled:      userDetails.Disabled,
+		MFAEnabled:    userDetails.MFAEnabled(),
+		SingleSignOn:  userDetails.Password == user.DisabledPassword,
+	}
+}
+
+// ListUsersHandler - returns page of users, limit and nextToken query params select the page
+func ListUsersHandler(w http.ResponseWriter, r *http.Request) {
+	urlParams := r.URL.Query()
+	limit := defaultUsersLimit
+	if len(urlParams.Get("limit")) > 0 {
+		parsedLimit, err := strconv.Atoi(urlParams.Get("limit"))
+		if err == nil && parsedLimit > 0 {
+			limit = parsedLimit
+		}
+	}
+	if limit > maxUsersLimit {
+		limit = maxUsersLimit
+	}
+	users, nextToken, err := listUsersFunction(r.Context(), int64(limit), urlParams.Get("nextToken"))
+	if err != nil {
+		logging.FromRequest(r).Error("Unable to list users: ", err)
+		http.Error(w, "Unable to list users", http.StatusInternalServerError)
+		return
+	}
+	page := UsersResponse{Users: []UserResponse{}, NextToken: nextToken}
+	for _, userDetails := range users {
+		page.Users = append(page.Users, newUserResponse(userDetails))
+	}
+	response.WriteResponse(w, page)
+}
+
+// GetUserHandler - returns user in path
+func GetUserHandler(w http.ResponseWriter, r *http.Request) {
+	userDetails := getUserDetailsFunction(r.Context(), mux.Vars(r)["username"])
+	if userDetails.Username == "" {
+		http.Error(w, user.ErrNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	response.WriteResponse(w, newUserResponse(userDetails))
+}
+
+// UpdateUserHandler - changes profile of user in path
+func UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
+	var request UpdateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.Firstname == nil && request.Lastname == nil && request.Email == nil {
+		http.Error(w, "Nothing to update", http.StatusBadRequest)
+		return
+	}
+	update := user.Update{Firstname: request.Firstname, Lastname: request.Lastname, Email: request.Email}
+	if request.Email != nil {
+		// new address wasn't proven by invite
+		verified := false
+		update.EmailVerified = &verified
+	}
+	updateUser(w, r, audit.ActionUpdateUser, update)
+}
+
+// SetGrantsHandler - replaces grants of user in path managed by admins, body is JSON list of grants,
+// empty list leaves user only with RBAC_DEFAULT_ROLE, no access when it is not set
+func SetGrantsHandler(w http.ResponseWriter, r *http.Request) {
+	grants := []rbac.Grant{}
+	if err := json.NewDecoder(r.Body).Decode(&grants); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateGrants(grants); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	updateUser(w, r, audit.ActionSetGrants, user.Update{Grants: &grants})
+}
+
+// DisableUserHandler - stops user in path from logging in and refreshing tokens and revokes its sessions
+func DisableUserHandler(w http.ResponseWriter, r *http.Request) {
+	if mux.Vars(r)["username"] == user.UsernameFromContext(r.Context()) {
+		http.Error(w, "Admins can't disable their own account", http.StatusConflict)
+		return
+	}
+	disabled := true
+	updated, ok := applyUpdate(w, r, audit.ActionDisableUser, user.Update{Disabled: &disabled})
+	if !ok {
+		return
+	}
+	// refresh is already refused, revoking sessions stops access tokens before they expire
+	if _, err := revokeAllSessions(r.Context(), updated.Username); err != nil {
+		logging.FromRequest(r).Error("Unable to revoke sessions of disabled user: ", err)
+		http.Error(w, "User was disabled, but its sessions could not be revoked", http.StatusInternalServerError)
+		return
+	}
+	response.WriteResponse(w, newUserResponse(updated))
+}
+
+// EnableUserHandler - lets disabled user in path log in again
+func EnableUserHandler(w http.ResponseWriter, r *http.Request) {
+	disabled := false
+	updateUser(w, r, audit.ActionEnableUser, user.Update{Disabled: &disabled})
+}
+
+// DeleteUserHandler - deletes user in path and revokes its sessions
+func DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+	if username == user.UsernameFromContext(r.Context()) {
+		http.Error(w, "Admins can't delete their own account", http.StatusConflict)
+		return
+	}
+	err := deleteUserFunction(r.Context(), username)
+	audit.Record(r, audit.Event{Action: audit.ActionDeleteUser, Target: username, Outcome: audit.Outcome(err)})
+	if errors.Is(err, user.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logging.FromRequest(r).Error("Unable to delete user: ", err)
+		http.Error(w, "Unable to delete user", http.StatusInternalServerError)
+		return
+	}
+	if _, err := revokeAllSessions(r.Context(), username); err != nil {
+		logging.FromRequest(r).Error("Unable to revoke sessions of deleted user: ", err)
+		http.Error(w, "User was deleted, but its sessions could not be revoked", http.StatusInternalServerError)
+		return
+	}
+	response.WriteResponse(w, "User "+username+" was deleted")
+}
+
+// validateGrants - checks all roles are known
+func validateGrants(grants []rbac.Grant) error {
+	for _, grant := range grants {
+		if !rbac.ValidRole(grant.Role) {
+			return errors.New("unknown role " + strconv.Quote(grant.Role))
+		}
+	}
+	return nil
+}
+
+// updateUser - applies update to existing user in path and responds with updated user
+func updateUser(w http.ResponseWriter, r *http.Request, action string, update user.Update) {
+	if updated, ok := applyUpdate(w, r, action, update); ok {
+		response.WriteResponse(w, newUserResponse(updated))
+	}
+}
+
+// applyUpdate - applies update to existing user in path, responds only with error
+func applyUpdate(w http.ResponseWriter, r *http.Request, action string, update user.Update) (user.UserDetails, bool) {
+	username := mux.Vars(r)["username"]
+	updated, err := updateUserFunction(r.Context(), username, update)
+	audit.Record(r, audit.Event{Action: action, Target: username, Outcome: audit.Outcome(err)})
+	if errors.Is(err, user.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return updated, false
+	}
+	if err != nil {
+		logging.FromRequest(r).Error("Unable to update user: ", err)
+		http.Error(w, "Unable to update user", http.StatusInternalServerError)
+		return updated, false
+	}
+	return updated, true
+}
@@ -0,0 +1,124 @@
+package authentication
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"sfr-backend/lockout"
+	"sfr-backend/models"
+	"sfr-backend/rbac"
+	"sfr-backend/revocation"
+	"sfr-backend/user"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// adminRequest - request of admin on route with username in path
+func adminRequest(method string, target string, username string, body string) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	return mux.SetURLVars(asUser(req, "admin"), map[string]string{"username": username})
+}
+
+func TestListUsersHandler(t *testing.T) {
+	var requestedLimit int64
+	var requestedToken string
+	listUsersFunction = func(ctx context.Context, limit int64, nextToken string) ([]user.UserDetails, string, error) {
+		requestedLimit, requestedToken = limit, nextToken
+		return []user.UserDetails{{Username: "jdoe", Password: "hash"}}, "jdoe", nil
+	}
+
+	rr := httptest.NewRecorder()
+	ListUsersHandler(rr, httptest.NewRequest("GET", "/users?limit=500&nextToken=alice", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, int64(maxUsersLimit), requestedLimit)
+	assert.Equal(t, "alice", requestedToken)
+	assert.NotContains(t, rr.Body.String(), "hash")
+	var page UsersResponse
+	json.NewDecoder(rr.Body).Decode(&page)
+	assert.Equal(t, "jdoe", page.NextToken)
+	assert.Equal(t, []UserResponse{{Username: "jdoe", Grants: []rbac.Grant{}, GroupGrants: []rbac.Grant{}}}, page.Users)
+}
+
+func TestUpdateUserHandlers(t *testing.T) {
+	stored := passwordUsers(user.UserDetails{Username: "jdoe", Password: hashed("password"), Firstname: "John", Email: "jdoe@example.com"})
+	testTable := []struct {
+		handler        func(http.ResponseWriter, *http.Request)
+		method         string
+		username       string
+		body           string
+		expectedStatus int
+	}{
+		{GetUserHandler, "GET", "jdoe", "", http.StatusOK},
+		{GetUserHandler, "GET", "nobody", "", http.StatusNotFound},
+		{UpdateUserHandler, "PATCH", "jdoe", `{"lastname": "Doe"}`, http.StatusOK},
+		{UpdateUserHandler, "PATCH", "jdoe", `{}`, http.StatusBadRequest},
+		{UpdateUserHandler, "PATCH", "nobody", `{"lastname": "Doe"}`, http.StatusNotFound},
+		{SetGrantsHandler, "PUT", "jdoe", `[{"role": "superuser"}]`, http.StatusBadRequest},
+		{SetGrantsHandler, "PUT", "jdoe", `[{"role": "operator", "region": "us-east-1", "requireMfa": true}]`, http.StatusOK},
+		{DisableUserHandler, "POST", "admin", "", http.StatusConflict},
+		{DeleteUserHandler, "DELETE", "admin", "", http.StatusConflict},
+	}
+
+	for _, testCase := range testTable {
+		rr := httptest.NewRecorder()
+		testCase.handler(rr, adminRequest(testCase.method, "/users/"+testCase.username, testCase.username, testCase.body))
+		assert.Equal(t, testCase.expectedStatus, rr.Code, testCase)
+		assert.NotContains(t, rr.Body.String(), "$2a$")
+	}
+	assert.Equal(t, "John", stored["jdoe"].Firstname)
+	assert.Equal(t, "Doe", stored["jdoe"].Lastname)
+	assert.Equal(t, []rbac.Grant{{Role: rbac.RoleOperator, Region: "us-east-1", RequireMFA: true}}, stored["jdoe"].Grants)
+}
+
+func TestDisableUser(t *testing.T) {
+	stored := passwordUsers(user.UserDetails{Username: "jdoe", Password: hashed("password")})
+	lockout.SetStore(lockout.NewMemoryStore())
+	defer lockout.SetStore(lockout.NewMemoryStore())
+	lockout.SetConfig(lockout.Config{})
+	defer lockout.SetConfig(lockout.DefaultConfig)
+	revocation.SetStore(revocation.NewMemoryStore())
+	login := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		LoginHandler(rr, httptest.NewRequest("POST", "/login", strings.NewReader(`{"username": "jdoe", "password": "password"}`)))
+		return rr
+	}
+	rr := login()
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var userDto models.UserDetailsDto
+	json.NewDecoder(rr.Body).Decode(&userDto)
+
+	rr = httptest.NewRecorder()
+	DisableUserHandler(rr, adminRequest("POST", "/users/jdoe/disable", "jdoe", ""))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.True(t, stored["jdoe"].Disabled)
+	assert.Equal(t, http.StatusForbidden, login().Code)
+	assert.Equal(t, http.StatusUnauthorized, refresh(userDto.RefreshToken).Code)
+	assert.Empty(t, listSessionsWith(userDto.AccessToken))
+
+	rr = httptest.NewRecorder()
+	EnableUserHandler(rr, adminRequest("POST", "/users/jdoe/enable", "jdoe", ""))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, http.StatusOK, login().Code)
+
+	rr = httptest.NewRecorder()
+	DeleteUserHandler(rr, adminRequest("DELETE", "/users/jdoe", "jdoe", ""))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	rr = httptest.NewRecorder()
+	DeleteUserHandler(rr, adminRequest("DELETE", "/users/jdoe", "jdoe", ""))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestCreateUserConflict(t *testing.T) {
+	passwordUsers(user.UserDetails{Username: "jdoe", Password: hashed("password")})
+
+	rr := httptest.NewRecorder()
+	CreateUser(rr, httptest.NewRequest("POST", "/createuser", strings.NewReader(`{"username": "jdoe", "password": "new-password"}`)))
+
+	assert.Equal(t, http.StatusConflict, rr.Code)
+}
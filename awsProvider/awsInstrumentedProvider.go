@@ -0,0 +1,143 @@
+package awsprovider
+
+import (
+	"time"
+
+	"sfr-backend/metrics"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/sfn"
+)
+
+// service labels of instrumented clients
+const (
+	serviceStepFunctions = "states"
+	serviceDynamoDB      = "dynamodb"
+)
+
+// InstrumentedStepFunctionsProvider - decorates provider so every step functions call is counted and timed
+type InstrumentedStepFunctionsProvider struct {
+	provider AwsStepFunctionsProvider
+}
+
+// NewInstrumentedStepFunctionsProvider - creates instrumenting decorator around provider
+func NewInstrumentedStepFunctionsProvider(provider AwsStepFunctionsProvider) *InstrumentedStepFunctionsProvider {
+	return &InstrumentedStepFunctionsProvider{provider: provider}
+}
+
+// New - creates client of decorated provider labelled with region of session
+func (instrumentedProvider *InstrumentedStepFunctionsProvider) New(sess *session.Session) (AwsStepFunctionInterface, error) {
+	client, err := instrumentedProvider.provider.New(sess)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedStepFunctions{client: client, region: aws.StringValue(sess.Config.Region)}, nil
+}
+
+type instrumentedStepFunctions struct {
+	client AwsStepFunctionInterface
+	region string
+}
+
+func (instrumented *instrumentedStepFunctions) ListExecutions(input *sfn.ListExecutionsInput) (*sfn.ListExecutionsOutput, error) {
+	started := time.Now()
+	output, err := instrumented.client.ListExecutions(input)
+	metrics.ObserveAWSCall(serviceStepFunctions, "ListExecutions", instrumented.region, started, err)
+	return output, err
+}
+
+func (instrumented *instrumentedStepFunctions) ListStateMachines(input *sfn.ListStateMachinesInput) (*sfn.ListStateMachinesOutput, error) {
+	started := time.Now()
+	output, err := instrumented.client.ListStateMachines(input)
+	metrics.ObserveAWSCall(serviceStepFunctions, "ListStateMachines", instrumented.region, started, err)
+	return output, err
+}
+
+func (instrumented *instrumentedStepFunctions) DescribeExecution(input *sfn.DescribeExecutionInput) (*sfn.DescribeExecutionOutput, error) {
+	started := time.Now()
+	output, err := instrumented.client.DescribeExecution(input)
+	metrics.ObserveAWSCall(serviceStepFunctions, "DescribeExecution", instrumented.region, started, err)
+	return output, err
+}
+
+func (instrumented *instrumentedStepFunctions) StartExecution(input *sfn.StartExecutionInput) (*sfn.StartExecutionOutput, error) {
+	started := time.Now()
+	output, err := instrumented.client.StartExecution(input)
+	metrics.ObserveAWSCall(serviceStepFunctions, "StartExecution", instrumented.region, started, err)
+	return output, err
+}
+
+func (instrumented *instrumentedStepFunctions) GetExecutionHistory(input *sfn.GetExecutionHistoryInput) (*sfn.GetExecutionHistoryOutput, error) {
+	started := time.Now()
+	output, err := instrumented.client.GetExecutionHistory(input)
+	metrics.ObserveAWSCall(serviceStepFunctions, "GetExecutionHistory", instrumented.region, started, err)
+	return output, err
+}
+
+// InstrumentedDatabaseProvider - decorates provider so every DynamoDB call is counted and timed
+type InstrumentedDatabaseProvider struct {
+	provider AwsDatabaseProvider
+}
+
+// NewInstrumentedDatabaseProvider - creates instrumenting decorator around provider
+func NewInstrumentedDatabaseProvider(provider AwsDatabaseProvider) *InstrumentedDatabaseProvider {
+	return &InstrumentedDatabaseProvider{provider: provider}
+}
+
+// New - creates client of decorated provider labelled with region of session
+func (instrumentedProvider *InstrumentedDatabaseProvider) New(sess *session.Session) (AwsDatabaseInterface, error) {
+	client, err := instrumentedProvider.provider.New(sess)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedDatabase{client: client, region: aws.StringValue(sess.Config.Region)}, nil
+}
+
+type instrumentedDatabase struct {
+	client AwsDatabaseInterface
+	region string
+}
+
+func (instrumented *instrumentedDatabase) GetItem(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+	started := time.Now()
+	output, err := instrumented.client.GetItem(input)
+	metrics.ObserveAWSCall(serviceDynamoDB, "GetItem", instrumented.region, started, err)
+	return output, err
+}
+
+func (instrumented *instrumentedDatabase) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+	started := time.Now()
+	output, err := instrumented.client.PutItem(input)
+	metrics.ObserveAWSCall(serviceDynamoDB, "PutItem", instrumented.region, started, err)
+	return output, err
+}
+
+func (instrumented *instrumentedDatabase) Query(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+	started := time.Now()
+	output, err := instrumented.client.Query(input)
+	metrics.ObserveAWSCall(serviceDynamoDB, "Query", instrumented.region, started, err)
+	return output, err
+}
+
+func (instrumented *instrumentedDatabase) Scan(input *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+	started := time.Now()
+	output, err := instrumented.client.Scan(input)
+	metrics.ObserveAWSCall(serviceDynamoDB, "Scan", instrumented.region, started, err)
+	return output, err
+}
+
+func (instrumented *instrumentedDatabase) UpdateItem(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+	started := time.Now()
+	output, err := instrumented.client.UpdateItem(input)
+	metrics.ObserveAWSCall(serviceDynamoDB, "UpdateItem", instrumented.region, started, err)
+	return output, err
+}
+
+func (instrumented *instrumentedDatabase) DeleteItem(input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+	started := time.Now()
+	output, err := instrumented.client.DeleteItem(input)
+	metrics.ObserveAWSCall(serviceDynamoDB, "DeleteItem", instrumented.region, started, err)
+	return output, err
+}
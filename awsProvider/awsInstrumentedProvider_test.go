@@ -0,0 +1,64 @@
+package awsprovider_test
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+
+	awsprovider "sfr-backend/awsProvider"
+	"sfr-backend/metrics"
+	"sfr-backend/mocks"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/sfn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func scrapeMetrics() string {
+	rr := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := ioutil.ReadAll(rr.Body)
+	return string(body)
+}
+
+func TestInstrumentedStepFunctions(t *testing.T) {
+	mockStepFunction := &mocks.AwsStepFunctionInterface{}
+	mockAwsProvider := &mocks.AwsStepFunctionsProvider{}
+	mockAwsProvider.On("New", mock.Anything).Return(mockStepFunction, nil)
+	output := &sfn.StartExecutionOutput{ExecutionArn: aws.String("arn")}
+	mockStepFunction.On("StartExecution", mock.Anything).Return(output, nil).Once()
+	mockStepFunction.On("StartExecution", mock.Anything).Return(nil, awserr.New(sfn.ErrCodeExecutionAlreadyExists, "exists", nil)).Once()
+	sess, _ := session.NewSession(&aws.Config{Region: aws.String("eu-north-1")})
+	client, err := awsprovider.NewInstrumentedStepFunctionsProvider(mockAwsProvider).New(sess)
+	assert.Nil(t, err)
+
+	started, err := client.StartExecution(&sfn.StartExecutionInput{})
+	assert.Nil(t, err)
+	assert.Equal(t, output, started)
+	_, err = client.StartExecution(&sfn.StartExecutionInput{})
+	assert.NotNil(t, err)
+
+	body := scrapeMetrics()
+	assert.Contains(t, body, `sfr_aws_calls_total{operation="StartExecution",region="eu-north-1",service="states"} 2`)
+	assert.Contains(t, body, `sfr_aws_call_errors_total{code="ExecutionAlreadyExists",operation="StartExecution",region="eu-north-1",service="states"} 1`)
+}
+
+func TestInstrumentedDatabase(t *testing.T) {
+	mockDatabase := &mocks.AwsDatabaseInterface{}
+	mockDatabaseProvider := &mocks.AwsDatabaseProvider{}
+	mockDatabaseProvider.On("New", mock.Anything).Return(mockDatabase, nil)
+	mockDatabase.On("Query", mock.Anything).Return(&dynamodb.QueryOutput{}, nil)
+	sess, _ := session.NewSession(&aws.Config{Region: aws.String("eu-north-1")})
+	client, err := awsprovider.NewInstrumentedDatabaseProvider(mockDatabaseProvider).New(sess)
+	assert.Nil(t, err)
+
+	_, err = client.Query(&dynamodb.QueryInput{})
+
+	assert.Nil(t, err)
+	assert.Contains(t, scrapeMetrics(), `sfr_aws_calls_total{operation="Query",region="eu-north-1",service="dynamodb"} 1`)
+	mockDatabase.AssertNumberOfCalls(t, "Query", 1)
+}
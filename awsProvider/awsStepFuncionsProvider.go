@@ -13,6 +13,7 @@ type AwsStepFunctionInterface interface {
 	ListStateMachines(input *sfn.ListStateMachinesInput) (*sfn.ListStateMachinesOutput, error)
 	DescribeExecution(input *sfn.DescribeExecutionInput) (*sfn.DescribeExecutionOutput, error)
 	StartExecution(input *sfn.StartExecutionInput) (*sfn.StartExecutionOutput, error)
+	GetExecutionHistory(input *sfn.GetExecutionHistoryInput) (*sfn.GetExecutionHistoryOutput, error)
 }
 
 //AwsStepFunctionsProvider - provider for step function interface
@@ -0,0 +1,343 @@
+package awsprovider
+
+import (
+	"container/list"
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sfn"
+)
+
+// cached operation names used in keys and statistics
+const (
+	opListStateMachines   = "ListStateMachines"
+	opListExecutions      = "ListExecutions"
+	opDescribeExecution   = "DescribeExecution"
+	opGetExecutionHistory = "GetExecutionHistory"
+)
+
+// terminalHistoryEvents - events after which execution history doesn't change anymore
+var terminalHistoryEvents = map[string]bool{
+	sfn.HistoryEventTypeExecutionSucceeded: true,
+	sfn.HistoryEventTypeExecutionFailed:    true,
+	sfn.HistoryEventTypeExecutionTimedOut:  true,
+	sfn.HistoryEventTypeExecutionAborted:   true,
+}
+
+// CacheBypasser - implemented by step function clients able to skip cached reads
+type CacheBypasser interface {
+	WithoutCache() AwsStepFunctionInterface
+}
+
+// StepFunctionsCacheConfig - per operation TTLs and size of step functions cache,
+// zero TTL disables caching of operation, zero MaxBytes bounds cache by entry count only
+type StepFunctionsCacheConfig struct {
+	MaxEntries           int
+	MaxBytes             int
+	ListStateMachinesTTL time.Duration
+	ListExecutionsTTL    time.Duration
+	RunningExecutionTTL  time.Duration
+}
+
+// CacheStats - cache counters of single operation
+type CacheStats struct {
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Bypasses  int64 `json:"bypasses"`
+	Evictions int64 `json:"evictions"`
+	Oversized int64 `json:"oversized"`
+}
+
+// StepFunctionsCacheConfigFromEnv - reads cache configuration from STEP_FUNCTIONS_CACHE_* variables
+func StepFunctionsCacheConfigFromEnv() StepFunctionsCacheConfig {
+	return StepFunctionsCacheConfig{
+		MaxEntries:           intFromEnv("STEP_FUNCTIONS_CACHE_MAX_ENTRIES", 5000),
+		MaxBytes:             intFromEnv("STEP_FUNCTIONS_CACHE_MAX_BYTES", 64<<20),
+		ListStateMachinesTTL: time.Second * time.Duration(intFromEnv("STEP_FUNCTIONS_CACHE_LIST_MACHINES_TTL", 30)),
+		ListExecutionsTTL:    time.Second * time.Duration(intFromEnv("STEP_FUNCTIONS_CACHE_LIST_EXECUTIONS_TTL", 5)),
+		RunningExecutionTTL:  time.Second * time.Duration(intFromEnv("STEP_FUNCTIONS_CACHE_RUNNING_TTL", 2)),
+	}
+}
+
+// CachingStepFunctionsProvider - decorates provider with cache shared by all sessions
+type CachingStepFunctionsProvider struct {
+	provider AwsStepFunctionsProvider
+	config   StepFunctionsCacheConfig
+	cache    *lruCache
+}
+
+// NewCachingStepFunctionsProvider - creates caching decorator around provider
+func NewCachingStepFunctionsProvider(provider AwsStepFunctionsProvider, config StepFunctionsCacheConfig) *CachingStepFunctionsProvider {
+	return &CachingStepFunctionsProvider{
+		provider: provider,
+		config:   config,
+		cache:    newLRUCache(config.MaxEntries, config.MaxBytes),
+	}
+}
+
+// New - creates client of decorated provider wrapped with cache, entries are separated per region
+func (cachingProvider *CachingStepFunctionsProvider) New(sess *session.Session) (AwsStepFunctionInterface, error) {
+	client, err := cachingProvider.provider.New(sess)
+	if err != nil {
+		return nil, err
+	}
+	return &cachingStepFunctions{
+		client:   client,
+		provider: cachingProvider,
+		region:   aws.StringValue(sess.Config.Region),
+	}, nil
+}
+
+// Stats - returns cache counters per operation
+func (cachingProvider *CachingStepFunctionsProvider) Stats() map[string]CacheStats {
+	return cachingProvider.cache.stats()
+}
+
+// cachingStepFunctions - step functions client reading through cache
+type cachingStepFunctions struct {
+	client   AwsStepFunctionInterface
+	provider *CachingStepFunctionsProvider
+	region   string
+	bypass   bool
+}
+
+// WithoutCache - returns client which always calls AWS but still refreshes cached entries
+func (cached *cachingStepFunctions) WithoutCache() AwsStepFunctionInterface {
+	return &cachingStepFunctions{client: cached.client, provider: cached.provider, region: cached.region, bypass: true}
+}
+
+func (cached *cachingStepFunctions) ListStateMachines(input *sfn.ListStateMachinesInput) (*sfn.ListStateMachinesOutput, error) {
+	key := cached.key(opListStateMachines, "", input)
+	if value, ok := cached.lookup(opListStateMachines, key); ok {
+		return value.(*sfn.ListStateMachinesOutput), nil
+	}
+	output, err := cached.client.ListStateMachines(input)
+	if err == nil {
+		cached.store(opListStateMachines, key, output, cached.provider.config.ListStateMachinesTTL)
+	}
+	return output, err
+}
+
+func (cached *cachingStepFunctions) ListExecutions(input *sfn.ListExecutionsInput) (*sfn.ListExecutionsOutput, error) {
+	key := cached.key(opListExecutions, aws.StringValue(input.StateMachineArn), input)
+	if value, ok := cached.lookup(opListExecutions, key); ok {
+		return value.(*sfn.ListExecutionsOutput), nil
+	}
+	output, err := cached.client.ListExecutions(input)
+	if err == nil {
+		cached.store(opListExecutions, key, output, cached.provider.config.ListExecutionsTTL)
+	}
+	return output, err
+}
+
+func (cached *cachingStepFunctions) DescribeExecution(input *sfn.DescribeExecutionInput) (*sfn.DescribeExecutionOutput, error) {
+	key := cached.key(opDescribeExecution, "", input)
+	if value, ok := cached.lookup(opDescribeExecution, key); ok {
+		return value.(*sfn.DescribeExecutionOutput), nil
+	}
+	output, err := cached.client.DescribeExecution(input)
+	if err == nil {
+		ttl := cached.provider.config.RunningExecutionTTL
+		if aws.StringValue(output.Status) != sfn.ExecutionStatusRunning {
+			ttl = permanent
+		}
+		cached.store(opDescribeExecution, key, output, ttl)
+	}
+	return output, err
+}
+
+func (cached *cachingStepFunctions) GetExecutionHistory(input *sfn.GetExecutionHistoryInput) (*sfn.GetExecutionHistoryOutput, error) {
+	key := cached.key(opGetExecutionHistory, "", input)
+	if value, ok := cached.lookup(opGetExecutionHistory, key); ok {
+		return value.(*sfn.GetExecutionHistoryOutput), nil
+	}
+	output, err := cached.client.GetExecutionHistory(input)
+	if err == nil {
+		ttl := cached.provider.config.RunningExecutionTTL
+		for _, event := range output.Events {
+			if terminalHistoryEvents[aws.StringValue(event.Type)] {
+				ttl = permanent
+				break
+			}
+		}
+		cached.store(opGetExecutionHistory, key, output, ttl)
+	}
+	return output, err
+}
+
+// StartExecution - is never cached, drops cached execution lists of the machine so new execution is visible
+func (cached *cachingStepFunctions) StartExecution(input *sfn.StartExecutionInput) (*sfn.StartExecutionOutput, error) {
+	output, err := cached.client.StartExecution(input)
+	if err == nil {
+		cached.provider.cache.removeTag(cached.tag(opListExecutions, aws.StringValue(input.StateMachineArn)))
+	}
+	return output, err
+}
+
+func (cached *cachingStepFunctions) key(operation string, machine string, input interface{}) cacheKey {
+	encoded, _ := json.Marshal(input)
+	return cacheKey{tag: cached.tag(operation, machine), input: string(encoded)}
+}
+
+func (cached *cachingStepFunctions) tag(operation string, machine string) string {
+	return strings.Join([]string{cached.region, operation, machine}, "|")
+}
+
+func (cached *cachingStepFunctions) lookup(operation string, key cacheKey) (interface{}, bool) {
+	if cached.bypass {
+		cached.provider.cache.count(operation, func(stats *CacheStats) { stats.Bypasses++ })
+		return nil, false
+	}
+	return cached.provider.cache.get(operation, key)
+}
+
+func (cached *cachingStepFunctions) store(operation string, key cacheKey, value interface{}, ttl time.Duration) {
+	if ttl == 0 {
+		return
+	}
+	// size of encoded response approximates memory held by entry
+	encoded, _ := json.Marshal(value)
+	size := len(encoded) + len(key.tag) + len(key.input)
+	cached.provider.cache.set(operation, key, value, size, ttl)
+}
+
+// permanent - TTL of entries which never expire, they are only evicted when cache is full
+const permanent = time.Duration(-1)
+
+// cacheKey - tag groups entries for invalidation, input distinguishes requests
+type cacheKey struct {
+	tag   string
+	input string
+}
+
+type cacheEntry struct {
+	key       cacheKey
+	operation string
+	value     interface{}
+	size      int
+	expires   time.Time
+}
+
+// lruCache - cache bounded by entry count and approximate size in bytes evicting least recently used entries,
+// entries over a quarter of byte budget are not cached so single large history page can't flush the cache
+type lruCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	maxBytes   int
+	bytes      int
+	entries    map[cacheKey]*list.Element
+	order      *list.List
+	statistics map[string]*CacheStats
+	now        func() time.Time
+}
+
+func newLRUCache(maxEntries int, maxBytes int) *lruCache {
+	return &lruCache{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		entries:    map[cacheKey]*list.Element{},
+		order:      list.New(),
+		statistics: map[string]*CacheStats{},
+		now:        time.Now,
+	}
+}
+
+func (cache *lruCache) get(operation string, key cacheKey) (interface{}, bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	element, ok := cache.entries[key]
+	if ok {
+		entry := element.Value.(*cacheEntry)
+		if entry.expires.IsZero() || cache.now().Before(entry.expires) {
+			cache.order.MoveToFront(element)
+			cache.statsFor(operation).Hits++
+			return entry.value, true
+		}
+		cache.removeElement(element)
+	}
+	cache.statsFor(operation).Misses++
+	return nil, false
+}
+
+func (cache *lruCache) set(operation string, key cacheKey, value interface{}, size int, ttl time.Duration) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if cache.maxEntries <= 0 {
+		return
+	}
+	if element, ok := cache.entries[key]; ok {
+		cache.removeElement(element)
+	}
+	if cache.maxBytes > 0 && size > cache.maxBytes/4 {
+		cache.statsFor(operation).Oversized++
+		return
+	}
+	entry := &cacheEntry{key: key, operation: operation, value: value, size: size}
+	if ttl > 0 {
+		entry.expires = cache.now().Add(ttl)
+	}
+	cache.entries[key] = cache.order.PushFront(entry)
+	cache.bytes += size
+	for cache.order.Len() > cache.maxEntries || (cache.maxBytes > 0 && cache.bytes > cache.maxBytes) {
+		oldest := cache.order.Back()
+		cache.statsFor(oldest.Value.(*cacheEntry).operation).Evictions++
+		cache.removeElement(oldest)
+	}
+}
+
+// removeTag - removes all entries with given tag
+func (cache *lruCache) removeTag(tag string) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	for key, element := range cache.entries {
+		if key.tag == tag {
+			cache.removeElement(element)
+		}
+	}
+}
+
+func (cache *lruCache) removeElement(element *list.Element) {
+	cache.order.Remove(element)
+	cache.bytes -= element.Value.(*cacheEntry).size
+	delete(cache.entries, element.Value.(*cacheEntry).key)
+}
+
+func (cache *lruCache) count(operation string, update func(stats *CacheStats)) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	update(cache.statsFor(operation))
+}
+
+// statsFor - has to be called with lock held
+func (cache *lruCache) statsFor(operation string) *CacheStats {
+	stats, ok := cache.statistics[operation]
+	if !ok {
+		stats = &CacheStats{}
+		cache.statistics[operation] = stats
+	}
+	return stats
+}
+
+func (cache *lruCache) stats() map[string]CacheStats {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	copied := map[string]CacheStats{}
+	for operation, stats := range cache.statistics {
+		copied[operation] = *stats
+	}
+	return copied
+}
+
+func intFromEnv(name string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || value < 0 {
+		return defaultValue
+	}
+	return value
+}
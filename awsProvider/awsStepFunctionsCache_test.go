@@ -0,0 +1,179 @@
+package awsprovider_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	awsprovider "sfr-backend/awsProvider"
+	"sfr-backend/mocks"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sfn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+var testCacheConfig = awsprovider.StepFunctionsCacheConfig{
+	MaxEntries:           10,
+	ListStateMachinesTTL: time.Minute,
+	ListExecutionsTTL:    time.Minute,
+	RunningExecutionTTL:  0,
+}
+
+func newCachedClient(t *testing.T, config awsprovider.StepFunctionsCacheConfig, region string) (*awsprovider.CachingStepFunctionsProvider, *mocks.AwsStepFunctionInterface, awsprovider.AwsStepFunctionInterface) {
+	mockStepFunction := &mocks.AwsStepFunctionInterface{}
+	mockAwsProvider := &mocks.AwsStepFunctionsProvider{}
+	mockAwsProvider.On("New", mock.Anything).Return(mockStepFunction, nil)
+	cachingProvider := awsprovider.NewCachingStepFunctionsProvider(mockAwsProvider, config)
+	sess, _ := session.NewSession(&aws.Config{Region: aws.String(region)})
+	client, err := cachingProvider.New(sess)
+	assert.Nil(t, err)
+	return cachingProvider, mockStepFunction, client
+}
+
+func TestCacheListStateMachines(t *testing.T) {
+	cachingProvider, mockStepFunction, client := newCachedClient(t, testCacheConfig, "eu-west-1")
+	output := &sfn.ListStateMachinesOutput{StateMachines: []*sfn.StateMachineListItem{{Name: aws.String("machine")}}}
+	mockStepFunction.On("ListStateMachines", mock.Anything).Return(output, nil).Once()
+
+	first, _ := client.ListStateMachines(&sfn.ListStateMachinesInput{})
+	second, _ := client.ListStateMachines(&sfn.ListStateMachinesInput{})
+
+	assert.Equal(t, output, first)
+	assert.Equal(t, output, second)
+	mockStepFunction.AssertNumberOfCalls(t, "ListStateMachines", 1)
+	assert.Equal(t, awsprovider.CacheStats{Hits: 1, Misses: 1}, cachingProvider.Stats()["ListStateMachines"])
+}
+
+func TestCacheSeparatesRegions(t *testing.T) {
+	cachingProvider, mockStepFunction, client := newCachedClient(t, testCacheConfig, "eu-west-1")
+	mockStepFunction.On("ListStateMachines", mock.Anything).Return(&sfn.ListStateMachinesOutput{}, nil)
+	sess, _ := session.NewSession(&aws.Config{Region: aws.String("us-east-1")})
+	otherRegion, _ := cachingProvider.New(sess)
+
+	client.ListStateMachines(&sfn.ListStateMachinesInput{})
+	otherRegion.ListStateMachines(&sfn.ListStateMachinesInput{})
+
+	mockStepFunction.AssertNumberOfCalls(t, "ListStateMachines", 2)
+}
+
+func TestCacheDescribeExecutionOnlyWhenTerminal(t *testing.T) {
+	_, mockStepFunction, client := newCachedClient(t, testCacheConfig, "eu-west-1")
+	running := &sfn.DescribeExecutionInput{ExecutionArn: aws.String("running")}
+	finished := &sfn.DescribeExecutionInput{ExecutionArn: aws.String("finished")}
+	mockStepFunction.On("DescribeExecution", running).Return(&sfn.DescribeExecutionOutput{Status: aws.String(sfn.ExecutionStatusRunning)}, nil)
+	mockStepFunction.On("DescribeExecution", finished).Return(&sfn.DescribeExecutionOutput{Status: aws.String(sfn.ExecutionStatusSucceeded)}, nil)
+
+	for i := 0; i < 3; i++ {
+		client.DescribeExecution(running)
+		client.DescribeExecution(finished)
+	}
+
+	mockStepFunction.AssertCalled(t, "DescribeExecution", running)
+	mockStepFunction.AssertNumberOfCalls(t, "DescribeExecution", 4)
+}
+
+func TestCacheExecutionHistoryOnlyWhenTerminal(t *testing.T) {
+	_, mockStepFunction, client := newCachedClient(t, testCacheConfig, "eu-west-1")
+	input := &sfn.GetExecutionHistoryInput{ExecutionArn: aws.String("execution")}
+	mockStepFunction.On("GetExecutionHistory", input).Return(&sfn.GetExecutionHistoryOutput{Events: []*sfn.HistoryEvent{
+		{Type: aws.String(sfn.HistoryEventTypeExecutionStarted)},
+	}}, nil).Once()
+	mockStepFunction.On("GetExecutionHistory", input).Return(&sfn.GetExecutionHistoryOutput{Events: []*sfn.HistoryEvent{
+		{Type: aws.String(sfn.HistoryEventTypeExecutionStarted)},
+		{Type: aws.String(sfn.HistoryEventTypeExecutionFailed)},
+	}}, nil).Once()
+
+	client.GetExecutionHistory(input)
+	client.GetExecutionHistory(input)
+	output, _ := client.GetExecutionHistory(input)
+
+	assert.Len(t, output.Events, 2)
+	mockStepFunction.AssertNumberOfCalls(t, "GetExecutionHistory", 2)
+}
+
+func TestCacheBypass(t *testing.T) {
+	cachingProvider, mockStepFunction, client := newCachedClient(t, testCacheConfig, "eu-west-1")
+	mockStepFunction.On("ListStateMachines", mock.Anything).Return(&sfn.ListStateMachinesOutput{}, nil)
+
+	client.ListStateMachines(&sfn.ListStateMachinesInput{})
+	client.(awsprovider.CacheBypasser).WithoutCache().ListStateMachines(&sfn.ListStateMachinesInput{})
+	client.ListStateMachines(&sfn.ListStateMachinesInput{})
+
+	mockStepFunction.AssertNumberOfCalls(t, "ListStateMachines", 2)
+	assert.Equal(t, awsprovider.CacheStats{Hits: 1, Misses: 1, Bypasses: 1}, cachingProvider.Stats()["ListStateMachines"])
+}
+
+func TestCacheStartExecutionInvalidatesExecutions(t *testing.T) {
+	_, mockStepFunction, client := newCachedClient(t, testCacheConfig, "eu-west-1")
+	listInput := &sfn.ListExecutionsInput{StateMachineArn: aws.String("machine")}
+	mockStepFunction.On("ListExecutions", listInput).Return(&sfn.ListExecutionsOutput{}, nil)
+	mockStepFunction.On("StartExecution", mock.Anything).Return(&sfn.StartExecutionOutput{}, nil)
+
+	client.ListExecutions(listInput)
+	client.ListExecutions(listInput)
+	client.StartExecution(&sfn.StartExecutionInput{StateMachineArn: aws.String("machine")})
+	client.ListExecutions(listInput)
+
+	mockStepFunction.AssertNumberOfCalls(t, "ListExecutions", 2)
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	config := testCacheConfig
+	config.MaxEntries = 2
+	cachingProvider, mockStepFunction, client := newCachedClient(t, config, "eu-west-1")
+	mockStepFunction.On("ListExecutions", mock.Anything).Return(&sfn.ListExecutionsOutput{}, nil)
+	first := &sfn.ListExecutionsInput{StateMachineArn: aws.String("first")}
+	second := &sfn.ListExecutionsInput{StateMachineArn: aws.String("second")}
+	third := &sfn.ListExecutionsInput{StateMachineArn: aws.String("third")}
+
+	client.ListExecutions(first)
+	client.ListExecutions(second)
+	client.ListExecutions(first)
+	client.ListExecutions(third)
+	client.ListExecutions(first)
+	client.ListExecutions(second)
+
+	mockStepFunction.AssertNumberOfCalls(t, "ListExecutions", 4)
+	assert.Equal(t, int64(2), cachingProvider.Stats()["ListExecutions"].Evictions)
+}
+
+func TestCacheEvictsByByteBudget(t *testing.T) {
+	config := testCacheConfig
+	config.MaxBytes = 10000
+	cachingProvider, mockStepFunction, client := newCachedClient(t, config, "eu-west-1")
+	page := &sfn.GetExecutionHistoryOutput{Events: []*sfn.HistoryEvent{
+		{Type: aws.String(sfn.HistoryEventTypeExecutionSucceeded), ExecutionSucceededEventDetails: &sfn.ExecutionSucceededEventDetails{Output: aws.String(strings.Repeat("x", 700))}},
+	}}
+	mockStepFunction.On("GetExecutionHistory", mock.Anything).Return(page, nil)
+	history := func(execution string) {
+		client.GetExecutionHistory(&sfn.GetExecutionHistoryInput{ExecutionArn: aws.String(execution)})
+	}
+
+	// every page takes about 2 KB with its key, so fifth page evicts the first one although entry limit is 10
+	for _, execution := range []string{"first", "second", "third", "fourth", "fifth", "first"} {
+		history(execution)
+	}
+
+	mockStepFunction.AssertNumberOfCalls(t, "GetExecutionHistory", 6)
+	assert.Equal(t, int64(2), cachingProvider.Stats()["GetExecutionHistory"].Evictions)
+}
+
+func TestCacheSkipsOversizedEntries(t *testing.T) {
+	config := testCacheConfig
+	config.MaxBytes = 10000
+	cachingProvider, mockStepFunction, client := newCachedClient(t, config, "eu-west-1")
+	page := &sfn.GetExecutionHistoryOutput{Events: []*sfn.HistoryEvent{
+		{Type: aws.String(sfn.HistoryEventTypeExecutionSucceeded), ExecutionSucceededEventDetails: &sfn.ExecutionSucceededEventDetails{Output: aws.String(strings.Repeat("x", 2000))}},
+	}}
+	mockStepFunction.On("GetExecutionHistory", mock.Anything).Return(page, nil)
+	input := &sfn.GetExecutionHistoryInput{ExecutionArn: aws.String("large")}
+
+	client.GetExecutionHistory(input)
+	client.GetExecutionHistory(input)
+
+	mockStepFunction.AssertNumberOfCalls(t, "GetExecutionHistory", 2)
+	assert.Equal(t, int64(2), cachingProvider.Stats()["GetExecutionHistory"].Oversized)
+}
@@ -1,13 +1,16 @@
 package awssession
 
 import (
+	"context"
 	"net/http"
+	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 
 	awsprovider "sfr-backend/awsProvider"
 	"sfr-backend/region"
+	"sfr-backend/tracing"
 )
 
 // CreateStepFunctionSession - creates session for executiong stepfunctions calls
@@ -15,7 +18,24 @@ func CreateStepFunctionSession(w http.ResponseWriter, r *http.Request, awsInterf
 	//Setting some default region for convience
 	region := region.GetDefaultRegion(r)
 
-	// an example API handler
+	client, err := createStepFunctionSession(r.Context(), region, awsInterface)
+	if err != nil {
+		return nil, err
+	}
+	// Cached clients are skipped when caller explicitly asks for fresh data
+	if bypasser, ok := client.(awsprovider.CacheBypasser); ok && strings.Contains(r.Header.Get("Cache-Control"), "no-cache") {
+		return bypasser.WithoutCache(), nil
+	}
+	return client, nil
+}
+
+// CreateStepFunctionSessionForRegion - creates session for stepfunctions calls made outside of requests
+func CreateStepFunctionSessionForRegion(region string, awsInterface awsprovider.AwsStepFunctionsProvider) (awsprovider.AwsStepFunctionInterface, error) {
+	return createStepFunctionSession(context.Background(), region, awsInterface)
+}
+
+// createStepFunctionSession - creates session which calls are traced as children of span in ctx
+func createStepFunctionSession(ctx context.Context, region string, awsInterface awsprovider.AwsStepFunctionsProvider) (awsprovider.AwsStepFunctionInterface, error) {
 	sess, err := session.NewSessionWithOptions(session.Options{
 		// Provide SDK Config options, such as Region.
 		Config: aws.Config{
@@ -25,5 +45,6 @@ func CreateStepFunctionSession(w http.ResponseWriter, r *http.Request, awsInterf
 	if err != nil {
 		return nil, err
 	}
+	tracing.InstrumentSession(ctx, sess)
 	return awsInterface.New(sess)
 }
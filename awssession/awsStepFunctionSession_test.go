@@ -3,6 +3,7 @@ package awssession_test
 import (
 	"net/http"
 	"net/http/httptest"
+	awsprovider "sfr-backend/awsProvider"
 	"sfr-backend/awssession"
 	"sfr-backend/mocks"
 	"testing"
@@ -34,3 +35,27 @@ func TestStepFunctionSession(t *testing.T) {
 	assert.Equal(t, mockStepFunction, stepFunctionProvider)
 	assert.Equal(t, error, nil)
 }
+
+type bypassingStepFunction struct {
+	mocks.AwsStepFunctionInterface
+	uncached *mocks.AwsStepFunctionInterface
+}
+
+func (b *bypassingStepFunction) WithoutCache() awsprovider.AwsStepFunctionInterface {
+	return b.uncached
+}
+
+func TestStepFunctionSessionCacheBypass(t *testing.T) {
+	uncached := &mocks.AwsStepFunctionInterface{}
+	cached := &bypassingStepFunction{uncached: uncached}
+	mockAwsProvider := &mocks.AwsStepFunctionsProvider{}
+	mockAwsProvider.On("New", mock.Anything).Return(cached, nil)
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	stepFunctionProvider, _ := awssession.CreateStepFunctionSession(httptest.NewRecorder(), req, mockAwsProvider)
+	assert.Equal(t, cached, stepFunctionProvider)
+
+	req.Header.Set("Cache-Control", "no-cache")
+	stepFunctionProvider, _ = awssession.CreateStepFunctionSession(httptest.NewRecorder(), req, mockAwsProvider)
+	assert.Equal(t, uncached, stepFunctionProvider)
+}
@@ -0,0 +1,206 @@
+package database
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+
+	"sfr-backend/approval"
+)
+
+// ApprovalStore - protected machines table keyed by machine and change requests table keyed by id
+type ApprovalStore struct {
+	ProtectedMachinesTable string
+	ChangeRequestsTable    string
+}
+
+// NewApprovalStoreFromEnv - creates approval store using PROTECTED_MACHINES_TABLE and CHANGE_REQUESTS_TABLE,
+// ProtectedMachines and ChangeRequests by default
+func NewApprovalStoreFromEnv() *ApprovalStore {
+	approvalStore := &ApprovalStore{
+		ProtectedMachinesTable: os.Getenv("PROTECTED_MACHINES_TABLE"),
+		ChangeRequestsTable:    os.Getenv("CHANGE_REQUESTS_TABLE"),
+	}
+	if approvalStore.ProtectedMachinesTable == "" {
+		approvalStore.ProtectedMachinesTable = "ProtectedMachines"
+	}
+	if approvalStore.ChangeRequestsTable == "" {
+		approvalStore.ChangeRequestsTable = "ChangeRequests"
+	}
+	return approvalStore
+}
+
+// IsProtected - checks if machine is in protected machines table
+func (approvalStore *ApprovalStore) IsProtected(ctx context.Context, machine string) (bool, error) {
+	if machine == "" {
+		return false, nil
+	}
+	result, err := fetchAwsSession(ctx).GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(approvalStore.ProtectedMachinesTable),
+		Key: map[string]*dynamodb.AttributeValue{
+			"machine": {S: aws.String(machine)},
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+	return len(result.Item) > 0, nil
+}
+
+// ProtectedMachines - returns all protected machines
+func (approvalStore *ApprovalStore) ProtectedMachines(ctx context.Context) ([]approval.ProtectedMachine, error) {
+	machines := []approval.ProtectedMachine{}
+	err := scanAll(ctx, &dynamodb.ScanInput{TableName: aws.String(approvalStore.ProtectedMachinesTable)}, func(item map[string]*dynamodb.AttributeValue) error {
+		var machine approval.ProtectedMachine
+		if err := dynamodbattribute.UnmarshalMap(item, &machine); err != nil {
+			return err
+		}
+		machines = append(machines, machine)
+		return nil
+	})
+	return machines, err
+}
+
+// Protect - puts machine into protected machines table
+func (approvalStore *ApprovalStore) Protect(ctx context.Context, machine approval.ProtectedMachine) error {
+	item, err := dynamodbattribute.MarshalMap(machine)
+	if err != nil {
+		return err
+	}
+	_, err = fetchAwsSession(ctx).PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(approvalStore.ProtectedMachinesTable),
+		Item:      item,
+	})
+	return err
+}
+
+// Unprotect - removes machine from protected machines table
+func (approvalStore *ApprovalStore) Unprotect(ctx context.Context, machine string) error {
+	_, err := fetchAwsSession(ctx).DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String(approvalStore.ProtectedMachinesTable),
+		Key: map[string]*dynamodb.AttributeValue{
+			"machine": {S: aws.String(machine)},
+		},
+	})
+	return err
+}
+
+// Create - puts new change request, existing ids are never overwritten
+func (approvalStore *ApprovalStore) Create(ctx context.Context, changeRequest approval.ChangeRequest) error {
+	item, err := dynamodbattribute.MarshalMap(changeRequest)
+	if err != nil {
+		return err
+	}
+	_, err = fetchAwsSession(ctx).PutItem(&dynamodb.PutItemInput{
+		TableName:                aws.String(approvalStore.ChangeRequestsTable),
+		Item:                     item,
+		ConditionExpression:      aws.String("attribute_not_exists(#id)"),
+		ExpressionAttributeNames: map[string]*string{"#id": aws.String("id")},
+	})
+	return err
+}
+
+// Get - returns change request or nil when it doesn't exist
+func (approvalStore *ApprovalStore) Get(ctx context.Context, id string) (*approval.ChangeRequest, error) {
+	result, err := fetchAwsSession(ctx).GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(approvalStore.ChangeRequestsTable),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(id)},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Item) == 0 {
+		return nil, nil
+	}
+	var changeRequest approval.ChangeRequest
+	if err := dynamodbattribute.UnmarshalMap(result.Item, &changeRequest); err != nil {
+		return nil, err
+	}
+	return &changeRequest, nil
+}
+
+// List - returns change requests with status
+func (approvalStore *ApprovalStore) List(ctx context.Context, status string) ([]approval.ChangeRequest, error) {
+	changeRequests := []approval.ChangeRequest{}
+	input := &dynamodb.ScanInput{
+		TableName:                 aws.String(approvalStore.ChangeRequestsTable),
+		FilterExpression:          aws.String("#status = :status"),
+		ExpressionAttributeNames:  map[string]*string{"#status": aws.String("status")},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":status": {S: aws.String(status)}},
+	}
+	err := scanAll(ctx, input, func(item map[string]*dynamodb.AttributeValue) error {
+		var changeRequest approval.ChangeRequest
+		if err := dynamodbattribute.UnmarshalMap(item, &changeRequest); err != nil {
+			return err
+		}
+		changeRequests = append(changeRequests, changeRequest)
+		return nil
+	})
+	return changeRequests, err
+}
+
+// Decide - sets status of pending change request, condition makes sure only one decision wins
+func (approvalStore *ApprovalStore) Decide(ctx context.Context, id string, status string, decidedBy string, decidedAt time.Time, reason string) error {
+	_, err := fetchAwsSession(ctx).UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String(approvalStore.ChangeRequestsTable),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(id)},
+		},
+		UpdateExpression:    aws.String("SET #status = :status, decidedBy = :decidedBy, decidedAt = :decidedAt, reason = :reason"),
+		ConditionExpression: aws.String("#status = :pending"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status": aws.String("status"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":status":    {S: aws.String(status)},
+			":pending":   {S: aws.String(approval.StatusPending)},
+			":decidedBy": {S: aws.String(decidedBy)},
+			":decidedAt": {S: aws.String(decidedAt.Format(time.RFC3339Nano))},
+			":reason":    {S: aws.String(reason)},
+		},
+	})
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return approval.ErrNotPending
+	}
+	return err
+}
+
+// Complete - stores change request with results of its executions
+func (approvalStore *ApprovalStore) Complete(ctx context.Context, changeRequest approval.ChangeRequest) error {
+	item, err := dynamodbattribute.MarshalMap(changeRequest)
+	if err != nil {
+		return err
+	}
+	_, err = fetchAwsSession(ctx).PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(approvalStore.ChangeRequestsTable),
+		Item:      item,
+	})
+	return err
+}
+
+// scanAll - calls handle for every item of scan, following pagination
+func scanAll(ctx context.Context, input *dynamodb.ScanInput, handle func(item map[string]*dynamodb.AttributeValue) error) error {
+	svc := fetchAwsSession(ctx)
+	for {
+		output, err := svc.Scan(input)
+		if err != nil {
+			return err
+		}
+		for _, item := range output.Items {
+			if err := handle(item); err != nil {
+				return err
+			}
+		}
+		if len(output.LastEvaluatedKey) == 0 {
+			return nil
+		}
+		input.ExclusiveStartKey = output.LastEvaluatedKey
+	}
+}
@@ -0,0 +1,115 @@
+package database
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+
+	"sfr-backend/audit"
+)
+
+// AuditStore - append only audit table partitioned by day with time ordered event IDs
+type AuditStore struct {
+	Table string
+}
+
+// NewAuditStoreFromEnv - creates audit store using table from AUDIT_TABLE, AuditEvents by default
+func NewAuditStoreFromEnv() *AuditStore {
+	table := os.Getenv("AUDIT_TABLE")
+	if table == "" {
+		table = "AuditEvents"
+	}
+	return &AuditStore{Table: table}
+}
+
+// Append - puts event into audit table, existing events are never overwritten
+func (auditStore *AuditStore) Append(ctx context.Context, event audit.Event) error {
+	item, err := dynamodbattribute.MarshalMap(event)
+	if err != nil {
+		return err
+	}
+	_, err = fetchAwsSession(ctx).PutItem(&dynamodb.PutItemInput{
+		TableName:           aws.String(auditStore.Table),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(#id)"),
+		ExpressionAttributeNames: map[string]*string{
+			"#id": aws.String("id"),
+		},
+	})
+	return err
+}
+
+// Query - returns newest events matching filter, querying one day partition at a time
+func (auditStore *AuditStore) Query(ctx context.Context, filter audit.Filter) ([]audit.Event, error) {
+	svc := fetchAwsSession(ctx)
+	events := []audit.Event{}
+	from := filter.From.UTC()
+	to := filter.To.UTC()
+	day := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	for !day.Before(time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)) {
+		input := auditQueryInput(auditStore.Table, day, filter)
+		for {
+			output, err := svc.Query(input)
+			if err != nil {
+				return nil, err
+			}
+			for _, item := range output.Items {
+				var event audit.Event
+				if err := dynamodbattribute.UnmarshalMap(item, &event); err != nil {
+					return nil, err
+				}
+				events = append(events, event)
+				if len(events) >= filter.Limit {
+					return events, nil
+				}
+			}
+			if len(output.LastEvaluatedKey) == 0 {
+				break
+			}
+			input.ExclusiveStartKey = output.LastEvaluatedKey
+		}
+		day = day.AddDate(0, 0, -1)
+	}
+	return events, nil
+}
+
+// auditQueryInput - query of single day partition, newest first
+func auditQueryInput(table string, day time.Time, filter audit.Filter) *dynamodb.QueryInput {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(table),
+		KeyConditionExpression: aws.String("#day = :day AND #id BETWEEN :from AND :to"),
+		ExpressionAttributeNames: map[string]*string{
+			"#day": aws.String("day"),
+			"#id":  aws.String("id"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":day": {S: aws.String(day.Format("2006-01-02"))},
+			// event IDs are timestamp followed by # and random suffix
+			":from": {S: aws.String(filter.From.UTC().Format(audit.TimeLayout))},
+			":to":   {S: aws.String(filter.To.UTC().Format(audit.TimeLayout) + "#~")},
+		},
+		ScanIndexForward: aws.Bool(false),
+	}
+	filterExpression := ""
+	if filter.User != "" {
+		filterExpression = "#user = :user"
+		input.ExpressionAttributeNames["#user"] = aws.String("user")
+		input.ExpressionAttributeValues[":user"] = &dynamodb.AttributeValue{S: aws.String(filter.User)}
+	}
+	if filter.Action != "" {
+		if filterExpression != "" {
+			filterExpression += " AND "
+		}
+		filterExpression += "#action = :action"
+		input.ExpressionAttributeNames["#action"] = aws.String("action")
+		input.ExpressionAttributeValues[":action"] = &dynamodb.AttributeValue{S: aws.String(filter.Action)}
+	}
+	if filterExpression != "" {
+		input.FilterExpression = aws.String(filterExpression)
+	}
+	return input
+}
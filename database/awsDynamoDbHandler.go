@@ -1,26 +1,40 @@
 package database
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	log "github.com/sirupsen/logrus"
 
 	awsprovider "sfr-backend/awsProvider"
+	"sfr-backend/tracing"
 	"sfr-backend/user"
 )
 
 var awsDatabaseProvider awsprovider.AwsDatabaseProvider
 
 func init() {
-	awsDatabaseProvider = &awsprovider.AwsDatabaseProviderRealProvider{}
+	awsDatabaseProvider = awsprovider.NewInstrumentedDatabaseProvider(&awsprovider.AwsDatabaseProviderRealProvider{})
 }
 
-//GetUserDetails - get user details from DB
-func GetUserDetails(username string) user.UserDetails {
-	svc := fetchAwsSession()
+//GetUserDetails - get user details from DB, errors are logged and give empty user details
+func GetUserDetails(ctx context.Context, username string) user.UserDetails {
+	userDetails, err := LoadUserDetails(ctx, username)
+	if err != nil {
+		log.Error("Unable to get user details: ", err)
+	}
+	return userDetails
+}
+
+//LoadUserDetails - get user details from DB, unknown user gives empty user details
+//and error is returned only when DB can't be read, so callers can tell outage from wrong username
+func LoadUserDetails(ctx context.Context, username string) (user.UserDetails, error) {
+	svc := fetchAwsSession(ctx)
 	result, err := svc.GetItem(&dynamodb.GetItemInput{
 		TableName: aws.String("UserDetails"),
 		Key: map[string]*dynamodb.AttributeValue{
@@ -31,8 +45,7 @@ func GetUserDetails(username string) user.UserDetails {
 	})
 
 	if err != nil {
-		fmt.Println(err.Error())
-		return user.UserDetails{}
+		return user.UserDetails{}, err
 	}
 
 	databaseUser := user.UserDetails{}
@@ -40,44 +53,89 @@ func GetUserDetails(username string) user.UserDetails {
 	err = dynamodbattribute.UnmarshalMap(result.Item, &databaseUser)
 
 	if err != nil {
-		panic(fmt.Sprintf("Failed to Unmarshal JSON Record, %s", err))
+		return user.UserDetails{}, fmt.Errorf("failed to unmarshal user details: %v", err)
 	}
 
 	if databaseUser.Password == "" {
-		fmt.Println("Could not retrieve user details")
-		return user.UserDetails{}
+		log.Debug("Could not retrieve user details")
+		return user.UserDetails{}, nil
 	}
 
-	return databaseUser
+	return databaseUser, nil
 }
 
-//CreateUser - function to create a user
-func CreateUser(userDetails user.UserDetails) string {
-	svc := fetchAwsSession()
+//CreateUser - function to create a user, returns "exists" when user with the username already exists
+func CreateUser(ctx context.Context, userDetails user.UserDetails) string {
+	svc := fetchAwsSession(ctx)
 
 	av, error := dynamodbattribute.MarshalMap(userDetails)
 	if error != nil {
-		fmt.Println("Got error marshalling new movie item:")
-		fmt.Println(error.Error())
+		log.Error("Unable to marshal user: ", error)
 		return "error"
 	}
 
 	_, err := svc.PutItem(&dynamodb.PutItemInput{
-		Item:      av,
-		TableName: aws.String("UserDetails"),
+		Item:                av,
+		TableName:           aws.String("UserDetails"),
+		ConditionExpression: aws.String("attribute_not_exists(username)"),
 	})
 
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return "exists"
+	}
 	if err != nil {
-		fmt.Println(err.Error())
+		log.Error("Unable to create user: ", err)
 		return "error"
 	}
 
-	fmt.Println("Successfully added user with username " + userDetails.Username + " to table UserDetails")
+	log.Info("Successfully added user with username " + userDetails.Username + " to table UserDetails")
 
 	return "success"
 }
 
-func fetchAwsSession() awsprovider.AwsDatabaseInterface {
+// UpdatePassword - replaces password hash of existing user, returns user.ErrNotFound when user doesn't exist
+func UpdatePassword(ctx context.Context, username string, passwordHash string) error {
+	_, err := fetchAwsSession(ctx).UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String("UserDetails"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"username": {S: aws.String(username)},
+		},
+		UpdateExpression:          aws.String("SET password = :password"),
+		ConditionExpression:       aws.String("attribute_exists(username)"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":password": {S: aws.String(passwordHash)}},
+	})
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return user.ErrNotFound
+	}
+	return err
+}
+
+// UpdateMFA - replaces MFA enrollment of existing user, nil removes it, returns user.ErrNotFound when user doesn't exist
+func UpdateMFA(ctx context.Context, username string, mfa *user.MFA) error {
+	input := &dynamodb.UpdateItemInput{
+		TableName: aws.String("UserDetails"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"username": {S: aws.String(username)},
+		},
+		UpdateExpression:    aws.String("REMOVE mfa"),
+		ConditionExpression: aws.String("attribute_exists(username)"),
+	}
+	if mfa != nil {
+		av, err := dynamodbattribute.Marshal(mfa)
+		if err != nil {
+			return err
+		}
+		input.UpdateExpression = aws.String("SET mfa = :mfa")
+		input.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{":mfa": av}
+	}
+	_, err := fetchAwsSession(ctx).UpdateItem(input)
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return user.ErrNotFound
+	}
+	return err
+}
+
+func fetchAwsSession(ctx context.Context) awsprovider.AwsDatabaseInterface {
 
 	sess, err := session.NewSessionWithOptions(session.Options{
 		// Provide SDK Config options, such as Region.
@@ -88,6 +146,8 @@ func fetchAwsSession() awsprovider.AwsDatabaseInterface {
 	if err != nil {
 		panic(fmt.Sprintf("Failed to Unmarshal JSON Record, %s", err))
 	}
+	// calls become children of span in ctx, so store calls of request belong to request trace
+	tracing.InstrumentSession(ctx, sess)
 	svc, _ := awsDatabaseProvider.New(sess)
 
 	return svc
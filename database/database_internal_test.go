@@ -1,15 +1,36 @@
 package database
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sfr-backend/apikey"
+	"sfr-backend/approval"
+	"sfr-backend/audit"
+	"sfr-backend/invite"
+	"sfr-backend/lockout"
 	"sfr-backend/mocks"
+	"sfr-backend/password"
+	"sfr-backend/rbac"
+	"sfr-backend/revocation"
+	"sfr-backend/session"
 	"sfr-backend/user"
 	"testing"
+	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	sdksession "github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func TestFetchDatabaseSession(t *testing.T) {
@@ -19,11 +40,40 @@ func TestFetchDatabaseSession(t *testing.T) {
 	// change database provider for mock provider
 	awsDatabaseProvider = mockAwsDatabseProvider
 
-	databaseProvider := fetchAwsSession()
+	databaseProvider := fetchAwsSession(context.Background())
 
 	assert.Equal(t, mockAwsDatabase, databaseProvider)
 }
 
+func TestFetchDatabaseSessionJoinsRequestTrace(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(previous)
+	awsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer awsServer.Close()
+	var sess *sdksession.Session
+	mockAwsDatabseProvider := &mocks.AwsDatabaseProvider{}
+	mockAwsDatabseProvider.On("New", mock.Anything).Run(func(args mock.Arguments) {
+		sess = args.Get(0).(*sdksession.Session)
+	}).Return(&mocks.AwsDatabaseInterface{}, nil)
+	awsDatabaseProvider = mockAwsDatabseProvider
+
+	request, requestSpan := otel.Tracer("test").Start(context.Background(), "request")
+	fetchAwsSession(request)
+	client := dynamodb.New(sess, &aws.Config{Endpoint: aws.String(awsServer.URL), Credentials: credentials.NewStaticCredentials("id", "secret", "")})
+	_, err := client.GetItem(&dynamodb.GetItemInput{TableName: aws.String("UserDetails"), Key: map[string]*dynamodb.AttributeValue{"username": {S: aws.String("jdoe")}}})
+	requestSpan.End()
+
+	assert.Nil(t, err)
+	spans := recorder.Ended()
+	assert.Len(t, spans, 2)
+	assert.Equal(t, "dynamodb.GetItem", spans[0].Name())
+	assert.Equal(t, requestSpan.SpanContext().SpanID(), spans[0].Parent().SpanID())
+}
+
 func TestCreateUser(t *testing.T) {
 	mockAwsDatabseProvider := &mocks.AwsDatabaseProvider{}
 	mockAwsDatabase := &mocks.AwsDatabaseInterface{}
@@ -47,7 +97,7 @@ func TestCreateUser(t *testing.T) {
 	}
 
 	for _, testCase := range testTable {
-		output := CreateUser(testCase.userDetails)
+		output := CreateUser(context.Background(), testCase.userDetails)
 		assert.Equal(t, testCase.expectedOutput, output)
 	}
 }
@@ -79,7 +129,390 @@ func TestGetUserDetails(t *testing.T) {
 		{user.UserDetails{}},
 	}
 	for _, testCase := range testTable {
-		output := GetUserDetails(username)
+		output := GetUserDetails(context.Background(), username)
 		assert.Equal(t, testCase.expectedUser, output)
 	}
 }
+
+func TestAuditStoreAppend(t *testing.T) {
+	mockAwsDatabseProvider := &mocks.AwsDatabaseProvider{}
+	mockAwsDatabase := &mocks.AwsDatabaseInterface{}
+	mockAwsDatabase.On("PutItem", mock.MatchedBy(func(input *dynamodb.PutItemInput) bool {
+		return *input.TableName == "AuditEvents" &&
+			*input.ConditionExpression == "attribute_not_exists(#id)" &&
+			*input.Item["day"].S == "2021-01-01" &&
+			*input.Item["action"].S == audit.ActionLogin
+	})).Return(&dynamodb.PutItemOutput{}, nil).Once()
+	mockAwsDatabseProvider.On("New", mock.Anything).Return(mockAwsDatabase, nil)
+	awsDatabaseProvider = mockAwsDatabseProvider
+
+	err := NewAuditStoreFromEnv().Append(context.Background(), audit.Event{Day: "2021-01-01", ID: "id", Action: audit.ActionLogin})
+
+	assert.Nil(t, err)
+	mockAwsDatabase.AssertExpectations(t)
+}
+
+func TestAuditStoreQuery(t *testing.T) {
+	mockAwsDatabseProvider := &mocks.AwsDatabaseProvider{}
+	mockAwsDatabase := &mocks.AwsDatabaseInterface{}
+	item := func(id string) map[string]*dynamodb.AttributeValue {
+		event, _ := dynamodbattribute.MarshalMap(audit.Event{ID: id, User: "admin"})
+		return event
+	}
+	forDay := func(day string) interface{} {
+		return mock.MatchedBy(func(input *dynamodb.QueryInput) bool {
+			return *input.ExpressionAttributeValues[":day"].S == day &&
+				*input.FilterExpression == "#user = :user" &&
+				!*input.ScanIndexForward
+		})
+	}
+	mockAwsDatabase.On("Query", forDay("2021-01-02")).Return(&dynamodb.QueryOutput{
+		Items:            []map[string]*dynamodb.AttributeValue{item("4")},
+		LastEvaluatedKey: item("4"),
+	}, nil).Once()
+	mockAwsDatabase.On("Query", forDay("2021-01-02")).Return(&dynamodb.QueryOutput{
+		Items: []map[string]*dynamodb.AttributeValue{item("3")},
+	}, nil).Once()
+	mockAwsDatabase.On("Query", forDay("2021-01-01")).Return(&dynamodb.QueryOutput{
+		Items: []map[string]*dynamodb.AttributeValue{item("2"), item("1")},
+	}, nil).Once()
+	mockAwsDatabseProvider.On("New", mock.Anything).Return(mockAwsDatabase, nil)
+	awsDatabaseProvider = mockAwsDatabseProvider
+
+	events, err := NewAuditStoreFromEnv().Query(context.Background(), audit.Filter{
+		User:  "admin",
+		From:  time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC),
+		To:    time.Date(2021, 1, 2, 12, 0, 0, 0, time.UTC),
+		Limit: 3,
+	})
+
+	assert.Nil(t, err)
+	ids := []string{}
+	for _, event := range events {
+		ids = append(ids, event.ID)
+	}
+	assert.Equal(t, []string{"4", "3", "2"}, ids)
+	mockAwsDatabase.AssertExpectations(t)
+}
+
+func TestApprovalStoreDecide(t *testing.T) {
+	mockAwsDatabseProvider := &mocks.AwsDatabaseProvider{}
+	mockAwsDatabase := &mocks.AwsDatabaseInterface{}
+	conditional := mock.MatchedBy(func(input *dynamodb.UpdateItemInput) bool {
+		return *input.TableName == "ChangeRequests" &&
+			*input.ConditionExpression == "#status = :pending" &&
+			*input.ExpressionAttributeValues[":status"].S == approval.StatusApproved
+	})
+	mockAwsDatabase.On("UpdateItem", conditional).Return(&dynamodb.UpdateItemOutput{}, nil).Once()
+	mockAwsDatabase.On("UpdateItem", conditional).Return(nil, awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "failed", nil)).Once()
+	mockAwsDatabseProvider.On("New", mock.Anything).Return(mockAwsDatabase, nil)
+	awsDatabaseProvider = mockAwsDatabseProvider
+	approvalStore := NewApprovalStoreFromEnv()
+
+	assert.Nil(t, approvalStore.Decide(context.Background(), "id", approval.StatusApproved, "approver", time.Now(), ""))
+	assert.Equal(t, approval.ErrNotPending, approvalStore.Decide(context.Background(), "id", approval.StatusApproved, "approver", time.Now(), ""))
+}
+
+func TestApprovalStoreGet(t *testing.T) {
+	mockAwsDatabseProvider := &mocks.AwsDatabaseProvider{}
+	mockAwsDatabase := &mocks.AwsDatabaseInterface{}
+	item, _ := dynamodbattribute.MarshalMap(approval.ChangeRequest{ID: "id", Status: approval.StatusPending})
+	mockAwsDatabase.On("GetItem", mock.Anything).Return(&dynamodb.GetItemOutput{Item: item}, nil).Once()
+	mockAwsDatabase.On("GetItem", mock.Anything).Return(&dynamodb.GetItemOutput{}, nil).Once()
+	mockAwsDatabseProvider.On("New", mock.Anything).Return(mockAwsDatabase, nil)
+	awsDatabaseProvider = mockAwsDatabseProvider
+	approvalStore := NewApprovalStoreFromEnv()
+
+	changeRequest, err := approvalStore.Get(context.Background(), "id")
+	assert.Nil(t, err)
+	assert.Equal(t, approval.StatusPending, changeRequest.Status)
+	changeRequest, err = approvalStore.Get(context.Background(), "missing")
+	assert.Nil(t, err)
+	assert.Nil(t, changeRequest)
+}
+
+func TestServiceAccountStoreConditions(t *testing.T) {
+	mockAwsDatabseProvider := &mocks.AwsDatabaseProvider{}
+	mockAwsDatabase := &mocks.AwsDatabaseInterface{}
+	conditionFailed := awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "failed", nil)
+	withCondition := func(condition string) interface{} {
+		return mock.MatchedBy(func(input *dynamodb.PutItemInput) bool {
+			return *input.TableName == "ServiceAccounts" && *input.ConditionExpression == condition
+		})
+	}
+	mockAwsDatabase.On("PutItem", withCondition("attribute_not_exists(#name)")).Return(nil, conditionFailed).Once()
+	mockAwsDatabase.On("PutItem", withCondition("attribute_exists(#name) AND attribute_not_exists(revokedAt)")).Return(nil, conditionFailed).Once()
+	mockAwsDatabase.On("PutItem", withCondition("attribute_exists(#name) AND attribute_not_exists(revokedAt)")).Return(&dynamodb.PutItemOutput{}, nil).Once()
+	mockAwsDatabseProvider.On("New", mock.Anything).Return(mockAwsDatabase, nil)
+	awsDatabaseProvider = mockAwsDatabseProvider
+	accountStore := NewServiceAccountStoreFromEnv()
+	account := apikey.ServiceAccount{Name: "ci"}
+
+	assert.Equal(t, apikey.ErrExists, accountStore.Create(context.Background(), account))
+	assert.Equal(t, apikey.ErrRevoked, accountStore.Update(context.Background(), account))
+	assert.Nil(t, accountStore.Update(context.Background(), account))
+	mockAwsDatabase.AssertExpectations(t)
+}
+
+func TestRevocationStore(t *testing.T) {
+	mockAwsDatabseProvider := &mocks.AwsDatabaseProvider{}
+	mockAwsDatabase := &mocks.AwsDatabaseInterface{}
+	conditionFailed := awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "failed", nil)
+	revoke := mock.MatchedBy(func(input *dynamodb.PutItemInput) bool {
+		return *input.TableName == "RevokedTokens" && *input.Item["id"].S == "token#1" && *input.Item["expiresAt"].N == "1600000000"
+	})
+	mockAwsDatabase.On("PutItem", revoke).Return(&dynamodb.PutItemOutput{}, nil).Once()
+	mockAwsDatabase.On("PutItem", revoke).Return(nil, conditionFailed).Once()
+	expired := &dynamodb.AttributeValue{N: aws.String("1600000000")}
+	valid := &dynamodb.AttributeValue{N: aws.String(fmt.Sprint(time.Now().Add(time.Hour).Unix()))}
+	mockAwsDatabase.On("GetItem", mock.Anything).Return(&dynamodb.GetItemOutput{Item: map[string]*dynamodb.AttributeValue{"expiresAt": valid}}, nil).Once()
+	mockAwsDatabase.On("GetItem", mock.Anything).Return(&dynamodb.GetItemOutput{Item: map[string]*dynamodb.AttributeValue{"expiresAt": expired}}, nil).Once()
+	mockAwsDatabase.On("GetItem", mock.Anything).Return(&dynamodb.GetItemOutput{}, nil).Once()
+	mockAwsDatabseProvider.On("New", mock.Anything).Return(mockAwsDatabase, nil)
+	awsDatabaseProvider = mockAwsDatabseProvider
+	revocationStore := NewRevocationStoreFromEnv()
+
+	assert.Nil(t, revocationStore.Revoke(context.Background(), "token#1", time.Unix(1600000000, 0)))
+	assert.Equal(t, revocation.ErrRevoked, revocationStore.Revoke(context.Background(), "token#1", time.Unix(1600000000, 0)))
+	for _, expected := range []bool{true, false, false} {
+		revoked, err := revocationStore.IsRevoked(context.Background(), "token#1")
+		assert.Nil(t, err)
+		assert.Equal(t, expected, revoked)
+	}
+	mockAwsDatabase.AssertExpectations(t)
+}
+
+func TestUpdatePassword(t *testing.T) {
+	mockAwsDatabseProvider := &mocks.AwsDatabaseProvider{}
+	mockAwsDatabase := &mocks.AwsDatabaseInterface{}
+	conditionFailed := awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "failed", nil)
+	update := mock.MatchedBy(func(input *dynamodb.UpdateItemInput) bool {
+		return *input.Key["username"].S == "jdoe" && *input.ExpressionAttributeValues[":password"].S == "hash" &&
+			*input.ConditionExpression == "attribute_exists(username)"
+	})
+	mockAwsDatabase.On("UpdateItem", update).Return(&dynamodb.UpdateItemOutput{}, nil).Once()
+	mockAwsDatabase.On("UpdateItem", update).Return(nil, conditionFailed).Once()
+	mockAwsDatabseProvider.On("New", mock.Anything).Return(mockAwsDatabase, nil)
+	awsDatabaseProvider = mockAwsDatabseProvider
+
+	assert.Nil(t, UpdatePassword(context.Background(), "jdoe", "hash"))
+	assert.Equal(t, user.ErrNotFound, UpdatePassword(context.Background(), "jdoe", "hash"))
+	mockAwsDatabase.AssertExpectations(t)
+}
+
+func TestUpdateMFA(t *testing.T) {
+	mockAwsDatabseProvider := &mocks.AwsDatabaseProvider{}
+	mockAwsDatabase := &mocks.AwsDatabaseInterface{}
+	conditionFailed := awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "failed", nil)
+	set := mock.MatchedBy(func(input *dynamodb.UpdateItemInput) bool {
+		return *input.Key["username"].S == "jdoe" && *input.UpdateExpression == "SET mfa = :mfa" &&
+			*input.ExpressionAttributeValues[":mfa"].M["secret"].S == "encrypted"
+	})
+	remove := mock.MatchedBy(func(input *dynamodb.UpdateItemInput) bool {
+		return *input.UpdateExpression == "REMOVE mfa" && *input.ConditionExpression == "attribute_exists(username)"
+	})
+	mockAwsDatabase.On("UpdateItem", set).Return(&dynamodb.UpdateItemOutput{}, nil).Once()
+	mockAwsDatabase.On("UpdateItem", remove).Return(nil, conditionFailed).Once()
+	mockAwsDatabseProvider.On("New", mock.Anything).Return(mockAwsDatabase, nil)
+	awsDatabaseProvider = mockAwsDatabseProvider
+
+	assert.Nil(t, UpdateMFA(context.Background(), "jdoe", &user.MFA{Secret: "encrypted", Enabled: true}))
+	assert.Equal(t, user.ErrNotFound, UpdateMFA(context.Background(), "jdoe", nil))
+	mockAwsDatabase.AssertExpectations(t)
+}
+
+func TestCreateUserExists(t *testing.T) {
+	mockAwsDatabseProvider := &mocks.AwsDatabaseProvider{}
+	mockAwsDatabase := &mocks.AwsDatabaseInterface{}
+	conditionFailed := awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "failed", nil)
+	create := mock.MatchedBy(func(input *dynamodb.PutItemInput) bool {
+		return *input.ConditionExpression == "attribute_not_exists(username)"
+	})
+	mockAwsDatabase.On("PutItem", create).Return(nil, conditionFailed).Once()
+	mockAwsDatabseProvider.On("New", mock.Anything).Return(mockAwsDatabase, nil)
+	awsDatabaseProvider = mockAwsDatabseProvider
+
+	assert.Equal(t, "exists", CreateUser(context.Background(), user.UserDetails{Username: "jdoe"}))
+	mockAwsDatabase.AssertExpectations(t)
+}
+
+func TestListUsers(t *testing.T) {
+	mockAwsDatabseProvider := &mocks.AwsDatabaseProvider{}
+	mockAwsDatabase := &mocks.AwsDatabaseInterface{}
+	item, _ := dynamodbattribute.MarshalMap(user.UserDetails{Username: "jdoe", Password: "hash"})
+	firstPage := mock.MatchedBy(func(input *dynamodb.ScanInput) bool {
+		return *input.Limit == 1 && input.ExclusiveStartKey == nil
+	})
+	nextPage := mock.MatchedBy(func(input *dynamodb.ScanInput) bool {
+		return input.ExclusiveStartKey != nil && *input.ExclusiveStartKey["username"].S == "jdoe"
+	})
+	mockAwsDatabase.On("Scan", firstPage).Return(&dynamodb.ScanOutput{
+		Items:            []map[string]*dynamodb.AttributeValue{item},
+		LastEvaluatedKey: map[string]*dynamodb.AttributeValue{"username": {S: aws.String("jdoe")}},
+	}, nil).Once()
+	mockAwsDatabase.On("Scan", nextPage).Return(&dynamodb.ScanOutput{}, nil).Once()
+	mockAwsDatabseProvider.On("New", mock.Anything).Return(mockAwsDatabase, nil)
+	awsDatabaseProvider = mockAwsDatabseProvider
+
+	users, nextToken, err := ListUsers(context.Background(), 1, "")
+	assert.Nil(t, err)
+	assert.Equal(t, "jdoe", nextToken)
+	assert.Equal(t, []user.UserDetails{{Username: "jdoe", Password: "hash"}}, users)
+	users, nextToken, err = ListUsers(context.Background(), 1, nextToken)
+	assert.Nil(t, err)
+	assert.Empty(t, nextToken)
+	assert.Empty(t, users)
+	mockAwsDatabase.AssertExpectations(t)
+}
+
+func TestUpdateUser(t *testing.T) {
+	mockAwsDatabseProvider := &mocks.AwsDatabaseProvider{}
+	mockAwsDatabase := &mocks.AwsDatabaseInterface{}
+	conditionFailed := awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "failed", nil)
+	updated, _ := dynamodbattribute.MarshalMap(user.UserDetails{Username: "jdoe", Lastname: "Doe", Disabled: true})
+	update := mock.MatchedBy(func(input *dynamodb.UpdateItemInput) bool {
+		return *input.UpdateExpression == "SET #lastname = :lastname, #disabled = :disabled" &&
+			*input.ConditionExpression == "attribute_exists(username)" && *input.ExpressionAttributeValues[":disabled"].BOOL
+	})
+	mockAwsDatabase.On("UpdateItem", update).Return(&dynamodb.UpdateItemOutput{Attributes: updated}, nil).Once()
+	mockAwsDatabase.On("UpdateItem", update).Return(nil, conditionFailed).Once()
+	mockAwsDatabseProvider.On("New", mock.Anything).Return(mockAwsDatabase, nil)
+	awsDatabaseProvider = mockAwsDatabseProvider
+	lastname, disabled := "Doe", true
+
+	userDetails, err := UpdateUser(context.Background(), "jdoe", user.Update{Lastname: &lastname, Disabled: &disabled})
+	assert.Nil(t, err)
+	assert.Equal(t, user.UserDetails{Username: "jdoe", Lastname: "Doe", Disabled: true}, userDetails)
+	_, err = UpdateUser(context.Background(), "jdoe", user.Update{Lastname: &lastname, Disabled: &disabled})
+	assert.Equal(t, user.ErrNotFound, err)
+	mockAwsDatabase.AssertExpectations(t)
+}
+
+func TestDeleteUser(t *testing.T) {
+	mockAwsDatabseProvider := &mocks.AwsDatabaseProvider{}
+	mockAwsDatabase := &mocks.AwsDatabaseInterface{}
+	conditionFailed := awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "failed", nil)
+	mockAwsDatabase.On("DeleteItem", mock.Anything).Return(&dynamodb.DeleteItemOutput{}, nil).Once()
+	mockAwsDatabase.On("DeleteItem", mock.Anything).Return(nil, conditionFailed).Once()
+	mockAwsDatabseProvider.On("New", mock.Anything).Return(mockAwsDatabase, nil)
+	awsDatabaseProvider = mockAwsDatabseProvider
+
+	assert.Nil(t, DeleteUser(context.Background(), "jdoe"))
+	assert.Equal(t, user.ErrNotFound, DeleteUser(context.Background(), "jdoe"))
+	mockAwsDatabase.AssertExpectations(t)
+}
+
+func TestPasswordResetStoreConsume(t *testing.T) {
+	mockAwsDatabseProvider := &mocks.AwsDatabaseProvider{}
+	mockAwsDatabase := &mocks.AwsDatabaseInterface{}
+	conditionFailed := awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "failed", nil)
+	token := password.ResetToken{ID: "id", Username: "jdoe", RequestedBy: "admin", ExpiresAt: 1600000000}
+	item, _ := dynamodbattribute.MarshalMap(token)
+	consume := mock.MatchedBy(func(input *dynamodb.DeleteItemInput) bool {
+		return *input.TableName == "PasswordResets" && *input.Key["id"].S == "id" && *input.ReturnValues == dynamodb.ReturnValueAllOld
+	})
+	mockAwsDatabase.On("DeleteItem", consume).Return(&dynamodb.DeleteItemOutput{Attributes: item}, nil).Once()
+	mockAwsDatabase.On("DeleteItem", consume).Return(nil, conditionFailed).Once()
+	mockAwsDatabseProvider.On("New", mock.Anything).Return(mockAwsDatabase, nil)
+	awsDatabaseProvider = mockAwsDatabseProvider
+	resetStore := NewPasswordResetStoreFromEnv()
+
+	consumed, err := resetStore.Consume(context.Background(), "id")
+	assert.Nil(t, err)
+	assert.Equal(t, &token, consumed)
+	consumed, err = resetStore.Consume(context.Background(), "id")
+	assert.Nil(t, err)
+	assert.Nil(t, consumed)
+	mockAwsDatabase.AssertExpectations(t)
+}
+
+func TestInviteStoreConsume(t *testing.T) {
+	mockAwsDatabseProvider := &mocks.AwsDatabaseProvider{}
+	mockAwsDatabase := &mocks.AwsDatabaseInterface{}
+	conditionFailed := awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "failed", nil)
+	pending := invite.Invite{ID: "id", Username: "jdoe", Email: "jdoe@example.com", Grants: []rbac.Grant{{Role: rbac.RoleOperator}}, InvitedBy: "admin", ExpiresAt: 1600000000}
+	item, _ := dynamodbattribute.MarshalMap(pending)
+	consume := mock.MatchedBy(func(input *dynamodb.DeleteItemInput) bool {
+		return *input.TableName == "Invites" && *input.Key["id"].S == "id" && *input.ReturnValues == dynamodb.ReturnValueAllOld
+	})
+	mockAwsDatabase.On("DeleteItem", consume).Return(&dynamodb.DeleteItemOutput{Attributes: item}, nil).Once()
+	mockAwsDatabase.On("DeleteItem", consume).Return(nil, conditionFailed).Once()
+	mockAwsDatabseProvider.On("New", mock.Anything).Return(mockAwsDatabase, nil)
+	awsDatabaseProvider = mockAwsDatabseProvider
+	inviteStore := NewInviteStoreFromEnv()
+
+	consumed, err := inviteStore.Consume(context.Background(), "id")
+	assert.Nil(t, err)
+	assert.Equal(t, &pending, consumed)
+	consumed, err = inviteStore.Consume(context.Background(), "id")
+	assert.Nil(t, err)
+	assert.Nil(t, consumed)
+	mockAwsDatabase.AssertExpectations(t)
+}
+
+func TestSessionStore(t *testing.T) {
+	mockAwsDatabseProvider := &mocks.AwsDatabaseProvider{}
+	mockAwsDatabase := &mocks.AwsDatabaseInterface{}
+	stored := session.Session{ID: "fam", Username: "jdoe", UserAgent: "browser", IP: "192.0.2.1",
+		CreatedAt: time.Unix(1600000000, 0).UTC(), LastUsedAt: time.Unix(1600000060, 0).UTC(), ExpiresAt: 1600086400}
+	item, _ := dynamodbattribute.MarshalMap(stored)
+	byKey := func(key map[string]*dynamodb.AttributeValue) bool {
+		return *key["username"].S == "jdoe" && *key["id"].S == "fam"
+	}
+	mockAwsDatabase.On("PutItem", mock.MatchedBy(func(input *dynamodb.PutItemInput) bool {
+		return *input.TableName == "Sessions" && *input.Item["expiresAt"].N == "1600086400"
+	})).Return(&dynamodb.PutItemOutput{}, nil).Once()
+	mockAwsDatabase.On("GetItem", mock.MatchedBy(func(input *dynamodb.GetItemInput) bool {
+		return byKey(input.Key)
+	})).Return(&dynamodb.GetItemOutput{Item: item}, nil).Once()
+	mockAwsDatabase.On("Query", mock.MatchedBy(func(input *dynamodb.QueryInput) bool {
+		return input.ExclusiveStartKey == nil && *input.ExpressionAttributeValues[":username"].S == "jdoe"
+	})).Return(&dynamodb.QueryOutput{Items: []map[string]*dynamodb.AttributeValue{item}, LastEvaluatedKey: item}, nil).Once()
+	mockAwsDatabase.On("Query", mock.MatchedBy(func(input *dynamodb.QueryInput) bool {
+		return input.ExclusiveStartKey != nil
+	})).Return(&dynamodb.QueryOutput{Items: []map[string]*dynamodb.AttributeValue{item}}, nil).Once()
+	mockAwsDatabase.On("DeleteItem", mock.MatchedBy(func(input *dynamodb.DeleteItemInput) bool {
+		return byKey(input.Key)
+	})).Return(&dynamodb.DeleteItemOutput{}, nil).Once()
+	mockAwsDatabseProvider.On("New", mock.Anything).Return(mockAwsDatabase, nil)
+	awsDatabaseProvider = mockAwsDatabseProvider
+	sessionStore := NewSessionStoreFromEnv()
+
+	assert.Nil(t, sessionStore.Save(context.Background(), stored))
+	found, err := sessionStore.Get(context.Background(), "jdoe", "fam")
+	assert.Nil(t, err)
+	assert.Equal(t, &stored, found)
+	sessions, err := sessionStore.List(context.Background(), "jdoe")
+	assert.Nil(t, err)
+	assert.Equal(t, []session.Session{stored, stored}, sessions)
+	assert.Nil(t, sessionStore.Delete(context.Background(), "jdoe", "fam"))
+	mockAwsDatabase.AssertExpectations(t)
+}
+
+func TestLoginAttemptsStoreCompareAndPut(t *testing.T) {
+	mockAwsDatabseProvider := &mocks.AwsDatabaseProvider{}
+	mockAwsDatabase := &mocks.AwsDatabaseInterface{}
+	conditionFailed := awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "failed", nil)
+	first := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	increment := mock.MatchedBy(func(input *dynamodb.UpdateItemInput) bool {
+		return *input.TableName == "LoginAttempts" && *input.Key["key"].S == "user#jdoe" &&
+			*input.UpdateExpression == "ADD failures :one SET nextAttemptAt = :nextAttemptAt, expiresAt = :expiresAt REMOVE lockedUntil" &&
+			*input.ConditionExpression == "failures = :previousFailures AND firstFailureAt = :previousFirstFailureAt" &&
+			*input.ExpressionAttributeValues[":one"].N == "1" && *input.ExpressionAttributeValues[":previousFailures"].N == "1"
+	})
+	create := mock.MatchedBy(func(input *dynamodb.UpdateItemInput) bool {
+		return *input.ConditionExpression == "attribute_not_exists(#key) OR expiresAt < :now" &&
+			*input.ExpressionAttributeValues[":failures"].N == "1"
+	})
+	mockAwsDatabase.On("UpdateItem", create).Return(&dynamodb.UpdateItemOutput{}, nil).Once()
+	mockAwsDatabase.On("UpdateItem", increment).Return(nil, conditionFailed).Once()
+	mockAwsDatabseProvider.On("New", mock.Anything).Return(mockAwsDatabase, nil)
+	awsDatabaseProvider = mockAwsDatabseProvider
+	attemptsStore := NewLoginAttemptsStoreFromEnv()
+	attempts := lockout.Attempts{Key: "user#jdoe", Failures: 1, FirstFailureAt: first, NextAttemptAt: first.Add(time.Second)}
+	next := lockout.Attempts{Key: "user#jdoe", Failures: 2, FirstFailureAt: first, NextAttemptAt: first.Add(2 * time.Second)}
+
+	assert.Nil(t, attemptsStore.CompareAndPut(context.Background(), nil, attempts))
+	assert.Equal(t, lockout.ErrConflict, attemptsStore.CompareAndPut(context.Background(), &attempts, next))
+	mockAwsDatabase.AssertExpectations(t)
+}
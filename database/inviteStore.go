@@ -0,0 +1,64 @@
+package database
+
+import (
+	"context"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+
+	"sfr-backend/invite"
+)
+
+// InviteStore - invites table keyed by id, expiresAt is the table's TTL attribute
+type InviteStore struct {
+	Table string
+}
+
+// NewInviteStoreFromEnv - creates invite store using table from INVITES_TABLE,
+// Invites by default
+func NewInviteStoreFromEnv() *InviteStore {
+	table := os.Getenv("INVITES_TABLE")
+	if table == "" {
+		table = "Invites"
+	}
+	return &InviteStore{Table: table}
+}
+
+// Create - puts invite
+func (inviteStore *InviteStore) Create(ctx context.Context, pending invite.Invite) error {
+	item, err := dynamodbattribute.MarshalMap(pending)
+	if err != nil {
+		return err
+	}
+	_, err = fetchAwsSession(ctx).PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(inviteStore.Table),
+		Item:      item,
+	})
+	return err
+}
+
+// Consume - deletes invite and returns deleted item, concurrent acceptances can't both get it
+func (inviteStore *InviteStore) Consume(ctx context.Context, id string) (*invite.Invite, error) {
+	result, err := fetchAwsSession(ctx).DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String(inviteStore.Table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(id)},
+		},
+		ConditionExpression: aws.String("attribute_exists(id)"),
+		ReturnValues:        aws.String(dynamodb.ReturnValueAllOld),
+	})
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var pending invite.Invite
+	if err := dynamodbattribute.UnmarshalMap(result.Attributes, &pending); err != nil {
+		return nil, err
+	}
+	return &pending, nil
+}
@@ -0,0 +1,116 @@
+package database
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+
+	"sfr-backend/lockout"
+)
+
+// LoginAttemptsStore - failed login attempts table keyed by key, expiresAt is the table's TTL attribute
+type LoginAttemptsStore struct {
+	Table string
+}
+
+// NewLoginAttemptsStoreFromEnv - creates login attempts store using table from LOGIN_ATTEMPTS_TABLE,
+// LoginAttempts by default
+func NewLoginAttemptsStoreFromEnv() *LoginAttemptsStore {
+	table := os.Getenv("LOGIN_ATTEMPTS_TABLE")
+	if table == "" {
+		table = "LoginAttempts"
+	}
+	return &LoginAttemptsStore{Table: table}
+}
+
+// Get - returns attempts of key, nil when there are none or they expired but DynamoDB didn't delete them yet
+func (attemptsStore *LoginAttemptsStore) Get(ctx context.Context, key string) (*lockout.Attempts, error) {
+	result, err := fetchAwsSession(ctx).GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(attemptsStore.Table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"key": {S: aws.String(key)},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil || len(result.Item) == 0 {
+		return nil, err
+	}
+	var attempts lockout.Attempts
+	if err := dynamodbattribute.UnmarshalMap(result.Item, &attempts); err != nil {
+		return nil, err
+	}
+	if attempts.ExpiresAt < time.Now().Unix() {
+		return nil, nil
+	}
+	return &attempts, nil
+}
+
+// CompareAndPut - writes attempts with one conditional update, failure following previous in the same window
+// is added to stored counter, so concurrent failures on other instances are never overwritten
+func (attemptsStore *LoginAttemptsStore) CompareAndPut(ctx context.Context, previous *lockout.Attempts, attempts lockout.Attempts) error {
+	values := map[string]interface{}{
+		":nextAttemptAt": attempts.NextAttemptAt,
+		":expiresAt":     attempts.ExpiresAt,
+	}
+	update := "SET nextAttemptAt = :nextAttemptAt, expiresAt = :expiresAt"
+	if previous != nil && attempts.FirstFailureAt.Equal(previous.FirstFailureAt) {
+		update = "ADD failures :one " + update
+		values[":one"] = 1
+	} else {
+		update += ", failures = :failures, firstFailureAt = :firstFailureAt"
+		values[":failures"] = attempts.Failures
+		values[":firstFailureAt"] = attempts.FirstFailureAt
+	}
+	if attempts.LockedUntil != nil {
+		update += ", lockedUntil = :lockedUntil"
+		values[":lockedUntil"] = *attempts.LockedUntil
+	} else {
+		update += " REMOVE lockedUntil"
+	}
+	// expired attempts DynamoDB didn't delete yet were read as no attempts
+	condition := "attribute_not_exists(#key) OR expiresAt < :now"
+	values[":now"] = time.Now().Unix()
+	if previous != nil {
+		condition = "failures = :previousFailures AND firstFailureAt = :previousFirstFailureAt"
+		values[":previousFailures"] = previous.Failures
+		values[":previousFirstFailureAt"] = previous.FirstFailureAt
+		delete(values, ":now")
+	}
+	expressionValues, err := dynamodbattribute.MarshalMap(values)
+	if err != nil {
+		return err
+	}
+	input := &dynamodb.UpdateItemInput{
+		TableName: aws.String(attemptsStore.Table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"key": {S: aws.String(attempts.Key)},
+		},
+		UpdateExpression:          aws.String(update),
+		ConditionExpression:       aws.String(condition),
+		ExpressionAttributeValues: expressionValues,
+	}
+	if previous == nil {
+		input.ExpressionAttributeNames = map[string]*string{"#key": aws.String("key")}
+	}
+	_, err = fetchAwsSession(ctx).UpdateItem(input)
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return lockout.ErrConflict
+	}
+	return err
+}
+
+// Delete - forgets attempts of key
+func (attemptsStore *LoginAttemptsStore) Delete(ctx context.Context, key string) error {
+	_, err := fetchAwsSession(ctx).DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String(attemptsStore.Table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"key": {S: aws.String(key)},
+		},
+	})
+	return err
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"context"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+
+	"sfr-backend/password"
+)
+
+// PasswordResetStore - password reset tokens table keyed by id, expiresAt is the table's TTL attribute
+type PasswordResetStore struct {
+	Table string
+}
+
+// NewPasswordResetStoreFromEnv - creates password reset store using table from PASSWORD_RESETS_TABLE,
+// PasswordResets by default
+func NewPasswordResetStoreFromEnv() *PasswordResetStore {
+	table := os.Getenv("PASSWORD_RESETS_TABLE")
+	if table == "" {
+		table = "PasswordResets"
+	}
+	return &PasswordResetStore{Table: table}
+}
+
+// Create - puts reset token
+func (resetStore *PasswordResetStore) Create(ctx context.Context, token password.ResetToken) error {
+	item, err := dynamodbattribute.MarshalMap(token)
+	if err != nil {
+		return err
+	}
+	_, err = fetchAwsSession(ctx).PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(resetStore.Table),
+		Item:      item,
+	})
+	return err
+}
+
+// Consume - deletes reset token and returns deleted item, concurrent redemptions can't both get it
+func (resetStore *PasswordResetStore) Consume(ctx context.Context, id string) (*password.ResetToken, error) {
+	result, err := fetchAwsSession(ctx).DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String(resetStore.Table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(id)},
+		},
+		ConditionExpression: aws.String("attribute_exists(id)"),
+		ReturnValues:        aws.String(dynamodb.ReturnValueAllOld),
+	})
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var token password.ResetToken
+	if err := dynamodbattribute.UnmarshalMap(result.Attributes, &token); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
@@ -0,0 +1,71 @@
+package database
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+
+	"sfr-backend/revocation"
+)
+
+// RevocationStore - revoked tokens table keyed by id, expiresAt is the table's TTL attribute
+type RevocationStore struct {
+	Table string
+}
+
+// NewRevocationStoreFromEnv - creates revocation store using table from REVOKED_TOKENS_TABLE,
+// RevokedTokens by default
+func NewRevocationStoreFromEnv() *RevocationStore {
+	table := os.Getenv("REVOKED_TOKENS_TABLE")
+	if table == "" {
+		table = "RevokedTokens"
+	}
+	return &RevocationStore{Table: table}
+}
+
+// Revoke - puts id unless it is already revoked, entries past their expiration are replaced
+// as DynamoDB deletes expired items only eventually
+func (revocationStore *RevocationStore) Revoke(ctx context.Context, id string, expiresAt time.Time) error {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	_, err := fetchAwsSession(ctx).PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(revocationStore.Table),
+		Item: map[string]*dynamodb.AttributeValue{
+			"id":        {S: aws.String(id)},
+			"expiresAt": {N: aws.String(strconv.FormatInt(expiresAt.Unix(), 10))},
+		},
+		ConditionExpression:       aws.String("attribute_not_exists(id) OR expiresAt < :now"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":now": {N: aws.String(now)}},
+	})
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return revocation.ErrRevoked
+	}
+	return err
+}
+
+// IsRevoked - checks if id is stored and not expired
+func (revocationStore *RevocationStore) IsRevoked(ctx context.Context, id string) (bool, error) {
+	result, err := fetchAwsSession(ctx).GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(revocationStore.Table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(id)},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil || len(result.Item) == 0 {
+		return false, err
+	}
+	expiresAt, ok := result.Item["expiresAt"]
+	if !ok || expiresAt.N == nil {
+		return true, nil
+	}
+	expiration, err := strconv.ParseInt(*expiresAt.N, 10, 64)
+	if err != nil {
+		return false, err
+	}
+	return expiration > time.Now().Unix(), nil
+}
@@ -0,0 +1,92 @@
+package database
+
+import (
+	"context"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+
+	"sfr-backend/apikey"
+)
+
+// ServiceAccountStore - service accounts table keyed by name
+type ServiceAccountStore struct {
+	Table string
+}
+
+// NewServiceAccountStoreFromEnv - creates service account store using table from SERVICE_ACCOUNTS_TABLE,
+// ServiceAccounts by default
+func NewServiceAccountStoreFromEnv() *ServiceAccountStore {
+	table := os.Getenv("SERVICE_ACCOUNTS_TABLE")
+	if table == "" {
+		table = "ServiceAccounts"
+	}
+	return &ServiceAccountStore{Table: table}
+}
+
+// Get - returns service account or nil when it doesn't exist
+func (accountStore *ServiceAccountStore) Get(ctx context.Context, name string) (*apikey.ServiceAccount, error) {
+	result, err := fetchAwsSession(ctx).GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(accountStore.Table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"name": {S: aws.String(name)},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Item) == 0 {
+		return nil, nil
+	}
+	var account apikey.ServiceAccount
+	if err := dynamodbattribute.UnmarshalMap(result.Item, &account); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// List - returns all service accounts
+func (accountStore *ServiceAccountStore) List(ctx context.Context) ([]apikey.ServiceAccount, error) {
+	accounts := []apikey.ServiceAccount{}
+	err := scanAll(ctx, &dynamodb.ScanInput{TableName: aws.String(accountStore.Table)}, func(item map[string]*dynamodb.AttributeValue) error {
+		var account apikey.ServiceAccount
+		if err := dynamodbattribute.UnmarshalMap(item, &account); err != nil {
+			return err
+		}
+		accounts = append(accounts, account)
+		return nil
+	})
+	return accounts, err
+}
+
+// Create - puts new service account, existing names are never overwritten
+func (accountStore *ServiceAccountStore) Create(ctx context.Context, account apikey.ServiceAccount) error {
+	return accountStore.put(ctx, account, "attribute_not_exists(#name)", apikey.ErrExists)
+}
+
+// Update - replaces service account unless it was revoked meanwhile
+func (accountStore *ServiceAccountStore) Update(ctx context.Context, account apikey.ServiceAccount) error {
+	return accountStore.put(ctx, account, "attribute_exists(#name) AND attribute_not_exists(revokedAt)", apikey.ErrRevoked)
+}
+
+// put - puts service account with condition, failed condition is returned as conditionErr
+func (accountStore *ServiceAccountStore) put(ctx context.Context, account apikey.ServiceAccount, condition string, conditionErr error) error {
+	item, err := dynamodbattribute.MarshalMap(account)
+	if err != nil {
+		return err
+	}
+	_, err = fetchAwsSession(ctx).PutItem(&dynamodb.PutItemInput{
+		TableName:                aws.String(accountStore.Table),
+		Item:                     item,
+		ConditionExpression:      aws.String(condition),
+		ExpressionAttributeNames: map[string]*string{"#name": aws.String("name")},
+	})
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return conditionErr
+	}
+	return err
+}
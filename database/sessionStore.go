@@ -0,0 +1,103 @@
+package database
+
+import (
+	"context"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+
+	"sfr-backend/session"
+)
+
+// SessionStore - sessions table with partition key username and sort key id, expiresAt is the table's TTL attribute
+type SessionStore struct {
+	Table string
+}
+
+// NewSessionStoreFromEnv - creates session store using table from SESSIONS_TABLE,
+// Sessions by default
+func NewSessionStoreFromEnv() *SessionStore {
+	table := os.Getenv("SESSIONS_TABLE")
+	if table == "" {
+		table = "Sessions"
+	}
+	return &SessionStore{Table: table}
+}
+
+// Save - puts session
+func (sessionStore *SessionStore) Save(ctx context.Context, stored session.Session) error {
+	item, err := dynamodbattribute.MarshalMap(stored)
+	if err != nil {
+		return err
+	}
+	_, err = fetchAwsSession(ctx).PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(sessionStore.Table),
+		Item:      item,
+	})
+	return err
+}
+
+// Get - returns session, nil when it doesn't exist
+func (sessionStore *SessionStore) Get(ctx context.Context, username string, id string) (*session.Session, error) {
+	result, err := fetchAwsSession(ctx).GetItem(&dynamodb.GetItemInput{
+		TableName:      aws.String(sessionStore.Table),
+		Key:            sessionKey(username, id),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil || len(result.Item) == 0 {
+		return nil, err
+	}
+	var stored session.Session
+	if err := dynamodbattribute.UnmarshalMap(result.Item, &stored); err != nil {
+		return nil, err
+	}
+	return &stored, nil
+}
+
+// List - queries all sessions of user
+func (sessionStore *SessionStore) List(ctx context.Context, username string) ([]session.Session, error) {
+	svc := fetchAwsSession(ctx)
+	input := &dynamodb.QueryInput{
+		TableName:                aws.String(sessionStore.Table),
+		KeyConditionExpression:   aws.String("#username = :username"),
+		ExpressionAttributeNames: map[string]*string{"#username": aws.String("username")},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":username": {S: aws.String(username)},
+		},
+		ConsistentRead: aws.Bool(true),
+	}
+	sessions := []session.Session{}
+	for {
+		output, err := svc.Query(input)
+		if err != nil {
+			return nil, err
+		}
+		page := []session.Session{}
+		if err := dynamodbattribute.UnmarshalListOfMaps(output.Items, &page); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, page...)
+		if len(output.LastEvaluatedKey) == 0 {
+			return sessions, nil
+		}
+		input.ExclusiveStartKey = output.LastEvaluatedKey
+	}
+}
+
+// Delete - deletes session, deleting missing session is not an error
+func (sessionStore *SessionStore) Delete(ctx context.Context, username string, id string) error {
+	_, err := fetchAwsSession(ctx).DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String(sessionStore.Table),
+		Key:       sessionKey(username, id),
+	})
+	return err
+}
+
+func sessionKey(username string, id string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"username": {S: aws.String(username)},
+		"id":       {S: aws.String(id)},
+	}
+}
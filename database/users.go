@@ -0,0 +1,147 @@
+package database
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+
+	"sfr-backend/user"
+)
+
+// ListUsers - returns page of at most limit users starting after nextToken and token of next page,
+// empty token when there are no more users
+func ListUsers(ctx context.Context, limit int64, nextToken string) ([]user.UserDetails, string, error) {
+	input := &dynamodb.ScanInput{
+		TableName: aws.String("UserDetails"),
+		Limit:     aws.Int64(limit),
+	}
+	if nextToken != "" {
+		input.ExclusiveStartKey = map[string]*dynamodb.AttributeValue{"username": {S: aws.String(nextToken)}}
+	}
+	output, err := fetchAwsSession(ctx).Scan(input)
+	if err != nil {
+		return nil, "", err
+	}
+	users := []user.UserDetails{}
+	if err := dynamodbattribute.UnmarshalListOfMaps(output.Items, &users); err != nil {
+		return nil, "", err
+	}
+	if key, ok := output.LastEvaluatedKey["username"]; ok && key.S != nil {
+		return users, *key.S, nil
+	}
+	return users, "", nil
+}
+
+// GetUserByIdentity - returns user linked to account at identity provider, empty user when no user is linked
+func GetUserByIdentity(ctx context.Context, issuer string, subject string) (user.UserDetails, error) {
+	input := &dynamodb.ScanInput{
+		TableName:        aws.String("UserDetails"),
+		FilterExpression: aws.String("oidcIssuer = :issuer AND oidcSubject = :subject"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":issuer":  {S: aws.String(issuer)},
+			":subject": {S: aws.String(subject)},
+		},
+	}
+	linked := user.UserDetails{}
+	err := scanAll(ctx, input, func(item map[string]*dynamodb.AttributeValue) error {
+		return dynamodbattribute.UnmarshalMap(item, &linked)
+	})
+	return linked, err
+}
+
+// UpdateUser - sets attributes of existing user which are not nil in update, returns user after update
+// or user.ErrNotFound when user doesn't exist, so deleted users are never recreated
+func UpdateUser(ctx context.Context, username string, update user.Update) (user.UserDetails, error) {
+	type attribute struct {
+		name  string
+		value interface{}
+	}
+	var attributes []attribute
+	if update.Firstname != nil {
+		attributes = append(attributes, attribute{"firstname", *update.Firstname})
+	}
+	if update.Lastname != nil {
+		attributes = append(attributes, attribute{"lastname", *update.Lastname})
+	}
+	if update.Email != nil {
+		attributes = append(attributes, attribute{"email", *update.Email})
+	}
+	if update.EmailVerified != nil {
+		attributes = append(attributes, attribute{"emailVerified", *update.EmailVerified})
+	}
+	if update.Grants != nil {
+		attributes = append(attributes, attribute{"grants", *update.Grants})
+	}
+	if update.GroupGrants != nil {
+		attributes = append(attributes, attribute{"groupGrants", *update.GroupGrants})
+	}
+	if update.Disabled != nil {
+		attributes = append(attributes, attribute{"disabled", *update.Disabled})
+	}
+	if update.OIDCIssuer != nil {
+		attributes = append(attributes, attribute{"oidcIssuer", *update.OIDCIssuer})
+	}
+	if update.OIDCSubject != nil {
+		attributes = append(attributes, attribute{"oidcSubject", *update.OIDCSubject})
+	}
+	input := &dynamodb.UpdateItemInput{
+		TableName: aws.String("UserDetails"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"username": {S: aws.String(username)},
+		},
+		ConditionExpression:       aws.String("attribute_exists(username)"),
+		ExpressionAttributeNames:  map[string]*string{},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{},
+		ReturnValues:              aws.String(dynamodb.ReturnValueAllNew),
+	}
+	expression := ""
+	for _, attribute := range attributes {
+		name := attribute.name
+		av, err := dynamodbattribute.Marshal(attribute.value)
+		if err != nil {
+			return user.UserDetails{}, err
+		}
+		if expression != "" {
+			expression += ", "
+		}
+		expression += "#" + name + " = :" + name
+		input.ExpressionAttributeNames["#"+name] = aws.String(name)
+		input.ExpressionAttributeValues[":"+name] = av
+	}
+	if expression == "" {
+		// nothing to change, the user is only read
+		userDetails := GetUserDetails(ctx, username)
+		if userDetails.Username == "" {
+			return userDetails, user.ErrNotFound
+		}
+		return userDetails, nil
+	}
+	input.UpdateExpression = aws.String("SET " + expression)
+	output, err := fetchAwsSession(ctx).UpdateItem(input)
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return user.UserDetails{}, user.ErrNotFound
+	}
+	if err != nil {
+		return user.UserDetails{}, err
+	}
+	updated := user.UserDetails{}
+	err = dynamodbattribute.UnmarshalMap(output.Attributes, &updated)
+	return updated, err
+}
+
+// DeleteUser - deletes user, returns user.ErrNotFound when user doesn't exist
+func DeleteUser(ctx context.Context, username string) error {
+	_, err := fetchAwsSession(ctx).DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String("UserDetails"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"username": {S: aws.String(username)},
+		},
+		ConditionExpression: aws.String("attribute_exists(username)"),
+	})
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return user.ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,117 @@
+package docs
+
+import "sfr-backend/approval"
+
+// swagger:route GET /approvals approvals-endpoint idGetApprovals
+// Returns change requests of protected machines with given status, only of machines caller can read.
+// responses:
+//   200: approvalsResponse
+
+// swagger:route GET /approvals/{id} approvals-endpoint idGetApproval
+// Returns single change request, change requests of machines caller can't read are not found.
+// responses:
+//   200: approvalResponse
+//   404: authfailureResponse
+
+// swagger:route POST /approvals/{id}/approve approvals-endpoint idApprove
+// Approves pending change request and starts its executions. Requester can't approve own change request.
+// Accepts application/json body {"reason": "..."} instead of form values.
+// responses:
+//   200: approvalResponse
+
+// swagger:route POST /approvals/{id}/reject approvals-endpoint idReject
+// Rejects pending change request, requester can reject own change request to cancel it.
+// Accepts application/json body {"reason": "..."} instead of form values.
+// responses:
+//   200: approvalResponse
+
+// swagger:route GET /protected-machines approvals-endpoint idGetProtectedMachines
+// Returns machines which starts, restarts and batch restarts need approval.
+// responses:
+//   200: protectedMachinesResponse
+
+// swagger:route PUT /protected-machines/{machine} approvals-endpoint idProtectMachine
+// Marks machine as protected, admin only.
+// responses:
+//   200: protectedMachineResponse
+
+// swagger:route DELETE /protected-machines/{machine} approvals-endpoint idUnprotectMachine
+// Removes protection of machine, admin only.
+// responses:
+//   204: description: Machine is not protected anymore
+
+// swagger:parameters idGetApprovals
+type approvalsWrapper struct {
+	// Status of change requests: pending (default), approved, executed, failed or rejected.
+	// in:query
+	// name:status
+	// required:false
+	Status string `json:"status"`
+	// JWT Token for authentication in subsequent operations
+	// in:header
+	Authentication string
+}
+
+// swagger:parameters idGetApproval idApprove idReject
+type approvalWrapper struct {
+	// Change request ID.
+	// in:path
+	// name:id
+	// required:true
+	ID string `json:"id"`
+	// Comment stored with decision.
+	// in:formData
+	// name:reason
+	// required:false
+	Reason string `json:"reason"`
+	// JWT Token for authentication in subsequent operations
+	// in:header
+	Authentication string
+}
+
+// swagger:parameters idGetProtectedMachines
+type protectedMachinesWrapper struct {
+	// JWT Token for authentication in subsequent operations
+	// in:header
+	Authentication string
+}
+
+// swagger:parameters idProtectMachine idUnprotectMachine
+type protectedMachineWrapper struct {
+	// State Machine's ARN.
+	// in:path
+	// name:machine
+	// required:true
+	Machine string `json:"machine"`
+	// JWT Token for authentication in subsequent operations
+	// in:header
+	Authentication string
+}
+
+// Returns a JSON with change requests.
+// swagger:response approvalsResponse
+type approvalsResponse struct {
+	// in:body
+	Body []approval.ChangeRequest
+}
+
+// Returns a JSON with change request. Starts of protected machines respond with it and status 202.
+// swagger:response approvalResponse
+type approvalResponse struct {
+	// in:body
+	Body approval.ChangeRequest
+}
+
+// Returns a JSON with protected machines.
+// swagger:response protectedMachinesResponse
+type protectedMachinesResponse struct {
+	// in:body
+	Body []approval.ProtectedMachine
+}
+
+// Returns a JSON with protected machine.
+// swagger:response protectedMachineResponse
+type protectedMachineResponse struct {
+	// in:body
+	Body approval.ProtectedMachine
+}
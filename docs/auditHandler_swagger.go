@@ -0,0 +1,47 @@
+package docs
+
+import "sfr-backend/audit"
+
+// swagger:route GET /audit audit-endpoint idGetAudit
+// Returns audit events of logins, user creation and execution starts, newest first. Only users with admin role can read them.
+// responses:
+//   200: auditResponse
+
+// swagger:parameters idGetAudit
+type auditWrapper struct {
+	// Only events of this user.
+	// in:query
+	// name:user
+	// required:false
+	User string `json:"user"`
+	// Only events of this action, one of login, create_user, start_execution, restart_execution, batch_restart or stop_execution.
+	// in:query
+	// name:action
+	// required:false
+	Action string `json:"action"`
+	// Start of the time window in RFC3339 format, defaults to 24 hours before to.
+	// in:query
+	// name:from
+	// required:false
+	From string `json:"from"`
+	// End of the time window in RFC3339 format, defaults to now. Window can't be longer than 31 days.
+	// in:query
+	// name:to
+	// required:false
+	To string `json:"to"`
+	// Max number of returned events, defaults to 100, at most 1000.
+	// in:query
+	// name:limit
+	// required:false
+	Limit int32 `json:"limit"`
+	// JWT Token for authentication in subsequent operations
+	// in:header
+	Authentication string
+}
+
+// Returns a JSON with audit events.
+// swagger:response auditResponse
+type auditResponse struct {
+	// in:body
+	Body audit.EventsResponse
+}
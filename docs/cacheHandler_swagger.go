@@ -0,0 +1,23 @@
+package docs
+
+import awsprovider "sfr-backend/awsProvider"
+
+// swagger:route GET /aws/cache cache-endpoint idGetCacheStats
+// Returns hits, misses, bypasses, evictions and oversized responses of the Step Functions read cache per operation.
+// Any Step Functions endpoint can skip the cache by sending Cache-Control: no-cache.
+// responses:
+//   200: cacheStatsResponse
+
+// swagger:parameters idGetCacheStats
+type cacheStatsWrapper struct {
+	// JWT Token for authentication in subsequent operations
+	// in:header
+	Authentication string
+}
+
+// Returns cache counters keyed by Step Functions operation.
+// swagger:response cacheStatsResponse
+type cacheStatsResponse struct {
+	// in:body
+	Body map[string]awsprovider.CacheStats
+}
@@ -0,0 +1,10 @@
+package docs
+
+import errHandler "sfr-backend/error"
+
+// RFC 7807 problem document with AWS error code, transaction id and whether the request can be retried.
+// swagger:response problemResponse
+type problemResponse struct {
+	// in:body
+	Body errHandler.Problem
+}
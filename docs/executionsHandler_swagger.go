@@ -8,6 +8,7 @@ import (
 // Returns the list of executions for a provided stepfunction.
 // responses:
 //   200: getExecutionsResponse
+//   default: problemResponse
 
 // swagger:parameters idGetExecutions
 type getExecutionsWrapper struct {
@@ -47,6 +48,7 @@ type getExecutionsResponse struct {
 // Returns a specific execution.
 // responses:
 //   200: getExecutionResponse
+//   default: problemResponse
 
 // swagger:parameters idGetExecution
 type getExecutionWrapper struct {
@@ -69,8 +71,11 @@ type getExecutionResponse struct {
 
 // swagger:route POST /aws/execution executions-endpoint idCreateExecution
 // Executes a specific stepfunction with given parameters.
+// Accepts application/json body {"machine": "...", "input": {...}, "name": "..."} instead of form values.
 // responses:
 //   200: executionResponse
+//   409: existingExecutionResponse
+//   default: problemResponse
 
 // swagger:parameters idCreateExecution
 type executionWrapper struct {
@@ -84,6 +89,17 @@ type executionWrapper struct {
 	// name:input
 	// required:true
 	Input string `json:"input"`
+	// Execution name or name template, supports {machine}, {execution}, {key}, {date}, {time}, {hash(input)} and {hash(execution)}.
+	// Starting an execution with an already used name returns 409 with the existing execution.
+	// in:formData
+	// name:name
+	// required:false
+	Name string `json:"name"`
+	// Key used as execution name when name is not provided, makes retries idempotent.
+	// in:header
+	// name:Idempotency-Key
+	// required:false
+	IdempotencyKey string
 	// JWT Token for authentication in subsequent operations
 	// in:header
 	Authentication string
@@ -98,8 +114,11 @@ type executionResponse struct {
 
 // swagger:route POST /aws/execution/restart executions-endpoint idRecreateExecution
 // Executes a specific stepfunction with same original parameters.
+// Accepts application/json body {"machine": "...", "execution": "...", "name": "..."} instead of form values.
 // responses:
 //   200: executionRestartResponse
+//   409: existingExecutionResponse
+//   default: problemResponse
 
 // swagger:parameters idRecreateExecution
 type reexecutionWrapper struct {
@@ -113,6 +132,17 @@ type reexecutionWrapper struct {
 	// name:execution
 	// required:true
 	Execution string `json:"execution"`
+	// Execution name or name template, supports {machine}, {execution}, {key}, {date}, {time}, {hash(input)} and {hash(execution)}.
+	// Starting an execution with an already used name returns 409 with the existing execution.
+	// in:formData
+	// name:name
+	// required:false
+	Name string `json:"name"`
+	// Key used as execution name when name is not provided, makes retries idempotent.
+	// in:header
+	// name:Idempotency-Key
+	// required:false
+	IdempotencyKey string
 	// JWT Token for authentication in subsequent operations
 	// in:header
 	Authentication string
@@ -127,8 +157,10 @@ type executionRestartResponse struct {
 
 // swagger:route POST /aws/execution/batch executions-endpoint idBatchExecution
 // Rexecutes a list of stepfunctions with original parameters.
+// Accepts application/json body {"machine": "...", "executions": ["..."], "useOriginalInput": true, "input": {...}, "name": "..."} instead of form values.
 // responses:
 //   200: executionBatchResponse
+//   default: problemResponse
 
 // swagger:parameters idBatchExecution
 type executionBatchWrapper struct {
@@ -152,6 +184,17 @@ type executionBatchWrapper struct {
 	// name:input
 	// required:false
 	Input string `json:"input"`
+	// Execution name or name template, supports {machine}, {execution}, {key}, {date}, {time}, {hash(input)} and {hash(execution)}.
+	// Starting an execution with an already used name returns 409 with the existing execution.
+	// in:formData
+	// name:name
+	// required:false
+	Name string `json:"name"`
+	// Key used as execution name when name is not provided, makes retries idempotent.
+	// in:header
+	// name:Idempotency-Key
+	// required:false
+	IdempotencyKey string
 	// JWT Token for authentication in subsequent operations
 	// in:header
 	Authentication string
@@ -162,5 +205,13 @@ type executionBatchWrapper struct {
 type executionBatchResponse struct {
 	// in:body
 	Execution []sfn.StartExecutionOutput
+	Existing  []sfn.DescribeExecutionOutput
 	Errors    []string
 }
+
+// Returns a JSON with the execution already started with the requested name.
+// swagger:response existingExecutionResponse
+type existingExecutionResponse struct {
+	// in:body
+	Body sfn.DescribeExecutionOutput
+}
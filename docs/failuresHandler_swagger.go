@@ -0,0 +1,43 @@
+package docs
+
+import "sfr-backend/failure"
+
+// swagger:route GET /aws/machines/{machine}/failures failures-endpoint idGetFailures
+// Returns failed and timed out executions of a stepfunction grouped by error and normalized cause.
+// responses:
+//   200: failuresResponse
+//   default: problemResponse
+
+// swagger:parameters idGetFailures
+type failuresWrapper struct {
+	// State Machine's ARN.
+	// in:path
+	// name:machine
+	// required:true
+	Machine string `json:"machine"`
+	// Start of the time window in RFC3339 format, defaults to 24 hours before to.
+	// in:query
+	// name:from
+	// required:false
+	From string `json:"from"`
+	// End of the time window in RFC3339 format, defaults to now.
+	// in:query
+	// name:to
+	// required:false
+	To string `json:"to"`
+	// Max number of failed executions inspected, defaults to 200, at most 1000.
+	// in:query
+	// name:limit
+	// required:false
+	Limit int32 `json:"limit"`
+	// JWT Token for authentication in subsequent operations
+	// in:header
+	Authentication string
+}
+
+// Returns a JSON with failure clusters, biggest first.
+// swagger:response failuresResponse
+type failuresResponse struct {
+	// in:body
+	Body failure.FailuresResponse
+}
@@ -8,8 +8,9 @@ import (
 // Healthcheck returns a fixed JSON structure for healthcheck.
 // responses:
 //   200: healthcheckResponse
+//   503: healthcheckResponse
 
-// Returns a JSON with an element STATUS with the OK text.
+// Returns a JSON with an element STATUS with the OK text, or DRAINING with 503 while the instance shuts down.
 // swagger:response healthcheckResponse
 type healthcheckResponse struct {
 	// in:body
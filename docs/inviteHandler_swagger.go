@@ -0,0 +1,62 @@
+package docs
+
+import "sfr-backend/authentication"
+
+// swagger:route POST /invites users-endpoint idCreateInvite
+// Creates invite with grants of new user and emails signed link accepting it. Only users with admin role can call it.
+// responses:
+//   201: inviteResponse
+//   400: authfailureResponse
+//   409: authfailureResponse
+
+// swagger:route DELETE /invites/{id} users-endpoint idRevokeInvite
+// Revokes pending invite, its link stops working. Only users with admin role can call it.
+// responses:
+//   200: deleteUserResponse
+//   404: authfailureResponse
+
+// swagger:route POST /invites/{token}/accept users-endpoint idAcceptInvite
+// Creates invited user with chosen password, email of the user is verified. The token from the link works once until the invite expires.
+// responses:
+//   201: userResponse
+//   400: authfailureResponse
+//   409: authfailureResponse
+
+// swagger:parameters idCreateInvite
+type createInviteWrapper struct {
+	// Email, optional username (email by default), grants and expiresIn duration (INVITE_TTL by default).
+	// in:body
+	Body authentication.CreateInviteRequest
+	// JWT Token for authentication in subsequent operations
+	// in:header
+	Authentication string
+}
+
+// swagger:parameters idRevokeInvite
+type revokeInviteWrapper struct {
+	// Id of invite returned when it was created.
+	// in:path
+	// required:true
+	ID string `json:"id"`
+	// JWT Token for authentication in subsequent operations
+	// in:header
+	Authentication string
+}
+
+// swagger:parameters idAcceptInvite
+type acceptInviteWrapper struct {
+	// Token from invite link.
+	// in:path
+	// required:true
+	Token string `json:"token"`
+	// Password and name of the new user.
+	// in:body
+	Body authentication.AcceptInviteRequest
+}
+
+// Created invite.
+// swagger:response inviteResponse
+type inviteResponse struct {
+	// in:body
+	Body authentication.InviteResponse
+}
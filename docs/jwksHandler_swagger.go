@@ -0,0 +1,15 @@
+package docs
+
+import "sfr-backend/signing"
+
+// swagger:route GET /.well-known/jwks.json users-endpoint idJWKS
+// Returns public keys verifying access tokens, kid header of token selects the key. HMAC keys are never published.
+// responses:
+//   200: jwksResponse
+
+// Returns a JSON web key set.
+// swagger:response jwksResponse
+type jwksResponse struct {
+	// in:body
+	Body signing.JSONWebKeySet
+}
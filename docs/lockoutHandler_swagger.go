@@ -0,0 +1,23 @@
+package docs
+
+// swagger:route DELETE /users/{username}/lockout users-endpoint idUnlockUser
+// Forgets failed logins and lockout of user. Only users with admin role can call it.
+// responses:
+//   200: unlockResponse
+
+// swagger:parameters idUnlockUser
+type unlockUserWrapper struct {
+	// Locked out user.
+	// in:path
+	// required:true
+	Username string `json:"username"`
+	// JWT Token for authentication in subsequent operations
+	// in:header
+	Authentication string
+}
+
+// Returns a fixed string with a message.
+// swagger:response unlockResponse
+type unlockResponse struct {
+	result string
+}
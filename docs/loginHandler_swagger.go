@@ -1,12 +1,14 @@
 package docs
 
 import (
+	"sfr-backend/authentication"
 	"sfr-backend/models"
 	"sfr-backend/user"
 )
 
 // swagger:route POST /login users-endpoint idLoginEndpoint
 // login returns a fixed string SUCCESS when user is properly logged in.
+// Users with multi-factor authentication get mfaRequired and challengeToken to be sent to /login/mfa instead of tokens.
 // responses:
 //   200: loginResponse
 
@@ -34,25 +36,29 @@ type authfailureResponse struct {
 }
 
 // swagger:route POST /createuser users-endpoint idCreateUserEndpoint
-// Returns a complete user when it is created successfully.
+// Returns created user. Only users with admin role can call it, existing users are not overwritten.
 // responses:
 //   200: createuserResponse
+//   409: authfailureResponse
 
 // swagger:parameters idCreateUserEndpoint
 type createUserParamsWrapper struct {
 	// Complete User body needed for new user creation.
 	// in:body
 	Body user.UserDetails
+	// JWT Token for authentication in subsequent operations
+	// in:header
+	Authentication string
 }
 
 // Returns a fixed string with a STATUS string
 // swagger:response createuserResponse
 type createuserResponse struct {
-	result user.UserDetails
+	result authentication.UserResponse
 }
 
 // swagger:route POST /logout users-endpoint idLogoutEndpoint
-// Returns a complete user when it is created successfully.
+// Revokes access token and all refresh tokens issued since login, expired access token is accepted.
 // responses:
 //   200: logoutResponse
 
@@ -70,7 +76,8 @@ type logoutResponse struct {
 }
 
 // swagger:route POST /refreshtoken users-endpoint idRefreshToken
-// Refreshes JWT Token data.
+// Refreshes JWT Token data. Returns new refresh token too, every refresh token can be used once,
+// using it again revokes all tokens issued since login.
 // responses:
 //   200: refreshTokenResponse
 
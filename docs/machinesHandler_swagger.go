@@ -6,6 +6,7 @@ import "github.com/aws/aws-sdk-go/service/sfn"
 // Returns machine's list from current AWS environment.
 // responses:
 //   200: machinesResponse
+//   default: problemResponse
 
 // swagger:parameters idMachinesEndpoint
 type machinesWrapper struct {
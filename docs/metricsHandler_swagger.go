@@ -0,0 +1,24 @@
+package docs
+
+// swagger:route GET /metrics metrics-endpoint idGetMetrics
+// Returns Prometheus metrics in text exposition format.
+// Requires Authorization: Bearer <METRICS_TOKEN> header when METRICS_TOKEN is set.
+// responses:
+//   200: metricsResponse
+//   401: authfailureResponse
+
+// swagger:parameters idGetMetrics
+type metricsWrapper struct {
+	// Bearer METRICS_TOKEN
+	// in:header
+	// name:Authorization
+	// required:false
+	Authorization string
+}
+
+// Returns metrics in Prometheus text format.
+// swagger:response metricsResponse
+type metricsResponse struct {
+	// in:body
+	Body string
+}
@@ -0,0 +1,80 @@
+package docs
+
+import "sfr-backend/authentication"
+
+// swagger:route POST /login/mfa users-endpoint idMFALogin
+// Second step of login of users with multi-factor authentication. Exchanges challenge token returned by /login
+// and code from authenticator app or unused recovery code for access and refresh tokens.
+// responses:
+//   200: loginResponse
+//   401: authfailureResponse
+//   429: authfailureResponse
+
+// swagger:route POST /me/mfa users-endpoint idEnrollMFA
+// Generates TOTP secret and recovery codes of logged in user. Second factor is required after it is confirmed.
+// responses:
+//   200: mfaEnrollmentResponse
+//   409: authfailureResponse
+
+// swagger:route POST /me/mfa/confirm users-endpoint idConfirmMFA
+// Enables enrolled second factor with first code from authenticator app.
+// responses:
+//   200: mfaResponse
+
+// swagger:route POST /me/mfa/disable users-endpoint idDisableMFA
+// Disables second factor of logged in user, code or recovery code is required.
+// responses:
+//   200: mfaResponse
+
+// swagger:route DELETE /users/{username}/mfa users-endpoint idResetMFA
+// Removes second factor of user who lost it. Only users with admin role can call it.
+// responses:
+//   200: mfaResponse
+
+// swagger:parameters idMFALogin
+type mfaLoginWrapper struct {
+	// Challenge token and code or recovery code.
+	// in:body
+	Body authentication.MFALoginRequest
+}
+
+// swagger:parameters idEnrollMFA
+type enrollMFAWrapper struct {
+	// JWT Token for authentication in subsequent operations
+	// in:header
+	Authentication string
+}
+
+// swagger:parameters idConfirmMFA idDisableMFA
+type mfaCodeWrapper struct {
+	// Code from authenticator app, recovery code is accepted only to disable second factor.
+	// in:body
+	Body authentication.MFACodeRequest
+	// JWT Token for authentication in subsequent operations
+	// in:header
+	Authentication string
+}
+
+// swagger:parameters idResetMFA
+type resetMFAWrapper struct {
+	// User whose second factor is removed.
+	// in:path
+	// required:true
+	Username string `json:"username"`
+	// JWT Token for authentication in subsequent operations
+	// in:header
+	Authentication string
+}
+
+// Secret and otpauth URI for authenticator app and recovery codes, shown only once.
+// swagger:response mfaEnrollmentResponse
+type mfaEnrollmentResponse struct {
+	// in:body
+	Body authentication.MFAEnrollmentResponse
+}
+
+// Returns a fixed string with a message.
+// swagger:response mfaResponse
+type mfaResponse struct {
+	result string
+}
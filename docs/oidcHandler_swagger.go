@@ -0,0 +1,41 @@
+package docs
+
+import (
+	"sfr-backend/authentication"
+	"sfr-backend/models"
+)
+
+// swagger:route GET /oidc/login users-endpoint idOIDCLogin
+// Starts single sign-on. Frontend keeps loginState and redirects user to authorizationUrl,
+// identity provider redirects user back to OIDC_REDIRECT_URL with code and state.
+// responses:
+//   200: oidcLoginResponse
+
+// swagger:route POST /oidc/callback users-endpoint idOIDCCallback
+// Finishes single sign-on and returns tokens like /login. Users are created on first login.
+// Existing accounts with password are used only after admin linked them.
+// responses:
+//   200: oidcCallbackResponse
+//   401: authfailureResponse
+//   403: authfailureResponse
+
+// swagger:parameters idOIDCCallback
+type oidcCallbackWrapper struct {
+	// Code and state from redirect of identity provider and loginState returned by /oidc/login.
+	// in:body
+	Body authentication.OIDCCallbackRequest
+}
+
+// Returns a JSON with authorization URL and login state.
+// swagger:response oidcLoginResponse
+type oidcLoginResponse struct {
+	// in:body
+	Body authentication.OIDCLoginResponse
+}
+
+// Returns a JSON with user details and tokens.
+// swagger:response oidcCallbackResponse
+type oidcCallbackResponse struct {
+	// in:body
+	Body models.UserDetailsDto
+}
@@ -0,0 +1,67 @@
+package docs
+
+import "sfr-backend/authentication"
+
+// swagger:route POST /me/password users-endpoint idChangePassword
+// Changes password of logged in user, current password is required and new one has to follow password policy.
+// Other sessions of the user are revoked.
+// responses:
+//   200: passwordResponse
+//   401: authfailureResponse
+
+// swagger:route POST /password-reset users-endpoint idRequestPasswordReset
+// Sends single use reset link to email of user. Response is the same whether the user exists or not.
+// responses:
+//   202: passwordResponse
+
+// swagger:route POST /password-reset/confirm users-endpoint idResetPassword
+// Sets new password with token from reset link, the token works once until PASSWORD_RESET_TTL passes.
+// All sessions of the user are revoked.
+// responses:
+//   200: passwordResponse
+
+// swagger:route POST /users/{username}/password-reset users-endpoint idAdminPasswordReset
+// Sends reset link to email of user. Only users with admin role can call it.
+// responses:
+//   202: passwordResponse
+
+// swagger:parameters idChangePassword
+type changePasswordWrapper struct {
+	// Current and new password.
+	// in:body
+	Body authentication.ChangePasswordRequest
+	// JWT Token for authentication in subsequent operations
+	// in:header
+	Authentication string
+}
+
+// swagger:parameters idRequestPasswordReset
+type requestPasswordResetWrapper struct {
+	// User whose password is reset.
+	// in:body
+	Body authentication.PasswordResetRequest
+}
+
+// swagger:parameters idResetPassword
+type resetPasswordWrapper struct {
+	// Token from reset link and new password.
+	// in:body
+	Body authentication.ResetPasswordRequest
+}
+
+// swagger:parameters idAdminPasswordReset
+type adminPasswordResetWrapper struct {
+	// User whose password is reset.
+	// in:path
+	// required:true
+	Username string `json:"username"`
+	// JWT Token for authentication in subsequent operations
+	// in:header
+	Authentication string
+}
+
+// Returns a fixed string with a message.
+// swagger:response passwordResponse
+type passwordResponse struct {
+	result string
+}
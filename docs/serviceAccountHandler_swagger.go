@@ -0,0 +1,91 @@
+package docs
+
+import "sfr-backend/apikey"
+
+// swagger:route GET /service-accounts service-accounts-endpoint idGetServiceAccounts
+// Returns service accounts, keys are never returned. Only users with admin role can manage service accounts.
+// responses:
+//   200: serviceAccountsResponse
+
+// swagger:route POST /service-accounts service-accounts-endpoint idCreateServiceAccount
+// Creates service account and returns its API key. The key is shown only once.
+// Accepts application/json body {"name": "...", "description": "...", "scopes": ["read"], "grants": [...]} instead of form values.
+// responses:
+//   201: serviceAccountKeyResponse
+
+// swagger:route POST /service-accounts/{name}/rotate service-accounts-endpoint idRotateServiceAccountKey
+// Returns new API key of service account, previous key keeps working until API_KEY_ROTATION_GRACE passes.
+// responses:
+//   200: serviceAccountKeyResponse
+
+// swagger:route POST /service-accounts/{name}/revoke service-accounts-endpoint idRevokeServiceAccount
+// Revokes service account, its keys stop working immediately.
+// responses:
+//   200: serviceAccountResponse
+
+// swagger:parameters idGetServiceAccounts
+type serviceAccountsWrapper struct {
+	// JWT Token for authentication in subsequent operations
+	// in:header
+	Authentication string
+}
+
+// swagger:parameters idCreateServiceAccount
+type createServiceAccountWrapper struct {
+	// Name of service account, lowercase letters, digits and dashes.
+	// in:formData
+	// name:name
+	// required:true
+	Name string `json:"name"`
+	// Description of service account.
+	// in:formData
+	// name:description
+	// required:false
+	Description string `json:"description"`
+	// Comma separated routes the key can call: read, execute and batch.
+	// in:formData
+	// name:scopes
+	// required:true
+	Scopes string `json:"scopes"`
+	// JSON list of grants, e.g. [{"role": "operator", "machine": "arn:aws:states:*:*:stateMachine:deploy-*"}].
+	// in:formData
+	// name:grants
+	// required:true
+	Grants string `json:"grants"`
+	// JWT Token for authentication in subsequent operations
+	// in:header
+	Authentication string
+}
+
+// swagger:parameters idRotateServiceAccountKey idRevokeServiceAccount
+type serviceAccountWrapper struct {
+	// Name of service account.
+	// in:path
+	// name:name
+	// required:true
+	Name string `json:"name"`
+	// JWT Token for authentication in subsequent operations
+	// in:header
+	Authentication string
+}
+
+// Returns a JSON with service accounts.
+// swagger:response serviceAccountsResponse
+type serviceAccountsResponse struct {
+	// in:body
+	Body []apikey.ServiceAccount
+}
+
+// Returns a JSON with service account.
+// swagger:response serviceAccountResponse
+type serviceAccountResponse struct {
+	// in:body
+	Body apikey.ServiceAccount
+}
+
+// Returns a JSON with service account and its API key, send the key in X-API-Key header.
+// swagger:response serviceAccountKeyResponse
+type serviceAccountKeyResponse struct {
+	// in:body
+	Body apikey.KeyResponse
+}
@@ -0,0 +1,74 @@
+package docs
+
+import "sfr-backend/authentication"
+
+// swagger:route GET /me/sessions users-endpoint idListSessions
+// Returns sessions of logged in user, most recently used first. Current is the session of the calling token.
+// responses:
+//   200: sessionsResponse
+//   401: authfailureResponse
+
+// swagger:route DELETE /me/sessions/{id} users-endpoint idRevokeSession
+// Signs logged in user out of session, its tokens stop working immediately.
+// responses:
+//   200: revokeSessionResponse
+//   404: authfailureResponse
+
+// swagger:route GET /users/{username}/sessions users-endpoint idListUserSessions
+// Returns sessions of user. Only users with admin role can call it.
+// responses:
+//   200: sessionsResponse
+
+// swagger:route DELETE /users/{username}/sessions users-endpoint idRevokeUserSessions
+// Signs user out everywhere, tokens of all sessions stop working immediately. Only users with admin role can call it.
+// responses:
+//   200: revokedSessionsResponse
+
+// swagger:parameters idListSessions
+type listSessionsWrapper struct {
+	// JWT Token for authentication in subsequent operations
+	// in:header
+	Authentication string
+}
+
+// swagger:parameters idRevokeSession
+type revokeSessionWrapper struct {
+	// Id of session returned by GET /me/sessions.
+	// in:path
+	// required:true
+	ID string `json:"id"`
+	// JWT Token for authentication in subsequent operations
+	// in:header
+	Authentication string
+}
+
+// swagger:parameters idListUserSessions idRevokeUserSessions
+type userSessionsWrapper struct {
+	// User whose sessions are listed or revoked.
+	// in:path
+	// required:true
+	Username string `json:"username"`
+	// JWT Token for authentication in subsequent operations
+	// in:header
+	Authentication string
+}
+
+// Sessions with user agent, address, creation and last use.
+// swagger:response sessionsResponse
+type sessionsResponse struct {
+	// in:body
+	Body []authentication.SessionResponse
+}
+
+// Returns a fixed string with a message.
+// swagger:response revokeSessionResponse
+type revokeSessionResponse struct {
+	result string
+}
+
+// Number of revoked sessions.
+// swagger:response revokedSessionsResponse
+type revokedSessionsResponse struct {
+	// in:body
+	Body authentication.RevokedSessionsResponse
+}
@@ -0,0 +1,157 @@
+package docs
+
+import (
+	"sfr-backend/authentication"
+	"sfr-backend/rbac"
+	"sfr-backend/user"
+)
+
+// swagger:route GET /users users-endpoint idListUsers
+// Returns page of users. Only users with admin role can call it.
+// responses:
+//   200: usersResponse
+
+// swagger:route POST /users users-endpoint idCreateUser
+// Creates user like /createuser. Only users with admin role can call it.
+// responses:
+//   200: userResponse
+//   409: authfailureResponse
+
+// swagger:route GET /users/{username} users-endpoint idGetUser
+// Returns user. Only users with admin role can call it.
+// responses:
+//   200: userResponse
+//   404: authfailureResponse
+
+// swagger:route PATCH /users/{username} users-endpoint idUpdateUser
+// Changes profile of user, omitted fields are kept. Only users with admin role can call it.
+// responses:
+//   200: userResponse
+//   404: authfailureResponse
+
+// swagger:route DELETE /users/{username} users-endpoint idDeleteUser
+// Deletes user. Only users with admin role can call it.
+// responses:
+//   200: deleteUserResponse
+//   404: authfailureResponse
+
+// swagger:route PUT /users/{username}/grants users-endpoint idSetGrants
+// Replaces grants of user managed by admins. Only users with admin role can call it.
+// responses:
+//   200: userResponse
+//   404: authfailureResponse
+
+// swagger:route PUT /users/{username}/identity users-endpoint idLinkIdentity
+// Links user to account at identity provider, single sign-on of the account logs in as the user. Only users with admin role can call it.
+// responses:
+//   200: userResponse
+//   404: authfailureResponse
+//   409: authfailureResponse
+
+// swagger:route POST /users/{username}/disable users-endpoint idDisableUser
+// Stops user from logging in and refreshing tokens. Only users with admin role can call it.
+// responses:
+//   200: userResponse
+//   404: authfailureResponse
+
+// swagger:route POST /users/{username}/enable users-endpoint idEnableUser
+// Lets disabled user log in again. Only users with admin role can call it.
+// responses:
+//   200: userResponse
+//   404: authfailureResponse
+
+// swagger:parameters idListUsers
+type listUsersWrapper struct {
+	// Max number of users on page, 50 by default, at most 100.
+	// in:query
+	Limit int `json:"limit"`
+	// nextToken of previous page.
+	// in:query
+	NextToken string `json:"nextToken"`
+	// JWT Token for authentication in subsequent operations
+	// in:header
+	Authentication string
+}
+
+// swagger:parameters idCreateUser
+type createUserWrapper struct {
+	// Username, password and profile of new user.
+	// in:body
+	Body user.UserDetails
+	// JWT Token for authentication in subsequent operations
+	// in:header
+	Authentication string
+}
+
+// swagger:parameters idGetUser idDeleteUser idDisableUser idEnableUser
+type userWrapper struct {
+	// User to manage.
+	// in:path
+	// required:true
+	Username string `json:"username"`
+	// JWT Token for authentication in subsequent operations
+	// in:header
+	Authentication string
+}
+
+// swagger:parameters idUpdateUser
+type updateUserWrapper struct {
+	// User to manage.
+	// in:path
+	// required:true
+	Username string `json:"username"`
+	// Changed profile fields.
+	// in:body
+	Body authentication.UpdateUserRequest
+	// JWT Token for authentication in subsequent operations
+	// in:header
+	Authentication string
+}
+
+// swagger:parameters idSetGrants
+type setGrantsWrapper struct {
+	// User to manage.
+	// in:path
+	// required:true
+	Username string `json:"username"`
+	// New grants of user.
+	// in:body
+	Body []rbac.Grant
+	// JWT Token for authentication in subsequent operations
+	// in:header
+	Authentication string
+}
+
+// swagger:parameters idLinkIdentity
+type linkIdentityWrapper struct {
+	// User to manage.
+	// in:path
+	// required:true
+	Username string `json:"username"`
+	// Subject of account at identity provider.
+	// in:body
+	Body authentication.LinkIdentityRequest
+	// JWT Token for authentication in subsequent operations
+	// in:header
+	Authentication string
+}
+
+// Page of users.
+// swagger:response usersResponse
+type usersResponse struct {
+	// in:body
+	Body authentication.UsersResponse
+}
+
+// User without password hash and MFA secret.
+// swagger:response userResponse
+type userResponse struct {
+	// in:body
+	Body authentication.UserResponse
+}
+
+// Returns a fixed string with a message.
+// swagger:response deleteUserResponse
+type deleteUserResponse struct {
+	result string
+}
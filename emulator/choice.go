@@ -0,0 +1,175 @@
+package emulator
+
+import (
+	"path"
+	"strings"
+	"time"
+)
+
+// evaluateChoice - evaluates single choice rule, including And, Or and Not combinations
+func evaluateChoice(rule map[string]interface{}, input interface{}) (bool, error) {
+	if rules, ok := rule["And"].([]interface{}); ok {
+		for _, nested := range rules {
+			matched, err := evaluateNestedChoice(nested, input)
+			if err != nil || !matched {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+	if rules, ok := rule["Or"].([]interface{}); ok {
+		for _, nested := range rules {
+			matched, err := evaluateNestedChoice(nested, input)
+			if err != nil || matched {
+				return matched, err
+			}
+		}
+		return false, nil
+	}
+	if nested, ok := rule["Not"]; ok {
+		matched, err := evaluateNestedChoice(nested, input)
+		return !matched, err
+	}
+
+	variable, ok := rule["Variable"].(string)
+	if !ok {
+		return false, runtimeError("choice rule has no Variable")
+	}
+	for operator, expected := range rule {
+		if operator == "Variable" || operator == "Next" || operator == "Comment" {
+			continue
+		}
+		if operator == "IsPresent" {
+			return pathExists(input, variable) == expected, nil
+		}
+		value, err := getPath(input, variable)
+		if err != nil {
+			return false, err
+		}
+		if strings.HasSuffix(operator, "Path") {
+			expectedPath, ok := expected.(string)
+			if !ok {
+				return false, runtimeError("%s must be a path", operator)
+			}
+			if expected, err = getPath(input, expectedPath); err != nil {
+				return false, err
+			}
+			operator = strings.TrimSuffix(operator, "Path")
+		}
+		return compare(operator, value, expected)
+	}
+	return false, runtimeError("choice rule for %q has no comparison", variable)
+}
+
+func evaluateNestedChoice(nested interface{}, input interface{}) (bool, error) {
+	rule, ok := nested.(map[string]interface{})
+	if !ok {
+		return false, runtimeError("invalid nested choice rule")
+	}
+	return evaluateChoice(rule, input)
+}
+
+// compare - applies comparison operator, values of wrong type never match
+func compare(operator string, value interface{}, expected interface{}) (bool, error) {
+	switch operator {
+	case "IsNull":
+		return (value == nil) == expected, nil
+	case "IsNumeric":
+		_, ok := value.(float64)
+		return ok == expected, nil
+	case "IsString":
+		_, ok := value.(string)
+		return ok == expected, nil
+	case "IsBoolean":
+		_, ok := value.(bool)
+		return ok == expected, nil
+	case "IsTimestamp":
+		_, ok := parseTimestamp(value)
+		return ok == expected, nil
+	case "BooleanEquals":
+		actual, ok := value.(bool)
+		return ok && actual == expected, nil
+	case "StringMatches":
+		actual, ok := value.(string)
+		pattern, _ := expected.(string)
+		if !ok {
+			return false, nil
+		}
+		matched, err := path.Match(pattern, actual)
+		if err != nil {
+			return false, runtimeError("invalid StringMatches pattern %q", pattern)
+		}
+		return matched, nil
+	}
+
+	comparison, kind, ok := splitOperator(operator)
+	if !ok {
+		return false, runtimeError("unsupported choice operator %q", operator)
+	}
+	var result int
+	switch kind {
+	case "String":
+		actual, ok := value.(string)
+		wanted, wantedOk := expected.(string)
+		if !ok || !wantedOk {
+			return false, nil
+		}
+		result = strings.Compare(actual, wanted)
+	case "Numeric":
+		actual, ok := value.(float64)
+		wanted, wantedOk := expected.(float64)
+		if !ok || !wantedOk {
+			return false, nil
+		}
+		result = compareFloats(actual, wanted)
+	case "Timestamp":
+		actual, ok := parseTimestamp(value)
+		wanted, wantedOk := parseTimestamp(expected)
+		if !ok || !wantedOk {
+			return false, nil
+		}
+		result = compareFloats(float64(actual.UnixNano()), float64(wanted.UnixNano()))
+	}
+	switch comparison {
+	case "Equals":
+		return result == 0, nil
+	case "LessThan":
+		return result < 0, nil
+	case "GreaterThan":
+		return result > 0, nil
+	case "LessThanEquals":
+		return result <= 0, nil
+	case "GreaterThanEquals":
+		return result >= 0, nil
+	}
+	return false, runtimeError("unsupported choice operator %q", operator)
+}
+
+// splitOperator - splits operator like NumericLessThan into LessThan and Numeric
+func splitOperator(operator string) (string, string, bool) {
+	for _, kind := range []string{"String", "Numeric", "Timestamp"} {
+		if strings.HasPrefix(operator, kind) {
+			return strings.TrimPrefix(operator, kind), kind, true
+		}
+	}
+	return "", "", false
+}
+
+func compareFloats(a float64, b float64) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
+
+func parseTimestamp(value interface{}) (time.Time, bool) {
+	text, ok := value.(string)
+	if !ok {
+		return time.Time{}, false
+	}
+	parsed, err := time.Parse(time.RFC3339, text)
+	return parsed, err == nil
+}
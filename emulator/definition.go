@@ -0,0 +1,177 @@
+package emulator
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// state types supported by emulator
+const (
+	statePass     = "Pass"
+	stateTask     = "Task"
+	stateChoice   = "Choice"
+	stateWait     = "Wait"
+	stateSucceed  = "Succeed"
+	stateFail     = "Fail"
+	stateParallel = "Parallel"
+	stateMap      = "Map"
+)
+
+// definition - Amazon States Language state machine or branch definition
+type definition struct {
+	Comment        string            `json:"Comment"`
+	StartAt        string            `json:"StartAt"`
+	States         map[string]*state `json:"States"`
+	TimeoutSeconds int               `json:"TimeoutSeconds"`
+}
+
+// state - single state of definition, fields not used by state type are ignored
+type state struct {
+	Type       string       `json:"Type"`
+	Next       string       `json:"Next"`
+	End        bool         `json:"End"`
+	InputPath  optionalPath `json:"InputPath"`
+	OutputPath optionalPath `json:"OutputPath"`
+	ResultPath optionalPath `json:"ResultPath"`
+
+	Parameters     interface{} `json:"Parameters"`
+	ResultSelector interface{} `json:"ResultSelector"`
+	Result         interface{} `json:"Result"`
+
+	// Task
+	Resource       string    `json:"Resource"`
+	TimeoutSeconds int       `json:"TimeoutSeconds"`
+	Retry          []retrier `json:"Retry"`
+	Catch          []catcher `json:"Catch"`
+
+	// Choice
+	Choices []map[string]interface{} `json:"Choices"`
+	Default string                   `json:"Default"`
+
+	// Wait
+	Seconds       *float64 `json:"Seconds"`
+	SecondsPath   string   `json:"SecondsPath"`
+	Timestamp     string   `json:"Timestamp"`
+	TimestampPath string   `json:"TimestampPath"`
+
+	// Fail
+	Error string `json:"Error"`
+	Cause string `json:"Cause"`
+
+	// Parallel
+	Branches []*definition `json:"Branches"`
+
+	// Map
+	ItemsPath      string      `json:"ItemsPath"`
+	ItemSelector   interface{} `json:"ItemSelector"`
+	Iterator       *definition `json:"Iterator"`
+	ItemProcessor  *definition `json:"ItemProcessor"`
+	MaxConcurrency int         `json:"MaxConcurrency"`
+}
+
+// retrier - retry policy of Task, Parallel and Map states
+type retrier struct {
+	ErrorEquals     []string `json:"ErrorEquals"`
+	IntervalSeconds *float64 `json:"IntervalSeconds"`
+	MaxAttempts     *int     `json:"MaxAttempts"`
+	BackoffRate     *float64 `json:"BackoffRate"`
+}
+
+// catcher - fallback transition of Task, Parallel and Map states
+type catcher struct {
+	ErrorEquals []string     `json:"ErrorEquals"`
+	Next        string       `json:"Next"`
+	ResultPath  optionalPath `json:"ResultPath"`
+}
+
+// parseDefinition - parses and validates state machine definition
+func parseDefinition(content string) (*definition, error) {
+	var parsed definition
+	if err := json.Unmarshal([]byte(content), &parsed); err != nil {
+		return nil, fmt.Errorf("invalid definition: %s", err)
+	}
+	if err := parsed.validate(); err != nil {
+		return nil, err
+	}
+	return &parsed, nil
+}
+
+// validate - checks transitions and state specific fields of definition and its branches
+func (def *definition) validate() error {
+	if _, ok := def.States[def.StartAt]; !ok {
+		return fmt.Errorf("invalid definition: StartAt %q does not exist", def.StartAt)
+	}
+	for name, st := range def.States {
+		if st == nil {
+			return fmt.Errorf("invalid definition: state %q is empty", name)
+		}
+		transitions := []string{}
+		switch st.Type {
+		case statePass, stateTask, stateWait, stateParallel, stateMap:
+			if st.End == (st.Next != "") {
+				return fmt.Errorf("invalid definition: state %q must have either Next or End", name)
+			}
+			transitions = append(transitions, st.Next)
+		case stateChoice:
+			if len(st.Choices) == 0 {
+				return fmt.Errorf("invalid definition: choice state %q has no choices", name)
+			}
+			for _, choice := range st.Choices {
+				next, _ := choice["Next"].(string)
+				if next == "" {
+					return fmt.Errorf("invalid definition: choice in state %q has no Next", name)
+				}
+				transitions = append(transitions, next)
+			}
+			transitions = append(transitions, st.Default)
+		case stateSucceed, stateFail:
+		default:
+			return fmt.Errorf("invalid definition: state %q has unsupported type %q", name, st.Type)
+		}
+		if st.Type == stateTask && st.Resource == "" {
+			return fmt.Errorf("invalid definition: task state %q has no Resource", name)
+		}
+		for _, c := range st.Catch {
+			transitions = append(transitions, c.Next)
+		}
+		for _, next := range transitions {
+			if _, ok := def.States[next]; next != "" && !ok {
+				return fmt.Errorf("invalid definition: state %q transitions to missing state %q", name, next)
+			}
+		}
+		for _, branch := range st.Branches {
+			if branch == nil {
+				return fmt.Errorf("invalid definition: state %q has empty branch", name)
+			}
+			if err := branch.validate(); err != nil {
+				return err
+			}
+		}
+		if st.Type == stateMap {
+			processor := st.processor()
+			if processor == nil {
+				return fmt.Errorf("invalid definition: map state %q has no ItemProcessor", name)
+			}
+			if err := processor.validate(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// processor - returns map iteration definition, supporting both old and new field names
+func (st *state) processor() *definition {
+	if st.ItemProcessor != nil {
+		return st.ItemProcessor
+	}
+	return st.Iterator
+}
+
+// itemSelector - returns map item template, supporting both old and new field names
+func (st *state) itemSelector() interface{} {
+	if st.ItemSelector != nil {
+		return st.ItemSelector
+	}
+	return st.Parameters
+}
@@ -0,0 +1,516 @@
+package emulator
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sfn"
+
+	awsprovider "sfr-backend/awsProvider"
+)
+
+// emulatorAccount - account id used in ARNs of emulated resources
+const emulatorAccount = "000000000000"
+
+// defaultPageSize - page size used when MaxResults is not provided
+const defaultPageSize = 100
+
+var _ awsprovider.AwsStepFunctionInterface = (*Emulator)(nil)
+
+// TaskHandler - handles Task state resource, receives effective parameters and returns task result
+// Returning StateError fails task with its error name, other errors fail it with States.TaskFailed
+type TaskHandler func(ctx context.Context, input interface{}) (interface{}, error)
+
+// EchoTaskHandler - task handler returning its input, useful as default handler for local development
+func EchoTaskHandler(ctx context.Context, input interface{}) (interface{}, error) {
+	return input, nil
+}
+
+// stateMachine - emulated state machine
+type stateMachine struct {
+	arn        string
+	name       string
+	definition *definition
+	created    time.Time
+}
+
+// execution - emulated execution with its history
+type execution struct {
+	arn        string
+	name       string
+	machineArn string
+	input      string
+	output     *string
+	status     string
+	startDate  time.Time
+	stopDate   *time.Time
+	events     []*sfn.HistoryEvent
+	done       chan struct{}
+}
+
+// Emulator - in memory Step Functions implementation interpreting Amazon States Language
+type Emulator struct {
+	mu         sync.Mutex
+	region     string
+	machines   map[string]*stateMachine
+	executions map[string]*execution
+	handlers   map[string]TaskHandler
+	sleepFunc  func(ctx context.Context, d time.Duration) error
+	nowFunc    func() time.Time
+	// running executions are aborted when ctx is cancelled by Stop
+	ctx     context.Context
+	stop    context.CancelFunc
+	running sync.WaitGroup
+
+	// DefaultTaskHandler - used for resources without registered handler, tasks fail when nil
+	DefaultTaskHandler TaskHandler
+}
+
+// New - creates empty emulator for given region
+func New(region string) *Emulator {
+	ctx, stop := context.WithCancel(context.Background())
+	return &Emulator{
+		region:     region,
+		machines:   map[string]*stateMachine{},
+		executions: map[string]*execution{},
+		handlers:   map[string]TaskHandler{},
+		sleepFunc:  sleepWithContext,
+		nowFunc:    time.Now,
+		ctx:        ctx,
+		stop:       stop,
+	}
+}
+
+// Stop - aborts running executions and waits until they record their end,
+// executions started afterwards are aborted right away
+func (emulator *Emulator) Stop() {
+	emulator.mu.Lock()
+	emulator.stop()
+	emulator.mu.Unlock()
+	emulator.running.Wait()
+}
+
+// NewFromEnv - creates emulator configured with EMULATOR_* variables and loads definitions
+// from EMULATOR_DEFINITIONS_DIR, every *.json file is created as state machine named after the file
+func NewFromEnv() (*Emulator, error) {
+	region := os.Getenv("EMULATOR_REGION")
+	if region == "" {
+		region = "us-east-1"
+	}
+	emulator := New(region)
+	if os.Getenv("EMULATOR_ECHO_TASKS") == "true" {
+		emulator.DefaultTaskHandler = EchoTaskHandler
+	}
+	if scale, err := strconv.ParseFloat(os.Getenv("EMULATOR_WAIT_SCALE"), 64); err == nil && scale >= 0 {
+		emulator.SetSleep(func(ctx context.Context, d time.Duration) error {
+			return sleepWithContext(ctx, time.Duration(float64(d)*scale))
+		})
+	}
+	directory := os.Getenv("EMULATOR_DEFINITIONS_DIR")
+	if directory == "" {
+		return emulator, nil
+	}
+	files, err := filepath.Glob(filepath.Join(directory, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		name := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(file), ".json"), ".asl")
+		if _, err := emulator.CreateStateMachine(name, string(content)); err != nil {
+			return nil, fmt.Errorf("%s: %s", file, err)
+		}
+	}
+	return emulator, nil
+}
+
+// Provider - step functions provider returning shared emulator for every session
+type Provider struct {
+	Emulator *Emulator
+}
+
+// New - returns emulator, session is ignored as emulator keeps its own state
+func (provider *Provider) New(sess *session.Session) (awsprovider.AwsStepFunctionInterface, error) {
+	return provider.Emulator, nil
+}
+
+// RegisterTaskHandler - registers handler for Task states with given resource
+func (emulator *Emulator) RegisterTaskHandler(resource string, handler TaskHandler) {
+	emulator.mu.Lock()
+	defer emulator.mu.Unlock()
+	emulator.handlers[resource] = handler
+}
+
+// SetSleep - replaces function used by Wait states and retries, allows tests to skip waiting
+func (emulator *Emulator) SetSleep(sleep func(ctx context.Context, d time.Duration) error) {
+	emulator.mu.Lock()
+	defer emulator.mu.Unlock()
+	emulator.sleepFunc = sleep
+}
+
+// CreateStateMachine - parses definition and creates state machine, returns its ARN
+func (emulator *Emulator) CreateStateMachine(name string, definitionContent string) (string, error) {
+	parsed, err := parseDefinition(definitionContent)
+	if err != nil {
+		return "", awserr.New(sfn.ErrCodeInvalidDefinition, err.Error(), nil)
+	}
+	emulator.mu.Lock()
+	defer emulator.mu.Unlock()
+	arn := fmt.Sprintf("arn:aws:states:%s:%s:stateMachine:%s", emulator.region, emulatorAccount, name)
+	if _, ok := emulator.machines[arn]; ok {
+		return "", awserr.New(sfn.ErrCodeStateMachineAlreadyExists, "State Machine Already Exists: '"+arn+"'", nil)
+	}
+	emulator.machines[arn] = &stateMachine{arn: arn, name: name, definition: parsed, created: emulator.nowFunc()}
+	return arn, nil
+}
+
+// ListStateMachines - lists state machines sorted by name
+func (emulator *Emulator) ListStateMachines(input *sfn.ListStateMachinesInput) (*sfn.ListStateMachinesOutput, error) {
+	emulator.mu.Lock()
+	defer emulator.mu.Unlock()
+	machines := make([]*stateMachine, 0, len(emulator.machines))
+	for _, machine := range emulator.machines {
+		machines = append(machines, machine)
+	}
+	sort.Slice(machines, func(i, j int) bool { return machines[i].name < machines[j].name })
+	start, end, nextToken, err := page(len(machines), input.MaxResults, input.NextToken)
+	if err != nil {
+		return nil, err
+	}
+	output := &sfn.ListStateMachinesOutput{StateMachines: []*sfn.StateMachineListItem{}, NextToken: nextToken}
+	for _, machine := range machines[start:end] {
+		output.StateMachines = append(output.StateMachines, &sfn.StateMachineListItem{
+			StateMachineArn: aws.String(machine.arn),
+			Name:            aws.String(machine.name),
+			Type:            aws.String(sfn.StateMachineTypeStandard),
+			CreationDate:    aws.Time(machine.created),
+		})
+	}
+	return output, nil
+}
+
+// StartExecution - starts execution asynchronously
+func (emulator *Emulator) StartExecution(input *sfn.StartExecutionInput) (*sfn.StartExecutionOutput, error) {
+	executionInput := aws.StringValue(input.Input)
+	if executionInput == "" {
+		executionInput = "{}"
+	}
+	var parsedInput interface{}
+	if err := json.Unmarshal([]byte(executionInput), &parsedInput); err != nil {
+		return nil, awserr.New(sfn.ErrCodeInvalidExecutionInput, "Invalid State Machine Execution Input: "+err.Error(), nil)
+	}
+
+	emulator.mu.Lock()
+	machine, ok := emulator.machines[aws.StringValue(input.StateMachineArn)]
+	if !ok {
+		emulator.mu.Unlock()
+		return nil, awserr.New(sfn.ErrCodeStateMachineDoesNotExist, "State Machine Does Not Exist: '"+aws.StringValue(input.StateMachineArn)+"'", nil)
+	}
+	name := aws.StringValue(input.Name)
+	if name == "" {
+		name = newExecutionName()
+	}
+	arn := fmt.Sprintf("arn:aws:states:%s:%s:execution:%s:%s", emulator.region, emulatorAccount, machine.name, name)
+	if _, ok := emulator.executions[arn]; ok {
+		emulator.mu.Unlock()
+		return nil, awserr.New(sfn.ErrCodeExecutionAlreadyExists, "Execution Already Exists: '"+arn+"'", nil)
+	}
+	exec := &execution{
+		arn:        arn,
+		name:       name,
+		machineArn: machine.arn,
+		input:      executionInput,
+		status:     sfn.ExecutionStatusRunning,
+		startDate:  emulator.nowFunc(),
+		events:     []*sfn.HistoryEvent{},
+		done:       make(chan struct{}),
+	}
+	emulator.executions[arn] = exec
+	// added under lock, so Stop waits for every execution started before it
+	emulator.running.Add(1)
+	emulator.mu.Unlock()
+
+	emulator.recordEvent(exec, sfn.HistoryEventTypeExecutionStarted, func(event *sfn.HistoryEvent) {
+		event.ExecutionStartedEventDetails = &sfn.ExecutionStartedEventDetails{Input: aws.String(executionInput)}
+	})
+	go emulator.runExecution(machine, exec, parsedInput)
+
+	return &sfn.StartExecutionOutput{ExecutionArn: aws.String(arn), StartDate: aws.Time(exec.startDate)}, nil
+}
+
+// runExecution - interprets machine definition and stores execution result
+func (emulator *Emulator) runExecution(machine *stateMachine, exec *execution, input interface{}) {
+	defer emulator.running.Done()
+	defer close(exec.done)
+	// bug in interpreter or task handler fails the execution instead of the whole process
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			emulator.fail(exec, panicError(recovered))
+		}
+	}()
+	ctx := emulator.ctx
+	if machine.definition.TimeoutSeconds > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(machine.definition.TimeoutSeconds)*time.Second)
+		defer cancel()
+	}
+	contextObject := map[string]interface{}{
+		"Execution": map[string]interface{}{
+			"Id":        exec.arn,
+			"Name":      exec.name,
+			"Input":     input,
+			"StartTime": exec.startDate.UTC().Format(time.RFC3339Nano),
+		},
+		"StateMachine": map[string]interface{}{
+			"Id":   machine.arn,
+			"Name": machine.name,
+		},
+	}
+	in := &interpreter{emulator: emulator, execution: exec}
+	output, err := in.run(ctx, machine.definition, input, contextObject)
+
+	if err == nil {
+		encoded := toJSON(output)
+		emulator.recordEvent(exec, sfn.HistoryEventTypeExecutionSucceeded, func(event *sfn.HistoryEvent) {
+			event.ExecutionSucceededEventDetails = &sfn.ExecutionSucceededEventDetails{Output: aws.String(encoded)}
+		})
+		emulator.finish(exec, sfn.ExecutionStatusSucceeded, &encoded)
+		return
+	}
+	if emulator.ctx.Err() != nil {
+		emulator.recordEvent(exec, sfn.HistoryEventTypeExecutionAborted, func(event *sfn.HistoryEvent) {
+			event.ExecutionAbortedEventDetails = &sfn.ExecutionAbortedEventDetails{Cause: aws.String("emulator was stopped")}
+		})
+		emulator.finish(exec, sfn.ExecutionStatusAborted, nil)
+		return
+	}
+	stateErr := asStateError(err)
+	if stateErr.Name == errorTimeout && ctx.Err() == context.DeadlineExceeded {
+		emulator.recordEvent(exec, sfn.HistoryEventTypeExecutionTimedOut, func(event *sfn.HistoryEvent) {
+			event.ExecutionTimedOutEventDetails = &sfn.ExecutionTimedOutEventDetails{Error: aws.String(stateErr.Name), Cause: aws.String(stateErr.Cause)}
+		})
+		emulator.finish(exec, sfn.ExecutionStatusTimedOut, nil)
+		return
+	}
+	emulator.fail(exec, stateErr)
+}
+
+// fail - records ExecutionFailed event and ends execution as failed
+func (emulator *Emulator) fail(exec *execution, stateErr *StateError) {
+	emulator.recordEvent(exec, sfn.HistoryEventTypeExecutionFailed, func(event *sfn.HistoryEvent) {
+		event.ExecutionFailedEventDetails = &sfn.ExecutionFailedEventDetails{Error: aws.String(stateErr.Name), Cause: aws.String(stateErr.Cause)}
+	})
+	emulator.finish(exec, sfn.ExecutionStatusFailed, nil)
+}
+
+func (emulator *Emulator) finish(exec *execution, status string, output *string) {
+	emulator.mu.Lock()
+	defer emulator.mu.Unlock()
+	stopDate := emulator.nowFunc()
+	exec.status = status
+	exec.output = output
+	exec.stopDate = &stopDate
+}
+
+// DescribeExecution - returns execution details
+func (emulator *Emulator) DescribeExecution(input *sfn.DescribeExecutionInput) (*sfn.DescribeExecutionOutput, error) {
+	emulator.mu.Lock()
+	defer emulator.mu.Unlock()
+	exec, err := emulator.findExecution(aws.StringValue(input.ExecutionArn))
+	if err != nil {
+		return nil, err
+	}
+	return &sfn.DescribeExecutionOutput{
+		ExecutionArn:    aws.String(exec.arn),
+		Name:            aws.String(exec.name),
+		StateMachineArn: aws.String(exec.machineArn),
+		Status:          aws.String(exec.status),
+		StartDate:       aws.Time(exec.startDate),
+		StopDate:        exec.stopDate,
+		Input:           aws.String(exec.input),
+		Output:          exec.output,
+	}, nil
+}
+
+// ListExecutions - lists executions of state machine, newest first
+func (emulator *Emulator) ListExecutions(input *sfn.ListExecutionsInput) (*sfn.ListExecutionsOutput, error) {
+	emulator.mu.Lock()
+	defer emulator.mu.Unlock()
+	machineArn := aws.StringValue(input.StateMachineArn)
+	if _, ok := emulator.machines[machineArn]; !ok {
+		return nil, awserr.New(sfn.ErrCodeStateMachineDoesNotExist, "State Machine Does Not Exist: '"+machineArn+"'", nil)
+	}
+	executions := []*execution{}
+	for _, exec := range emulator.executions {
+		if exec.machineArn != machineArn {
+			continue
+		}
+		if input.StatusFilter != nil && *input.StatusFilter != exec.status {
+			continue
+		}
+		executions = append(executions, exec)
+	}
+	sort.Slice(executions, func(i, j int) bool {
+		if executions[i].startDate.Equal(executions[j].startDate) {
+			return executions[i].arn > executions[j].arn
+		}
+		return executions[i].startDate.After(executions[j].startDate)
+	})
+	start, end, nextToken, err := page(len(executions), input.MaxResults, input.NextToken)
+	if err != nil {
+		return nil, err
+	}
+	output := &sfn.ListExecutionsOutput{Executions: []*sfn.ExecutionListItem{}, NextToken: nextToken}
+	for _, exec := range executions[start:end] {
+		output.Executions = append(output.Executions, &sfn.ExecutionListItem{
+			ExecutionArn:    aws.String(exec.arn),
+			Name:            aws.String(exec.name),
+			StateMachineArn: aws.String(exec.machineArn),
+			Status:          aws.String(exec.status),
+			StartDate:       aws.Time(exec.startDate),
+			StopDate:        exec.stopDate,
+		})
+	}
+	return output, nil
+}
+
+// GetExecutionHistory - returns recorded history events
+func (emulator *Emulator) GetExecutionHistory(input *sfn.GetExecutionHistoryInput) (*sfn.GetExecutionHistoryOutput, error) {
+	emulator.mu.Lock()
+	defer emulator.mu.Unlock()
+	exec, err := emulator.findExecution(aws.StringValue(input.ExecutionArn))
+	if err != nil {
+		return nil, err
+	}
+	events := append([]*sfn.HistoryEvent{}, exec.events...)
+	if aws.BoolValue(input.ReverseOrder) {
+		for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+			events[i], events[j] = events[j], events[i]
+		}
+	}
+	start, end, nextToken, err := page(len(events), input.MaxResults, input.NextToken)
+	if err != nil {
+		return nil, err
+	}
+	return &sfn.GetExecutionHistoryOutput{Events: events[start:end], NextToken: nextToken}, nil
+}
+
+// WaitForExecution - blocks until execution finishes or timeout passes, returns final status
+func (emulator *Emulator) WaitForExecution(executionArn string, timeout time.Duration) (string, error) {
+	emulator.mu.Lock()
+	exec, err := emulator.findExecution(executionArn)
+	emulator.mu.Unlock()
+	if err != nil {
+		return "", err
+	}
+	select {
+	case <-exec.done:
+	case <-time.After(timeout):
+		return sfn.ExecutionStatusRunning, fmt.Errorf("execution %s did not finish within %s", executionArn, timeout)
+	}
+	emulator.mu.Lock()
+	defer emulator.mu.Unlock()
+	return exec.status, nil
+}
+
+// findExecution - has to be called with lock held
+func (emulator *Emulator) findExecution(arn string) (*execution, error) {
+	exec, ok := emulator.executions[arn]
+	if !ok {
+		return nil, awserr.New(sfn.ErrCodeExecutionDoesNotExist, "Execution Does Not Exist: '"+arn+"'", nil)
+	}
+	return exec, nil
+}
+
+// recordEvent - appends event with next id to execution history
+func (emulator *Emulator) recordEvent(exec *execution, eventType string, details func(event *sfn.HistoryEvent)) {
+	emulator.mu.Lock()
+	defer emulator.mu.Unlock()
+	event := &sfn.HistoryEvent{
+		Id:              aws.Int64(int64(len(exec.events) + 1)),
+		PreviousEventId: aws.Int64(int64(len(exec.events))),
+		Timestamp:       aws.Time(emulator.nowFunc()),
+		Type:            aws.String(eventType),
+	}
+	if details != nil {
+		details(event)
+	}
+	exec.events = append(exec.events, event)
+}
+
+func (emulator *Emulator) taskHandler(resource string) TaskHandler {
+	emulator.mu.Lock()
+	defer emulator.mu.Unlock()
+	if handler, ok := emulator.handlers[resource]; ok {
+		return handler
+	}
+	return emulator.DefaultTaskHandler
+}
+
+func (emulator *Emulator) sleep(ctx context.Context, d time.Duration) error {
+	emulator.mu.Lock()
+	sleep := emulator.sleepFunc
+	emulator.mu.Unlock()
+	return sleep(ctx, d)
+}
+
+func (emulator *Emulator) now() time.Time {
+	return emulator.nowFunc()
+}
+
+// page - resolves offset based pagination, tokens are offsets encoded as strings
+func page(total int, maxResults *int64, nextToken *string) (int, int, *string, error) {
+	start := 0
+	if nextToken != nil {
+		parsed, err := strconv.Atoi(*nextToken)
+		if err != nil || parsed < 0 || parsed > total {
+			return 0, 0, nil, awserr.New(sfn.ErrCodeInvalidToken, "Invalid Token: '"+*nextToken+"'", nil)
+		}
+		start = parsed
+	}
+	size := defaultPageSize
+	if maxResults != nil && *maxResults > 0 {
+		size = int(*maxResults)
+	}
+	end := start + size
+	if end >= total {
+		return start, total, nil, nil
+	}
+	return start, end, aws.String(strconv.Itoa(end)), nil
+}
+
+func sleepWithContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// newExecutionName - generates random UUID like name used when StartExecution has no name
+func newExecutionName() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	id[6] = (id[6] & 0x0f) | 0x40
+	id[8] = (id[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:])
+}
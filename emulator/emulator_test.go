@@ -0,0 +1,295 @@
+package emulator_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sfr-backend/emulator"
+	"sfr-backend/execution"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/sfn"
+	"github.com/stretchr/testify/assert"
+)
+
+const waitTimeout = 5 * time.Second
+
+func newEmulator() *emulator.Emulator {
+	emu := emulator.New("us-east-1")
+	emu.SetSleep(func(ctx context.Context, d time.Duration) error { return ctx.Err() })
+	return emu
+}
+
+func runDefinition(t *testing.T, emu *emulator.Emulator, definition string, input string) (*sfn.DescribeExecutionOutput, []*sfn.HistoryEvent) {
+	machineArn, err := emu.CreateStateMachine("machine", definition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start, err := emu.StartExecution(&sfn.StartExecutionInput{StateMachineArn: aws.String(machineArn), Input: aws.String(input)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := emu.WaitForExecution(*start.ExecutionArn, waitTimeout); err != nil {
+		t.Fatal(err)
+	}
+	description, _ := emu.DescribeExecution(&sfn.DescribeExecutionInput{ExecutionArn: start.ExecutionArn})
+	history, _ := emu.GetExecutionHistory(&sfn.GetExecutionHistoryInput{ExecutionArn: start.ExecutionArn, MaxResults: aws.Int64(1000)})
+	return description, history.Events
+}
+
+func decodeOutput(t *testing.T, description *sfn.DescribeExecutionOutput) map[string]interface{} {
+	var output map[string]interface{}
+	if err := json.Unmarshal([]byte(aws.StringValue(description.Output)), &output); err != nil {
+		t.Fatal(err)
+	}
+	return output
+}
+
+func TestPassTaskAndChoice(t *testing.T) {
+	emu := newEmulator()
+	emu.RegisterTaskHandler("double", func(ctx context.Context, input interface{}) (interface{}, error) {
+		value := input.(map[string]interface{})["value"].(float64)
+		return map[string]interface{}{"doubled": value * 2}, nil
+	})
+	definition := `{
+		"StartAt": "Prepare",
+		"States": {
+			"Prepare": {"Type": "Pass", "Result": {"value": 21}, "ResultPath": "$.prepared", "Next": "Double"},
+			"Double": {
+				"Type": "Task", "Resource": "double",
+				"Parameters": {"value.$": "$.prepared.value"},
+				"ResultSelector": {"result.$": "$.doubled"},
+				"ResultPath": "$.task",
+				"Next": "Check"
+			},
+			"Check": {
+				"Type": "Choice",
+				"Choices": [
+					{"And": [{"Variable": "$.task.result", "NumericGreaterThan": 40}, {"Variable": "$.name", "StringEquals": "answer"}], "Next": "Done"}
+				],
+				"Default": "Wrong"
+			},
+			"Done": {"Type": "Succeed", "OutputPath": "$.task"},
+			"Wrong": {"Type": "Fail", "Error": "Wrong", "Cause": "unexpected result"}
+		}
+	}`
+
+	description, events := runDefinition(t, emu, definition, `{"name": "answer"}`)
+
+	assert.Equal(t, sfn.ExecutionStatusSucceeded, *description.Status)
+	assert.Equal(t, map[string]interface{}{"result": float64(42)}, decodeOutput(t, description))
+	assert.Equal(t, sfn.HistoryEventTypeExecutionStarted, *events[0].Type)
+	assert.Equal(t, sfn.HistoryEventTypeExecutionSucceeded, *events[len(events)-1].Type)
+}
+
+func TestRetryAndCatch(t *testing.T) {
+	emu := newEmulator()
+	calls := 0
+	emu.RegisterTaskHandler("flaky", func(ctx context.Context, input interface{}) (interface{}, error) {
+		calls++
+		if calls < 3 {
+			return nil, &emulator.StateError{Name: "Flaky", Cause: "try again"}
+		}
+		return "ok", nil
+	})
+	emu.RegisterTaskHandler("broken", func(ctx context.Context, input interface{}) (interface{}, error) {
+		return nil, errors.New("broken")
+	})
+	definition := `{
+		"StartAt": "Flaky",
+		"States": {
+			"Flaky": {
+				"Type": "Task", "Resource": "flaky", "ResultPath": "$.flaky",
+				"Retry": [{"ErrorEquals": ["Flaky"], "MaxAttempts": 2}],
+				"Next": "Broken"
+			},
+			"Broken": {
+				"Type": "Task", "Resource": "broken",
+				"Catch": [{"ErrorEquals": ["States.TaskFailed"], "ResultPath": "$.error", "Next": "Recovered"}],
+				"End": true
+			},
+			"Recovered": {"Type": "Pass", "End": true}
+		}
+	}`
+
+	description, _ := runDefinition(t, emu, definition, `{}`)
+
+	assert.Equal(t, sfn.ExecutionStatusSucceeded, *description.Status)
+	output := decodeOutput(t, description)
+	assert.Equal(t, "ok", output["flaky"])
+	assert.Equal(t, map[string]interface{}{"Error": "States.TaskFailed", "Cause": "broken"}, output["error"])
+	assert.Equal(t, 3, calls)
+}
+
+func TestParallelAndMap(t *testing.T) {
+	emu := newEmulator()
+	emu.RegisterTaskHandler("square", func(ctx context.Context, input interface{}) (interface{}, error) {
+		value := input.(float64)
+		return value * value, nil
+	})
+	definition := `{
+		"StartAt": "Both",
+		"States": {
+			"Both": {
+				"Type": "Parallel",
+				"Branches": [
+					{"StartAt": "Squares", "States": {"Squares": {
+						"Type": "Map", "ItemsPath": "$.numbers", "MaxConcurrency": 2,
+						"ItemProcessor": {"StartAt": "Square", "States": {"Square": {"Type": "Task", "Resource": "square", "End": true}}},
+						"End": true
+					}}},
+					{"StartAt": "Indexes", "States": {"Indexes": {
+						"Type": "Map", "ItemsPath": "$.numbers",
+						"ItemSelector": {"index.$": "$$.Map.Item.Index"},
+						"Iterator": {"StartAt": "Index", "States": {"Index": {"Type": "Pass", "OutputPath": "$.index", "End": true}}},
+						"End": true
+					}}}
+				],
+				"ResultPath": "$.results",
+				"End": true
+			}
+		}
+	}`
+
+	description, _ := runDefinition(t, emu, definition, `{"numbers": [1, 2, 3]}`)
+
+	assert.Equal(t, sfn.ExecutionStatusSucceeded, *description.Status)
+	output := decodeOutput(t, description)
+	assert.Equal(t, []interface{}{
+		[]interface{}{float64(1), float64(4), float64(9)},
+		[]interface{}{float64(0), float64(1), float64(2)},
+	}, output["results"])
+}
+
+func TestFailedExecution(t *testing.T) {
+	emu := newEmulator()
+	definition := `{
+		"StartAt": "Wait",
+		"States": {
+			"Wait": {"Type": "Wait", "Seconds": 3600, "Next": "Unknown"},
+			"Unknown": {"Type": "Task", "Resource": "missing", "End": true}
+		}
+	}`
+
+	description, events := runDefinition(t, emu, definition, `{}`)
+
+	assert.Equal(t, sfn.ExecutionStatusFailed, *description.Status)
+	lastEvent := events[len(events)-1]
+	assert.Equal(t, sfn.HistoryEventTypeExecutionFailed, *lastEvent.Type)
+	assert.Equal(t, "States.TaskFailed", *lastEvent.ExecutionFailedEventDetails.Error)
+}
+
+func TestPanickingTaskFailsExecution(t *testing.T) {
+	definitions := []string{
+		`{"StartAt": "Task", "States": {"Task": {"Type": "Task", "Resource": "panics", "End": true}}}`,
+		`{"StartAt": "Map", "States": {"Map": {"Type": "Map", "End": true, "Iterator":
+			{"StartAt": "Task", "States": {"Task": {"Type": "Task", "Resource": "panics", "End": true}}}}}}`,
+	}
+	for _, definition := range definitions {
+		emu := newEmulator()
+		emu.RegisterTaskHandler("panics", func(ctx context.Context, input interface{}) (interface{}, error) {
+			panic("handler bug")
+		})
+		description, events := runDefinition(t, emu, definition, `[1, 2]`)
+
+		assert.Equal(t, sfn.ExecutionStatusFailed, *description.Status)
+		lastEvent := events[len(events)-1]
+		assert.Equal(t, sfn.HistoryEventTypeExecutionFailed, *lastEvent.Type)
+		assert.Equal(t, "States.Runtime", *lastEvent.ExecutionFailedEventDetails.Error)
+		assert.Contains(t, *lastEvent.ExecutionFailedEventDetails.Cause, "handler bug")
+	}
+}
+
+func TestStopAbortsRunningExecutions(t *testing.T) {
+	emu := emulator.New("us-east-1")
+	emu.SetSleep(func(ctx context.Context, d time.Duration) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	machineArn, _ := emu.CreateStateMachine("machine", `{"StartAt": "Wait", "States": {"Wait": {"Type": "Wait", "Seconds": 3600, "End": true}}}`)
+	start, _ := emu.StartExecution(&sfn.StartExecutionInput{StateMachineArn: aws.String(machineArn)})
+
+	emu.Stop()
+
+	description, _ := emu.DescribeExecution(&sfn.DescribeExecutionInput{ExecutionArn: start.ExecutionArn})
+	assert.Equal(t, sfn.ExecutionStatusAborted, *description.Status)
+	history, _ := emu.GetExecutionHistory(&sfn.GetExecutionHistoryInput{ExecutionArn: start.ExecutionArn, ReverseOrder: aws.Bool(true)})
+	assert.Equal(t, sfn.HistoryEventTypeExecutionAborted, *history.Events[0].Type)
+}
+
+func TestEmulatorErrors(t *testing.T) {
+	emu := newEmulator()
+	emu.DefaultTaskHandler = emulator.EchoTaskHandler
+
+	_, err := emu.CreateStateMachine("invalid", `{"StartAt": "Missing", "States": {}}`)
+	assert.Equal(t, sfn.ErrCodeInvalidDefinition, err.(awserr.Error).Code())
+	_, err = emu.CreateStateMachine("nil-branch", `{"StartAt": "Parallel", "States": {"Parallel": {"Type": "Parallel", "Branches": [null], "End": true}}}`)
+	assert.Equal(t, sfn.ErrCodeInvalidDefinition, err.(awserr.Error).Code())
+	_, err = emu.CreateStateMachine("nil-processor", `{"StartAt": "Parallel", "States": {"Parallel": {"Type": "Parallel", "End": true, "Branches": [
+		{"StartAt": "Map", "States": {"Map": {"Type": "Map", "ItemProcessor": null, "End": true}}}]}}}`)
+	assert.Equal(t, sfn.ErrCodeInvalidDefinition, err.(awserr.Error).Code())
+
+	machineArn, _ := emu.CreateStateMachine("machine", `{"StartAt": "Task", "States": {"Task": {"Type": "Task", "Resource": "any", "End": true}}}`)
+	input := &sfn.StartExecutionInput{StateMachineArn: aws.String(machineArn), Name: aws.String("name")}
+	_, err = emu.StartExecution(input)
+	assert.Nil(t, err)
+	_, err = emu.StartExecution(input)
+	assert.Equal(t, sfn.ErrCodeExecutionAlreadyExists, err.(awserr.Error).Code())
+
+	_, err = emu.StartExecution(&sfn.StartExecutionInput{StateMachineArn: aws.String("missing")})
+	assert.Equal(t, sfn.ErrCodeStateMachineDoesNotExist, err.(awserr.Error).Code())
+
+	_, err = emu.DescribeExecution(&sfn.DescribeExecutionInput{ExecutionArn: aws.String("missing")})
+	assert.Equal(t, sfn.ErrCodeExecutionDoesNotExist, err.(awserr.Error).Code())
+}
+
+func TestListExecutionsPagination(t *testing.T) {
+	emu := newEmulator()
+	emu.DefaultTaskHandler = emulator.EchoTaskHandler
+	machineArn, _ := emu.CreateStateMachine("machine", `{"StartAt": "Task", "States": {"Task": {"Type": "Task", "Resource": "any", "End": true}}}`)
+	for i := 0; i < 3; i++ {
+		start, _ := emu.StartExecution(&sfn.StartExecutionInput{StateMachineArn: aws.String(machineArn)})
+		emu.WaitForExecution(*start.ExecutionArn, waitTimeout)
+	}
+
+	firstPage, _ := emu.ListExecutions(&sfn.ListExecutionsInput{StateMachineArn: aws.String(machineArn), MaxResults: aws.Int64(2)})
+	secondPage, _ := emu.ListExecutions(&sfn.ListExecutionsInput{StateMachineArn: aws.String(machineArn), MaxResults: aws.Int64(2), NextToken: firstPage.NextToken})
+	failed, _ := emu.ListExecutions(&sfn.ListExecutionsInput{StateMachineArn: aws.String(machineArn), StatusFilter: aws.String(sfn.ExecutionStatusFailed)})
+
+	assert.Equal(t, 2, len(firstPage.Executions))
+	assert.Equal(t, 1, len(secondPage.Executions))
+	assert.Nil(t, secondPage.NextToken)
+	assert.Equal(t, 0, len(failed.Executions))
+}
+
+func TestExecutionHandlersWithEmulator(t *testing.T) {
+	emu := newEmulator()
+	emu.DefaultTaskHandler = emulator.EchoTaskHandler
+	machineArn, _ := emu.CreateStateMachine("machine", `{"StartAt": "Task", "States": {"Task": {"Type": "Task", "Resource": "any", "End": true}}}`)
+	provider := &emulator.Provider{Emulator: emu}
+
+	payload := strings.NewReader("machine=" + machineArn + "&input={\"key\":\"value\"}&name=run")
+	req, _ := http.NewRequest("POST", "/aws/execution", payload)
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	execution.PostStartExecution(rr, req, provider)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var started sfn.StartExecutionOutput
+	json.Unmarshal(rr.Body.Bytes(), &started)
+	status, _ := emu.WaitForExecution(*started.ExecutionArn, waitTimeout)
+	assert.Equal(t, sfn.ExecutionStatusSucceeded, status)
+
+	payload = strings.NewReader("machine=" + machineArn + "&execution=" + *started.ExecutionArn + "&name=run")
+	req, _ = http.NewRequest("POST", "/aws/execution/restart", payload)
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+	execution.PostRestartExecution(rr, req, provider)
+	assert.Equal(t, http.StatusConflict, rr.Code)
+}
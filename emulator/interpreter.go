@@ -0,0 +1,540 @@
+package emulator
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sfn"
+)
+
+// predefined error names of Amazon States Language
+const (
+	errorAll             = "States.ALL"
+	errorRuntime         = "States.Runtime"
+	errorTaskFailed      = "States.TaskFailed"
+	errorTimeout         = "States.Timeout"
+	errorNoChoiceMatched = "States.NoChoiceMatched"
+)
+
+// StateError - error raised by state, task handlers can return it to fail task with custom error name
+type StateError struct {
+	Name  string
+	Cause string
+}
+
+func (e *StateError) Error() string {
+	if e.Cause == "" {
+		return e.Name
+	}
+	return e.Name + ": " + e.Cause
+}
+
+func runtimeError(format string, args ...interface{}) *StateError {
+	return &StateError{Name: errorRuntime, Cause: fmt.Sprintf(format, args...)}
+}
+
+// panicError - runtime error reported instead of panic recovered while running execution
+func panicError(recovered interface{}) *StateError {
+	return runtimeError("emulator panicked: %v", recovered)
+}
+
+// enteredEvents and exitedEvents - history event types per state type
+var enteredEvents = map[string]string{
+	statePass:     sfn.HistoryEventTypePassStateEntered,
+	stateTask:     sfn.HistoryEventTypeTaskStateEntered,
+	stateChoice:   sfn.HistoryEventTypeChoiceStateEntered,
+	stateWait:     sfn.HistoryEventTypeWaitStateEntered,
+	stateSucceed:  sfn.HistoryEventTypeSucceedStateEntered,
+	stateFail:     sfn.HistoryEventTypeFailStateEntered,
+	stateParallel: sfn.HistoryEventTypeParallelStateEntered,
+	stateMap:      sfn.HistoryEventTypeMapStateEntered,
+}
+
+var exitedEvents = map[string]string{
+	statePass:     sfn.HistoryEventTypePassStateExited,
+	stateTask:     sfn.HistoryEventTypeTaskStateExited,
+	stateChoice:   sfn.HistoryEventTypeChoiceStateExited,
+	stateWait:     sfn.HistoryEventTypeWaitStateExited,
+	stateSucceed:  sfn.HistoryEventTypeSucceedStateExited,
+	stateParallel: sfn.HistoryEventTypeParallelStateExited,
+	stateMap:      sfn.HistoryEventTypeMapStateExited,
+}
+
+// interpreter - runs single execution and records its history
+type interpreter struct {
+	emulator  *Emulator
+	execution *execution
+}
+
+// run - runs definition from StartAt until a terminal state
+func (in *interpreter) run(ctx context.Context, def *definition, input interface{}, contextObject map[string]interface{}) (interface{}, error) {
+	current := def.StartAt
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, contextError(err)
+		}
+		st := def.States[current]
+		stateContext := withState(contextObject, current)
+		in.record(enteredEvents[st.Type], func(event *sfn.HistoryEvent) {
+			event.StateEnteredEventDetails = &sfn.StateEnteredEventDetails{Name: aws.String(current), Input: aws.String(toJSON(input))}
+		})
+		output, next, err := in.runState(ctx, st, input, stateContext)
+		if err != nil {
+			return nil, err
+		}
+		if exitedType, ok := exitedEvents[st.Type]; ok {
+			in.record(exitedType, func(event *sfn.HistoryEvent) {
+				event.StateExitedEventDetails = &sfn.StateExitedEventDetails{Name: aws.String(current), Output: aws.String(toJSON(output))}
+			})
+		}
+		if next == "" {
+			return output, nil
+		}
+		current = next
+		input = output
+	}
+}
+
+// runState - runs single state, returns its output and next state name, empty when execution ends
+func (in *interpreter) runState(ctx context.Context, st *state, rawInput interface{}, contextObject map[string]interface{}) (interface{}, string, error) {
+	input, err := applyInputPath(st.InputPath, rawInput)
+	if err != nil {
+		return nil, "", err
+	}
+	switch st.Type {
+	case stateSucceed:
+		output, err := applyOutputPath(st.OutputPath, input)
+		return output, "", err
+	case stateFail:
+		return nil, "", &StateError{Name: st.Error, Cause: st.Cause}
+	case stateChoice:
+		for _, choice := range st.Choices {
+			matched, err := evaluateChoice(choice, input)
+			if err != nil {
+				return nil, "", err
+			}
+			if matched {
+				output, err := applyOutputPath(st.OutputPath, input)
+				return output, choice["Next"].(string), err
+			}
+		}
+		if st.Default == "" {
+			return nil, "", &StateError{Name: errorNoChoiceMatched, Cause: "no choice rule matched and no Default is set"}
+		}
+		output, err := applyOutputPath(st.OutputPath, input)
+		return output, st.Default, err
+	case stateWait:
+		if err := in.wait(ctx, st, input); err != nil {
+			return nil, "", err
+		}
+		output, err := applyOutputPath(st.OutputPath, input)
+		return output, st.Next, err
+	case statePass:
+		result := input
+		if st.Result != nil {
+			result = st.Result
+		} else if st.Parameters != nil {
+			if result, err = applyParameters(st.Parameters, input, contextObject); err != nil {
+				return nil, "", err
+			}
+		}
+		return in.finishState(st, rawInput, result, st.Next)
+	}
+
+	// Task, Parallel and Map share Retry and Catch handling
+	attempts := map[int]int{}
+	for {
+		result, err := in.runWork(ctx, st, input, contextObject)
+		if err == nil {
+			if st.ResultSelector != nil {
+				if result, err = applyParameters(st.ResultSelector, result, contextObject); err != nil {
+					return nil, "", err
+				}
+			}
+			return in.finishState(st, rawInput, result, st.Next)
+		}
+		stateErr := asStateError(err)
+		if retryIndex := matchRetrier(st.Retry, stateErr.Name); retryIndex >= 0 {
+			retry := st.Retry[retryIndex]
+			if attempts[retryIndex] < retry.maxAttempts() {
+				delay := retry.delay(attempts[retryIndex])
+				attempts[retryIndex]++
+				if sleepErr := in.emulator.sleep(ctx, delay); sleepErr != nil {
+					return nil, "", contextError(sleepErr)
+				}
+				continue
+			}
+		}
+		for _, c := range st.Catch {
+			if matchesError(c.ErrorEquals, stateErr.Name) {
+				errorOutput := map[string]interface{}{"Error": stateErr.Name, "Cause": stateErr.Cause}
+				output, err := applyResultPath(c.ResultPath, rawInput, errorOutput)
+				return output, c.Next, err
+			}
+		}
+		return nil, "", stateErr
+	}
+}
+
+// finishState - applies ResultPath and OutputPath and resolves transition
+func (in *interpreter) finishState(st *state, rawInput interface{}, result interface{}, next string) (interface{}, string, error) {
+	output, err := applyResultPath(st.ResultPath, rawInput, result)
+	if err != nil {
+		return nil, "", err
+	}
+	if output, err = applyOutputPath(st.OutputPath, output); err != nil {
+		return nil, "", err
+	}
+	if st.End {
+		next = ""
+	}
+	return output, next, nil
+}
+
+// runWork - runs Task, Parallel or Map body once
+func (in *interpreter) runWork(ctx context.Context, st *state, input interface{}, contextObject map[string]interface{}) (interface{}, error) {
+	switch st.Type {
+	case stateTask:
+		return in.runTask(ctx, st, input, contextObject)
+	case stateParallel:
+		return in.runParallel(ctx, st, input, contextObject)
+	case stateMap:
+		return in.runMap(ctx, st, input, contextObject)
+	}
+	return nil, runtimeError("unsupported state type %q", st.Type)
+}
+
+func (in *interpreter) runTask(ctx context.Context, st *state, input interface{}, contextObject map[string]interface{}) (interface{}, error) {
+	payload := input
+	if st.Parameters != nil {
+		var err error
+		if payload, err = applyParameters(st.Parameters, input, contextObject); err != nil {
+			return nil, err
+		}
+	}
+	in.record(sfn.HistoryEventTypeTaskScheduled, func(event *sfn.HistoryEvent) {
+		event.TaskScheduledEventDetails = &sfn.TaskScheduledEventDetails{
+			Resource:     aws.String(st.Resource),
+			ResourceType: aws.String("emulator"),
+			Region:       aws.String(in.emulator.region),
+			Parameters:   aws.String(toJSON(payload)),
+		}
+	})
+	handler := in.emulator.taskHandler(st.Resource)
+	if handler == nil {
+		err := &StateError{Name: errorTaskFailed, Cause: fmt.Sprintf("no task handler registered for resource %q", st.Resource)}
+		in.recordTaskFailed(st.Resource, err)
+		return nil, err
+	}
+	taskCtx := ctx
+	if st.TimeoutSeconds > 0 {
+		var cancel context.CancelFunc
+		taskCtx, cancel = context.WithTimeout(ctx, time.Duration(st.TimeoutSeconds)*time.Second)
+		defer cancel()
+	}
+	result, err := handler(taskCtx, payload)
+	if err == nil && taskCtx.Err() != nil {
+		err = taskCtx.Err()
+	}
+	if err != nil {
+		stateErr := asStateError(err)
+		if taskCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+			stateErr = &StateError{Name: errorTimeout, Cause: fmt.Sprintf("task did not finish within %d seconds", st.TimeoutSeconds)}
+		} else if ctx.Err() != nil {
+			return nil, contextError(ctx.Err())
+		}
+		in.recordTaskFailed(st.Resource, stateErr)
+		return nil, stateErr
+	}
+	in.record(sfn.HistoryEventTypeTaskSucceeded, func(event *sfn.HistoryEvent) {
+		event.TaskSucceededEventDetails = &sfn.TaskSucceededEventDetails{
+			Resource:     aws.String(st.Resource),
+			ResourceType: aws.String("emulator"),
+			Output:       aws.String(toJSON(result)),
+		}
+	})
+	return result, nil
+}
+
+func (in *interpreter) recordTaskFailed(resource string, err *StateError) {
+	in.record(sfn.HistoryEventTypeTaskFailed, func(event *sfn.HistoryEvent) {
+		event.TaskFailedEventDetails = &sfn.TaskFailedEventDetails{
+			Resource:     aws.String(resource),
+			ResourceType: aws.String("emulator"),
+			Error:        aws.String(err.Name),
+			Cause:        aws.String(err.Cause),
+		}
+	})
+}
+
+func (in *interpreter) runParallel(ctx context.Context, st *state, input interface{}, contextObject map[string]interface{}) (interface{}, error) {
+	payload := input
+	if st.Parameters != nil {
+		var err error
+		if payload, err = applyParameters(st.Parameters, input, contextObject); err != nil {
+			return nil, err
+		}
+	}
+	in.record(sfn.HistoryEventTypeParallelStateStarted, nil)
+	results := make([]interface{}, len(st.Branches))
+	branchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	failure := newFirstFailure(cancel)
+	var wg sync.WaitGroup
+	for i, branch := range st.Branches {
+		wg.Add(1)
+		go func(i int, branch *definition) {
+			defer wg.Done()
+			defer failure.recoverPanic()
+			result, err := in.run(branchCtx, branch, payload, contextObject)
+			if err != nil {
+				failure.fail(err)
+				return
+			}
+			results[i] = result
+		}(i, branch)
+	}
+	wg.Wait()
+	if err := failure.err; err != nil {
+		in.record(sfn.HistoryEventTypeParallelStateFailed, nil)
+		return nil, err
+	}
+	in.record(sfn.HistoryEventTypeParallelStateSucceeded, nil)
+	return results, nil
+}
+
+func (in *interpreter) runMap(ctx context.Context, st *state, input interface{}, contextObject map[string]interface{}) (interface{}, error) {
+	itemsValue := input
+	if st.ItemsPath != "" {
+		var err error
+		if itemsValue, err = getPath(input, st.ItemsPath); err != nil {
+			return nil, err
+		}
+	}
+	items, ok := itemsValue.([]interface{})
+	if !ok {
+		return nil, runtimeError("map items must be an array")
+	}
+	in.record(sfn.HistoryEventTypeMapStateStarted, func(event *sfn.HistoryEvent) {
+		event.MapStateStartedEventDetails = &sfn.MapStateStartedEventDetails{Length: aws.Int64(int64(len(items)))}
+	})
+	concurrency := st.MaxConcurrency
+	if concurrency <= 0 || concurrency > len(items) {
+		concurrency = len(items)
+	}
+	results := make([]interface{}, len(items))
+	iterationCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	failure := newFirstFailure(cancel)
+	semaphore := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, item := range items {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(i int, item interface{}) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			defer failure.recoverPanic()
+			itemContext := withMapItem(contextObject, i, item)
+			payload := item
+			if selector := st.itemSelector(); selector != nil {
+				var err error
+				if payload, err = applyParameters(selector, input, itemContext); err != nil {
+					failure.fail(err)
+					return
+				}
+			}
+			in.recordMapIteration(sfn.HistoryEventTypeMapIterationStarted, i)
+			result, err := in.run(iterationCtx, st.processor(), payload, itemContext)
+			if err != nil {
+				in.recordMapIteration(sfn.HistoryEventTypeMapIterationFailed, i)
+				failure.fail(err)
+				return
+			}
+			results[i] = result
+			in.recordMapIteration(sfn.HistoryEventTypeMapIterationSucceeded, i)
+		}(i, item)
+	}
+	wg.Wait()
+	if err := failure.err; err != nil {
+		in.record(sfn.HistoryEventTypeMapStateFailed, nil)
+		return nil, err
+	}
+	in.record(sfn.HistoryEventTypeMapStateSucceeded, nil)
+	return results, nil
+}
+
+func (in *interpreter) recordMapIteration(eventType string, index int) {
+	in.record(eventType, func(event *sfn.HistoryEvent) {
+		details := &sfn.MapIterationEventDetails{Index: aws.Int64(int64(index))}
+		switch eventType {
+		case sfn.HistoryEventTypeMapIterationStarted:
+			event.MapIterationStartedEventDetails = details
+		case sfn.HistoryEventTypeMapIterationFailed:
+			event.MapIterationFailedEventDetails = details
+		case sfn.HistoryEventTypeMapIterationSucceeded:
+			event.MapIterationSucceededEventDetails = details
+		}
+	})
+}
+
+// wait - sleeps for Seconds, SecondsPath, Timestamp or TimestampPath of Wait state
+func (in *interpreter) wait(ctx context.Context, st *state, input interface{}) error {
+	var duration time.Duration
+	switch {
+	case st.Seconds != nil:
+		duration = time.Duration(*st.Seconds * float64(time.Second))
+	case st.SecondsPath != "":
+		value, err := getPath(input, st.SecondsPath)
+		if err != nil {
+			return err
+		}
+		seconds, ok := value.(float64)
+		if !ok || seconds < 0 {
+			return runtimeError("SecondsPath %q must reference a non negative number", st.SecondsPath)
+		}
+		duration = time.Duration(seconds * float64(time.Second))
+	case st.Timestamp != "" || st.TimestampPath != "":
+		var value interface{} = st.Timestamp
+		if st.TimestampPath != "" {
+			var err error
+			if value, err = getPath(input, st.TimestampPath); err != nil {
+				return err
+			}
+		}
+		timestamp, ok := parseTimestamp(value)
+		if !ok {
+			return runtimeError("invalid timestamp %v", value)
+		}
+		duration = timestamp.Sub(in.emulator.now())
+	}
+	if duration <= 0 {
+		return nil
+	}
+	return contextError(in.emulator.sleep(ctx, duration))
+}
+
+// record - appends event to execution history
+func (in *interpreter) record(eventType string, details func(event *sfn.HistoryEvent)) {
+	in.emulator.recordEvent(in.execution, eventType, details)
+}
+
+// maxAttempts - MaxAttempts defaults to 3
+func (r retrier) maxAttempts() int {
+	if r.MaxAttempts == nil {
+		return 3
+	}
+	return *r.MaxAttempts
+}
+
+// delay - IntervalSeconds defaults to 1 and BackoffRate to 2
+func (r retrier) delay(attempt int) time.Duration {
+	interval := 1.0
+	if r.IntervalSeconds != nil {
+		interval = *r.IntervalSeconds
+	}
+	backoff := 2.0
+	if r.BackoffRate != nil {
+		backoff = *r.BackoffRate
+	}
+	return time.Duration(interval * math.Pow(backoff, float64(attempt)) * float64(time.Second))
+}
+
+// matchRetrier - returns index of first retrier matching error or -1
+func matchRetrier(retriers []retrier, errorName string) int {
+	for i, r := range retriers {
+		if matchesError(r.ErrorEquals, errorName) {
+			return i
+		}
+	}
+	return -1
+}
+
+// matchesError - States.ALL matches every error and States.TaskFailed every error but timeout
+func matchesError(errorEquals []string, errorName string) bool {
+	// runtime errors can't be retried nor caught
+	if errorName == errorRuntime {
+		return false
+	}
+	for _, expected := range errorEquals {
+		if expected == errorName || expected == errorAll {
+			return true
+		}
+		if expected == errorTaskFailed && errorName != errorTimeout {
+			return true
+		}
+	}
+	return false
+}
+
+func asStateError(err error) *StateError {
+	if stateErr, ok := err.(*StateError); ok {
+		return stateErr
+	}
+	return &StateError{Name: errorTaskFailed, Cause: err.Error()}
+}
+
+// contextError - translates cancellation of execution context into States.Timeout
+func contextError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if err == context.DeadlineExceeded {
+		return &StateError{Name: errorTimeout, Cause: "execution timed out"}
+	}
+	return &StateError{Name: errorRuntime, Cause: err.Error()}
+}
+
+// firstFailure - keeps the first error of concurrent branches and stops the remaining ones,
+// so errors caused by the cancellation itself are not reported
+type firstFailure struct {
+	once   sync.Once
+	cancel context.CancelFunc
+	err    error
+}
+
+func newFirstFailure(cancel context.CancelFunc) *firstFailure {
+	return &firstFailure{cancel: cancel}
+}
+
+func (f *firstFailure) fail(err error) {
+	f.once.Do(func() {
+		f.err = err
+		f.cancel()
+	})
+}
+
+// recoverPanic - deferred by branch goroutines, their panic fails the state as it can't be recovered by execution
+func (f *firstFailure) recoverPanic() {
+	if recovered := recover(); recovered != nil {
+		f.fail(panicError(recovered))
+	}
+}
+
+// withState - copies context object with current state name
+func withState(contextObject map[string]interface{}, name string) map[string]interface{} {
+	copied := copyContext(contextObject)
+	copied["State"] = map[string]interface{}{"Name": name}
+	return copied
+}
+
+// withMapItem - copies context object with current map item
+func withMapItem(contextObject map[string]interface{}, index int, value interface{}) map[string]interface{} {
+	copied := copyContext(contextObject)
+	copied["Map"] = map[string]interface{}{
+		"Item": map[string]interface{}{"Index": float64(index), "Value": value},
+	}
+	return copied
+}
+
+func copyContext(contextObject map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(contextObject)+1)
+	for key, value := range contextObject {
+		copied[key] = value
+	}
+	return copied
+}
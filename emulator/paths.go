@@ -0,0 +1,241 @@
+package emulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// pathToken - single step of a reference path, either object key or array index
+type pathToken struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// optionalPath - InputPath, ResultPath or OutputPath, which may be missing, null or a path
+type optionalPath struct {
+	set  bool
+	null bool
+	path string
+}
+
+// UnmarshalJSON - is only called when field is present in definition
+func (p *optionalPath) UnmarshalJSON(data []byte) error {
+	p.set = true
+	if string(data) == "null" {
+		p.null = true
+		return nil
+	}
+	return json.Unmarshal(data, &p.path)
+}
+
+// parsePath - parses simple reference paths like $.a.b[0]['c'], without wildcards and filters
+func parsePath(path string) ([]pathToken, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, runtimeError("invalid path %q, paths must start with $", path)
+	}
+	tokens := []pathToken{}
+	rest := path[1:]
+	for len(rest) > 0 {
+		switch {
+		case rest[0] == '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end == -1 {
+				end = len(rest) - 1
+			}
+			key := rest[1 : end+1]
+			if key == "" || key == "*" {
+				return nil, runtimeError("unsupported path %q", path)
+			}
+			tokens = append(tokens, pathToken{key: key})
+			rest = rest[end+1:]
+		case strings.HasPrefix(rest, "['"):
+			end := strings.Index(rest, "']")
+			if end == -1 {
+				return nil, runtimeError("invalid path %q", path)
+			}
+			tokens = append(tokens, pathToken{key: rest[2:end]})
+			rest = rest[end+2:]
+		case rest[0] == '[':
+			end := strings.Index(rest, "]")
+			if end == -1 {
+				return nil, runtimeError("invalid path %q", path)
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil || index < 0 {
+				return nil, runtimeError("unsupported path %q", path)
+			}
+			tokens = append(tokens, pathToken{index: index, isIndex: true})
+			rest = rest[end+1:]
+		default:
+			return nil, runtimeError("invalid path %q", path)
+		}
+	}
+	return tokens, nil
+}
+
+// getPath - returns value referenced by path, missing values result in States.Runtime error
+func getPath(data interface{}, path string) (interface{}, error) {
+	tokens, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	current := data
+	for _, token := range tokens {
+		if token.isIndex {
+			array, ok := current.([]interface{})
+			if !ok || token.index >= len(array) {
+				return nil, runtimeError("path %q does not match input", path)
+			}
+			current = array[token.index]
+			continue
+		}
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, runtimeError("path %q does not match input", path)
+		}
+		value, ok := object[token.key]
+		if !ok {
+			return nil, runtimeError("path %q does not match input", path)
+		}
+		current = value
+	}
+	return current, nil
+}
+
+// pathExists - checks whether path references existing value
+func pathExists(data interface{}, path string) bool {
+	_, err := getPath(data, path)
+	return err == nil
+}
+
+// setPath - returns copy of data with value placed at path, objects on the way are created when missing
+func setPath(data interface{}, path string, value interface{}) (interface{}, error) {
+	tokens, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	return setTokens(data, tokens, value, path)
+}
+
+func setTokens(data interface{}, tokens []pathToken, value interface{}, path string) (interface{}, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	token := tokens[0]
+	if token.isIndex {
+		array, ok := data.([]interface{})
+		if !ok || token.index >= len(array) {
+			return nil, runtimeError("unable to apply result path %q to input", path)
+		}
+		copied := append([]interface{}{}, array...)
+		child, err := setTokens(array[token.index], tokens[1:], value, path)
+		if err != nil {
+			return nil, err
+		}
+		copied[token.index] = child
+		return copied, nil
+	}
+	object, ok := data.(map[string]interface{})
+	if data != nil && !ok {
+		return nil, runtimeError("unable to apply result path %q to input", path)
+	}
+	copied := make(map[string]interface{}, len(object)+1)
+	for key, existing := range object {
+		copied[key] = existing
+	}
+	child, err := setTokens(object[token.key], tokens[1:], value, path)
+	if err != nil {
+		return nil, err
+	}
+	copied[token.key] = child
+	return copied, nil
+}
+
+// selectPath - resolves path against input, or against context object when path starts with $$
+func selectPath(input interface{}, contextObject map[string]interface{}, path string) (interface{}, error) {
+	if strings.HasPrefix(path, "$$") {
+		return getPath(contextObject, path[1:])
+	}
+	return getPath(input, path)
+}
+
+// applyParameters - builds payload template, keys ending with .$ are replaced with values of their paths
+func applyParameters(template interface{}, input interface{}, contextObject map[string]interface{}) (interface{}, error) {
+	switch typed := template.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(typed))
+		for key, value := range typed {
+			if strings.HasSuffix(key, ".$") {
+				path, ok := value.(string)
+				if !ok {
+					return nil, runtimeError("value of %q must be a path", key)
+				}
+				if !strings.HasPrefix(path, "$") {
+					return nil, runtimeError("intrinsic function %q is not supported", path)
+				}
+				selected, err := selectPath(input, contextObject, path)
+				if err != nil {
+					return nil, err
+				}
+				result[strings.TrimSuffix(key, ".$")] = selected
+				continue
+			}
+			applied, err := applyParameters(value, input, contextObject)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = applied
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, len(typed))
+		for i, value := range typed {
+			applied, err := applyParameters(value, input, contextObject)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = applied
+		}
+		return result, nil
+	default:
+		return template, nil
+	}
+}
+
+// applyInputPath - InputPath null results in empty object, missing InputPath keeps the input
+func applyInputPath(p optionalPath, input interface{}) (interface{}, error) {
+	if p.null {
+		return map[string]interface{}{}, nil
+	}
+	if !p.set {
+		return input, nil
+	}
+	return getPath(input, p.path)
+}
+
+// applyOutputPath - same rules as for InputPath
+func applyOutputPath(p optionalPath, output interface{}) (interface{}, error) {
+	return applyInputPath(p, output)
+}
+
+// applyResultPath - ResultPath null discards result, missing ResultPath replaces input with result
+func applyResultPath(p optionalPath, input interface{}, result interface{}) (interface{}, error) {
+	if p.null {
+		return input, nil
+	}
+	if !p.set {
+		return result, nil
+	}
+	return setPath(input, p.path, result)
+}
+
+func toJSON(value interface{}) string {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%q", err.Error())
+	}
+	return string(encoded)
+}
@@ -1,10 +1,126 @@
 package error
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sfn"
+	log "github.com/sirupsen/logrus"
 )
 
-// HandleError - returns bad request response to user
+// ProblemContentType - media type of problem documents
+const ProblemContentType = "application/problem+json"
+
+// codes of errors not coming from AWS
+const (
+	// CodeBadRequest - error without type, caused by invalid input
+	CodeBadRequest = "BadRequest"
+	// CodeNotConfigured - feature needs storage which is not configured
+	CodeNotConfigured = "NotConfigured"
+	// CodeInternal - failure of the backend itself
+	CodeInternal = "InternalError"
+)
+
+// Problem - RFC 7807 problem document, code, transaction id and retryability are extension members
+type Problem struct {
+	Type          string `json:"type"`
+	Title         string `json:"title"`
+	Status        int    `json:"status"`
+	Detail        string `json:"detail"`
+	Code          string `json:"code"`
+	TransactionID string `json:"transactionId,omitempty"`
+	// Retryable - the same request may succeed later
+	Retryable bool `json:"retryable"`
+}
+
+// Error - error with HTTP status and code returned to user
+type Error struct {
+	Status    int
+	Code      string
+	Message   string
+	Retryable bool
+	// Err - wrapped cause
+	Err error
+}
+
+// New - creates error with status, code and message
+func New(status int, code string, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+func (typed *Error) Error() string {
+	return typed.Message
+}
+
+// Unwrap - returns cause
+func (typed *Error) Unwrap() error {
+	return typed.Err
+}
+
+// awsStatuses - HTTP status of AWS error codes, other AWS errors mean AWS failed and are 502 Bad Gateway
+var awsStatuses = map[string]int{
+	sfn.ErrCodeExecutionDoesNotExist:    http.StatusNotFound,
+	sfn.ErrCodeStateMachineDoesNotExist: http.StatusNotFound,
+	sfn.ErrCodeExecutionAlreadyExists:   http.StatusConflict,
+	"ThrottlingException":               http.StatusTooManyRequests,
+	"AccessDeniedException":             http.StatusForbidden,
+	sfn.ErrCodeInvalidArn:               http.StatusBadRequest,
+	sfn.ErrCodeInvalidExecutionInput:    http.StatusBadRequest,
+}
+
+// FromError - returns typed error of err, AWS errors are mapped by code and other errors are bad requests
+func FromError(err error) *Error {
+	var typed *Error
+	if errors.As(err, &typed) {
+		return typed
+	}
+	var awsErr awserr.Error
+	if !errors.As(err, &awsErr) {
+		return &Error{Status: http.StatusBadRequest, Code: CodeBadRequest, Message: err.Error(), Err: err}
+	}
+	status, ok := awsStatuses[awsErr.Code()]
+	if !ok {
+		status = http.StatusBadGateway
+	}
+	return &Error{
+		Status:    status,
+		Code:      awsErr.Code(),
+		Message:   awsErr.Message(),
+		Retryable: status == http.StatusTooManyRequests || (status == http.StatusBadGateway && awsRetryable(awsErr)),
+		Err:       err,
+	}
+}
+
+// awsRetryable - AWS failed with server error or error SDK retries
+func awsRetryable(awsErr awserr.Error) bool {
+	var requestFailure awserr.RequestFailure
+	if errors.As(awsErr, &requestFailure) && requestFailure.StatusCode() >= http.StatusInternalServerError {
+		return true
+	}
+	return request.IsErrorRetryable(awsErr) || request.IsErrorThrottle(awsErr)
+}
+
+// HandleError - writes problem document of err, transaction id is taken from X-Request-ID response header
 func HandleError(w http.ResponseWriter, err error) {
-	http.Error(w, err.Error(), http.StatusBadRequest)
+	typed := FromError(err)
+	problem := Problem{
+		Type:          "about:blank",
+		Title:         http.StatusText(typed.Status),
+		Status:        typed.Status,
+		Detail:        typed.Message,
+		Code:          typed.Code,
+		TransactionID: w.Header().Get("X-Request-ID"),
+		Retryable:     typed.Retryable,
+	}
+	if typed.Status >= http.StatusInternalServerError {
+		log.WithField("transaction_id", problem.TransactionID).Error("Request failed: ", err)
+	}
+	js, _ := json.Marshal(problem)
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(typed.Status)
+	w.Write(js)
 }
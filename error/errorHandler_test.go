@@ -1,22 +1,67 @@
 package error_test
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"sfr-backend/error"
 	"testing"
 
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestErrorHandler(t *testing.T) {
 	rr := httptest.NewRecorder()
-	expectedRecorder := httptest.NewRecorder()
+	rr.Header().Set("X-Request-ID", "tid")
 
 	errorMessage := "errorMessage"
 	error.HandleError(rr, errors.New(errorMessage))
-	http.Error(expectedRecorder, errorMessage, http.StatusBadRequest)
 
-	assert.Equal(t, expectedRecorder.Body, rr.Body)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Equal(t, error.ProblemContentType, rr.Header().Get("Content-Type"))
+	var problem error.Problem
+	json.NewDecoder(rr.Body).Decode(&problem)
+	assert.Equal(t, error.Problem{Type: "about:blank", Title: "Bad Request", Status: http.StatusBadRequest, Detail: errorMessage,
+		Code: error.CodeBadRequest, TransactionID: "tid"}, problem)
+}
+
+func TestAwsErrorMapping(t *testing.T) {
+	testTable := []struct {
+		err               awserr.Error
+		expectedStatus    int
+		expectedRetryable bool
+	}{
+		{awserr.New("ExecutionDoesNotExist", "Execution Does Not Exist", nil), http.StatusNotFound, false},
+		{awserr.New("ExecutionAlreadyExists", "Execution Already Exists", nil), http.StatusConflict, false},
+		{awserr.New("ThrottlingException", "Rate exceeded", nil), http.StatusTooManyRequests, true},
+		{awserr.New("AccessDeniedException", "not authorized", nil), http.StatusForbidden, false},
+		{awserr.New("InvalidArn", "Invalid Arn", nil), http.StatusBadRequest, false},
+		{awserr.NewRequestFailure(awserr.New("InternalFailure", "internal error", nil), http.StatusInternalServerError, "id"), http.StatusBadGateway, true},
+		{awserr.New("RequestError", "send request failed", errors.New("connection reset by peer")), http.StatusBadGateway, true},
+		{awserr.New("UnrecognizedClientException", "invalid token", nil), http.StatusBadGateway, false},
+	}
+
+	for _, testCase := range testTable {
+		rr := httptest.NewRecorder()
+		// wrapped errors are mapped as well
+		error.HandleError(rr, fmt.Errorf("listing executions: %w", testCase.err))
+
+		assert.Equal(t, testCase.expectedStatus, rr.Code, testCase.err.Code())
+		var problem error.Problem
+		json.NewDecoder(rr.Body).Decode(&problem)
+		assert.Equal(t, testCase.err.Code(), problem.Code)
+		assert.Equal(t, testCase.err.Message(), problem.Detail)
+		assert.Equal(t, testCase.expectedRetryable, problem.Retryable, testCase.err.Code())
+	}
+}
+
+func TestTypedError(t *testing.T) {
+	rr := httptest.NewRecorder()
+	error.HandleError(rr, error.New(http.StatusServiceUnavailable, "NotConfigured", "store is not configured"))
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"code":"NotConfigured"`)
 }
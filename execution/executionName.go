@@ -0,0 +1,129 @@
+package execution
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/sfn"
+
+	awsprovider "sfr-backend/awsProvider"
+)
+
+// maxExecutionNameLength - step functions limit for execution names
+const maxExecutionNameLength = 80
+
+// IdempotencyKeyHeader - header used by clients to make execution starts idempotent
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// characters not allowed by step functions in execution names
+const invalidNameCharacters = " <>{}[]?*\"#%\\^|~`$&,;:/"
+
+// executionNaming - name template and idempotency key used to name started executions
+type executionNaming struct {
+	template string
+	key      string
+	now      time.Time
+}
+
+// executionExistsError - returned when an execution with the same name was already started
+type executionExistsError struct {
+	existing *sfn.DescribeExecutionOutput
+	err      error
+}
+
+func (e *executionExistsError) Error() string {
+	return e.err.Error()
+}
+
+// namingFromRequest - reads name template from form value "name" or falls back to Idempotency-Key header
+// defaultKeyTemplate is used when only the idempotency key is provided
+func namingFromRequest(r *http.Request, defaultKeyTemplate string) executionNaming {
+	naming := executionNaming{
+		template: r.FormValue("name"),
+		key:      r.Header.Get(IdempotencyKeyHeader),
+		now:      time.Now(),
+	}
+	if len(naming.template) == 0 && len(naming.key) > 0 {
+		naming.template = defaultKeyTemplate
+	}
+	return naming
+}
+
+// name - renders execution name, returns empty string when no naming was requested
+// Supported placeholders: {machine}, {execution}, {key}, {date}, {time}, {hash(input)}, {hash(execution)}
+func (naming executionNaming) name(machine string, execution string, input string) string {
+	if len(naming.template) == 0 {
+		return ""
+	}
+	replacer := strings.NewReplacer(
+		"{machine}", lastArnSegment(machine),
+		"{execution}", lastArnSegment(execution),
+		"{key}", naming.key,
+		"{date}", naming.now.UTC().Format("2006-01-02"),
+		"{time}", naming.now.UTC().Format("150405"),
+		"{hash(input)}", shortHash(input),
+		"{hash(execution)}", shortHash(execution),
+	)
+	return sanitizeExecutionName(replacer.Replace(naming.template))
+}
+
+// sanitizeExecutionName - replaces characters not allowed by step functions and shortens names over max length,
+// shortened names keep hash of the full name at the end so names differing only in their tail stay distinct
+func sanitizeExecutionName(name string) string {
+	sanitized := strings.Map(func(r rune) rune {
+		if r < 0x20 || (r >= 0x7f && r <= 0x9f) || strings.ContainsRune(invalidNameCharacters, r) {
+			return '-'
+		}
+		return r
+	}, name)
+	if len(sanitized) <= maxExecutionNameLength {
+		return sanitized
+	}
+	suffix := "-" + shortHash(sanitized)
+	cut := maxExecutionNameLength - len(suffix)
+	for cut > 0 && !utf8.RuneStart(sanitized[cut]) {
+		cut--
+	}
+	return sanitized[:cut] + suffix
+}
+
+func lastArnSegment(arn string) string {
+	return arn[strings.LastIndex(arn, ":")+1:]
+}
+
+func shortHash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// executionArnForName - builds execution ARN from state machine ARN and execution name
+func executionArnForName(machine string, name string) string {
+	return fmt.Sprintf("%s:%s", strings.Replace(machine, ":stateMachine:", ":execution:", 1), name)
+}
+
+// startExecution - starts execution and translates ExecutionAlreadyExists into executionExistsError
+// carrying the already started execution
+func startExecution(stepFunctionAPI awsprovider.AwsStepFunctionInterface, executionInput *sfn.StartExecutionInput) (*sfn.StartExecutionOutput, error) {
+	executionStart, err := stepFunctionAPI.StartExecution(executionInput)
+	if err == nil {
+		return executionStart, nil
+	}
+	awsErr, ok := err.(awserr.Error)
+	if !ok || awsErr.Code() != sfn.ErrCodeExecutionAlreadyExists || executionInput.Name == nil {
+		return nil, err
+	}
+	existing, describeErr := stepFunctionAPI.DescribeExecution(&sfn.DescribeExecutionInput{
+		ExecutionArn: aws.String(executionArnForName(aws.StringValue(executionInput.StateMachineArn), *executionInput.Name)),
+	})
+	if describeErr != nil {
+		return nil, err
+	}
+	return nil, &executionExistsError{existing: existing, err: err}
+}
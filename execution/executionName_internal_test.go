@@ -0,0 +1,74 @@
+package execution
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecutionNaming(t *testing.T) {
+	now := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	machine := "arn:aws:states:us-east-1:123456789012:stateMachine:Machine"
+	execution := "arn:aws:states:us-east-1:123456789012:execution:Machine:previous"
+	testTable := []struct {
+		template       string
+		key            string
+		expectedOutput string
+	}{
+		{"", "", ""},
+		{"{machine}-{date}", "", "Machine-2021-03-04"},
+		{"{key}", "retry-1", "retry-1"},
+		{"{execution}-{time}", "", "previous-050607"},
+		{"{machine}-{hash(input)}", "", "Machine-" + shortHash("{}")},
+		{"name with spaces/and:colons", "", "name-with-spaces-and-colons"},
+		{strings.Repeat("a", 100), "", strings.Repeat("a", 63) + "-" + shortHash(strings.Repeat("a", 100))},
+	}
+	for _, testCase := range testTable {
+		naming := executionNaming{template: testCase.template, key: testCase.key, now: now}
+		assert.Equal(t, testCase.expectedOutput, naming.name(machine, execution, "{}"))
+	}
+}
+
+func TestExecutionNamingKeepsLongNamesDistinct(t *testing.T) {
+	now := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	machine := "arn:aws:states:us-east-1:123456789012:stateMachine:" + strings.Repeat("Machine", 12)
+	first := "arn:aws:states:us-east-1:123456789012:execution:Machine:first"
+	second := "arn:aws:states:us-east-1:123456789012:execution:Machine:second"
+	testTable := []struct {
+		template string
+		key      string
+	}{
+		{"{key}-{hash(execution)}", strings.Repeat("k", 64)},
+		{"{machine}-{date}-{hash(input)}", ""},
+		{"{key}-{hash(execution)}", strings.Repeat("ключ", 20)},
+	}
+	for _, testCase := range testTable {
+		naming := executionNaming{template: testCase.template, key: testCase.key, now: now}
+		firstName := naming.name(machine, first, `{"item": 1}`)
+		secondName := naming.name(machine, second, `{"item": 2}`)
+		assert.NotEqual(t, firstName, secondName, testCase.template)
+		assert.LessOrEqual(t, len(firstName), maxExecutionNameLength)
+		assert.True(t, utf8.ValidString(firstName), firstName)
+	}
+}
+
+func TestNamingFromRequest(t *testing.T) {
+	req, _ := http.NewRequest("POST", "/aws/execution", strings.NewReader("machine=machine"))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Add(IdempotencyKeyHeader, "key")
+	assert.Equal(t, "{key}-{hash(execution)}", namingFromRequest(req, "{key}-{hash(execution)}").template)
+
+	req, _ = http.NewRequest("POST", "/aws/execution", strings.NewReader("machine=machine&name={machine}"))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Add(IdempotencyKeyHeader, "key")
+	assert.Equal(t, "{machine}", namingFromRequest(req, "{key}").template)
+}
+
+func TestExecutionArnForName(t *testing.T) {
+	machine := "arn:aws:states:us-east-1:123456789012:stateMachine:Machine"
+	assert.Equal(t, "arn:aws:states:us-east-1:123456789012:execution:Machine:name", executionArnForName(machine, "name"))
+}
@@ -1,10 +1,10 @@
 package execution
 
 import (
-	"encoding/json"
 	"net/http"
 	"strconv"
 
+	"sfr-backend/audit"
 	awsprovider "sfr-backend/awsProvider"
 	"sfr-backend/awssession"
 	errHandler "sfr-backend/error"
@@ -89,97 +89,64 @@ func GetExecutionHandler(w http.ResponseWriter, r *http.Request, providerInterfa
 
 // PostStartExecution - starts executions with given params
 func PostStartExecution(w http.ResponseWriter, r *http.Request, providerInterface awsprovider.AwsStepFunctionsProvider) {
-	sfv, err := awssession.CreateStepFunctionSession(w, r, providerInterface)
-	if err != nil {
-		errHandler.HandleError(w, err)
-		return
-	}
-	err = r.ParseForm()
-
-	executionInput := &sfn.StartExecutionInput{
-		StateMachineArn: aws.String(r.FormValue("machine")),
-	}
-
-	if len(r.FormValue("input")) > 0 {
-		executionInput.Input = aws.String(r.FormValue("input"))
-	} else {
-		executionInput.Input = aws.String("{}")
-	}
-	executionStart, err := sfv.StartExecution(executionInput)
-
-	if err != nil {
-		errHandler.HandleError(w, err)
-		return
-	}
-	response.WriteResponse(w, executionStart)
+	postStartRequest(w, r, providerInterface, audit.ActionStartExecution)
 }
 
 // PostRestartExecution - restarts given execution
 func PostRestartExecution(w http.ResponseWriter, r *http.Request, providerInterface awsprovider.AwsStepFunctionsProvider) {
-	sfv, err := awssession.CreateStepFunctionSession(w, r, providerInterface)
-	if err != nil {
-		errHandler.HandleError(w, err)
-		return
-	}
-	err = r.ParseForm()
-	executionStart, err := runExecution(sfv, r.FormValue("machine"), r.FormValue("execution"), "")
-	if err != nil {
-		errHandler.HandleError(w, err)
-		return
-	}
-	response.WriteResponse(w, executionStart)
+	postStartRequest(w, r, providerInterface, audit.ActionRestartExecution)
 }
 
 // PostRestartBatch - post request to reproces execution batch
 func PostRestartBatch(w http.ResponseWriter, r *http.Request, providerInterface awsprovider.AwsStepFunctionsProvider) {
+	postStartRequest(w, r, providerInterface, audit.ActionBatchRestart)
+}
+
+func postStartRequest(w http.ResponseWriter, r *http.Request, providerInterface awsprovider.AwsStepFunctionsProvider, action string) {
 	sfv, err := awssession.CreateStepFunctionSession(w, r, providerInterface)
 	if err != nil {
 		errHandler.HandleError(w, err)
 		return
 	}
-	err = r.ParseForm()
-	useOriginalInput, err := strconv.ParseBool(r.FormValue("useOriginalInput"))
+	request, err := ParseStartRequest(r, action)
 	if err != nil {
 		errHandler.HandleError(w, err)
 		return
 	}
-	var executions []string
-	err = json.Unmarshal([]byte(r.FormValue("executions")), &executions)
-	if err != nil {
-		errHandler.HandleError(w, err)
+	WriteStartResults(w, request, ExecuteStartRequest(r, sfv, request))
+}
+
+// recordExecution - records audit event of started execution, target is machine or restarted execution
+func recordExecution(r *http.Request, request StartRequest, target string, input string, output *sfn.StartExecutionOutput, err error) {
+	event := audit.Event{
+		Action:    request.Action,
+		Target:    target,
+		InputHash: audit.HashInput(input),
+		Outcome:   audit.Outcome(err),
+		Approval:  request.ApprovalID,
+	}
+	if output != nil {
+		event.Execution = aws.StringValue(output.ExecutionArn)
+	}
+	if existsErr, ok := err.(*executionExistsError); ok {
+		event.Outcome = audit.OutcomeConflict
+		event.Execution = aws.StringValue(existsErr.existing.ExecutionArn)
+	} else if err != nil {
+		event.Error = err.Error()
+	}
+	audit.Record(r, event)
+}
+
+// handleStartError - responds with already started execution and 409 when execution name was reused
+func handleStartError(w http.ResponseWriter, err error) {
+	if existsErr, ok := err.(*executionExistsError); ok {
+		response.WriteResponseWithStatus(w, http.StatusConflict, existsErr.existing)
 		return
 	}
-	executionsBatches := []*sfn.StartExecutionOutput{}
-	errors := []string{}
-	for _, execution := range executions {
-		if useOriginalInput {
-			rerun, err := runExecution(sfv, r.FormValue("machine"), execution, "")
-			if err != nil {
-				errors = append(errors, err.Error())
-			} else {
-				executionsBatches = append(executionsBatches, rerun)
-			}
-		} else {
-			rerun, err := runExecution(sfv, r.FormValue("machine"), execution, r.FormValue("input"))
-			if err != nil {
-				errors = append(errors, err.Error())
-			} else {
-				executionsBatches = append(executionsBatches, rerun)
-			}
-		}
-	}
-	type ResponseStruct struct {
-		Execution []*sfn.StartExecutionOutput
-		Errors    []string
-	}
-	responseData := ResponseStruct{
-		Execution: executionsBatches,
-		Errors:    errors,
-	}
-	response.WriteResponse(w, responseData)
+	errHandler.HandleError(w, err)
 }
 
-func runExecution(stepFunctionAPI awsprovider.AwsStepFunctionInterface, machine string, execution string, input string) (*sfn.StartExecutionOutput, error) {
+func runExecution(stepFunctionAPI awsprovider.AwsStepFunctionInterface, machine string, execution string, input string, naming executionNaming) (*sfn.StartExecutionOutput, string, error) {
 	executionInput := &sfn.StartExecutionInput{
 		StateMachineArn: aws.String(machine),
 	}
@@ -193,14 +160,18 @@ func runExecution(stepFunctionAPI awsprovider.AwsStepFunctionInterface, machine
 			ExecutionArn: aws.String(execution),
 		})
 		if err != nil {
-			return nil, err
+			return nil, "", err
 		}
 		executionInput.Input = aws.String(*execution.Input)
 	}
-	executionStart, err := stepFunctionAPI.StartExecution(executionInput)
+	name := naming.name(machine, execution, *executionInput.Input)
+	if len(name) > 0 {
+		executionInput.Name = aws.String(name)
+	}
+	executionStart, err := startExecution(stepFunctionAPI, executionInput)
 	if err != nil {
-		return nil, err
+		return nil, *executionInput.Input, err
 	}
-	return executionStart, nil
+	return executionStart, *executionInput.Input, nil
 
 }
@@ -1,16 +1,23 @@
 package execution_test
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"sfr-backend/audit"
 	"sfr-backend/execution"
+	"sfr-backend/lifecycle"
 	"sfr-backend/mocks"
+	"sfr-backend/requestbody"
+	"sfr-backend/user"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/sfn"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -340,3 +347,201 @@ func TestPostRestartBatch(t *testing.T) {
 
 	assert.Equal(t, http.StatusOK, rr.Code)
 }
+
+func TestPostStartExecutionWithName(t *testing.T) {
+	mockAwsProvider := &mocks.AwsStepFunctionsProvider{}
+	mockStepFunction := &mocks.AwsStepFunctionInterface{}
+
+	mockAwsProvider.On("New", mock.Anything).Return(mockStepFunction, nil)
+	executionArn := "executionArn"
+	output := &sfn.StartExecutionOutput{
+		ExecutionArn: &executionArn,
+		StartDate:    &time.Time{},
+	}
+	mockStepFunction.On("StartExecution", mock.MatchedBy(func(input *sfn.StartExecutionInput) bool {
+		return input.Name != nil && *input.Name == "retry-key"
+	})).Return(output, nil)
+
+	payload := strings.NewReader("machine=machine")
+	req, _ := http.NewRequest("POST", "/aws/execution", payload)
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Add(execution.IdempotencyKeyHeader, "retry-key")
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		execution.PostStartExecution(w, r, mockAwsProvider)
+	})
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	mockStepFunction.AssertExpectations(t)
+}
+
+func TestPostStartExecutionAlreadyExists(t *testing.T) {
+	mockAwsProvider := &mocks.AwsStepFunctionsProvider{}
+	mockStepFunction := &mocks.AwsStepFunctionInterface{}
+
+	mockAwsProvider.On("New", mock.Anything).Return(mockStepFunction, nil)
+	mockStepFunction.On("StartExecution", mock.Anything).Return(nil, awserr.New(sfn.ErrCodeExecutionAlreadyExists, "Execution Already Exists", nil))
+	existingArn := "arn:aws:states:us-east-1:123456789012:execution:Machine:name"
+	existing := &sfn.DescribeExecutionOutput{
+		ExecutionArn: &existingArn,
+	}
+	mockStepFunction.On("DescribeExecution", &sfn.DescribeExecutionInput{ExecutionArn: &existingArn}).Return(existing, nil)
+
+	payload := strings.NewReader("machine=arn:aws:states:us-east-1:123456789012:stateMachine:Machine&name=name")
+	req, _ := http.NewRequest("POST", "/aws/execution", payload)
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		execution.PostStartExecution(w, r, mockAwsProvider)
+	})
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	var rval sfn.DescribeExecutionOutput
+	json.Unmarshal(rr.Body.Bytes(), &rval)
+	assert.Equal(t, existingArn, *rval.ExecutionArn)
+}
+
+type recordingAuditStore struct {
+	events []audit.Event
+}
+
+func (store *recordingAuditStore) Append(ctx context.Context, event audit.Event) error {
+	store.events = append(store.events, event)
+	return nil
+}
+
+func (store *recordingAuditStore) Query(ctx context.Context, filter audit.Filter) ([]audit.Event, error) {
+	return store.events, nil
+}
+
+func TestPostStartExecutionAudit(t *testing.T) {
+	store := &recordingAuditStore{}
+	audit.SetStore(store)
+	defer audit.SetStore(nil)
+	mockAwsProvider := &mocks.AwsStepFunctionsProvider{}
+	mockStepFunction := &mocks.AwsStepFunctionInterface{}
+	executionArn := "arn:aws:states:us-east-1:123456789012:execution:Machine:name"
+	mockAwsProvider.On("New", mock.Anything).Return(mockStepFunction, nil)
+	mockStepFunction.On("StartExecution", mock.Anything).Return(&sfn.StartExecutionOutput{ExecutionArn: &executionArn}, nil)
+
+	machine := "arn:aws:states:us-east-1:123456789012:stateMachine:Machine"
+	payload := strings.NewReader("machine=" + machine + "&input={}")
+	req, _ := http.NewRequest("POST", "/aws/execution", payload)
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req = req.WithContext(user.WithUsername(req.Context(), "operator"))
+	rr := httptest.NewRecorder()
+
+	execution.PostStartExecution(rr, req, mockAwsProvider)
+
+	assert.Len(t, store.events, 1)
+	assert.Equal(t, audit.ActionStartExecution, store.events[0].Action)
+	assert.Equal(t, "operator", store.events[0].User)
+	assert.Equal(t, machine, store.events[0].Target)
+	assert.Equal(t, executionArn, store.events[0].Execution)
+	assert.Equal(t, audit.HashInput("{}"), store.events[0].InputHash)
+	assert.Equal(t, audit.OutcomeSuccess, store.events[0].Outcome)
+}
+
+func TestPostRestartBatchJSON(t *testing.T) {
+	mockAwsProvider := &mocks.AwsStepFunctionsProvider{}
+	mockStepFunction := &mocks.AwsStepFunctionInterface{}
+
+	mockAwsProvider.On("New", mock.Anything).Return(mockStepFunction, nil)
+	executionArn := "executionArn"
+	mockStepFunction.On("StartExecution", mock.MatchedBy(func(input *sfn.StartExecutionInput) bool {
+		return *input.StateMachineArn == "machine" && *input.Input == `{"retry": true}`
+	})).Return(&sfn.StartExecutionOutput{ExecutionArn: &executionArn, StartDate: &time.Time{}}, nil).Twice()
+
+	payload := strings.NewReader(`{"machine": "machine", "executions": ["first", "second"], "input": {"retry": true}}`)
+	req, _ := http.NewRequest("POST", "/aws/execution/batch", payload)
+	req.Header.Add("Content-Type", "application/json")
+
+	handler := requestbody.Decode(execution.NewStartBody(audit.ActionBatchRestart), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		execution.PostRestartBatch(w, r, mockAwsProvider)
+	}))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var batch execution.BatchResponse
+	json.NewDecoder(rr.Body).Decode(&batch)
+	assert.Len(t, batch.Execution, 2)
+	mockStepFunction.AssertExpectations(t)
+}
+
+func TestPostRestartBatchStopping(t *testing.T) {
+	defer lifecycle.Reset()
+	mockAwsProvider := &mocks.AwsStepFunctionsProvider{}
+	mockStepFunction := &mocks.AwsStepFunctionInterface{}
+
+	mockAwsProvider.On("New", mock.Anything).Return(mockStepFunction, nil)
+	executionArn := "executionArn"
+	// drain timeout passes while the first execution is starting
+	mockStepFunction.On("StartExecution", mock.Anything).Run(func(mock.Arguments) {
+		lifecycle.Stop()
+	}).Return(&sfn.StartExecutionOutput{ExecutionArn: &executionArn, StartDate: &time.Time{}}, nil).Once()
+
+	payload := strings.NewReader(`{"machine": "machine", "executions": ["first", "second"], "input": {"retry": true}}`)
+	req, _ := http.NewRequest("POST", "/aws/execution/batch", payload)
+	req.Header.Add("Content-Type", "application/json")
+
+	handler := requestbody.Decode(execution.NewStartBody(audit.ActionBatchRestart), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		execution.PostRestartBatch(w, r, mockAwsProvider)
+	}))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var batch execution.BatchResponse
+	json.NewDecoder(rr.Body).Decode(&batch)
+	assert.Len(t, batch.Execution, 1)
+	assert.Equal(t, []string{"restart of second was not started, server is shutting down"}, batch.Errors)
+	mockStepFunction.AssertNumberOfCalls(t, "StartExecution", 1)
+}
+
+func TestPostStartExecutionStopping(t *testing.T) {
+	lifecycle.Stop()
+	defer lifecycle.Reset()
+	mockAwsProvider := &mocks.AwsStepFunctionsProvider{}
+	mockStepFunction := &mocks.AwsStepFunctionInterface{}
+	mockAwsProvider.On("New", mock.Anything).Return(mockStepFunction, nil)
+
+	req, _ := http.NewRequest("POST", "/aws/execution", strings.NewReader("machine=machine"))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	execution.PostStartExecution(rr, req, mockAwsProvider)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Contains(t, rr.Body.String(), lifecycle.CodeShuttingDown)
+	mockStepFunction.AssertNotCalled(t, "StartExecution", mock.Anything)
+}
+
+func TestStartBodyValidation(t *testing.T) {
+	testTable := []struct {
+		action string
+		body   string
+	}{
+		{audit.ActionStartExecution, `{"input": {}}`},
+		{audit.ActionStartExecution, `{"machine": "machine", "input": "not json"}`},
+		{audit.ActionStartExecution, `{"machine": "machine", "execution": "execution"}`},
+		{audit.ActionRestartExecution, `{"machine": "machine"}`},
+		{audit.ActionBatchRestart, `{"machine": "machine", "executions": []}`},
+		{audit.ActionBatchRestart, `{"machine": "machine", "executions": "[\"execution\"]"}`},
+	}
+
+	for _, testCase := range testTable {
+		req, _ := http.NewRequest("POST", "/aws/execution", strings.NewReader(testCase.body))
+		req.Header.Add("Content-Type", "application/json")
+		handler := requestbody.Decode(execution.NewStartBody(testCase.action), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("handler called with invalid body", testCase.body)
+		}))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code, testCase.body)
+	}
+}
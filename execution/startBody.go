@@ -0,0 +1,112 @@
+package execution
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+
+	"sfr-backend/audit"
+	"sfr-backend/requestbody"
+)
+
+// StartExecutionBody - JSON body of POST /aws/execution
+type StartExecutionBody struct {
+	Machine string `json:"machine"`
+	// Input - JSON input of execution, object or string containing JSON, {} by default
+	Input json.RawMessage `json:"input,omitempty"`
+	// Name - template of execution name
+	Name string `json:"name,omitempty"`
+}
+
+// RestartExecutionBody - JSON body of POST /aws/execution/restart
+type RestartExecutionBody struct {
+	Machine   string `json:"machine"`
+	Execution string `json:"execution"`
+	Name      string `json:"name,omitempty"`
+}
+
+// BatchRestartBody - JSON body of POST /aws/execution/batch
+type BatchRestartBody struct {
+	Machine    string   `json:"machine"`
+	Executions []string `json:"executions"`
+	// UseOriginalInput - every execution restarts with input of its source execution, input is ignored
+	UseOriginalInput bool `json:"useOriginalInput"`
+	// Input - input of all executions when useOriginalInput is false, inputs of source executions when empty
+	Input json.RawMessage `json:"input,omitempty"`
+	Name  string          `json:"name,omitempty"`
+}
+
+// NewStartBody - returns empty JSON body of start, restart or batch restart action
+func NewStartBody(action string) func() requestbody.Body {
+	return func() requestbody.Body {
+		switch action {
+		case audit.ActionRestartExecution:
+			return &RestartExecutionBody{}
+		case audit.ActionBatchRestart:
+			return &BatchRestartBody{}
+		default:
+			return &StartExecutionBody{}
+		}
+	}
+}
+
+// Form - validates body and returns form values of ParseStartRequest
+func (body *StartExecutionBody) Form() (url.Values, error) {
+	input, err := executionInput(body.Input)
+	if err != nil {
+		return nil, err
+	}
+	values := url.Values{"machine": {body.Machine}, "input": {input}, "name": {body.Name}}
+	return values, requireValues(values, "machine")
+}
+
+// Form - validates body and returns form values of ParseStartRequest
+func (body *RestartExecutionBody) Form() (url.Values, error) {
+	values := url.Values{"machine": {body.Machine}, "execution": {body.Execution}, "name": {body.Name}}
+	return values, requireValues(values, "machine", "execution")
+}
+
+// Form - validates body and returns form values of ParseStartRequest
+func (body *BatchRestartBody) Form() (url.Values, error) {
+	if len(body.Executions) == 0 {
+		return nil, errors.New("executions has to list at least one execution")
+	}
+	for _, execution := range body.Executions {
+		if execution == "" {
+			return nil, errors.New("executions can't contain empty execution")
+		}
+	}
+	executions, _ := json.Marshal(body.Executions)
+	input, err := executionInput(body.Input)
+	if err != nil {
+		return nil, err
+	}
+	values := url.Values{
+		"machine":          {body.Machine},
+		"executions":       {string(executions)},
+		"useOriginalInput": {strconv.FormatBool(body.UseOriginalInput)},
+		"input":            {input},
+		"name":             {body.Name},
+	}
+	return values, requireValues(values, "machine")
+}
+
+// executionInput - returns input as string, step functions accept only JSON
+func executionInput(value json.RawMessage) (string, error) {
+	input := requestbody.JSONString(value)
+	if input != "" && !json.Valid([]byte(input)) {
+		return "", errors.New("input has to be JSON")
+	}
+	return input, nil
+}
+
+// requireValues - returns error naming first empty value
+func requireValues(values url.Values, names ...string) error {
+	for _, name := range names {
+		if values.Get(name) == "" {
+			return errors.New(name + " is required")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package execution
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"sfr-backend/audit"
+	awsprovider "sfr-backend/awsProvider"
+	"sfr-backend/lifecycle"
+	"sfr-backend/metrics"
+	"sfr-backend/rbac"
+	"sfr-backend/region"
+	"sfr-backend/response"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sfn"
+)
+
+// StartRequest - parsed start, restart or batch restart request, stored with change requests until approved
+type StartRequest struct {
+	Action         string      `json:"action" dynamodbav:"action"`
+	Region         string      `json:"region" dynamodbav:"region"`
+	Machine        string      `json:"machine" dynamodbav:"machine"`
+	NameTemplate   string      `json:"nameTemplate,omitempty" dynamodbav:"nameTemplate,omitempty"`
+	IdempotencyKey string      `json:"idempotencyKey,omitempty" dynamodbav:"idempotencyKey,omitempty"`
+	RequestedAt    time.Time   `json:"requestedAt" dynamodbav:"requestedAt"`
+	Items          []StartItem `json:"items" dynamodbav:"items"`
+	// ApprovalID - change request which approval started the executions
+	ApprovalID string `json:"approvalId,omitempty" dynamodbav:"approvalId,omitempty"`
+}
+
+// StartItem - single execution to start, empty input means input of source execution
+type StartItem struct {
+	Execution string `json:"execution,omitempty" dynamodbav:"execution,omitempty"`
+	Input     string `json:"input,omitempty" dynamodbav:"input,omitempty"`
+}
+
+// StartResult - outcome of single started execution
+type StartResult struct {
+	Output   *sfn.StartExecutionOutput
+	Existing *sfn.DescribeExecutionOutput
+	Err      error
+}
+
+// ParseStartRequest - reads form of start, restart or batch restart request
+func ParseStartRequest(r *http.Request, action string) (StartRequest, error) {
+	err := r.ParseForm()
+	if err != nil {
+		return StartRequest{}, err
+	}
+	defaultKeyTemplate := "{key}"
+	if action == audit.ActionBatchRestart {
+		// every execution in batch needs its own name, so key alone is combined with source execution
+		defaultKeyTemplate = "{key}-{hash(execution)}"
+	}
+	naming := namingFromRequest(r, defaultKeyTemplate)
+	request := StartRequest{
+		Action:         action,
+		Region:         region.GetDefaultRegion(r),
+		Machine:        rbac.BaseMachine(r.FormValue("machine")),
+		NameTemplate:   naming.template,
+		IdempotencyKey: naming.key,
+		RequestedAt:    naming.now.UTC(),
+	}
+
+	switch action {
+	case audit.ActionStartExecution:
+		input := r.FormValue("input")
+		if len(input) == 0 {
+			input = "{}"
+		}
+		request.Items = []StartItem{{Input: input}}
+	case audit.ActionRestartExecution:
+		request.Items = []StartItem{{Execution: r.FormValue("execution")}}
+	case audit.ActionBatchRestart:
+		useOriginalInput, err := strconv.ParseBool(r.FormValue("useOriginalInput"))
+		if err != nil {
+			return StartRequest{}, err
+		}
+		var executions []string
+		err = json.Unmarshal([]byte(r.FormValue("executions")), &executions)
+		if err != nil {
+			return StartRequest{}, err
+		}
+		input := r.FormValue("input")
+		if useOriginalInput {
+			input = ""
+		}
+		for _, execution := range executions {
+			request.Items = append(request.Items, StartItem{Execution: execution, Input: input})
+		}
+	}
+	return request, nil
+}
+
+// ResolveInputs - fills items without input with input of their source execution
+func ResolveInputs(stepFunctionAPI awsprovider.AwsStepFunctionInterface, request *StartRequest) error {
+	for i, item := range request.Items {
+		if len(item.Input) > 0 {
+			continue
+		}
+		if lifecycle.Stopping().Err() != nil {
+			return lifecycle.ErrStopping
+		}
+		execution, err := stepFunctionAPI.DescribeExecution(&sfn.DescribeExecutionInput{
+			ExecutionArn: aws.String(item.Execution),
+		})
+		if err != nil {
+			return err
+		}
+		request.Items[i].Input = aws.StringValue(execution.Input)
+	}
+	return nil
+}
+
+// ExecuteStartRequest - starts all executions of request and records them in audit log. Once server stops after
+// drain timeout, executions which were not started yet are skipped and reported as not started.
+func ExecuteStartRequest(r *http.Request, stepFunctionAPI awsprovider.AwsStepFunctionInterface, request StartRequest) []StartResult {
+	naming := executionNaming{template: request.NameTemplate, key: request.IdempotencyKey, now: request.RequestedAt}
+	results := []StartResult{}
+	if request.Action == audit.ActionBatchRestart {
+		metrics.ObserveBatchRestart(len(request.Items))
+	}
+	for _, item := range request.Items {
+		target := item.Execution
+		if request.Action == audit.ActionStartExecution {
+			target = request.Machine
+		}
+		if lifecycle.Stopping().Err() != nil {
+			err := notStartedError(request, item)
+			recordExecution(r, request, target, item.Input, nil, err)
+			results = append(results, StartResult{Err: err})
+			continue
+		}
+		output, input, err := runExecution(stepFunctionAPI, request.Machine, item.Execution, item.Input, naming)
+		recordExecution(r, request, target, input, output, err)
+		result := StartResult{Output: output, Err: err}
+		if existsErr, ok := err.(*executionExistsError); ok {
+			result.Existing = existsErr.existing
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// notStartedError - error of execution skipped because server is stopping, batch errors name restarted execution
+func notStartedError(request StartRequest, item StartItem) error {
+	if request.Action != audit.ActionBatchRestart {
+		return lifecycle.ErrStopping
+	}
+	return fmt.Errorf("restart of %s was not started, server is shutting down", item.Execution)
+}
+
+// WriteStartResults - responds with single execution or with batch summary
+func WriteStartResults(w http.ResponseWriter, request StartRequest, results []StartResult) {
+	if request.Action != audit.ActionBatchRestart {
+		if results[0].Err != nil {
+			handleStartError(w, results[0].Err)
+			return
+		}
+		response.WriteResponse(w, results[0].Output)
+		return
+	}
+	responseData := BatchResponse{
+		Execution: []*sfn.StartExecutionOutput{},
+		Existing:  []*sfn.DescribeExecutionOutput{},
+		Errors:    []string{},
+	}
+	for _, result := range results {
+		if result.Existing != nil {
+			responseData.Existing = append(responseData.Existing, result.Existing)
+		} else if result.Err != nil {
+			responseData.Errors = append(responseData.Errors, result.Err.Error())
+		} else {
+			responseData.Execution = append(responseData.Execution, result.Output)
+		}
+	}
+	response.WriteResponse(w, responseData)
+}
+
+// BatchResponse - response of batch restart
+type BatchResponse struct {
+	Execution []*sfn.StartExecutionOutput
+	Existing  []*sfn.DescribeExecutionOutput
+	Errors    []string
+}
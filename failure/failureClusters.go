@@ -0,0 +1,119 @@
+package failure
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxSampleExecutions - number of execution ARNs kept as samples for every cluster
+const maxSampleExecutions = 5
+
+// maxCauseLength - normalized causes are trimmed to this length before grouping
+const maxCauseLength = 500
+
+// causeNormalizers - replaces volatile parts of failure causes, order matters as
+// more specific patterns have to be replaced before generic numbers
+var causeNormalizers = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`arn:aws[a-zA-Z-]*:[^\s"',]+`), "<arn>"},
+	{regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`), "<id>"},
+	{regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:?\d{2})?`), "<timestamp>"},
+	{regexp.MustCompile(`\b\d{4}/\d{2}/\d{2}\b`), "<date>"},
+	{regexp.MustCompile(`(?i)\b[0-9a-f]{8,}\b`), "<id>"},
+	{regexp.MustCompile(`\d+(\.\d+)?`), "<n>"},
+	{regexp.MustCompile(`\s+`), " "},
+}
+
+// Failure - single failed execution with its error and cause taken from history
+type Failure struct {
+	ExecutionArn string
+	Status       string
+	Error        string
+	Cause        string
+	Date         time.Time
+}
+
+// Cluster - group of failures sharing the same error and normalized cause
+type Cluster struct {
+	Error               string    `json:"error"`
+	Cause               string    `json:"cause"`
+	Count               int       `json:"count"`
+	FirstSeen           time.Time `json:"firstSeen"`
+	LastSeen            time.Time `json:"lastSeen"`
+	Statuses            []string  `json:"statuses"`
+	SampleExecutionArns []string  `json:"sampleExecutionArns"`
+}
+
+// NormalizeCause - strips ids, ARNs, timestamps and numbers from cause so similar failures can be grouped
+func NormalizeCause(cause string) string {
+	normalized := cause
+	for _, normalizer := range causeNormalizers {
+		normalized = normalizer.pattern.ReplaceAllString(normalized, normalizer.replacement)
+	}
+	normalized = strings.TrimSpace(normalized)
+	if len(normalized) > maxCauseLength {
+		cut := maxCauseLength
+		for cut > 0 && !utf8.RuneStart(normalized[cut]) {
+			cut--
+		}
+		normalized = normalized[:cut]
+	}
+	return normalized
+}
+
+// ClusterFailures - groups failures by error and normalized cause, biggest clusters first
+func ClusterFailures(failures []Failure) []*Cluster {
+	clustersByKey := map[string]*Cluster{}
+	clusters := []*Cluster{}
+	for _, failure := range failures {
+		cause := NormalizeCause(failure.Cause)
+		key := failure.Error + "\x00" + cause
+		cluster, ok := clustersByKey[key]
+		if !ok {
+			cluster = &Cluster{
+				Error:               failure.Error,
+				Cause:               cause,
+				FirstSeen:           failure.Date,
+				LastSeen:            failure.Date,
+				Statuses:            []string{},
+				SampleExecutionArns: []string{},
+			}
+			clustersByKey[key] = cluster
+			clusters = append(clusters, cluster)
+		}
+		cluster.Count++
+		if failure.Date.Before(cluster.FirstSeen) {
+			cluster.FirstSeen = failure.Date
+		}
+		if failure.Date.After(cluster.LastSeen) {
+			cluster.LastSeen = failure.Date
+		}
+		if !containsString(cluster.Statuses, failure.Status) {
+			cluster.Statuses = append(cluster.Statuses, failure.Status)
+		}
+		if len(cluster.SampleExecutionArns) < maxSampleExecutions {
+			cluster.SampleExecutionArns = append(cluster.SampleExecutionArns, failure.ExecutionArn)
+		}
+	}
+	sort.SliceStable(clusters, func(i, j int) bool {
+		if clusters[i].Count != clusters[j].Count {
+			return clusters[i].Count > clusters[j].Count
+		}
+		return clusters[i].LastSeen.After(clusters[j].LastSeen)
+	})
+	return clusters
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,164 @@
+package failure_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sfr-backend/failure"
+	"sfr-backend/mocks"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sfn"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestNormalizeCause(t *testing.T) {
+	testTable := []struct {
+		firstCause  string
+		secondCause string
+	}{
+		{
+			"Lambda arn:aws:lambda:us-east-1:123456789012:function:worker failed for request 3f2b8c1e-2d4a-4b6c-8e9f-0a1b2c3d4e5f",
+			"Lambda arn:aws:lambda:us-east-1:123456789012:function:other failed for request 9a8b7c6d-5e4f-4a3b-2c1d-0e9f8a7b6c5d",
+		},
+		{
+			"Timeout at 2021-02-03T04:05:06.789Z after 30 seconds",
+			"Timeout at 2021-02-04T14:15:16Z after 45 seconds",
+		},
+		{
+			"Object 0123456789abcdef not found",
+			"Object fedcba9876543210 not found",
+		},
+	}
+	for _, testCase := range testTable {
+		assert.Equal(t, failure.NormalizeCause(testCase.firstCause), failure.NormalizeCause(testCase.secondCause))
+	}
+	assert.NotEqual(t, failure.NormalizeCause("Access denied"), failure.NormalizeCause("Connection refused"))
+}
+
+func TestNormalizeCauseTruncatesOnRuneBoundary(t *testing.T) {
+	normalized := failure.NormalizeCause("x" + strings.Repeat("é", 300))
+	assert.True(t, utf8.ValidString(normalized))
+	assert.LessOrEqual(t, len(normalized), 500)
+}
+
+func TestClusterFailures(t *testing.T) {
+	now := time.Now()
+	failures := []failure.Failure{
+		{ExecutionArn: "first", Status: "FAILED", Error: "States.TaskFailed", Cause: "request 1 failed", Date: now.Add(-time.Hour)},
+		{ExecutionArn: "second", Status: "FAILED", Error: "States.TaskFailed", Cause: "request 2 failed", Date: now},
+		{ExecutionArn: "third", Status: "TIMED_OUT", Error: "States.Timeout", Cause: "", Date: now},
+	}
+
+	clusters := failure.ClusterFailures(failures)
+
+	assert.Equal(t, 2, len(clusters))
+	assert.Equal(t, 2, clusters[0].Count)
+	assert.Equal(t, "States.TaskFailed", clusters[0].Error)
+	assert.Equal(t, now.Add(-time.Hour), clusters[0].FirstSeen)
+	assert.Equal(t, now, clusters[0].LastSeen)
+	assert.Equal(t, []string{"first", "second"}, clusters[0].SampleExecutionArns)
+	assert.Equal(t, 1, clusters[1].Count)
+}
+
+func TestGetFailuresHandler(t *testing.T) {
+	mockAwsProvider := &mocks.AwsStepFunctionsProvider{}
+	mockStepFunction := &mocks.AwsStepFunctionInterface{}
+	mockAwsProvider.On("New", mock.Anything).Return(mockStepFunction, nil)
+
+	to := time.Date(2021, 2, 3, 12, 0, 0, 0, time.UTC)
+	executions := []*sfn.ExecutionListItem{
+		{ExecutionArn: aws.String("failed-1"), Status: aws.String("FAILED"), StartDate: aws.Time(to.Add(-time.Hour))},
+		{ExecutionArn: aws.String("failed-2"), Status: aws.String("FAILED"), StartDate: aws.Time(to.Add(-2 * time.Hour))},
+		{ExecutionArn: aws.String("too-old"), Status: aws.String("FAILED"), StartDate: aws.Time(to.Add(-48 * time.Hour))},
+	}
+	mockStepFunction.On("ListExecutions", mock.MatchedBy(func(input *sfn.ListExecutionsInput) bool {
+		return *input.StatusFilter == "FAILED"
+	})).Return(&sfn.ListExecutionsOutput{Executions: executions}, nil)
+	mockStepFunction.On("ListExecutions", mock.Anything).Return(&sfn.ListExecutionsOutput{}, nil)
+	mockStepFunction.On("GetExecutionHistory", mock.Anything).Return(&sfn.GetExecutionHistoryOutput{
+		Events: []*sfn.HistoryEvent{
+			{
+				Type: aws.String(sfn.HistoryEventTypeExecutionFailed),
+				ExecutionFailedEventDetails: &sfn.ExecutionFailedEventDetails{
+					Error: aws.String("States.TaskFailed"),
+					Cause: aws.String("Task 12 failed"),
+				},
+			},
+		},
+	}, nil)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/aws/machines/{machine}/failures", func(w http.ResponseWriter, r *http.Request) {
+		failure.GetFailuresHandler(w, r, mockAwsProvider)
+	})
+	req, _ := http.NewRequest("GET", "/aws/machines/machine/failures?to=2021-02-03T12:00:00Z", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var rval failure.FailuresResponse
+	json.Unmarshal(rr.Body.Bytes(), &rval)
+	assert.Equal(t, 2, rval.TotalFailures)
+	assert.Equal(t, 1, len(rval.Clusters))
+	assert.Equal(t, "Task <n> failed", rval.Clusters[0].Cause)
+}
+
+func TestCollectFailuresByStopDate(t *testing.T) {
+	mockStepFunction := &mocks.AwsStepFunctionInterface{}
+	from := time.Date(2021, 2, 3, 0, 0, 0, 0, time.UTC)
+	to := from.Add(12 * time.Hour)
+	executions := []*sfn.ExecutionListItem{
+		{ExecutionArn: aws.String("stopped-after-to"), Status: aws.String("FAILED"), StartDate: aws.Time(to.Add(-time.Hour)), StopDate: aws.Time(to.Add(time.Hour))},
+		{ExecutionArn: aws.String("in-window"), Status: aws.String("FAILED"), StartDate: aws.Time(from.Add(time.Hour)), StopDate: aws.Time(from.Add(2 * time.Hour))},
+		{ExecutionArn: aws.String("started-before-from"), Status: aws.String("FAILED"), StartDate: aws.Time(from.Add(-3 * time.Hour)), StopDate: aws.Time(from.Add(time.Hour))},
+		{ExecutionArn: aws.String("stopped-before-from"), Status: aws.String("FAILED"), StartDate: aws.Time(from.Add(-4 * time.Hour)), StopDate: aws.Time(from.Add(-time.Hour))},
+		{ExecutionArn: aws.String("beyond-lookback"), Status: aws.String("FAILED"), StartDate: aws.Time(from.Add(-48 * time.Hour)), StopDate: aws.Time(from.Add(time.Hour))},
+	}
+	mockStepFunction.On("ListExecutions", mock.MatchedBy(func(input *sfn.ListExecutionsInput) bool {
+		return *input.StatusFilter == "FAILED"
+	})).Return(&sfn.ListExecutionsOutput{Executions: executions}, nil)
+	mockStepFunction.On("ListExecutions", mock.Anything).Return(&sfn.ListExecutionsOutput{}, nil)
+	mockStepFunction.On("GetExecutionHistory", mock.Anything).Return(&sfn.GetExecutionHistoryOutput{}, nil)
+
+	failures, truncated, err := failure.CollectFailures(mockStepFunction, "machine", from, to, 10)
+
+	assert.Nil(t, err)
+	assert.False(t, truncated)
+	arns := []string{}
+	for _, f := range failures {
+		arns = append(arns, f.ExecutionArn)
+	}
+	assert.Equal(t, []string{"in-window", "started-before-from"}, arns)
+}
+
+func TestGetFailuresHandlerErrors(t *testing.T) {
+	mockAwsProvider := &mocks.AwsStepFunctionsProvider{}
+	mockStepFunction := &mocks.AwsStepFunctionInterface{}
+	mockAwsProvider.On("New", mock.Anything).Return(mockStepFunction, nil)
+	mockStepFunction.On("ListExecutions", mock.Anything).Return(nil, errors.New("Error"))
+
+	router := mux.NewRouter()
+	router.HandleFunc("/aws/machines/{machine}/failures", func(w http.ResponseWriter, r *http.Request) {
+		failure.GetFailuresHandler(w, r, mockAwsProvider)
+	})
+	testTable := []string{
+		"/aws/machines/machine/failures?from=yesterday",
+		"/aws/machines/machine/failures?from=2021-02-04T00:00:00Z&to=2021-02-03T00:00:00Z",
+		"/aws/machines/machine/failures",
+	}
+	for _, path := range testTable {
+		req, _ := http.NewRequest("GET", path, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	}
+}
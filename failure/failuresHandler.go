@@ -0,0 +1,187 @@
+package failure
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	awsprovider "sfr-backend/awsProvider"
+	"sfr-backend/awssession"
+	errHandler "sfr-backend/error"
+	"sfr-backend/response"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sfn"
+	"github.com/gorilla/mux"
+)
+
+// defaultFailuresWindow - time window used when from is not provided
+const defaultFailuresWindow = 24 * time.Hour
+
+// defaultFailuresLimit - max number of failed executions inspected by default
+const defaultFailuresLimit = 200
+
+// maxFailuresLimit - upper bound for limit param as every failure needs a history call
+const maxFailuresLimit = 1000
+
+// failuresLookback - how long before from executions are listed to find those which started earlier
+// but failed within the window, failures of executions running longer than that are missed
+const failuresLookback = 24 * time.Hour
+
+// failedStatuses - execution statuses collected for clustering
+var failedStatuses = []string{sfn.ExecutionStatusFailed, sfn.ExecutionStatusTimedOut}
+
+// FailuresResponse - response of failures endpoint
+type FailuresResponse struct {
+	Machine       string     `json:"machine"`
+	From          time.Time  `json:"from"`
+	To            time.Time  `json:"to"`
+	TotalFailures int        `json:"totalFailures"`
+	Truncated     bool       `json:"truncated"`
+	Clusters      []*Cluster `json:"clusters"`
+}
+
+// GetFailuresHandler - returns failed and timed out executions of machine grouped into clusters
+func GetFailuresHandler(w http.ResponseWriter, r *http.Request, providerInterface awsprovider.AwsStepFunctionsProvider) {
+	vars := mux.Vars(r)
+	urlParams := r.URL.Query()
+
+	to, err := parseTimeParam(urlParams.Get("to"), time.Now())
+	if err != nil {
+		errHandler.HandleError(w, err)
+		return
+	}
+	from, err := parseTimeParam(urlParams.Get("from"), to.Add(-defaultFailuresWindow))
+	if err != nil {
+		errHandler.HandleError(w, err)
+		return
+	}
+	if from.After(to) {
+		errHandler.HandleError(w, fmt.Errorf("from %s is after to %s", from.Format(time.RFC3339), to.Format(time.RFC3339)))
+		return
+	}
+	limit := defaultFailuresLimit
+	if len(urlParams.Get("limit")) > 0 {
+		parsedLimit, err := strconv.Atoi(urlParams.Get("limit"))
+		if err == nil && parsedLimit > 0 {
+			limit = parsedLimit
+		}
+	}
+	if limit > maxFailuresLimit {
+		limit = maxFailuresLimit
+	}
+
+	sfv, err := awssession.CreateStepFunctionSession(w, r, providerInterface)
+	if err != nil {
+		errHandler.HandleError(w, err)
+		return
+	}
+
+	failures, truncated, err := CollectFailures(sfv, vars["machine"], from, to, limit)
+	if err != nil {
+		errHandler.HandleError(w, err)
+		return
+	}
+	response.WriteResponse(w, FailuresResponse{
+		Machine:       vars["machine"],
+		From:          from,
+		To:            to,
+		TotalFailures: len(failures),
+		Truncated:     truncated,
+		Clusters:      ClusterFailures(failures),
+	})
+}
+
+// CollectFailures - lists failed and timed out executions stopped between from and to and reads their
+// error and cause from history, returns true when more than limit failures were found
+func CollectFailures(stepFunctionAPI awsprovider.AwsStepFunctionInterface, machine string, from time.Time, to time.Time, limit int) ([]Failure, bool, error) {
+	failures := []Failure{}
+	for _, status := range failedStatuses {
+		input := &sfn.ListExecutionsInput{
+			StateMachineArn: aws.String(machine),
+			StatusFilter:    aws.String(status),
+		}
+		for {
+			executions, err := stepFunctionAPI.ListExecutions(input)
+			if err != nil {
+				return nil, false, err
+			}
+			reachedLookback := false
+			for _, execution := range executions.Executions {
+				// executions are listed newest first by start, so nothing started before lookback is left
+				if aws.TimeValue(execution.StartDate).Before(from.Add(-failuresLookback)) {
+					reachedLookback = true
+					break
+				}
+				failedAt := aws.TimeValue(execution.StartDate)
+				if execution.StopDate != nil {
+					failedAt = *execution.StopDate
+				}
+				if failedAt.Before(from) || failedAt.After(to) {
+					continue
+				}
+				if len(failures) == limit {
+					return failures, true, nil
+				}
+				failure, err := describeFailure(stepFunctionAPI, execution)
+				if err != nil {
+					return nil, false, err
+				}
+				failures = append(failures, failure)
+			}
+			if reachedLookback || executions.NextToken == nil {
+				break
+			}
+			input.NextToken = executions.NextToken
+		}
+	}
+	return failures, false, nil
+}
+
+// describeFailure - reads error and cause of failed execution from the last history events
+func describeFailure(stepFunctionAPI awsprovider.AwsStepFunctionInterface, execution *sfn.ExecutionListItem) (Failure, error) {
+	failure := Failure{
+		ExecutionArn: aws.StringValue(execution.ExecutionArn),
+		Status:       aws.StringValue(execution.Status),
+		Date:         aws.TimeValue(execution.StartDate),
+	}
+	if execution.StopDate != nil {
+		failure.Date = *execution.StopDate
+	}
+	history, err := stepFunctionAPI.GetExecutionHistory(&sfn.GetExecutionHistoryInput{
+		ExecutionArn: execution.ExecutionArn,
+		ReverseOrder: aws.Bool(true),
+		MaxResults:   aws.Int64(10),
+	})
+	if err != nil {
+		return failure, err
+	}
+	for _, event := range history.Events {
+		if event.ExecutionFailedEventDetails != nil {
+			failure.Error = aws.StringValue(event.ExecutionFailedEventDetails.Error)
+			failure.Cause = aws.StringValue(event.ExecutionFailedEventDetails.Cause)
+			break
+		}
+		if event.ExecutionTimedOutEventDetails != nil {
+			failure.Error = aws.StringValue(event.ExecutionTimedOutEventDetails.Error)
+			failure.Cause = aws.StringValue(event.ExecutionTimedOutEventDetails.Cause)
+			break
+		}
+	}
+	if len(failure.Error) == 0 && failure.Status == sfn.ExecutionStatusTimedOut {
+		failure.Error = "States.Timeout"
+	}
+	return failure, nil
+}
+
+func parseTimeParam(value string, defaultValue time.Time) (time.Time, error) {
+	if len(value) == 0 {
+		return defaultValue, nil
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, expected RFC3339 format", value)
+	}
+	return parsed, nil
+}
@@ -2,11 +2,9 @@ package healthcheck
 
 import (
 	"net/http"
+	"sfr-backend/lifecycle"
+	"sfr-backend/logging"
 	"sfr-backend/response"
-	"sfr-backend/tid"
-
-	//envs
-	log "github.com/sirupsen/logrus"
 )
 
 //ResponseHealthcheck - Response struct for healthcheck data
@@ -14,11 +12,20 @@ type ResponseHealthcheck struct {
 	Status string `json:"status"`
 }
 
-// Healthcheck - returns an empty OK response for load balancers
+// StatusDraining - status of instance which is shutting down
+const StatusDraining = "DRAINING"
+
+// Healthcheck - returns an empty OK response for load balancers, fails with 503 once shutdown started
+// so load balancer stops sending new requests while in-flight ones finish
 func Healthcheck(w http.ResponseWriter, r *http.Request) {
-	tid := tid.GetTid(r)
-	requestLogger := log.WithFields(log.Fields{"transaction_id": tid})
+	requestLogger := logging.FromRequest(r)
 	var resp ResponseHealthcheck
+	if !lifecycle.Ready() {
+		resp.Status = StatusDraining
+		requestLogger.Info("Healthcheck received while draining, will response with a 503")
+		response.WriteResponseWithStatus(w, http.StatusServiceUnavailable, resp)
+		return
+	}
 	resp.Status = "OK"
 	w.Header().Set("Content-Type", "application/json")
 	requestLogger.Info("Healthcheck received OK, will response with a 200 OK")
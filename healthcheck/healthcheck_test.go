@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"sfr-backend/healthcheck"
+	"sfr-backend/lifecycle"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -17,3 +18,15 @@ func TestHealthCheckHandler(t *testing.T) {
 
 	assert.Equal(t, http.StatusOK, rr.Code)
 }
+
+func TestHealthcheckFailsWhileDraining(t *testing.T) {
+	lifecycle.Drain()
+	defer lifecycle.Reset()
+	req, _ := http.NewRequest("GET", "/healthcheck", nil)
+	rr := httptest.NewRecorder()
+
+	healthcheck.Healthcheck(rr, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Contains(t, rr.Body.String(), healthcheck.StatusDraining)
+}
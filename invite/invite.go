@@ -0,0 +1,106 @@
+package invite
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"sfr-backend/rbac"
+)
+
+// defaultTTL - how long invites are valid when INVITE_TTL is not set and admin doesn't choose expiry
+const defaultTTL = 72 * time.Hour
+
+// MaxTTL - longest expiry admins can choose
+const MaxTTL = 30 * 24 * time.Hour
+
+// Invite - pending invitation of user, accepted once before ExpiresAt
+type Invite struct {
+	ID        string       `json:"id" dynamodbav:"id"`
+	Username  string       `json:"username" dynamodbav:"username"`
+	Email     string       `json:"email" dynamodbav:"email"`
+	Grants    []rbac.Grant `json:"grants" dynamodbav:"grants"`
+	InvitedBy string       `json:"invitedBy" dynamodbav:"invitedBy"`
+	// ExpiresAt - unix time, TTL attribute of invites table
+	ExpiresAt int64 `json:"expiresAt" dynamodbav:"expiresAt"`
+}
+
+// Store - storage of pending invites
+type Store interface {
+	Create(ctx context.Context, invite Invite) error
+	// Consume - deletes invite and returns it, nil when it doesn't exist
+	Consume(ctx context.Context, id string) (*Invite, error)
+}
+
+var store Store = NewMemoryStore()
+var now = time.Now
+
+// SetStore - sets storage of invites
+func SetStore(inviteStore Store) {
+	store = inviteStore
+}
+
+// DefaultTTL - INVITE_TTL or 72 hours
+func DefaultTTL() time.Duration {
+	ttl, err := time.ParseDuration(os.Getenv("INVITE_TTL"))
+	if err != nil || ttl <= 0 || ttl > MaxTTL {
+		return defaultTTL
+	}
+	return ttl
+}
+
+// Create - stores invite valid for ttl
+func Create(ctx context.Context, invite Invite, ttl time.Duration) (Invite, error) {
+	if ttl <= 0 || ttl > MaxTTL {
+		return invite, fmt.Errorf("invite expiry has to be between 1s and %s", MaxTTL)
+	}
+	invite.ExpiresAt = now().Add(ttl).Unix()
+	return invite, store.Create(ctx, invite)
+}
+
+// Consume - deletes invite and returns it when it didn't expire, nil when it doesn't exist, expired or was used
+func Consume(ctx context.Context, id string) (*Invite, error) {
+	invite, err := store.Consume(ctx, id)
+	if err != nil || invite == nil || invite.ExpiresAt <= now().Unix() {
+		return nil, err
+	}
+	return invite, nil
+}
+
+// MemoryStore - invites kept in memory, not shared by instances and lost on restart
+type MemoryStore struct {
+	mutex   sync.Mutex
+	invites map[string]Invite
+}
+
+// NewMemoryStore - creates empty memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{invites: map[string]Invite{}}
+}
+
+// Create - stores invite, expired invites are dropped
+func (memoryStore *MemoryStore) Create(ctx context.Context, invite Invite) error {
+	memoryStore.mutex.Lock()
+	defer memoryStore.mutex.Unlock()
+	for id, pending := range memoryStore.invites {
+		if pending.ExpiresAt <= now().Unix() {
+			delete(memoryStore.invites, id)
+		}
+	}
+	memoryStore.invites[invite.ID] = invite
+	return nil
+}
+
+// Consume - removes and returns invite
+func (memoryStore *MemoryStore) Consume(ctx context.Context, id string) (*Invite, error) {
+	memoryStore.mutex.Lock()
+	defer memoryStore.mutex.Unlock()
+	invite, ok := memoryStore.invites[id]
+	if !ok {
+		return nil, nil
+	}
+	delete(memoryStore.invites, id)
+	return &invite, nil
+}
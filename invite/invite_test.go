@@ -0,0 +1,46 @@
+package invite_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"sfr-backend/invite"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInvite(t *testing.T) {
+	invite.SetStore(invite.NewMemoryStore())
+
+	created, err := invite.Create(context.Background(), invite.Invite{ID: "id", Username: "jdoe", Email: "jdoe@example.com"}, time.Hour)
+	assert.Nil(t, err)
+	assert.InDelta(t, time.Now().Add(time.Hour).Unix(), created.ExpiresAt, 1)
+	accepted, err := invite.Consume(context.Background(), "id")
+	assert.Nil(t, err)
+	assert.Equal(t, &created, accepted)
+
+	accepted, err = invite.Consume(context.Background(), "id")
+	assert.Nil(t, err)
+	assert.Nil(t, accepted)
+
+	_, err = invite.Create(context.Background(), invite.Invite{ID: "long"}, invite.MaxTTL+time.Hour)
+	assert.NotNil(t, err)
+
+	// memory store returns expired invites, consumption rejects them
+	invite.Create(context.Background(), invite.Invite{ID: "expired"}, time.Nanosecond)
+	accepted, err = invite.Consume(context.Background(), "expired")
+	assert.Nil(t, err)
+	assert.Nil(t, accepted)
+}
+
+func TestDefaultTTL(t *testing.T) {
+	defer os.Unsetenv("INVITE_TTL")
+	os.Setenv("INVITE_TTL", "24h")
+	assert.Equal(t, 24*time.Hour, invite.DefaultTTL())
+	os.Setenv("INVITE_TTL", "invalid")
+	assert.Equal(t, 72*time.Hour, invite.DefaultTTL())
+	os.Setenv("INVITE_TTL", "10000h")
+	assert.Equal(t, 72*time.Hour, invite.DefaultTTL())
+}
@@ -0,0 +1,59 @@
+package lifecycle
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	errHandler "sfr-backend/error"
+)
+
+// CodeShuttingDown - code of work which was not done because server is shutting down
+const CodeShuttingDown = "ShuttingDown"
+
+// ErrStopping - returned for work which was not started because drain timeout passed, the same request can be retried
+var ErrStopping = &errHandler.Error{
+	Status:    http.StatusServiceUnavailable,
+	Code:      CodeShuttingDown,
+	Message:   "server is shutting down, request can be retried",
+	Retryable: true,
+}
+
+var draining int32
+
+var mu sync.Mutex
+var stopping, stop = context.WithCancel(context.Background())
+
+// Ready - service accepts new work, healthcheck fails once it is false so load balancer stops routing to the instance
+func Ready() bool {
+	return atomic.LoadInt32(&draining) == 0
+}
+
+// Drain - marks service as not ready, in-flight requests keep running
+func Drain() {
+	atomic.StoreInt32(&draining, 1)
+}
+
+// Stopping - returns context cancelled by Stop, long running loops of requests check it between steps
+func Stopping() context.Context {
+	mu.Lock()
+	defer mu.Unlock()
+	return stopping
+}
+
+// Stop - asks in-flight requests to finish what they started and skip the rest
+func Stop() {
+	mu.Lock()
+	defer mu.Unlock()
+	stop()
+}
+
+// Reset - makes service ready again with new Stopping context
+func Reset() {
+	mu.Lock()
+	defer mu.Unlock()
+	stop()
+	stopping, stop = context.WithCancel(context.Background())
+	atomic.StoreInt32(&draining, 0)
+}
@@ -0,0 +1,26 @@
+package lifecycle_test
+
+import (
+	"testing"
+
+	"sfr-backend/lifecycle"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDrainAndStop(t *testing.T) {
+	defer lifecycle.Reset()
+	assert.True(t, lifecycle.Ready())
+	stopping := lifecycle.Stopping()
+
+	lifecycle.Drain()
+	assert.False(t, lifecycle.Ready())
+	assert.Nil(t, stopping.Err())
+
+	lifecycle.Stop()
+	assert.NotNil(t, stopping.Err())
+
+	lifecycle.Reset()
+	assert.True(t, lifecycle.Ready())
+	assert.Nil(t, lifecycle.Stopping().Err())
+}
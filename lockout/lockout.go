@@ -0,0 +1,280 @@
+package lockout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Config - thresholds of failed logins, failures older than Window are forgotten
+type Config struct {
+	// UserThreshold - failures of one username locking it for Duration
+	UserThreshold int
+	// IPThreshold - failures from one address, for any usernames, locking the address for Duration
+	IPThreshold int
+	Window      time.Duration
+	Duration    time.Duration
+	// BaseDelay - wait after first failure, doubled by every next failure up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// DefaultConfig - used for LOGIN_LOCKOUT_* and LOGIN_DELAY_* variables which are not set
+var DefaultConfig = Config{
+	UserThreshold: 5,
+	IPThreshold:   50,
+	Window:        15 * time.Minute,
+	Duration:      15 * time.Minute,
+	BaseDelay:     time.Second,
+	MaxDelay:      30 * time.Second,
+}
+
+// Attempts - failed logins of username or address
+type Attempts struct {
+	Key            string    `json:"key" dynamodbav:"key"`
+	Failures       int       `json:"failures" dynamodbav:"failures"`
+	FirstFailureAt time.Time `json:"firstFailureAt" dynamodbav:"firstFailureAt"`
+	// NextAttemptAt - logins before it are rejected without checking password
+	NextAttemptAt time.Time  `json:"nextAttemptAt" dynamodbav:"nextAttemptAt"`
+	LockedUntil   *time.Time `json:"lockedUntil,omitempty" dynamodbav:"lockedUntil,omitempty"`
+	// ExpiresAt - unix time when attempts can be forgotten, TTL attribute of login attempts table
+	ExpiresAt int64 `json:"expiresAt" dynamodbav:"expiresAt"`
+}
+
+// ErrConflict - attempts of key were changed by concurrent failure since they were read
+var ErrConflict = errors.New("login attempts were changed concurrently")
+
+// maxConflictRetries - failure is counted again at most this many times after concurrent failures changed attempts
+const maxConflictRetries = 20
+
+// Store - storage of failed login attempts
+type Store interface {
+	// Get - returns nil when key has no failures
+	Get(ctx context.Context, key string) (*Attempts, error)
+	// CompareAndPut - replaces attempts of key only when stored attempts are still previous, nil when key had
+	// no failures or they expired, returns ErrConflict otherwise, so concurrent failures are never lost
+	CompareAndPut(ctx context.Context, previous *Attempts, attempts Attempts) error
+	Delete(ctx context.Context, key string) error
+}
+
+var store Store = NewMemoryStore()
+var config = DefaultConfig
+var now = time.Now
+
+// SetStore - sets storage of failed login attempts
+func SetStore(attemptsStore Store) {
+	store = attemptsStore
+}
+
+// SetConfig - sets thresholds and delays
+func SetConfig(lockoutConfig Config) {
+	config = lockoutConfig
+}
+
+// ConfigFromEnv - reads LOGIN_LOCKOUT_USER_THRESHOLD, LOGIN_LOCKOUT_IP_THRESHOLD, LOGIN_LOCKOUT_WINDOW,
+// LOGIN_LOCKOUT_DURATION, LOGIN_DELAY_BASE and LOGIN_DELAY_MAX, threshold 0 disables lockout
+func ConfigFromEnv() (Config, error) {
+	lockoutConfig := DefaultConfig
+	for name, threshold := range map[string]*int{
+		"LOGIN_LOCKOUT_USER_THRESHOLD": &lockoutConfig.UserThreshold,
+		"LOGIN_LOCKOUT_IP_THRESHOLD":   &lockoutConfig.IPThreshold,
+	} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			return Config{}, fmt.Errorf("invalid %s %q", name, value)
+		}
+		*threshold = parsed
+	}
+	for name, duration := range map[string]*time.Duration{
+		"LOGIN_LOCKOUT_WINDOW":   &lockoutConfig.Window,
+		"LOGIN_LOCKOUT_DURATION": &lockoutConfig.Duration,
+		"LOGIN_DELAY_BASE":       &lockoutConfig.BaseDelay,
+		"LOGIN_DELAY_MAX":        &lockoutConfig.MaxDelay,
+	} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < 0 {
+			return Config{}, fmt.Errorf("invalid %s %q", name, value)
+		}
+		*duration = parsed
+	}
+	return lockoutConfig, nil
+}
+
+// UserKey - key of failures of username
+func UserKey(username string) string {
+	return "user#" + username
+}
+
+// IPKey - key of failures from client address
+func IPKey(ip string) string {
+	return "ip#" + ip
+}
+
+// Check - returns how long client has to wait before username can be tried from ip, 0 when login can proceed
+func Check(ctx context.Context, username string, ip string) (time.Duration, error) {
+	var wait time.Duration
+	for _, key := range []string{UserKey(username), IPKey(ip)} {
+		attempts, err := store.Get(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+		if attempts == nil {
+			continue
+		}
+		until := attempts.NextAttemptAt
+		if attempts.LockedUntil != nil && attempts.LockedUntil.After(until) {
+			until = *attempts.LockedUntil
+		}
+		if remaining := until.Sub(now()); remaining > wait {
+			wait = remaining
+		}
+	}
+	return wait, nil
+}
+
+// Failure - counts failed login of username from ip, returns keys which became locked by it
+func Failure(ctx context.Context, username string, ip string) ([]string, error) {
+	var locked []string
+	for _, counter := range []struct {
+		key       string
+		threshold int
+	}{{UserKey(username), config.UserThreshold}, {IPKey(ip), config.IPThreshold}} {
+		nowLocked, err := countFailure(ctx, counter.key, counter.threshold)
+		if err != nil {
+			return locked, err
+		}
+		if nowLocked {
+			locked = append(locked, counter.key)
+		}
+	}
+	return locked, nil
+}
+
+// countFailure - adds failure to attempts of key, retried when concurrent failure stored attempts first,
+// returns true when this failure locked the key
+func countFailure(ctx context.Context, key string, threshold int) (bool, error) {
+	for retry := 0; ; retry++ {
+		previous, err := store.Get(ctx, key)
+		if err != nil {
+			return false, err
+		}
+		attempts, nowLocked := nextFailure(key, previous, threshold)
+		err = store.CompareAndPut(ctx, previous, attempts)
+		if err == ErrConflict && retry < maxConflictRetries {
+			continue
+		}
+		return nowLocked && err == nil, err
+	}
+}
+
+// nextFailure - returns attempts of key after one more failure and whether it reached threshold
+func nextFailure(key string, previous *Attempts, threshold int) (Attempts, bool) {
+	current := now()
+	var attempts Attempts
+	// failures are counted again from zero after window or lockout ends
+	if previous == nil || current.Sub(previous.FirstFailureAt) > config.Window ||
+		(previous.LockedUntil != nil && !previous.LockedUntil.After(current)) {
+		attempts = Attempts{Key: key, FirstFailureAt: current}
+	} else {
+		attempts = *previous
+	}
+	attempts.Failures++
+	attempts.NextAttemptAt = current.Add(delay(attempts.Failures))
+	expiresAt := attempts.FirstFailureAt.Add(config.Window)
+	if attempts.NextAttemptAt.After(expiresAt) {
+		expiresAt = attempts.NextAttemptAt
+	}
+	nowLocked := false
+	if threshold > 0 && attempts.Failures >= threshold && attempts.LockedUntil == nil {
+		lockedUntil := current.Add(config.Duration)
+		attempts.LockedUntil = &lockedUntil
+		nowLocked = true
+	}
+	if attempts.LockedUntil != nil && attempts.LockedUntil.After(expiresAt) {
+		expiresAt = *attempts.LockedUntil
+	}
+	attempts.ExpiresAt = expiresAt.Unix()
+	return attempts, nowLocked
+}
+
+// Success - forgets failures of username after successful login, failures of address are kept
+// so attacker can't reset them with own account
+func Success(ctx context.Context, username string) error {
+	return store.Delete(ctx, UserKey(username))
+}
+
+// Unlock - forgets failures and lockout of username
+func Unlock(ctx context.Context, username string) error {
+	return store.Delete(ctx, UserKey(username))
+}
+
+// delay - BaseDelay doubled for every failure after first one, at most MaxDelay
+func delay(failures int) time.Duration {
+	wait := config.BaseDelay
+	for i := 1; i < failures && wait < config.MaxDelay; i++ {
+		wait *= 2
+	}
+	if wait > config.MaxDelay {
+		return config.MaxDelay
+	}
+	return wait
+}
+
+// MemoryStore - failed attempts kept in memory, not shared by instances and lost on restart
+type MemoryStore struct {
+	mutex    sync.Mutex
+	attempts map[string]Attempts
+}
+
+// NewMemoryStore - creates empty memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{attempts: map[string]Attempts{}}
+}
+
+// Get - returns attempts of key unless they expired
+func (memoryStore *MemoryStore) Get(ctx context.Context, key string) (*Attempts, error) {
+	memoryStore.mutex.Lock()
+	defer memoryStore.mutex.Unlock()
+	attempts, ok := memoryStore.attempts[key]
+	if !ok || attempts.ExpiresAt < now().Unix() {
+		return nil, nil
+	}
+	return &attempts, nil
+}
+
+// CompareAndPut - stores attempts when stored attempts of key are still previous, expired attempts are dropped
+func (memoryStore *MemoryStore) CompareAndPut(ctx context.Context, previous *Attempts, attempts Attempts) error {
+	memoryStore.mutex.Lock()
+	defer memoryStore.mutex.Unlock()
+	for key, stored := range memoryStore.attempts {
+		if stored.ExpiresAt < now().Unix() {
+			delete(memoryStore.attempts, key)
+		}
+	}
+	stored, ok := memoryStore.attempts[attempts.Key]
+	if ok != (previous != nil) || (ok && (stored.Failures != previous.Failures || !stored.FirstFailureAt.Equal(previous.FirstFailureAt))) {
+		return ErrConflict
+	}
+	memoryStore.attempts[attempts.Key] = attempts
+	return nil
+}
+
+// Delete - forgets attempts of key
+func (memoryStore *MemoryStore) Delete(ctx context.Context, key string) error {
+	memoryStore.mutex.Lock()
+	defer memoryStore.mutex.Unlock()
+	delete(memoryStore.attempts, key)
+	return nil
+}
@@ -0,0 +1,118 @@
+package lockout
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFailureLocksUserAndAddress(t *testing.T) {
+	current := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return current }
+	defer func() { now = time.Now }()
+	SetStore(NewMemoryStore())
+	SetConfig(Config{UserThreshold: 3, IPThreshold: 4, Window: 10 * time.Minute, Duration: time.Hour, BaseDelay: time.Second, MaxDelay: 3 * time.Second})
+	defer SetConfig(DefaultConfig)
+
+	locked, _ := Failure(context.Background(), "jdoe", "192.0.2.1")
+	assert.Empty(t, locked)
+	wait, _ := Check(context.Background(), "jdoe", "192.0.2.2")
+	assert.Equal(t, time.Second, wait)
+	current = current.Add(time.Minute)
+	Failure(context.Background(), "jdoe", "192.0.2.1")
+	wait, _ = Check(context.Background(), "other", "192.0.2.1")
+	assert.Equal(t, 2*time.Second, wait)
+
+	current = current.Add(time.Minute)
+	locked, _ = Failure(context.Background(), "jdoe", "192.0.2.1")
+	assert.Equal(t, []string{UserKey("jdoe")}, locked)
+	wait, _ = Check(context.Background(), "jdoe", "192.0.2.2")
+	assert.Equal(t, time.Hour, wait)
+	locked, _ = Failure(context.Background(), "other", "192.0.2.1")
+	assert.Equal(t, []string{IPKey("192.0.2.1")}, locked)
+
+	// successful login of other user doesn't reset failures of address
+	Success(context.Background(), "other")
+	wait, _ = Check(context.Background(), "other", "192.0.2.1")
+	assert.Equal(t, time.Hour, wait)
+	Unlock(context.Background(), "jdoe")
+	wait, _ = Check(context.Background(), "jdoe", "192.0.2.2")
+	assert.Equal(t, time.Duration(0), wait)
+
+	// failures are forgotten after window
+	current = current.Add(2 * time.Hour)
+	Failure(context.Background(), "other", "192.0.2.3")
+	attempts, _ := store.Get(context.Background(), UserKey("other"))
+	assert.Equal(t, 1, attempts.Failures)
+}
+
+func TestConcurrentFailures(t *testing.T) {
+	SetStore(NewMemoryStore())
+	SetConfig(Config{UserThreshold: 5, Window: time.Hour, Duration: time.Hour, BaseDelay: time.Second, MaxDelay: time.Second})
+	defer SetConfig(DefaultConfig)
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	var locked []string
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			keys, err := Failure(context.Background(), "jdoe", "192.0.2.1")
+			assert.Nil(t, err)
+			mutex.Lock()
+			locked = append(locked, keys...)
+			mutex.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	// every failure is counted and only the one reaching threshold locks the user
+	attempts, _ := store.Get(context.Background(), UserKey("jdoe"))
+	assert.Equal(t, 50, attempts.Failures)
+	assert.Equal(t, []string{UserKey("jdoe")}, locked)
+}
+
+func TestCompareAndPutConflict(t *testing.T) {
+	memoryStore := NewMemoryStore()
+	first := Attempts{Key: "user#jdoe", Failures: 1, FirstFailureAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour).Unix()}
+	second := first
+	second.Failures = 2
+
+	assert.Nil(t, memoryStore.CompareAndPut(context.Background(), nil, first))
+	assert.Equal(t, ErrConflict, memoryStore.CompareAndPut(context.Background(), nil, first))
+	assert.Nil(t, memoryStore.CompareAndPut(context.Background(), &first, second))
+	assert.Equal(t, ErrConflict, memoryStore.CompareAndPut(context.Background(), &first, second))
+}
+
+func TestDelay(t *testing.T) {
+	SetConfig(Config{BaseDelay: time.Second, MaxDelay: 10 * time.Second})
+	defer SetConfig(DefaultConfig)
+
+	assert.Equal(t, time.Second, delay(1))
+	assert.Equal(t, 4*time.Second, delay(3))
+	assert.Equal(t, 10*time.Second, delay(5))
+	assert.Equal(t, 10*time.Second, delay(100))
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	defer os.Unsetenv("LOGIN_LOCKOUT_USER_THRESHOLD")
+	defer os.Unsetenv("LOGIN_DELAY_MAX")
+	os.Setenv("LOGIN_LOCKOUT_USER_THRESHOLD", "0")
+	os.Setenv("LOGIN_DELAY_MAX", "1m")
+
+	lockoutConfig, err := ConfigFromEnv()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 0, lockoutConfig.UserThreshold)
+	assert.Equal(t, time.Minute, lockoutConfig.MaxDelay)
+	assert.Equal(t, DefaultConfig.IPThreshold, lockoutConfig.IPThreshold)
+
+	os.Setenv("LOGIN_DELAY_MAX", "soon")
+	_, err = ConfigFromEnv()
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,55 @@
+package logging
+
+import (
+	"errors"
+	"net/http"
+	"os"
+
+	"sfr-backend/tid"
+	"sfr-backend/user"
+
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// log formats selected by LOG_FORMAT
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// ConfigureFromEnv - sets format from LOG_FORMAT (text by default), level from LOG_LEVEL (info by default)
+// and redaction from LOG_REDACT_* variables
+func ConfigureFromEnv() error {
+	switch os.Getenv("LOG_FORMAT") {
+	case "", FormatText:
+		log.SetFormatter(&log.TextFormatter{})
+	case FormatJSON:
+		log.SetFormatter(&log.JSONFormatter{})
+	default:
+		return errors.New("LOG_FORMAT has to be text or json")
+	}
+	level := log.InfoLevel
+	if value := os.Getenv("LOG_LEVEL"); value != "" {
+		parsed, err := log.ParseLevel(value)
+		if err != nil {
+			return err
+		}
+		level = parsed
+	}
+	log.SetLevel(level)
+	SetRedaction(RedactionFromEnv())
+	return nil
+}
+
+// FromRequest - returns logger carrying transaction id, authenticated user and trace id of request
+func FromRequest(r *http.Request) *log.Entry {
+	fields := log.Fields{"transaction_id": tid.GetTid(r)}
+	if username := user.UsernameFromContext(r.Context()); username != "" {
+		fields["user"] = username
+	}
+	if spanContext := trace.SpanContextFromContext(r.Context()); spanContext.IsValid() {
+		fields["trace_id"] = spanContext.TraceID().String()
+	}
+	return log.WithFields(fields)
+}
@@ -0,0 +1,103 @@
+package logging_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"sfr-backend/logging"
+	"sfr-backend/user"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestFieldsRedactsJSONBody(t *testing.T) {
+	os.Setenv("LOG_REDACT_JSON_PATHS", "profile.email")
+	defer os.Unsetenv("LOG_REDACT_JSON_PATHS")
+	logging.SetRedaction(logging.RedactionFromEnv())
+	defer logging.SetRedaction(logging.DefaultRedaction())
+	body := `{"username": "user", "password": "secret", "profile": {"email": "user@example.com", "lastname": "Doe"}, "devices": [{"refreshToken": "rt"}]}`
+	req := httptest.NewRequest("POST", "/login?token=abc&page=2", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer jwt")
+	req.Header.Set("Accept", "application/json")
+
+	fields := logging.RequestFields(req)
+
+	assert.Equal(t, "POST", fields["method"])
+	headers := fields["headers"].(map[string]string)
+	assert.Equal(t, logging.Redacted, headers["authorization"])
+	assert.Equal(t, "application/json", headers["accept"])
+	query := fields["query"].(map[string]interface{})
+	assert.Equal(t, logging.Redacted, query["token"])
+	assert.Equal(t, "2", query["page"])
+	logged := fields["body"].(map[string]interface{})
+	assert.Equal(t, "user", logged["username"])
+	assert.Equal(t, logging.Redacted, logged["password"])
+	profile := logged["profile"].(map[string]interface{})
+	assert.Equal(t, logging.Redacted, profile["email"])
+	assert.Equal(t, "Doe", profile["lastname"])
+	devices := logged["devices"].([]interface{})
+	assert.Equal(t, logging.Redacted, devices[0].(map[string]interface{})["refreshToken"])
+	read, _ := ioutil.ReadAll(req.Body)
+	assert.Equal(t, body, string(read))
+}
+
+func TestRequestFieldsRedactsFormAndPathVariables(t *testing.T) {
+	router := mux.NewRouter()
+	var fields map[string]interface{}
+	var machine string
+	router.HandleFunc("/invites/{token}/accept", func(w http.ResponseWriter, r *http.Request) {
+		fields = logging.RequestFields(r)
+		machine = r.FormValue("machine")
+	})
+	req := httptest.NewRequest("POST", "/invites/signed.jwt/accept", strings.NewReader(`machine=arn&input={"ssn":"123"}`))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, "/invites/"+logging.Redacted+"/accept", fields["path"])
+	logged := fields["body"].(map[string]interface{})
+	assert.Equal(t, "arn", logged["machine"])
+	assert.Equal(t, logging.Redacted, logged["input"])
+	assert.Equal(t, "arn", machine)
+}
+
+func TestRequestFieldsSkipsLargeBody(t *testing.T) {
+	body := `{"value": "` + strings.Repeat("a", 70<<10) + `"}`
+	req := httptest.NewRequest("POST", "/aws/execution", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	fields := logging.RequestFields(req)
+
+	assert.Contains(t, fields["body"], "not logged")
+	read, _ := ioutil.ReadAll(req.Body)
+	assert.Equal(t, body, string(read))
+}
+
+func TestFromRequest(t *testing.T) {
+	req := httptest.NewRequest("GET", "/aws/machines", nil)
+	req.Header.Set("X-Request-ID", "tid")
+	req = req.WithContext(user.WithUsername(req.Context(), "operator"))
+
+	entry := logging.FromRequest(req)
+
+	assert.Equal(t, "tid", entry.Data["transaction_id"])
+	assert.Equal(t, "operator", entry.Data["user"])
+	assert.NotContains(t, entry.Data, "trace_id")
+}
+
+func TestConfigureFromEnv(t *testing.T) {
+	os.Setenv("LOG_FORMAT", "xml")
+	defer os.Unsetenv("LOG_FORMAT")
+	assert.NotNil(t, logging.ConfigureFromEnv())
+
+	os.Setenv("LOG_FORMAT", logging.FormatJSON)
+	os.Setenv("LOG_LEVEL", "verbose")
+	defer os.Unsetenv("LOG_LEVEL")
+	assert.NotNil(t, logging.ConfigureFromEnv())
+}
@@ -0,0 +1,232 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// Redacted - replaces redacted values in logs
+const Redacted = "[REDACTED]"
+
+// maxLoggedBody - longer bodies are not logged, handlers still read them whole
+const maxLoggedBody = 64 << 10
+
+// defaultHeaders - headers carrying credentials
+var defaultHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-API-Key", "X-CSRF-Token"}
+
+// defaultFields - form fields, JSON keys, query parameters and path variables with credentials or personal data
+var defaultFields = []string{
+	"password", "currentPassword", "newPassword", "token", "accessToken", "refreshToken", "challengeToken",
+	"code", "recoveryCode", "secret", "state", "input",
+}
+
+// Redaction - names of headers and fields which values are never logged, names are case insensitive.
+// Fields match form fields, query parameters, path variables and keys at any depth of JSON bodies,
+// paths are dot separated keys from the root of JSON body or form, e.g. input.customer.email.
+type Redaction struct {
+	Headers map[string]bool
+	Fields  map[string]bool
+	Paths   [][]string
+}
+
+var redaction = DefaultRedaction()
+
+// SetRedaction - sets redaction of logged requests
+func SetRedaction(configured Redaction) {
+	redaction = configured
+}
+
+// DefaultRedaction - redacts credentials and execution inputs
+func DefaultRedaction() Redaction {
+	return Redaction{Headers: nameSet(defaultHeaders), Fields: nameSet(defaultFields)}
+}
+
+// RedactionFromEnv - extends default redaction with comma separated LOG_REDACT_HEADERS, LOG_REDACT_FIELDS
+// and LOG_REDACT_JSON_PATHS
+func RedactionFromEnv() Redaction {
+	configured := DefaultRedaction()
+	for _, name := range splitList(os.Getenv("LOG_REDACT_HEADERS")) {
+		configured.Headers[strings.ToLower(name)] = true
+	}
+	for _, name := range splitList(os.Getenv("LOG_REDACT_FIELDS")) {
+		configured.Fields[strings.ToLower(name)] = true
+	}
+	for _, path := range splitList(os.Getenv("LOG_REDACT_JSON_PATHS")) {
+		configured.Paths = append(configured.Paths, strings.Split(strings.ToLower(path), "."))
+	}
+	return configured
+}
+
+// RequestFields - returns method, path, query, headers and form or JSON body of request with redacted values.
+// Body is read up to maxLoggedBody and put back, so handlers read it unchanged.
+func RequestFields(r *http.Request) log.Fields {
+	fields := log.Fields{
+		"method":  r.Method,
+		"path":    redactPath(r),
+		"host":    r.Host,
+		"headers": redaction.headers(r.Header),
+	}
+	if query := r.URL.Query(); len(query) > 0 {
+		fields["query"] = redaction.value(nil, formValue(query))
+	}
+	if body, ok := readBody(r); ok {
+		fields["body"] = body
+	}
+	return fields
+}
+
+// redactPath - returns request path with redacted path variables
+func redactPath(r *http.Request) string {
+	path := r.URL.Path
+	for name, value := range mux.Vars(r) {
+		if value != "" && redaction.Fields[strings.ToLower(name)] {
+			path = strings.Replace(path, value, Redacted, -1)
+		}
+	}
+	return path
+}
+
+// readBody - returns redacted form or JSON body, other media types are not logged
+func readBody(r *http.Request) (interface{}, bool) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, false
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/x-www-form-urlencoded" && mediaType != "application/json" {
+		return nil, false
+	}
+	body := r.Body
+	peeked, err := ioutil.ReadAll(io.LimitReader(body, maxLoggedBody+1))
+	r.Body = &replayedBody{Reader: io.MultiReader(bytes.NewReader(peeked), body), Closer: body}
+	if err != nil || len(peeked) > maxLoggedBody {
+		return "body is not logged, it is larger than 64 KiB", true
+	}
+	if mediaType == "application/json" {
+		var value interface{}
+		if json.Unmarshal(peeked, &value) != nil {
+			return "body is not logged, it is not valid JSON", true
+		}
+		return redaction.value(nil, value), true
+	}
+	form, err := url.ParseQuery(string(peeked))
+	if err != nil {
+		return "body is not logged, it is not valid form", true
+	}
+	return redaction.value(nil, formValue(form)), true
+}
+
+// replayedBody - body which was partly read for logging
+type replayedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// formValue - converts form to JSON like value, values containing JSON objects or arrays are decoded so paths apply to them
+func formValue(form url.Values) map[string]interface{} {
+	value := map[string]interface{}{}
+	for name, values := range form {
+		decoded := make([]interface{}, len(values))
+		for i, formValue := range values {
+			decoded[i] = formValue
+			trimmed := strings.TrimSpace(formValue)
+			if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+				var nested interface{}
+				if json.Unmarshal([]byte(trimmed), &nested) == nil {
+					decoded[i] = nested
+				}
+			}
+		}
+		if len(decoded) == 1 {
+			value[name] = decoded[0]
+		} else {
+			value[name] = decoded
+		}
+	}
+	return value
+}
+
+func (redaction Redaction) headers(header http.Header) map[string]string {
+	headers := map[string]string{}
+	for name, values := range header {
+		name = strings.ToLower(name)
+		if redaction.Headers[name] {
+			headers[name] = Redacted
+			continue
+		}
+		headers[name] = strings.Join(values, ", ")
+	}
+	return headers
+}
+
+// value - returns copy of JSON value with redacted fields and paths, path is position of value
+func (redaction Redaction) value(path []string, value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(typed))
+		for key, nested := range typed {
+			nestedPath := append(append([]string{}, path...), strings.ToLower(key))
+			if redaction.Fields[strings.ToLower(key)] || redaction.matches(nestedPath) {
+				redacted[key] = Redacted
+				continue
+			}
+			redacted[key] = redaction.value(nestedPath, nested)
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(typed))
+		for i, nested := range typed {
+			redacted[i] = redaction.value(path, nested)
+		}
+		return redacted
+	default:
+		return value
+	}
+}
+
+// matches - path is one of redacted paths, array elements have path of the array
+func (redaction Redaction) matches(path []string) bool {
+	for _, redacted := range redaction.Paths {
+		if len(redacted) != len(path) {
+			continue
+		}
+		matched := true
+		for i := range path {
+			if redacted[i] != path[i] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+func nameSet(names []string) map[string]bool {
+	set := map[string]bool{}
+	for _, name := range names {
+		set[strings.ToLower(name)] = true
+	}
+	return set
+}
+
+func splitList(value string) []string {
+	names := []string{}
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -1,12 +1,14 @@
 package machine_test
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"sfr-backend/machine"
 	"sfr-backend/mocks"
+	"sfr-backend/rbac"
 	"testing"
 	"time"
 
@@ -102,3 +104,27 @@ func TestGetMachinesStepFunctionProviderError(t *testing.T) {
 
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 }
+
+func TestGetMachinesFilteredByGrants(t *testing.T) {
+	mockAwsProvider := &mocks.AwsStepFunctionsProvider{}
+	mockStepFunction := &mocks.AwsStepFunctionInterface{}
+	orders := "arn:aws:states:us-east-1:123456789012:stateMachine:orders"
+	billing := "arn:aws:states:us-east-1:123456789012:stateMachine:billing"
+	mockOutput := &sfn.ListStateMachinesOutput{
+		StateMachines: []*sfn.StateMachineListItem{{StateMachineArn: &orders}, {StateMachineArn: &billing}},
+	}
+	mockStepFunction.On("ListStateMachines", mock.Anything).Return(mockOutput, nil)
+	mockAwsProvider.On("New", mock.Anything).Return(mockStepFunction, nil)
+
+	req, _ := http.NewRequest("GET", "/aws/machines", nil)
+	req = req.WithContext(rbac.WithGrants(req.Context(), []rbac.Grant{{Role: rbac.RoleViewer, Machine: "*:orders"}}))
+	rr := httptest.NewRecorder()
+
+	machine.GetMachinesHandler(rr, req, mockAwsProvider)
+
+	var rval sfn.ListStateMachinesOutput
+	json.Unmarshal(rr.Body.Bytes(), &rval)
+	assert.Len(t, rval.StateMachines, 1)
+	assert.Equal(t, orders, *rval.StateMachines[0].StateMachineArn)
+	assert.Len(t, mockOutput.StateMachines, 2)
+}
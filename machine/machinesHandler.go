@@ -5,6 +5,8 @@ import (
 	awsprovider "sfr-backend/awsProvider"
 	"sfr-backend/awssession"
 	"sfr-backend/error"
+	"sfr-backend/rbac"
+	"sfr-backend/region"
 	"sfr-backend/response"
 	"strconv"
 
@@ -38,5 +40,21 @@ func GetMachinesHandler(w http.ResponseWriter, r *http.Request, providerInterfac
 	}
 
 	// fmt.Println("machines", machines)
-	response.WriteResponse(w, machines)
+	response.WriteResponse(w, visibleMachines(r, machines))
+}
+
+// visibleMachines - removes machines user has no read permission on, output itself is not modified as it may be cached
+func visibleMachines(r *http.Request, machines *sfn.ListStateMachinesOutput) *sfn.ListStateMachinesOutput {
+	grants, ok := rbac.GrantsFromContext(r.Context())
+	if !ok {
+		return machines
+	}
+	visible := &sfn.ListStateMachinesOutput{NextToken: machines.NextToken, StateMachines: []*sfn.StateMachineListItem{}}
+	for _, stateMachine := range machines.StateMachines {
+		machineArn := aws.StringValue(stateMachine.StateMachineArn)
+		if rbac.Allowed(grants, rbac.PermissionRead, machineArn, region.GetDefaultRegion(r)) {
+			visible.StateMachines = append(visible.StateMachines, stateMachine)
+		}
+	}
+	return visible
 }
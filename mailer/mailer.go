@@ -0,0 +1,131 @@
+package mailer
+
+import (
+	"fmt"
+	"io"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Message - email message sent by mailers
+type Message struct {
+	To      []string
+	Subject string
+	Body    string
+}
+
+// Mailer - interface for sending emails
+type Mailer interface {
+	Send(message Message) error
+}
+
+// SMTPMailer - mailer sending messages through SMTP server
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// NewSMTPMailerFromEnv - creates SMTP mailer configured with SMTP_* variables, returns nil when SMTP_HOST is not set
+func NewSMTPMailerFromEnv() *SMTPMailer {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return nil
+	}
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+	return &SMTPMailer{
+		Host:     host,
+		Port:     port,
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("SMTP_FROM"),
+	}
+}
+
+// Send - sends message through configured SMTP server
+func (mailer *SMTPMailer) Send(message Message) error {
+	var auth smtp.Auth
+	if mailer.Username != "" {
+		auth = smtp.PlainAuth("", mailer.Username, mailer.Password, mailer.Host)
+	}
+	return smtp.SendMail(mailer.Host+":"+mailer.Port, auth, mailer.From, message.To, FormatMessage(mailer.From, message))
+}
+
+// FileMailer - appends messages to file instead of sending them, for local use
+type FileMailer struct {
+	Path  string
+	From  string
+	mutex sync.Mutex
+}
+
+// Send - appends formatted message to file
+func (mailer *FileMailer) Send(message Message) error {
+	mailer.mutex.Lock()
+	defer mailer.mutex.Unlock()
+	file, err := os.OpenFile(mailer.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return writeMessage(file, mailer.From, message)
+}
+
+// ConsoleMailer - prints messages to standard output instead of sending them, for local use
+type ConsoleMailer struct {
+	From string
+}
+
+// Send - prints formatted message
+func (mailer *ConsoleMailer) Send(message Message) error {
+	return writeMessage(os.Stdout, mailer.From, message)
+}
+
+func writeMessage(writer io.Writer, from string, message Message) error {
+	if _, err := writer.Write(FormatMessage(from, message)); err != nil {
+		return err
+	}
+	_, err := io.WriteString(writer, "\r\n.\r\n")
+	return err
+}
+
+// NewMailerFromEnv - SMTP mailer when SMTP_HOST is set, otherwise file mailer writing to MAILER_FILE
+// or console mailer
+func NewMailerFromEnv() Mailer {
+	if smtpMailer := NewSMTPMailerFromEnv(); smtpMailer != nil {
+		return smtpMailer
+	}
+	from := os.Getenv("SMTP_FROM")
+	if path := os.Getenv("MAILER_FILE"); path != "" {
+		log.Warn("SMTP_HOST is not set, emails are written to ", path)
+		return &FileMailer{Path: path, From: from}
+	}
+	log.Warn("SMTP_HOST is not set, emails are printed to standard output")
+	return &ConsoleMailer{From: from}
+}
+
+// FormatMessage - formats message as plain text email with headers
+func FormatMessage(from string, message Message) []byte {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "From: %s\r\n", from)
+	fmt.Fprintf(&builder, "To: %s\r\n", strings.Join(message.To, ", "))
+	fmt.Fprintf(&builder, "Subject: %s\r\n", sanitizeHeader(message.Subject))
+	builder.WriteString("MIME-Version: 1.0\r\n")
+	builder.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n")
+	builder.WriteString("\r\n")
+	builder.WriteString(message.Body)
+	return []byte(builder.String())
+}
+
+// sanitizeHeader - prevents header injection through new lines
+func sanitizeHeader(value string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(value)
+}
@@ -1,35 +1,150 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
+	"sync"
 	"syscall"
 	"time"
 
 	//envs
+	"sfr-backend/alerting"
+	"sfr-backend/apikey"
+	"sfr-backend/approval"
+	"sfr-backend/audit"
+	"sfr-backend/authentication"
+	awsprovider "sfr-backend/awsProvider"
+	"sfr-backend/database"
 	_ "sfr-backend/docs"
+	"sfr-backend/invite"
+	"sfr-backend/lifecycle"
+	"sfr-backend/lockout"
+	"sfr-backend/logging"
+	"sfr-backend/mailer"
+	"sfr-backend/mfa"
+	"sfr-backend/oidc"
+	"sfr-backend/password"
+	"sfr-backend/ratelimit"
+	"sfr-backend/revocation"
 	"sfr-backend/server"
+	"sfr-backend/session"
+	"sfr-backend/signing"
+	"sfr-backend/tracing"
 
 	"github.com/joho/godotenv"
 	rotatelogs "github.com/lestrrat/go-file-rotatelogs"
 	log "github.com/sirupsen/logrus"
 )
 
-func setupGracefulShutdown() {
-	sigChan := make(chan os.Signal)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+// stopGracePeriod - time requests get to respond after drain timeout asked them to stop
+const stopGracePeriod = 5 * time.Second
 
+// shutdownConfig - how long shutdown waits for load balancer and for requests to finish
+type shutdownConfig struct {
+	// readinessDelay - time between failing healthcheck and closing listener
+	readinessDelay time.Duration
+	// drainTimeout - time requests get to finish before they are asked to stop
+	drainTimeout time.Duration
+}
+
+// shutdownConfigFromEnv - reads SHUTDOWN_READINESS_DELAY (default 5s) and SHUTDOWN_TIMEOUT (default 30s),
+// parsed before serving, so invalid values stop startup instead of shutdown
+func shutdownConfigFromEnv() (shutdownConfig, error) {
+	config := shutdownConfig{readinessDelay: 5 * time.Second, drainTimeout: 30 * time.Second}
+	for name, duration := range map[string]*time.Duration{
+		"SHUTDOWN_READINESS_DELAY": &config.readinessDelay,
+		"SHUTDOWN_TIMEOUT":         &config.drainTimeout,
+	} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < 0 {
+			return shutdownConfig{}, fmt.Errorf("%s has to be duration like 30s, got %q", name, value)
+		}
+		*duration = parsed
+	}
+	return config, nil
+}
+
+// serve - serves requests until SIGINT or SIGTERM, then fails healthcheck, stops background work and drains
+// connections. Requests still running after drain timeout are asked to stop, batches skip executions they
+// didn't start yet and report them.
+func serve(httpServer *http.Server, shutdown shutdownConfig, stopBackground context.CancelFunc, background *sync.WaitGroup,
+	shutdownTracing func(context.Context) error) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	served := make(chan error, 1)
+	go func() {
+		served <- httpServer.ListenAndServe()
+	}()
+	select {
+	case err := <-served:
+		log.Fatalf("Failed to start server %s", err)
+	case received := <-signals:
+		log.Info("Got ", received, " signal, shutting down")
+	}
+	go func() {
+		<-signals
+		log.Warn("Got second signal, exiting without draining")
+		os.Exit(1)
+	}()
+
+	lifecycle.Drain()
+	stopBackground()
+	// load balancer has to notice failing healthcheck before listener closes
+	time.Sleep(shutdown.readinessDelay)
+	drained := make(chan struct{})
+	go func() {
+		httpServer.Shutdown(context.Background())
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(shutdown.drainTimeout):
+		log.Warn("Requests didn't finish within SHUTDOWN_TIMEOUT, stopping them")
+		lifecycle.Stop()
+		select {
+		case <-drained:
+		case <-time.After(stopGracePeriod):
+			log.Error("Requests didn't stop, closing connections")
+			httpServer.Close()
+		}
+	}
+	lifecycle.Stop()
+
+	stopped := make(chan struct{})
 	go func() {
-		log.Info(" got interrupt signal: ", <-sigChan)
-		log.Info("Shutting down....")
-		os.Exit(0)
+		background.Wait()
+		close(stopped)
 	}()
+	select {
+	case <-stopped:
+	case <-time.After(stopGracePeriod):
+		log.Error("Background work didn't stop")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), stopGracePeriod)
+	defer cancel()
+	if err := shutdownTracing(ctx); err != nil {
+		log.Error("Failed to flush traces: ", err)
+	}
+	log.Info("Shutdown complete")
 }
 
 func initLog() {
+	if err := logging.ConfigureFromEnv(); err != nil {
+		log.Fatalf("Failed to configure logging %s", err)
+	}
+	if os.Getenv("LOG_OUTPUT") == "stdout" {
+		log.SetOutput(os.Stdout)
+		return
+	}
+
 	maxAge := 0
 	maxAgeString := os.Getenv("LOG_MAX_AGE")
 	if maxAgeString == "" {
@@ -64,15 +179,117 @@ func initLog() {
 	log.SetOutput(writer)
 }
 
+// startAlerting - starts failure alerting watcher when machines and notifiers are configured, it runs until ctx is cancelled
+func startAlerting(ctx context.Context, background *sync.WaitGroup, stepFunctionsProvider awsprovider.AwsStepFunctionsProvider) {
+	watcher, err := alerting.NewWatcherFromEnv(stepFunctionsProvider)
+	if err != nil {
+		log.Error("Failed to initialize failure alerting: ", err)
+		return
+	}
+	if watcher != nil {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			watcher.Run(ctx)
+		}()
+	}
+}
+
 func main() {
 	// Load the .env file in the current directory
 	godotenv.Load()
 	initLog()
-	setupGracefulShutdown()
+	shutdown, err := shutdownConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to load shutdown settings %s", err)
+	}
+	shutdownTracing, err := tracing.InitFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing %s", err)
+	}
+	// background work stops when shutdown starts
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	background := &sync.WaitGroup{}
+	stepFunctionsProvider, err := server.StepFunctionsProviderFromEnv(backgroundCtx)
+	if err != nil {
+		log.Fatalf("Failed to initialize Step Functions provider %s", err)
+	}
+	if os.Getenv("METRICS_TOKEN") == "" {
+		log.Warn("METRICS_TOKEN is not set, /metrics is served without authentication")
+	}
+	audit.SetStore(database.NewAuditStoreFromEnv())
+	apikey.SetStore(database.NewServiceAccountStoreFromEnv())
+	if os.Getenv("APPROVALS_ENABLED") == "true" {
+		approval.SetStore(database.NewApprovalStoreFromEnv())
+	}
+	keyManager, err := signing.NewManagerFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to load JWT signing keys %s", err)
+	}
+	authentication.SetKeyManager(keyManager)
+	if os.Getenv("REVOKED_TOKENS_TABLE") != "" {
+		revocation.SetStore(database.NewRevocationStoreFromEnv())
+	} else {
+		log.Warn("REVOKED_TOKENS_TABLE is not set, revoked tokens are kept in memory and are not shared by instances")
+	}
+	if os.Getenv("SESSIONS_TABLE") != "" {
+		session.SetStore(database.NewSessionStoreFromEnv())
+	} else {
+		log.Warn("SESSIONS_TABLE is not set, sessions are kept in memory and are not shared by instances")
+	}
+	passwordPolicy, err := password.PolicyFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to load password policy %s", err)
+	}
+	password.SetPolicy(passwordPolicy)
+	if os.Getenv("PASSWORD_RESETS_TABLE") != "" {
+		password.SetStore(database.NewPasswordResetStoreFromEnv())
+	} else {
+		log.Warn("PASSWORD_RESETS_TABLE is not set, password reset tokens are kept in memory and are not shared by instances")
+	}
+	if os.Getenv("INVITES_TABLE") != "" {
+		invite.SetStore(database.NewInviteStoreFromEnv())
+	} else {
+		log.Warn("INVITES_TABLE is not set, pending invites are kept in memory and are not shared by instances")
+	}
+	authentication.SetMailer(mailer.NewMailerFromEnv())
+	lockoutConfig, err := lockout.ConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to load login lockout settings %s", err)
+	}
+	lockout.SetConfig(lockoutConfig)
+	if os.Getenv("LOGIN_ATTEMPTS_TABLE") != "" {
+		lockout.SetStore(database.NewLoginAttemptsStoreFromEnv())
+	} else {
+		log.Warn("LOGIN_ATTEMPTS_TABLE is not set, failed logins are counted in memory of every instance separately")
+	}
+	mfaCipher, err := mfa.NewCipherFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to load MFA encryption key %s", err)
+	}
+	if mfaCipher != nil {
+		authentication.SetMFACipher(mfaCipher)
+	} else {
+		log.Warn("MFA_ENCRYPTION_KEY is not set, users can't enroll multi-factor authentication")
+	}
+	oidcConfig, err := oidc.ConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to initialize single sign-on %s", err)
+	}
+	if oidcConfig != nil {
+		authentication.SetOIDCProvider(oidc.NewProvider(*oidcConfig))
+	}
+	startAlerting(backgroundCtx, background, stepFunctionsProvider)
+	limits, err := ratelimit.NewLimitsFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to initialize rate limits %s", err)
+	}
+	authentication.SetClientIP(limits.ClientIP)
 	// Start sever
 	serverPort := os.Getenv("SERVER_PORT")
 	if serverPort == "" {
 		serverPort = "8181"
 	}
-	http.ListenAndServe(":"+serverPort, server.StartServer())
+	httpServer := &http.Server{Addr: ":" + serverPort, Handler: server.StartServer(stepFunctionsProvider, limits)}
+	serve(httpServer, shutdown, stopBackground, background, shutdownTracing)
 }
@@ -0,0 +1,122 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	awsregion "sfr-backend/region"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// otherRegion - region label of calls to regions not in SDK endpoints list, region comes from query parameter,
+// so unknown values would create unbounded number of series
+const otherRegion = "other"
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sfr_http_requests_total",
+		Help: "HTTP requests by route template, method and status.",
+	}, []string{"route", "method", "status"})
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "sfr_http_request_duration_seconds",
+		Help:    "HTTP request latency by route template, method and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+	awsCalls = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sfr_aws_calls_total",
+		Help: "AWS SDK calls by service, operation and region.",
+	}, []string{"service", "operation", "region"})
+	awsErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sfr_aws_call_errors_total",
+		Help: "Failed AWS SDK calls by service, operation, region and AWS error code.",
+	}, []string{"service", "operation", "region", "code"})
+	awsDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "sfr_aws_call_duration_seconds",
+		Help:    "AWS SDK call latency by service, operation and region.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"service", "operation", "region"})
+	logins = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sfr_logins_total",
+		Help: "Login attempts by outcome.",
+	}, []string{"outcome"})
+	batchRestartSize = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "sfr_batch_restart_size",
+		Help:    "Number of executions in batch restart requests.",
+		Buckets: []float64{1, 2, 5, 10, 25, 50, 100, 250, 500, 1000},
+	})
+)
+
+// Middleware - counts requests and observes their latency per route template, method and status,
+// has to be registered with router.Use so the matched route is known
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		// router.Use runs middleware only for matched routes, so route template is always known
+		route, _ := mux.CurrentRoute(r).GetPathTemplate()
+		status := strconv.Itoa(recorder.status)
+		httpRequests.WithLabelValues(route, r.Method, status).Inc()
+		httpDuration.WithLabelValues(route, r.Method, status).Observe(time.Since(started).Seconds())
+	})
+}
+
+// statusRecorder - remembers status written by handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (recorder *statusRecorder) WriteHeader(status int) {
+	recorder.status = status
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+// ObserveAWSCall - counts AWS SDK call started at started, failed calls are counted per AWS error code
+func ObserveAWSCall(service string, operation string, region string, started time.Time, err error) {
+	if !awsregion.Known(region) {
+		region = otherRegion
+	}
+	awsCalls.WithLabelValues(service, operation, region).Inc()
+	awsDuration.WithLabelValues(service, operation, region).Observe(time.Since(started).Seconds())
+	if err == nil {
+		return
+	}
+	code := "Unknown"
+	if awsErr, ok := err.(awserr.Error); ok {
+		code = awsErr.Code()
+	}
+	awsErrors.WithLabelValues(service, operation, region, code).Inc()
+}
+
+// RecordLogin - counts login attempt with audit outcome
+func RecordLogin(outcome string) {
+	logins.WithLabelValues(outcome).Inc()
+}
+
+// ObserveBatchRestart - observes number of executions in batch restart
+func ObserveBatchRestart(size int) {
+	batchRestartSize.Observe(float64(size))
+}
+
+// Handler - serves metrics in Prometheus text format, requires Authorization: Bearer METRICS_TOKEN when it is set
+func Handler() http.Handler {
+	handler := promhttp.Handler()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := os.Getenv("METRICS_TOKEN")
+		if token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,89 @@
+package metrics_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"sfr-backend/metrics"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// scrape - returns metrics exposed by handler
+func scrape(t *testing.T) string {
+	rr := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	body, _ := ioutil.ReadAll(rr.Body)
+	return string(body)
+}
+
+func TestMiddlewareLabelsRouteTemplate(t *testing.T) {
+	router := mux.NewRouter()
+	router.Use(metrics.Middleware)
+	router.HandleFunc("/test/executions/{execution}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}).Methods("GET")
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/test/executions/first", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/test/executions/second", nil))
+
+	body := scrape(t)
+	assert.Contains(t, body, `sfr_http_requests_total{method="GET",route="/test/executions/{execution}",status="404"} 2`)
+	assert.Contains(t, body, `sfr_http_request_duration_seconds_count{method="GET",route="/test/executions/{execution}",status="404"} 2`)
+}
+
+func TestObserveAWSCall(t *testing.T) {
+	metrics.ObserveAWSCall("states", "StartExecution", "eu-central-1", time.Now(), nil)
+	metrics.ObserveAWSCall("states", "StartExecution", "eu-central-1", time.Now(), awserr.New("ThrottlingException", "slow down", nil))
+	metrics.ObserveAWSCall("states", "StartExecution", "eu-central-1", time.Now(), errors.New("not aws"))
+
+	body := scrape(t)
+	assert.Contains(t, body, `sfr_aws_calls_total{operation="StartExecution",region="eu-central-1",service="states"} 3`)
+	assert.Contains(t, body, `sfr_aws_call_errors_total{code="ThrottlingException",operation="StartExecution",region="eu-central-1",service="states"} 1`)
+	assert.Contains(t, body, `sfr_aws_call_errors_total{code="Unknown",operation="StartExecution",region="eu-central-1",service="states"} 1`)
+}
+
+func TestObserveAWSCallUnknownRegion(t *testing.T) {
+	metrics.ObserveAWSCall("dynamodb", "GetItem", "not-a-region", time.Now(), nil)
+	metrics.ObserveAWSCall("dynamodb", "GetItem", "", time.Now(), nil)
+
+	body := scrape(t)
+	assert.Contains(t, body, `sfr_aws_calls_total{operation="GetItem",region="other",service="dynamodb"} 2`)
+	assert.NotContains(t, body, `region="not-a-region"`)
+}
+
+func TestHandlerRequiresToken(t *testing.T) {
+	os.Setenv("METRICS_TOKEN", "secret")
+	defer os.Unsetenv("METRICS_TOKEN")
+
+	rr := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rr = httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestLoginsAndBatchRestarts(t *testing.T) {
+	metrics.RecordLogin("success")
+	metrics.RecordLogin("failure")
+	metrics.RecordLogin("failure")
+	metrics.ObserveBatchRestart(3)
+
+	body := scrape(t)
+	assert.Contains(t, body, `sfr_logins_total{outcome="success"} 1`)
+	assert.Contains(t, body, `sfr_logins_total{outcome="failure"} 2`)
+	assert.Contains(t, body, `sfr_batch_restart_size_bucket{le="5"} 1`)
+	assert.Contains(t, body, `sfr_batch_restart_size_sum 3`)
+}
@@ -0,0 +1,113 @@
+package mfa
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// recoveryCodes - number of recovery codes generated on enrollment
+const recoveryCodes = 10
+
+// Cipher - encrypts TOTP secrets stored in user records with AES-256-GCM
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+// NewCipherFromEnv - creates cipher from base64 encoded 32 byte MFA_ENCRYPTION_KEY, returns nil when it is not set
+func NewCipherFromEnv() (*Cipher, error) {
+	encoded := os.Getenv("MFA_ENCRYPTION_KEY")
+	if encoded == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("MFA_ENCRYPTION_KEY is not base64: %s", err)
+	}
+	return NewCipher(key)
+}
+
+// NewCipher - creates cipher with 32 byte key
+func NewCipher(key []byte) (*Cipher, error) {
+	if len(key) != 32 {
+		return nil, errors.New("MFA encryption key has to be 32 bytes long")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{aead: aead}, nil
+}
+
+// Encrypt - encrypts secret of user, username is authenticated so secret can't be moved to other user
+func (mfaCipher *Cipher) Encrypt(secret string, username string) (string, error) {
+	nonce := make([]byte, mfaCipher.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := mfaCipher.aead.Seal(nonce, nonce, []byte(secret), []byte(username))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt - decrypts secret encrypted for user
+func (mfaCipher *Cipher) Decrypt(encrypted string, username string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return "", err
+	}
+	nonceSize := mfaCipher.aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return "", errors.New("encrypted MFA secret is too short")
+	}
+	secret, err := mfaCipher.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], []byte(username))
+	if err != nil {
+		return "", err
+	}
+	return string(secret), nil
+}
+
+// GenerateRecoveryCodes - returns codes shown to user once and their hashes to be stored
+func GenerateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodes)
+	hashes := make([]string, recoveryCodes)
+	for i := range codes {
+		random := make([]byte, 5)
+		if _, err := rand.Read(random); err != nil {
+			return nil, nil, err
+		}
+		code := hex.EncodeToString(random)
+		codes[i] = code[:5] + "-" + code[5:]
+		hashes[i] = HashRecoveryCode(codes[i])
+	}
+	return codes, hashes, nil
+}
+
+// HashRecoveryCode - sha256 of code ignoring case and dash
+func HashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// UseRecoveryCode - returns hashes without the one matching code, false when no hash matches
+func UseRecoveryCode(hashes []string, code string) ([]string, bool) {
+	hash := HashRecoveryCode(code)
+	for i, stored := range hashes {
+		if subtle.ConstantTimeCompare([]byte(stored), []byte(hash)) == 1 {
+			return append(append([]string{}, hashes[:i]...), hashes[i+1:]...), true
+		}
+	}
+	return hashes, false
+}
@@ -0,0 +1,94 @@
+package mfa_test
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	"sfr-backend/mfa"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// rfcSecret - SHA1 secret of RFC 6238 test vectors
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	// last 6 digits of RFC 6238 SHA1 test vectors
+	testTable := []struct {
+		unix     int64
+		expected string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, testCase := range testTable {
+		code, err := mfa.Code(rfcSecret, time.Unix(testCase.unix, 0))
+		assert.Nil(t, err)
+		assert.Equal(t, testCase.expected, code, testCase.unix)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	secret, err := mfa.GenerateSecret()
+	assert.Nil(t, err)
+	now := time.Unix(1600000000, 0)
+	previous, _ := mfa.Code(secret, now.Add(-30*time.Second))
+	current, _ := mfa.Code(secret, now)
+	old, _ := mfa.Code(secret, now.Add(-90*time.Second))
+
+	step, ok := mfa.Verify(secret, previous, now, 0)
+	assert.True(t, ok)
+	step, ok = mfa.Verify(secret, current, now, step)
+	assert.True(t, ok)
+	assert.Equal(t, now.Unix()/30, step)
+	// codes can't be replayed
+	_, ok = mfa.Verify(secret, current, now, step)
+	assert.False(t, ok)
+	_, ok = mfa.Verify(secret, old, now, 0)
+	assert.False(t, ok)
+}
+
+func TestURI(t *testing.T) {
+	uri := mfa.URI("SFR", "jdoe", "SECRET")
+
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/SFR:jdoe?"))
+	assert.Contains(t, uri, "secret=SECRET")
+	assert.Contains(t, uri, "issuer=SFR")
+}
+
+func TestCipher(t *testing.T) {
+	cipher, err := mfa.NewCipher([]byte("0123456789abcdef0123456789abcdef"))
+	assert.Nil(t, err)
+
+	encrypted, err := cipher.Encrypt("SECRET", "jdoe")
+	assert.Nil(t, err)
+	assert.NotContains(t, encrypted, "SECRET")
+	decrypted, err := cipher.Decrypt(encrypted, "jdoe")
+	assert.Nil(t, err)
+	assert.Equal(t, "SECRET", decrypted)
+	// secret copied to other user doesn't decrypt
+	_, err = cipher.Decrypt(encrypted, "admin")
+	assert.NotNil(t, err)
+
+	_, err = mfa.NewCipher([]byte("short"))
+	assert.NotNil(t, err)
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := mfa.GenerateRecoveryCodes()
+	assert.Nil(t, err)
+	assert.Len(t, codes, 10)
+	assert.NotContains(t, hashes, codes[0])
+
+	remaining, ok := mfa.UseRecoveryCode(hashes, strings.ToUpper(codes[3]))
+	assert.True(t, ok)
+	assert.Len(t, remaining, 9)
+	assert.Len(t, hashes, 10)
+	_, ok = mfa.UseRecoveryCode(remaining, codes[3])
+	assert.False(t, ok)
+}
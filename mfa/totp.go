@@ -0,0 +1,88 @@
+package mfa
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// TOTP parameters of RFC 6238 supported by all authenticator apps
+const (
+	period = 30
+	digits = 6
+	// skew - steps before and after current one accepted for clocks out of sync
+	skew = 1
+)
+
+var secretEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret - random 160 bit secret in base32 as authenticator apps expect it
+func GenerateSecret() (string, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return secretEncoding.EncodeToString(secret), nil
+}
+
+// URI - otpauth URI of secret, shown as QR code to be scanned by authenticator app
+func URI(issuer string, account string, secret string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(digits))
+	query.Set("period", fmt.Sprint(period))
+	return "otpauth://totp/" + url.PathEscape(issuer+":"+account) + "?" + query.Encode()
+}
+
+// Code - code of secret in time step of t
+func Code(secret string, t time.Time) (string, error) {
+	return code(secret, step(t))
+}
+
+// Verify - checks code against steps around t, steps up to lastUsedStep are rejected so every code works once.
+// Returns step of matching code.
+func Verify(secret string, candidate string, t time.Time, lastUsedStep int64) (int64, bool) {
+	current := step(t)
+	for offset := int64(-skew); offset <= skew; offset++ {
+		matched := current + offset
+		if matched <= lastUsedStep {
+			continue
+		}
+		expected, err := code(secret, matched)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(candidate)) == 1 {
+			return matched, true
+		}
+	}
+	return 0, false
+}
+
+func step(t time.Time) int64 {
+	return t.Unix() / period
+}
+
+// code - HOTP of RFC 4226 with counter of time step
+func code(secret string, counter int64) (string, error) {
+	key, err := secretEncoding.DecodeString(secret)
+	if err != nil {
+		return "", err
+	}
+	message := make([]byte, 8)
+	binary.BigEndian.PutUint64(message, uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(message)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", digits, value%1000000), nil
+}
@@ -0,0 +1,206 @@
+package oidc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// discoveryTTL - how long discovery document and keys are used before they are fetched again
+const discoveryTTL = time.Hour
+
+// keysRefreshInterval - keys are fetched again for unknown kid at most this often
+const keysRefreshInterval = time.Minute
+
+// clockSkew - tolerated difference of identity provider clock
+const clockSkew = time.Minute
+
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksURI               string `json:"jwks_uri"`
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// discover - returns cached discovery document of issuer
+func (provider *Provider) discover() (*discoveryDocument, error) {
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+	if provider.discovery != nil && now().Sub(provider.discoveredAt) < discoveryTTL {
+		return provider.discovery, nil
+	}
+	var discovery discoveryDocument
+	if err := provider.getJSON(strings.TrimSuffix(provider.config.Issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, err
+	}
+	if discovery.Issuer != provider.config.Issuer {
+		return nil, fmt.Errorf("discovery document issuer %q doesn't match %q", discovery.Issuer, provider.config.Issuer)
+	}
+	provider.discovery = &discovery
+	provider.discoveredAt = now()
+	return provider.discovery, nil
+}
+
+// key - returns signing key with kid, keys are fetched again when kid is unknown
+func (provider *Provider) key(kid string) (interface{}, error) {
+	discovery, err := provider.discover()
+	if err != nil {
+		return nil, err
+	}
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+	if key, ok := provider.cachedKey(kid); ok && now().Sub(provider.keysFetchedAt) < discoveryTTL {
+		return key, nil
+	}
+	if provider.keys != nil && now().Sub(provider.keysFetchedAt) < keysRefreshInterval {
+		if key, ok := provider.cachedKey(kid); ok {
+			return key, nil
+		}
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := provider.getJSON(discovery.JwksURI, &jwks); err != nil {
+		return nil, err
+	}
+	provider.keys = map[string]interface{}{}
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if key, err := jwk.publicKey(); err == nil {
+			provider.keys[jwk.Kid] = key
+		}
+	}
+	provider.keysFetchedAt = now()
+	if key, ok := provider.cachedKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// cachedKey - tokens without kid can be verified only when provider publishes single key
+func (provider *Provider) cachedKey(kid string) (interface{}, bool) {
+	if kid == "" && len(provider.keys) == 1 {
+		for _, key := range provider.keys {
+			return key, true
+		}
+	}
+	key, ok := provider.keys[kid]
+	return key, ok
+}
+
+// validateIDToken - checks signature, issuer, audience, expiration and nonce of ID token
+func (provider *Provider) validateIDToken(idToken string, nonce string) (jwt.MapClaims, error) {
+	parser := &jwt.Parser{
+		ValidMethods: []string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"},
+		// times are checked below with tolerated clock skew
+		SkipClaimsValidation: true,
+	}
+	claims := jwt.MapClaims{}
+	_, err := parser.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return provider.key(kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidToken, err)
+	}
+	current := now()
+	switch {
+	case stringClaim(claims, "iss") != provider.config.Issuer:
+		return nil, fmt.Errorf("%w: unexpected issuer", ErrInvalidToken)
+	case !containsString(stringsClaim(claims, "aud"), provider.config.ClientID):
+		return nil, fmt.Errorf("%w: unexpected audience", ErrInvalidToken)
+	case len(stringsClaim(claims, "aud")) > 1 && stringClaim(claims, "azp") != provider.config.ClientID:
+		return nil, fmt.Errorf("%w: unexpected authorized party", ErrInvalidToken)
+	case !claims.VerifyExpiresAt(current.Add(-clockSkew).Unix(), true):
+		return nil, fmt.Errorf("%w: token expired", ErrInvalidToken)
+	case !claims.VerifyNotBefore(current.Add(clockSkew).Unix(), false):
+		return nil, fmt.Errorf("%w: token not valid yet", ErrInvalidToken)
+	case stringClaim(claims, "nonce") != nonce:
+		return nil, fmt.Errorf("%w: unexpected nonce", ErrInvalidToken)
+	}
+	return claims, nil
+}
+
+// publicKey - converts RSA or EC JSON web key to public key used by jwt-go
+func (jwk jsonWebKey) publicKey() (interface{}, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+		curve, ok := curves[jwk.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := decodeBigInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+}
+
+func (provider *Provider) getJSON(url string, target interface{}) error {
+	resp, err := provider.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(target)
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(decoded), nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, item := range values {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
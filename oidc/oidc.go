@@ -0,0 +1,355 @@
+package oidc
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"sfr-backend/rbac"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// loginStateTTL - how long user has to finish login at identity provider
+const loginStateTTL = 10 * time.Minute
+
+var (
+	// ErrInvalidState - login state is malformed, expired or doesn't belong to returned state
+	ErrInvalidState = errors.New("invalid or expired login state")
+	// ErrInvalidToken - ID token failed validation
+	ErrInvalidToken = errors.New("invalid ID token")
+)
+
+// Config - OIDC client registered at identity provider
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL - frontend page receiving code and state, it posts them to /oidc/callback
+	RedirectURL   string
+	Scopes        []string
+	UsernameClaim string
+	GroupsClaim   string
+	// GroupGrants - grants of users in IdP groups
+	GroupGrants map[string][]rbac.Grant
+	// StateSecret - signs login state, has to be same on all instances
+	StateSecret []byte
+}
+
+// ConfigFromEnv - reads OIDC_* variables, returns nil config when OIDC_ISSUER is not set
+func ConfigFromEnv() (*Config, error) {
+	issuer := os.Getenv("OIDC_ISSUER")
+	if issuer == "" {
+		return nil, nil
+	}
+	config := &Config{
+		Issuer:        issuer,
+		ClientID:      os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret:  os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:   os.Getenv("OIDC_REDIRECT_URL"),
+		Scopes:        strings.Fields(os.Getenv("OIDC_SCOPES")),
+		UsernameClaim: os.Getenv("OIDC_USERNAME_CLAIM"),
+		GroupsClaim:   os.Getenv("OIDC_GROUPS_CLAIM"),
+		GroupGrants:   map[string][]rbac.Grant{},
+		StateSecret:   []byte(os.Getenv("OIDC_STATE_SECRET")),
+	}
+	if config.ClientID == "" || config.RedirectURL == "" {
+		return nil, errors.New("OIDC_CLIENT_ID and OIDC_REDIRECT_URL are required with OIDC_ISSUER")
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "profile", "email"}
+	}
+	if config.UsernameClaim == "" {
+		config.UsernameClaim = "preferred_username"
+	}
+	if config.GroupsClaim == "" {
+		config.GroupsClaim = "groups"
+	}
+	if groupGrants := os.Getenv("OIDC_GROUP_GRANTS"); groupGrants != "" {
+		if err := json.Unmarshal([]byte(groupGrants), &config.GroupGrants); err != nil {
+			return nil, fmt.Errorf("OIDC_GROUP_GRANTS has to be JSON object of grant lists: %s", err)
+		}
+		for group, grants := range config.GroupGrants {
+			for _, grant := range grants {
+				if !rbac.ValidRole(grant.Role) {
+					return nil, fmt.Errorf("OIDC_GROUP_GRANTS has unknown role %q for group %q", grant.Role, group)
+				}
+			}
+		}
+	}
+	if len(config.StateSecret) == 0 {
+		log.Warn("OIDC_STATE_SECRET is not set, logins started on other instances will fail")
+		config.StateSecret = randomBytes(32)
+	}
+	return config, nil
+}
+
+// Identity - user authenticated by identity provider
+type Identity struct {
+	// Issuer, Subject - stable and unique identifier of account at identity provider, unlike username
+	Issuer    string
+	Subject   string
+	Username  string
+	Email     string
+	Firstname string
+	Lastname  string
+	Groups    []string
+	// MFA - identity provider reports multi-factor authentication in amr claim
+	MFA bool
+}
+
+// Provider - OIDC client using authorization code flow with PKCE
+type Provider struct {
+	config Config
+	client *http.Client
+
+	mutex         sync.Mutex
+	discovery     *discoveryDocument
+	discoveredAt  time.Time
+	keys          map[string]interface{}
+	keysFetchedAt time.Time
+}
+
+// NewProvider - creates provider, discovery document is fetched on first login
+func NewProvider(config Config) *Provider {
+	return &Provider{config: config, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// loginState - data of started login, signed and kept by frontend until callback
+type loginState struct {
+	State    string    `json:"state"`
+	Nonce    string    `json:"nonce"`
+	Verifier string    `json:"verifier"`
+	Expires  time.Time `json:"expires"`
+}
+
+// Start - returns URL of identity provider login page and signed login state, which has to be sent back with code
+func (provider *Provider) Start() (string, string, error) {
+	discovery, err := provider.discover()
+	if err != nil {
+		return "", "", err
+	}
+	state := loginState{
+		State:    encode(randomBytes(16)),
+		Nonce:    encode(randomBytes(16)),
+		Verifier: encode(randomBytes(32)),
+		Expires:  now().Add(loginStateTTL),
+	}
+	challenge := sha256.Sum256([]byte(state.Verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {provider.config.ClientID},
+		"redirect_uri":          {provider.config.RedirectURL},
+		"scope":                 {strings.Join(provider.config.Scopes, " ")},
+		"state":                 {state.State},
+		"nonce":                 {state.Nonce},
+		"code_challenge":        {encode(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	signed, err := provider.sign(state)
+	if err != nil {
+		return "", "", err
+	}
+	return discovery.AuthorizationEndpoint + separator + query.Encode(), signed, nil
+}
+
+// Finish - checks state returned by identity provider, exchanges code and validates ID token
+func (provider *Provider) Finish(code string, state string, signedState string) (*Identity, error) {
+	started, err := provider.verify(signedState)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal([]byte(started.State), []byte(state)) {
+		return nil, ErrInvalidState
+	}
+	idToken, err := provider.exchange(code, started.Verifier)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := provider.validateIDToken(idToken, started.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	identity := &Identity{
+		Issuer:    stringClaim(claims, "iss"),
+		Subject:   stringClaim(claims, "sub"),
+		Username:  stringClaim(claims, provider.config.UsernameClaim),
+		Email:     stringClaim(claims, "email"),
+		Firstname: stringClaim(claims, "given_name"),
+		Lastname:  stringClaim(claims, "family_name"),
+		Groups:    stringsClaim(claims, provider.config.GroupsClaim),
+		MFA:       multiFactor(stringsClaim(claims, "amr")),
+	}
+	if identity.Subject == "" {
+		log.Warn("ID token has no sub claim")
+		return nil, ErrInvalidToken
+	}
+	if identity.Username == "" {
+		log.Warn("ID token has no ", provider.config.UsernameClaim, " claim")
+		return nil, ErrInvalidToken
+	}
+	return identity, nil
+}
+
+// Issuer - issuer of ID tokens the provider accepts
+func (provider *Provider) Issuer() string {
+	return provider.config.Issuer
+}
+
+// Grants - returns grants of all groups in OIDC_GROUP_GRANTS user is member of
+func (provider *Provider) Grants(groups []string) []rbac.Grant {
+	grants := []rbac.Grant{}
+	for _, group := range groups {
+		grants = append(grants, provider.config.GroupGrants[group]...)
+	}
+	return grants
+}
+
+// exchange - redeems code at token endpoint, returns ID token
+func (provider *Provider) exchange(code string, verifier string) (string, error) {
+	discovery, err := provider.discover()
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {provider.config.RedirectURL},
+		"client_id":     {provider.config.ClientID},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequest("POST", discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if provider.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(provider.config.ClientID), url.QueryEscape(provider.config.ClientSecret))
+	}
+	resp, err := provider.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var tokens struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return "", fmt.Errorf("unable to decode token response: %s", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", &TokenError{Code: tokens.Error, Description: tokens.ErrorDescription}
+	}
+	if tokens.IDToken == "" {
+		return "", errors.New("token response has no id_token")
+	}
+	return tokens.IDToken, nil
+}
+
+// TokenError - error response of token endpoint, e.g. invalid_grant for reused or expired code
+type TokenError struct {
+	Code        string
+	Description string
+}
+
+func (err *TokenError) Error() string {
+	return strings.TrimSpace("token endpoint returned " + err.Code + " " + err.Description)
+}
+
+// sign - encodes login state with HMAC, so it can't be changed by client
+func (provider *Provider) sign(state loginState) (string, error) {
+	payload, err := json.Marshal(state)
+	if err != nil {
+		return "", err
+	}
+	encoded := encode(payload)
+	return encoded + "." + encode(provider.mac(encoded)), nil
+}
+
+// verify - decodes signed login state and checks its expiration
+func (provider *Provider) verify(signed string) (*loginState, error) {
+	parts := strings.Split(signed, ".")
+	if len(parts) != 2 {
+		return nil, ErrInvalidState
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(signature, provider.mac(parts[0])) {
+		return nil, ErrInvalidState
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidState
+	}
+	var state loginState
+	if err := json.Unmarshal(payload, &state); err != nil || now().After(state.Expires) {
+		return nil, ErrInvalidState
+	}
+	return &state, nil
+}
+
+func (provider *Provider) mac(payload string) []byte {
+	mac := hmac.New(sha256.New, provider.config.StateSecret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+var now = time.Now
+
+func randomBytes(length int) []byte {
+	value := make([]byte, length)
+	rand.Read(value)
+	return value
+}
+
+func encode(value []byte) string {
+	return base64.RawURLEncoding.EncodeToString(value)
+}
+
+func stringClaim(claims map[string]interface{}, name string) string {
+	value, _ := claims[name].(string)
+	return value
+}
+
+// stringsClaim - reads claim which can be list of strings or single string
+// multiFactor - checks authentication methods of RFC 8176 for multi-factor or one-time password
+func multiFactor(methods []string) bool {
+	for _, method := range methods {
+		if method == "mfa" || method == "otp" || method == "hwk" {
+			return true
+		}
+	}
+	return false
+}
+
+func stringsClaim(claims map[string]interface{}, name string) []string {
+	switch value := claims[name].(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		values := []string{}
+		for _, item := range value {
+			if text, ok := item.(string); ok {
+				values = append(values, text)
+			}
+		}
+		return values
+	}
+	return []string{}
+}
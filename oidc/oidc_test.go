@@ -0,0 +1,132 @@
+package oidc_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"sfr-backend/oidc"
+	"sfr-backend/oidc/oidctest"
+	"sfr-backend/rbac"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newProvider(identityProvider *oidctest.IdentityProvider) *oidc.Provider {
+	return oidc.NewProvider(oidc.Config{
+		Issuer:        identityProvider.URL,
+		ClientID:      identityProvider.ClientID,
+		ClientSecret:  identityProvider.ClientSecret,
+		RedirectURL:   "https://sfr.example.com/sso",
+		Scopes:        []string{"openid", "profile"},
+		UsernameClaim: "preferred_username",
+		GroupsClaim:   "groups",
+		GroupGrants:   map[string][]rbac.Grant{"sfr-admins": {{Role: rbac.RoleAdmin}}},
+		StateSecret:   []byte("secret"),
+	})
+}
+
+func TestLogin(t *testing.T) {
+	identityProvider := oidctest.NewIdentityProvider("sfr", "client-secret")
+	defer identityProvider.Close()
+	provider := newProvider(identityProvider)
+
+	authorizationURL, loginState, err := provider.Start()
+	assert.Nil(t, err)
+	code, state, err := identityProvider.Login(authorizationURL, map[string]interface{}{
+		"sub":                "1234",
+		"preferred_username": "jdoe",
+		"email":              "jdoe@example.com",
+		"groups":             []string{"sfr-admins", "everyone"},
+		"amr":                []string{"pwd", "otp"},
+	})
+	assert.Nil(t, err)
+
+	identity, err := provider.Finish(code, state, loginState)
+
+	assert.Nil(t, err)
+	assert.Equal(t, identityProvider.URL, identity.Issuer)
+	assert.Equal(t, "1234", identity.Subject)
+	assert.Equal(t, "jdoe", identity.Username)
+	assert.Equal(t, "jdoe@example.com", identity.Email)
+	assert.True(t, identity.MFA)
+	assert.Equal(t, []rbac.Grant{{Role: rbac.RoleAdmin}}, provider.Grants(identity.Groups))
+	// codes can be redeemed only once
+	_, err = provider.Finish(code, state, loginState)
+	var tokenErr *oidc.TokenError
+	assert.True(t, errors.As(err, &tokenErr))
+	assert.Equal(t, "invalid_grant", tokenErr.Code)
+}
+
+func TestLoginRejected(t *testing.T) {
+	identityProvider := oidctest.NewIdentityProvider("sfr", "")
+	defer identityProvider.Close()
+	provider := newProvider(identityProvider)
+	otherProvider := newProvider(identityProvider)
+	username := map[string]interface{}{"preferred_username": "jdoe"}
+	testTable := []struct {
+		name          string
+		claims        map[string]interface{}
+		changeState   func(state string, loginState string) (string, string)
+		expectedError error
+	}{
+		{"other audience", map[string]interface{}{"preferred_username": "jdoe", "aud": "other"}, nil, oidc.ErrInvalidToken},
+		{"other issuer", map[string]interface{}{"preferred_username": "jdoe", "iss": "https://idp.example.com"}, nil, oidc.ErrInvalidToken},
+		{"expired", map[string]interface{}{"preferred_username": "jdoe", "exp": time.Now().Add(-time.Hour).Unix()}, nil, oidc.ErrInvalidToken},
+		{"other nonce", map[string]interface{}{"preferred_username": "jdoe", "nonce": "replayed"}, nil, oidc.ErrInvalidToken},
+		{"no username", map[string]interface{}{"sub": "1234", "email": "jdoe@example.com"}, nil, oidc.ErrInvalidToken},
+		{"no subject", map[string]interface{}{"preferred_username": "jdoe"}, nil, oidc.ErrInvalidToken},
+		{"other state", username, func(state string, loginState string) (string, string) {
+			return "forged", loginState
+		}, oidc.ErrInvalidState},
+		{"tampered login state", username, func(state string, loginState string) (string, string) {
+			return state, "x" + loginState
+		}, oidc.ErrInvalidState},
+		{"login state of other login", username, func(state string, loginState string) (string, string) {
+			_, otherLoginState, _ := otherProvider.Start()
+			return state, otherLoginState
+		}, oidc.ErrInvalidState},
+	}
+
+	for _, testCase := range testTable {
+		authorizationURL, loginState, _ := provider.Start()
+		code, state, _ := identityProvider.Login(authorizationURL, testCase.claims)
+		if testCase.changeState != nil {
+			state, loginState = testCase.changeState(state, loginState)
+		}
+
+		_, err := provider.Finish(code, state, loginState)
+
+		assert.True(t, errors.Is(err, testCase.expectedError), testCase.name)
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	defer func() {
+		for _, name := range []string{"OIDC_ISSUER", "OIDC_CLIENT_ID", "OIDC_REDIRECT_URL", "OIDC_GROUP_GRANTS"} {
+			os.Unsetenv(name)
+		}
+	}()
+	config, err := oidc.ConfigFromEnv()
+	assert.Nil(t, config)
+	assert.Nil(t, err)
+
+	os.Setenv("OIDC_ISSUER", "https://idp.example.com")
+	_, err = oidc.ConfigFromEnv()
+	assert.NotNil(t, err)
+
+	os.Setenv("OIDC_CLIENT_ID", "sfr")
+	os.Setenv("OIDC_REDIRECT_URL", "https://sfr.example.com/sso")
+	os.Setenv("OIDC_GROUP_GRANTS", `{"sfr-ops": [{"role": "owner"}]}`)
+	_, err = oidc.ConfigFromEnv()
+	assert.NotNil(t, err)
+
+	os.Setenv("OIDC_GROUP_GRANTS", `{"sfr-ops": [{"role": "operator", "region": "eu-*"}]}`)
+	config, err = oidc.ConfigFromEnv()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"openid", "profile", "email"}, config.Scopes)
+	assert.Equal(t, "preferred_username", config.UsernameClaim)
+	assert.Equal(t, []rbac.Grant{{Role: rbac.RoleOperator, Region: "eu-*"}}, config.GroupGrants["sfr-ops"])
+	assert.NotEmpty(t, config.StateSecret)
+}
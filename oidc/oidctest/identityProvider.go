@@ -0,0 +1,149 @@
+// Package oidctest provides local OpenID Connect identity provider for tests
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// IdentityProvider - identity provider issuing RS256 signed ID tokens for codes created by Login
+type IdentityProvider struct {
+	URL          string
+	ClientID     string
+	ClientSecret string
+	// KeyID - kid of signing key, published in JWKS
+	KeyID string
+
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	mutex  sync.Mutex
+	codes  map[string]pendingCode
+}
+
+type pendingCode struct {
+	redirectURI string
+	challenge   string
+	claims      jwt.MapClaims
+}
+
+// NewIdentityProvider - starts identity provider for client, Close has to be called when test ends
+func NewIdentityProvider(clientID string, clientSecret string) *IdentityProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	provider := &IdentityProvider{ClientID: clientID, ClientSecret: clientSecret, KeyID: "test-key", key: key, codes: map[string]pendingCode{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", provider.discovery)
+	mux.HandleFunc("/jwks", provider.jwks)
+	mux.HandleFunc("/token", provider.token)
+	provider.server = httptest.NewServer(mux)
+	provider.URL = provider.server.URL
+	return provider
+}
+
+// Close - stops identity provider
+func (provider *IdentityProvider) Close() {
+	provider.server.Close()
+}
+
+// Login - acts as user logging in at authorization URL, returns code and state the user is redirected with.
+// Claims are added to ID token, iss, aud, exp, iat and nonce are set unless claims contain them.
+func (provider *IdentityProvider) Login(authorizationURL string, claims map[string]interface{}) (string, string, error) {
+	parsed, err := url.Parse(authorizationURL)
+	if err != nil {
+		return "", "", err
+	}
+	query := parsed.Query()
+	if query.Get("client_id") != provider.ClientID || query.Get("response_type") != "code" || query.Get("code_challenge_method") != "S256" {
+		return "", "", errors.New("unexpected authorization request " + authorizationURL)
+	}
+	idClaims := jwt.MapClaims{
+		"iss":   provider.URL,
+		"aud":   provider.ClientID,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(5 * time.Minute).Unix(),
+		"nonce": query.Get("nonce"),
+	}
+	for name, value := range claims {
+		idClaims[name] = value
+	}
+	code := randomString()
+	provider.mutex.Lock()
+	provider.codes[code] = pendingCode{redirectURI: query.Get("redirect_uri"), challenge: query.Get("code_challenge"), claims: idClaims}
+	provider.mutex.Unlock()
+	return code, query.Get("state"), nil
+}
+
+func (provider *IdentityProvider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 provider.URL,
+		"authorization_endpoint": provider.URL + "/authorize",
+		"token_endpoint":         provider.URL + "/token",
+		"jwks_uri":               provider.URL + "/jwks",
+	})
+}
+
+func (provider *IdentityProvider) jwks(w http.ResponseWriter, r *http.Request) {
+	publicKey := provider.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{"keys": []map[string]string{{
+		"kid": provider.KeyID,
+		"kty": "RSA",
+		"use": "sig",
+		"alg": "RS256",
+		"n":   base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+	}}})
+}
+
+// token - redeems code once, checks client credentials, redirect URI and PKCE verifier
+func (provider *IdentityProvider) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	provider.mutex.Lock()
+	pending, ok := provider.codes[r.FormValue("code")]
+	delete(provider.codes, r.FormValue("code"))
+	provider.mutex.Unlock()
+	clientID, clientSecret, _ := r.BasicAuth()
+	if provider.ClientSecret != "" && (clientID != provider.ClientID || clientSecret != provider.ClientSecret) {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	challenge := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+	if !ok || r.FormValue("grant_type") != "authorization_code" || r.FormValue("redirect_uri") != pending.redirectURI ||
+		base64.RawURLEncoding.EncodeToString(challenge[:]) != pending.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, pending.claims)
+	token.Header["kid"] = provider.KeyID
+	idToken, err := token.SignedString(provider.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"id_token": idToken, "access_token": randomString(), "token_type": "Bearer"})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func randomString() string {
+	value := make([]byte, 16)
+	rand.Read(value)
+	return base64.RawURLEncoding.EncodeToString(value)
+}
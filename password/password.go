@@ -0,0 +1,223 @@
+package password
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// character classes policy can require
+const (
+	ClassUpper  = "upper"
+	ClassLower  = "lower"
+	ClassDigit  = "digit"
+	ClassSymbol = "symbol"
+)
+
+// maxLength - bcrypt ignores everything after 72 bytes
+const maxLength = 72
+
+// defaultResetTTL - how long reset tokens work when PASSWORD_RESET_TTL is not set
+const defaultResetTTL = time.Hour
+
+// ErrInvalidToken - reset token is unknown, expired or was already used
+var ErrInvalidToken = errors.New("reset token is invalid or expired")
+
+// Policy - rules new passwords have to follow
+type Policy struct {
+	MinLength int
+	// Require - character classes password has to contain
+	Require []string
+}
+
+// DefaultPolicy - used when PASSWORD_MIN_LENGTH and PASSWORD_REQUIRE are not set
+var DefaultPolicy = Policy{MinLength: 8}
+
+// PolicyError - lists every rule password breaks
+type PolicyError struct {
+	Violations []string
+}
+
+func (policyError *PolicyError) Error() string {
+	return "password " + strings.Join(policyError.Violations, ", ")
+}
+
+var policy = DefaultPolicy
+
+// SetPolicy - sets policy enforced by Validate
+func SetPolicy(passwordPolicy Policy) {
+	policy = passwordPolicy
+}
+
+// PolicyFromEnv - reads PASSWORD_MIN_LENGTH and comma separated classes in PASSWORD_REQUIRE
+func PolicyFromEnv() (Policy, error) {
+	passwordPolicy := DefaultPolicy
+	if minLength := os.Getenv("PASSWORD_MIN_LENGTH"); minLength != "" {
+		length, err := strconv.Atoi(minLength)
+		if err != nil || length < 1 || length > maxLength {
+			return Policy{}, fmt.Errorf("PASSWORD_MIN_LENGTH has to be between 1 and %d", maxLength)
+		}
+		passwordPolicy.MinLength = length
+	}
+	for _, class := range strings.Split(os.Getenv("PASSWORD_REQUIRE"), ",") {
+		class = strings.TrimSpace(class)
+		if class == "" {
+			continue
+		}
+		if _, ok := classes[class]; !ok {
+			return Policy{}, fmt.Errorf("unknown character class %q in PASSWORD_REQUIRE", class)
+		}
+		passwordPolicy.Require = append(passwordPolicy.Require, class)
+	}
+	return passwordPolicy, nil
+}
+
+var classes = map[string]func(rune) bool{
+	ClassUpper: unicode.IsUpper,
+	ClassLower: unicode.IsLower,
+	ClassDigit: unicode.IsDigit,
+	ClassSymbol: func(r rune) bool {
+		return unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r)
+	},
+}
+
+// Validate - checks password against current policy, returns *PolicyError listing broken rules
+func Validate(password string, username string) error {
+	var violations []string
+	if len([]rune(password)) < policy.MinLength {
+		violations = append(violations, fmt.Sprintf("has to be at least %d characters long", policy.MinLength))
+	}
+	if len(password) > maxLength {
+		violations = append(violations, fmt.Sprintf("can't be longer than %d bytes", maxLength))
+	}
+	if username != "" && strings.EqualFold(password, username) {
+		violations = append(violations, "can't be the same as username")
+	}
+	for _, class := range policy.Require {
+		if !containsClass(password, classes[class]) {
+			violations = append(violations, "has to contain "+class+" character")
+		}
+	}
+	if len(violations) > 0 {
+		return &PolicyError{Violations: violations}
+	}
+	return nil
+}
+
+func containsClass(password string, inClass func(rune) bool) bool {
+	for _, r := range password {
+		if inClass(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResetToken - pending password reset, only sha256 of the token sent to user is stored
+type ResetToken struct {
+	ID          string `json:"id" dynamodbav:"id"`
+	Username    string `json:"username" dynamodbav:"username"`
+	RequestedBy string `json:"requestedBy" dynamodbav:"requestedBy"`
+	// ExpiresAt - unix time, TTL attribute of reset tokens table
+	ExpiresAt int64 `json:"expiresAt" dynamodbav:"expiresAt"`
+}
+
+// Store - storage of pending password resets
+type Store interface {
+	Create(ctx context.Context, token ResetToken) error
+	// Consume - deletes token and returns it, nil when it doesn't exist
+	Consume(ctx context.Context, id string) (*ResetToken, error)
+}
+
+var store Store = NewMemoryStore()
+var now = time.Now
+
+// SetStore - sets storage of reset tokens
+func SetStore(resetStore Store) {
+	store = resetStore
+}
+
+// IssueResetToken - creates single use token resetting password of user, requestedBy is user or admin asking for it
+func IssueResetToken(ctx context.Context, username string, requestedBy string) (string, time.Time, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", time.Time{}, err
+	}
+	token := hex.EncodeToString(secret)
+	expiresAt := now().Add(resetTTL())
+	err := store.Create(ctx, ResetToken{ID: hash(token), Username: username, RequestedBy: requestedBy, ExpiresAt: expiresAt.Unix()})
+	return token, expiresAt, err
+}
+
+// RedeemResetToken - consumes token and returns user whose password it resets
+func RedeemResetToken(ctx context.Context, token string) (string, error) {
+	if token == "" {
+		return "", ErrInvalidToken
+	}
+	resetToken, err := store.Consume(ctx, hash(token))
+	if err != nil {
+		return "", err
+	}
+	if resetToken == nil || resetToken.ExpiresAt <= now().Unix() {
+		return "", ErrInvalidToken
+	}
+	return resetToken.Username, nil
+}
+
+func hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func resetTTL() time.Duration {
+	ttl, err := time.ParseDuration(os.Getenv("PASSWORD_RESET_TTL"))
+	if err != nil || ttl <= 0 {
+		return defaultResetTTL
+	}
+	return ttl
+}
+
+// MemoryStore - reset tokens kept in memory, not shared by instances and lost on restart
+type MemoryStore struct {
+	mutex  sync.Mutex
+	tokens map[string]ResetToken
+}
+
+// NewMemoryStore - creates empty memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{tokens: map[string]ResetToken{}}
+}
+
+// Create - stores token, expired tokens are dropped
+func (memoryStore *MemoryStore) Create(ctx context.Context, token ResetToken) error {
+	memoryStore.mutex.Lock()
+	defer memoryStore.mutex.Unlock()
+	for id, pending := range memoryStore.tokens {
+		if pending.ExpiresAt <= now().Unix() {
+			delete(memoryStore.tokens, id)
+		}
+	}
+	memoryStore.tokens[token.ID] = token
+	return nil
+}
+
+// Consume - removes and returns token
+func (memoryStore *MemoryStore) Consume(ctx context.Context, id string) (*ResetToken, error) {
+	memoryStore.mutex.Lock()
+	defer memoryStore.mutex.Unlock()
+	token, ok := memoryStore.tokens[id]
+	if !ok {
+		return nil, nil
+	}
+	delete(memoryStore.tokens, id)
+	return &token, nil
+}
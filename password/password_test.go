@@ -0,0 +1,87 @@
+package password_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"sfr-backend/password"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	password.SetPolicy(password.Policy{MinLength: 10, Require: []string{password.ClassUpper, password.ClassDigit, password.ClassSymbol}})
+	defer password.SetPolicy(password.DefaultPolicy)
+	testTable := []struct {
+		password           string
+		username           string
+		expectedViolations int
+	}{
+		{"Correct-horse-1", "jdoe", 0},
+		{"Short-1", "jdoe", 1},
+		{"correct-horse-1", "jdoe", 1},
+		{"Correcthorse", "jdoe", 2},
+		{"Jdoe-12345", "jdoe-12345", 1},
+		{"Long-1" + string(make([]byte, 70)), "jdoe", 1},
+	}
+
+	for _, testCase := range testTable {
+		err := password.Validate(testCase.password, testCase.username)
+
+		if testCase.expectedViolations == 0 {
+			assert.Nil(t, err, testCase.password)
+			continue
+		}
+		policyError, ok := err.(*password.PolicyError)
+		assert.True(t, ok, testCase.password)
+		assert.Len(t, policyError.Violations, testCase.expectedViolations, testCase.password)
+	}
+}
+
+func TestPolicyFromEnv(t *testing.T) {
+	defer os.Unsetenv("PASSWORD_MIN_LENGTH")
+	defer os.Unsetenv("PASSWORD_REQUIRE")
+	policy, err := password.PolicyFromEnv()
+	assert.Nil(t, err)
+	assert.Equal(t, password.DefaultPolicy, policy)
+
+	os.Setenv("PASSWORD_MIN_LENGTH", "12")
+	os.Setenv("PASSWORD_REQUIRE", "upper, digit")
+	policy, err = password.PolicyFromEnv()
+	assert.Nil(t, err)
+	assert.Equal(t, password.Policy{MinLength: 12, Require: []string{"upper", "digit"}}, policy)
+
+	os.Setenv("PASSWORD_REQUIRE", "emoji")
+	_, err = password.PolicyFromEnv()
+	assert.NotNil(t, err)
+
+	os.Setenv("PASSWORD_REQUIRE", "")
+	os.Setenv("PASSWORD_MIN_LENGTH", "100")
+	_, err = password.PolicyFromEnv()
+	assert.NotNil(t, err)
+}
+
+func TestResetToken(t *testing.T) {
+	password.SetStore(password.NewMemoryStore())
+
+	token, _, err := password.IssueResetToken(context.Background(), "jdoe", "admin")
+	assert.Nil(t, err)
+	username, err := password.RedeemResetToken(context.Background(), token)
+	assert.Nil(t, err)
+	assert.Equal(t, "jdoe", username)
+
+	_, err = password.RedeemResetToken(context.Background(), token)
+	assert.Equal(t, password.ErrInvalidToken, err)
+	_, err = password.RedeemResetToken(context.Background(), "")
+	assert.Equal(t, password.ErrInvalidToken, err)
+
+	// memory store returns expired tokens, redemption rejects them
+	os.Setenv("PASSWORD_RESET_TTL", "1ns")
+	defer os.Unsetenv("PASSWORD_RESET_TTL")
+	token, _, _ = password.IssueResetToken(context.Background(), "jdoe", "jdoe")
+	time.Sleep(time.Second)
+	_, err = password.RedeemResetToken(context.Background(), token)
+	assert.Equal(t, password.ErrInvalidToken, err)
+}
@@ -0,0 +1,206 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// route groups limited separately
+const (
+	GroupAuth  = "auth"
+	GroupRead  = "read"
+	GroupWrite = "write"
+	GroupBatch = "batch"
+)
+
+// defaultLimits - limits used when RATE_LIMIT_<GROUP> is not set
+var defaultLimits = map[string]string{
+	GroupAuth:  "10/1m",
+	GroupRead:  "300/1m",
+	GroupWrite: "30/1m",
+	GroupBatch: "5/1m",
+}
+
+// sweepInterval - how often idle buckets are dropped
+const sweepInterval = time.Minute
+
+// Limit - token bucket holding up to Burst tokens, refilled by Burst tokens every Period
+type Limit struct {
+	Burst  int
+	Period time.Duration
+}
+
+// ParseLimit - parses limit in <requests>/<period> format, e.g. 60/1m
+func ParseLimit(value string) (Limit, error) {
+	parts := strings.Split(value, "/")
+	if len(parts) != 2 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q, expected <requests>/<period>", value)
+	}
+	burst, err := strconv.Atoi(parts[0])
+	if err != nil || burst <= 0 {
+		return Limit{}, fmt.Errorf("invalid number of requests in rate limit %q", value)
+	}
+	period, err := time.ParseDuration(parts[1])
+	if err != nil || period <= 0 {
+		return Limit{}, fmt.Errorf("invalid period in rate limit %q", value)
+	}
+	return Limit{Burst: burst, Period: period}, nil
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter - token buckets of single route group keyed by user or client
+type Limiter struct {
+	limit     Limit
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewLimiter - creates limiter with empty buckets
+func NewLimiter(limit Limit) *Limiter {
+	return &Limiter{
+		limit:     limit,
+		buckets:   map[string]*bucket{},
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+// Allow - takes token from bucket of key, returns remaining tokens or time to wait when bucket is empty
+func (limiter *Limiter) Allow(key string) (bool, int, time.Duration) {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	now := limiter.now()
+	limiter.sweep(now)
+
+	b, ok := limiter.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limiter.limit.Burst), last: now}
+		limiter.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(limiter.limit.Burst), b.tokens+now.Sub(b.last).Seconds()*limiter.rate())
+	b.last = now
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / limiter.rate() * float64(time.Second))
+		return false, 0, wait
+	}
+	b.tokens--
+	return true, int(b.tokens), 0
+}
+
+// rate - tokens added per second
+func (limiter *Limiter) rate() float64 {
+	return float64(limiter.limit.Burst) / limiter.limit.Period.Seconds()
+}
+
+// sweep - drops buckets which are full again, has to be called with lock held
+func (limiter *Limiter) sweep(now time.Time) {
+	if now.Sub(limiter.lastSweep) < sweepInterval {
+		return
+	}
+	limiter.lastSweep = now
+	for key, b := range limiter.buckets {
+		if now.Sub(b.last) >= limiter.limit.Period {
+			delete(limiter.buckets, key)
+		}
+	}
+}
+
+// KeyFunc - returns key of bucket request is counted against
+type KeyFunc func(r *http.Request) string
+
+// Limits - limiters of all route groups, groups without limiter are not limited
+type Limits struct {
+	limiters   map[string]*Limiter
+	trustProxy bool
+}
+
+// NewLimits - creates limits for given groups, X-Forwarded-For is used as client address only when trustProxy is set
+func NewLimits(groups map[string]Limit, trustProxy bool) *Limits {
+	limits := &Limits{limiters: map[string]*Limiter{}, trustProxy: trustProxy}
+	for group, limit := range groups {
+		limits.limiters[group] = NewLimiter(limit)
+	}
+	return limits
+}
+
+// NewLimitsFromEnv - reads RATE_LIMIT_AUTH, RATE_LIMIT_READ, RATE_LIMIT_WRITE and RATE_LIMIT_BATCH,
+// value off disables limiting of the group, RATE_LIMIT_TRUST_PROXY=true enables X-Forwarded-For
+func NewLimitsFromEnv() (*Limits, error) {
+	groups := map[string]Limit{}
+	for group, defaultValue := range defaultLimits {
+		value := os.Getenv("RATE_LIMIT_" + strings.ToUpper(group))
+		if value == "" {
+			value = defaultValue
+		}
+		if value == "off" {
+			continue
+		}
+		limit, err := ParseLimit(value)
+		if err != nil {
+			return nil, err
+		}
+		groups[group] = limit
+	}
+	return NewLimits(groups, os.Getenv("RATE_LIMIT_TRUST_PROXY") == "true"), nil
+}
+
+// ClientIP - returns address of client, first X-Forwarded-For address when proxy is trusted
+func (limits *Limits) ClientIP(r *http.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); limits.trustProxy && forwarded != "" {
+		return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ByClientIP - key function counting requests per client address
+func (limits *Limits) ByClientIP() KeyFunc {
+	return func(r *http.Request) string {
+		return "ip:" + limits.ClientIP(r)
+	}
+}
+
+// ByUser - key function counting requests per authenticated user, falling back to client address
+func (limits *Limits) ByUser(userFromRequest func(r *http.Request) (string, bool)) KeyFunc {
+	return func(r *http.Request) string {
+		if username, ok := userFromRequest(r); ok {
+			return "user:" + username
+		}
+		return "ip:" + limits.ClientIP(r)
+	}
+}
+
+// Handler - rejects requests over limit of group with 429 and Retry-After header
+func (limits *Limits) Handler(group string, key KeyFunc, next http.Handler) http.Handler {
+	limiter, ok := limits.limiters[group]
+	if !ok {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowed, remaining, wait := limiter.Allow(key(r))
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limiter.limit.Burst))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		if !allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
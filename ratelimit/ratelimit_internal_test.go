@@ -0,0 +1,134 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeClock struct {
+	current time.Time
+}
+
+func (clock *fakeClock) now() time.Time {
+	return clock.current
+}
+
+func TestParseLimit(t *testing.T) {
+	testTable := []struct {
+		value         string
+		expected      Limit
+		expectedError bool
+	}{
+		{"60/1m", Limit{Burst: 60, Period: time.Minute}, false},
+		{"5/10s", Limit{Burst: 5, Period: 10 * time.Second}, false},
+		{"60", Limit{}, true},
+		{"0/1m", Limit{}, true},
+		{"5/minute", Limit{}, true},
+	}
+
+	for _, testCase := range testTable {
+		limit, err := ParseLimit(testCase.value)
+
+		assert.Equal(t, testCase.expected, limit)
+		assert.Equal(t, testCase.expectedError, err != nil, testCase.value)
+	}
+}
+
+func TestLimiterRefillsTokens(t *testing.T) {
+	clock := &fakeClock{current: time.Now()}
+	limiter := NewLimiter(Limit{Burst: 2, Period: 10 * time.Second})
+	limiter.now = clock.now
+
+	allowed, remaining, _ := limiter.Allow("user")
+	assert.True(t, allowed)
+	assert.Equal(t, 1, remaining)
+	allowed, _, _ = limiter.Allow("user")
+	assert.True(t, allowed)
+	allowed, _, wait := limiter.Allow("user")
+	assert.False(t, allowed)
+	assert.Equal(t, 5*time.Second, wait)
+
+	allowed, _, _ = limiter.Allow("other")
+	assert.True(t, allowed)
+
+	clock.current = clock.current.Add(5 * time.Second)
+	allowed, remaining, _ = limiter.Allow("user")
+	assert.True(t, allowed)
+	assert.Equal(t, 0, remaining)
+}
+
+func TestLimiterSweepsIdleBuckets(t *testing.T) {
+	clock := &fakeClock{current: time.Now()}
+	limiter := NewLimiter(Limit{Burst: 1, Period: time.Second})
+	limiter.now = clock.now
+	limiter.lastSweep = clock.current
+
+	limiter.Allow("first")
+	clock.current = clock.current.Add(2 * sweepInterval)
+	limiter.Allow("second")
+
+	assert.Len(t, limiter.buckets, 1)
+	assert.Contains(t, limiter.buckets, "second")
+}
+
+func TestHandler(t *testing.T) {
+	limits := NewLimits(map[string]Limit{GroupBatch: {Burst: 1, Period: time.Minute}}, false)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	userFromRequest := func(r *http.Request) (string, bool) {
+		username := r.Header.Get("User")
+		return username, username != ""
+	}
+	handler := limits.Handler(GroupBatch, limits.ByUser(userFromRequest), next)
+
+	testTable := []struct {
+		user           string
+		remoteAddr     string
+		expectedStatus int
+	}{
+		{"first", "10.0.0.1:1234", http.StatusOK},
+		{"first", "10.0.0.2:1234", http.StatusTooManyRequests},
+		{"second", "10.0.0.1:1234", http.StatusOK},
+		{"", "10.0.0.1:1234", http.StatusOK},
+		{"", "10.0.0.1:4321", http.StatusTooManyRequests},
+	}
+
+	for _, testCase := range testTable {
+		req, _ := http.NewRequest("POST", "/aws/execution/batch", nil)
+		req.Header.Set("User", testCase.user)
+		req.RemoteAddr = testCase.remoteAddr
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, testCase.expectedStatus, rr.Code)
+		if testCase.expectedStatus == http.StatusTooManyRequests {
+			assert.Equal(t, "60", rr.Header().Get("Retry-After"))
+		}
+	}
+}
+
+func TestHandlerWithoutLimit(t *testing.T) {
+	limits := NewLimits(map[string]Limit{}, false)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler := limits.Handler(GroupRead, limits.ByClientIP(), next)
+
+	for i := 0; i < 3; i++ {
+		req, _ := http.NewRequest("GET", "/aws/machines", nil)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/login", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Forwarded-For", "192.168.1.1, 10.0.0.5")
+
+	assert.Equal(t, "10.0.0.1", NewLimits(nil, false).ClientIP(req))
+	assert.Equal(t, "192.168.1.1", NewLimits(nil, true).ClientIP(req))
+}
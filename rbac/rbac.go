@@ -0,0 +1,139 @@
+package rbac
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+)
+
+// roles which can be granted to users
+const (
+	RoleViewer   = "viewer"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+)
+
+// permissions required by routes
+const (
+	PermissionRead    = "read"
+	PermissionExecute = "execute"
+	PermissionAdmin   = "admin"
+)
+
+// rolePermissions - permissions included in every role
+var rolePermissions = map[string][]string{
+	RoleViewer:   {PermissionRead},
+	RoleOperator: {PermissionRead, PermissionExecute},
+	RoleAdmin:    {PermissionRead, PermissionExecute, PermissionAdmin},
+}
+
+// Grant - role granted on machines with ARN matching Machine glob in regions matching Region glob,
+// empty globs match everything
+type Grant struct {
+	Role    string `json:"role" dynamodbav:"role"`
+	Machine string `json:"machine,omitempty" dynamodbav:"machine,omitempty"`
+	Region  string `json:"region,omitempty" dynamodbav:"region,omitempty"`
+	// RequireMFA - grant applies only to sessions which passed multi-factor authentication
+	RequireMFA bool `json:"requireMfa,omitempty" dynamodbav:"requireMfa,omitempty"`
+}
+
+// ValidRole - checks if role is one of known roles
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// Allows - checks if grant includes permission on machine in region, empty machine or region means any
+func (grant Grant) Allows(permission string, machine string, region string) bool {
+	if !hasPermission(grant.Role, permission) {
+		return false
+	}
+	if region != "" && !matches(grant.Region, region) {
+		return false
+	}
+	return machine == "" || matches(grant.Machine, machine)
+}
+
+// Allowed - checks if any of grants includes permission on machine in region
+func Allowed(grants []Grant, permission string, machine string, region string) bool {
+	for _, grant := range grants {
+		if grant.Allows(permission, machine, region) {
+			return true
+		}
+	}
+	return false
+}
+
+// EffectiveGrants - returns stored grants of user, admin grant for users listed in ADMIN_USERS
+// and RBAC_DEFAULT_ROLE on everything for users without any grant, users get no access when it is not set
+func EffectiveGrants(username string, grants []Grant) []Grant {
+	effective := append([]Grant{}, grants...)
+	for _, admin := range strings.Split(os.Getenv("ADMIN_USERS"), ",") {
+		if username != "" && strings.TrimSpace(admin) == username {
+			effective = append(effective, Grant{Role: RoleAdmin})
+		}
+	}
+	if len(effective) == 0 {
+		if defaultRole := os.Getenv("RBAC_DEFAULT_ROLE"); ValidRole(defaultRole) {
+			effective = append(effective, Grant{Role: defaultRole})
+		}
+	}
+	return effective
+}
+
+// WithoutMFA - drops grants requiring multi-factor authentication from grants of session which didn't pass it
+func WithoutMFA(grants []Grant) []Grant {
+	allowed := []Grant{}
+	for _, grant := range grants {
+		if !grant.RequireMFA {
+			allowed = append(allowed, grant)
+		}
+	}
+	return allowed
+}
+
+// GrantsFromClaim - decodes grants stored in JWT claim
+func GrantsFromClaim(claim interface{}) []Grant {
+	grants := []Grant{}
+	encoded, err := json.Marshal(claim)
+	if err != nil {
+		return grants
+	}
+	json.Unmarshal(encoded, &grants)
+	return grants
+}
+
+type contextKey string
+
+const grantsKey contextKey = "grants"
+
+// WithGrants - returns context carrying grants of authenticated user
+func WithGrants(ctx context.Context, grants []Grant) context.Context {
+	return context.WithValue(ctx, grantsKey, grants)
+}
+
+// GrantsFromContext - returns grants of authenticated user, false when permissions are not checked
+func GrantsFromContext(ctx context.Context) ([]Grant, bool) {
+	grants, ok := ctx.Value(grantsKey).([]Grant)
+	return grants, ok
+}
+
+func hasPermission(role string, permission string) bool {
+	for _, granted := range rolePermissions[role] {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// matches - matches value against glob like arn:aws:states:*:*:stateMachine:orders-*, * matches / as well
+func matches(pattern string, value string) bool {
+	if pattern == "" || pattern == "*" {
+		return true
+	}
+	matched, err := path.Match(strings.ReplaceAll(pattern, "/", "\x00"), strings.ReplaceAll(value, "/", "\x00"))
+	return err == nil && matched
+}
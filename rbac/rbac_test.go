@@ -0,0 +1,110 @@
+package rbac_test
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"sfr-backend/rbac"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllowed(t *testing.T) {
+	orders := "arn:aws:states:eu-west-1:123456789012:stateMachine:orders-import"
+	billing := "arn:aws:states:us-east-1:123456789012:stateMachine:billing"
+	grants := []rbac.Grant{
+		{Role: rbac.RoleOperator, Machine: "arn:aws:states:*:*:stateMachine:orders-*"},
+		{Role: rbac.RoleViewer, Region: "us-*"},
+	}
+	testTable := []struct {
+		permission string
+		machine    string
+		region     string
+		expected   bool
+	}{
+		{rbac.PermissionExecute, orders, "eu-west-1", true},
+		{rbac.PermissionRead, orders, "eu-west-1", true},
+		{rbac.PermissionExecute, billing, "us-east-1", false},
+		{rbac.PermissionRead, billing, "us-east-1", true},
+		{rbac.PermissionRead, "arn:aws:states:eu-west-1:123456789012:stateMachine:billing", "eu-west-1", false},
+		{rbac.PermissionRead, "", "eu-west-1", true},
+		{rbac.PermissionAdmin, "", "", false},
+	}
+
+	for _, testCase := range testTable {
+		assert.Equal(t, testCase.expected, rbac.Allowed(grants, testCase.permission, testCase.machine, testCase.region), testCase)
+	}
+}
+
+func TestEffectiveGrants(t *testing.T) {
+	os.Setenv("ADMIN_USERS", "root, admin")
+	os.Setenv("RBAC_DEFAULT_ROLE", rbac.RoleViewer)
+	defer os.Unsetenv("ADMIN_USERS")
+	defer os.Unsetenv("RBAC_DEFAULT_ROLE")
+	stored := []rbac.Grant{{Role: rbac.RoleOperator, Machine: "machine"}}
+
+	assert.Equal(t, stored, rbac.EffectiveGrants("user", stored))
+	assert.Equal(t, []rbac.Grant{{Role: rbac.RoleViewer}}, rbac.EffectiveGrants("user", nil))
+	assert.Equal(t, []rbac.Grant{{Role: rbac.RoleAdmin}}, rbac.EffectiveGrants("admin", nil))
+
+	// without default role users get access only through grants
+	os.Unsetenv("RBAC_DEFAULT_ROLE")
+	assert.Empty(t, rbac.EffectiveGrants("user", nil))
+	assert.Empty(t, rbac.EffectiveGrants("user", []rbac.Grant{}))
+}
+
+func TestWithoutMFA(t *testing.T) {
+	grants := []rbac.Grant{{Role: rbac.RoleViewer}, {Role: rbac.RoleOperator, Region: "us-east-1", RequireMFA: true}}
+
+	assert.Equal(t, []rbac.Grant{{Role: rbac.RoleViewer}}, rbac.WithoutMFA(grants))
+	assert.Empty(t, rbac.WithoutMFA(grants[1:]))
+}
+
+func TestGrantsFromClaim(t *testing.T) {
+	claim := []interface{}{map[string]interface{}{"role": "viewer", "region": "eu-west-1"}}
+
+	assert.Equal(t, []rbac.Grant{{Role: rbac.RoleViewer, Region: "eu-west-1"}}, rbac.GrantsFromClaim(claim))
+	assert.Empty(t, rbac.GrantsFromClaim(nil))
+}
+
+func TestMachineOfExecution(t *testing.T) {
+	assert.Equal(t, "arn:aws:states:eu-west-1:123456789012:stateMachine:orders",
+		rbac.MachineOfExecution("arn:aws:states:eu-west-1:123456789012:execution:orders:run-1"))
+	assert.Equal(t, "invalid", rbac.MachineOfExecution("invalid"))
+}
+
+func TestBaseMachine(t *testing.T) {
+	machine := "arn:aws:states:eu-west-1:123456789012:stateMachine:orders"
+	assert.Equal(t, machine, rbac.BaseMachine(machine))
+	assert.Equal(t, machine, rbac.BaseMachine(machine+":3"))
+	assert.Equal(t, machine, rbac.BaseMachine(machine+":prod"))
+	assert.Equal(t, "invalid", rbac.BaseMachine("invalid"))
+}
+
+func TestResolvers(t *testing.T) {
+	machine := "arn:aws:states:eu-west-1:123456789012:stateMachine:orders"
+	execution := "arn:aws:states:us-east-1:123456789012:execution:billing:run-1"
+	body := `machine=` + machine + `&executions=["` + execution + `"]`
+	req, _ := http.NewRequest("POST", "/aws/execution/batch?region=us-west-2", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req = mux.SetURLVars(req, map[string]string{"execution": execution})
+
+	targets := rbac.All(
+		rbac.MachineForm(rbac.PermissionExecute, "machine"),
+		rbac.ExecutionsForm(rbac.PermissionRead, "executions"),
+		rbac.ExecutionVar(rbac.PermissionRead, "execution"),
+		rbac.MachineQuery(rbac.PermissionRead, "machine"),
+		rbac.Anywhere(rbac.PermissionRead),
+	)(req)
+
+	assert.Equal(t, []rbac.Target{
+		{Permission: rbac.PermissionExecute, Machine: machine, Region: "eu-west-1"},
+		{Permission: rbac.PermissionRead, Machine: "arn:aws:states:us-east-1:123456789012:stateMachine:billing", Region: "us-east-1"},
+		{Permission: rbac.PermissionRead, Machine: "arn:aws:states:us-east-1:123456789012:stateMachine:billing", Region: "us-east-1"},
+		{Permission: rbac.PermissionRead, Machine: "-", Region: "us-west-2"},
+		{Permission: rbac.PermissionRead, Region: "us-west-2"},
+	}, targets)
+}
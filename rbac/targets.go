@@ -0,0 +1,129 @@
+package rbac
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"sfr-backend/region"
+
+	"github.com/gorilla/mux"
+)
+
+// Target - permission required on machine, empty machine requires permission on any machine in region
+type Target struct {
+	Permission string
+	Machine    string
+	Region     string
+}
+
+// Resolver - returns targets request needs permissions on
+type Resolver func(r *http.Request) []Target
+
+// Anywhere - requires permission on any machine in requested region
+func Anywhere(permission string) Resolver {
+	return func(r *http.Request) []Target {
+		return []Target{{Permission: permission, Region: region.GetDefaultRegion(r)}}
+	}
+}
+
+// AnyRegion - requires permission on any machine in any region
+func AnyRegion(permission string) Resolver {
+	return func(r *http.Request) []Target {
+		return []Target{{Permission: permission}}
+	}
+}
+
+// MachineVar - requires permission on machine ARN in path variable
+func MachineVar(permission string, name string) Resolver {
+	return func(r *http.Request) []Target {
+		return []Target{machineTarget(r, permission, mux.Vars(r)[name])}
+	}
+}
+
+// MachineQuery - requires permission on machine ARN in query param
+func MachineQuery(permission string, name string) Resolver {
+	return func(r *http.Request) []Target {
+		return []Target{machineTarget(r, permission, r.URL.Query().Get(name))}
+	}
+}
+
+// MachineForm - requires permission on machine ARN in form value
+func MachineForm(permission string, name string) Resolver {
+	return func(r *http.Request) []Target {
+		return []Target{machineTarget(r, permission, BaseMachine(r.FormValue(name)))}
+	}
+}
+
+// ExecutionVar - requires permission on machine of execution ARN in path variable
+func ExecutionVar(permission string, name string) Resolver {
+	return func(r *http.Request) []Target {
+		return []Target{machineTarget(r, permission, MachineOfExecution(mux.Vars(r)[name]))}
+	}
+}
+
+// ExecutionForm - requires permission on machine of execution ARN in form value
+func ExecutionForm(permission string, name string) Resolver {
+	return func(r *http.Request) []Target {
+		return []Target{machineTarget(r, permission, MachineOfExecution(r.FormValue(name)))}
+	}
+}
+
+// ExecutionsForm - requires permission on machines of all execution ARNs in JSON list form value
+func ExecutionsForm(permission string, name string) Resolver {
+	return func(r *http.Request) []Target {
+		var executions []string
+		if err := json.Unmarshal([]byte(r.FormValue(name)), &executions); err != nil {
+			return nil
+		}
+		targets := []Target{}
+		for _, execution := range executions {
+			targets = append(targets, machineTarget(r, permission, MachineOfExecution(execution)))
+		}
+		return targets
+	}
+}
+
+// All - requires targets of all resolvers
+func All(resolvers ...Resolver) Resolver {
+	return func(r *http.Request) []Target {
+		targets := []Target{}
+		for _, resolver := range resolvers {
+			targets = append(targets, resolver(r)...)
+		}
+		return targets
+	}
+}
+
+// MachineOfExecution - returns state machine ARN of execution ARN,
+// arn:aws:states:region:account:execution:machine:name belongs to arn:aws:states:region:account:stateMachine:machine
+func MachineOfExecution(executionArn string) string {
+	parts := strings.Split(executionArn, ":")
+	if len(parts) < 8 || parts[5] != "execution" {
+		return executionArn
+	}
+	return strings.Join([]string{parts[0], parts[1], parts[2], parts[3], parts[4], "stateMachine", parts[6]}, ":")
+}
+
+// BaseMachine - returns state machine ARN without version or alias qualifier,
+// arn:aws:states:region:account:stateMachine:machine:3 and ...:stateMachine:machine:prod belong to ...:stateMachine:machine
+func BaseMachine(machineArn string) string {
+	parts := strings.Split(machineArn, ":")
+	if len(parts) < 8 || parts[5] != "stateMachine" {
+		return machineArn
+	}
+	return strings.Join(parts[:7], ":")
+}
+
+// machineTarget - target region is taken from machine ARN, request region is used for other values
+func machineTarget(r *http.Request, permission string, machine string) Target {
+	target := Target{Permission: permission, Machine: machine, Region: region.GetDefaultRegion(r)}
+	if parts := strings.Split(machine, ":"); len(parts) > 3 && parts[0] == "arn" {
+		target.Region = parts[3]
+	}
+	if machine == "" {
+		// missing machine must not turn into permission on any machine
+		target.Machine = "-"
+	}
+	return target
+}
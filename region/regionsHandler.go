@@ -18,6 +18,16 @@ func GetDefaultRegion(r *http.Request) string {
 	return "us-east-1"
 }
 
+// Known - checks if id is region of any partition in SDK endpoints list
+func Known(id string) bool {
+	for _, p := range endpoints.DefaultResolver().(endpoints.EnumPartitions).Partitions() {
+		if _, ok := p.Regions()[id]; ok {
+			return true
+		}
+	}
+	return false
+}
+
 // GetRegionsHandler - returns list of all aws regions
 func GetRegionsHandler(w http.ResponseWriter, r *http.Request) {
 	regionList := []string{}
@@ -0,0 +1,103 @@
+package requestbody
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	errHandler "sfr-backend/error"
+)
+
+// MaxBytes - largest accepted body, JSON or form encoded
+const MaxBytes = 1 << 20
+
+// codes of rejected bodies
+const (
+	CodeInvalidBody  = "InvalidBody"
+	CodeBodyTooLarge = "BodyTooLarge"
+)
+
+// Body - typed JSON body of endpoint which historically accepted form values
+type Body interface {
+	// Form - validates body and returns the same values form encoded request would have
+	Form() (url.Values, error)
+}
+
+// Decode - lets next handler accept application/json body besides form encoding. JSON is decoded strictly into
+// body created by newBody, validated and exposed as r.Form and r.PostForm, so handlers and permission resolvers
+// reading form values work with both encodings.
+func Decode(newBody func() Body, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, MaxBytes)
+		if !IsJSON(r) {
+			if err := r.ParseForm(); err != nil {
+				writeBodyError(w, err)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		body := newBody()
+		if err := decodeStrict(r.Body, body); err != nil {
+			writeBodyError(w, err)
+			return
+		}
+		values, err := body.Form()
+		if err != nil {
+			writeBodyError(w, err)
+			return
+		}
+		r.Form = r.URL.Query()
+		for name, value := range values {
+			r.Form[name] = value
+		}
+		r.PostForm = values
+		next.ServeHTTP(w, r)
+	})
+}
+
+// IsJSON - request declares application/json body
+func IsJSON(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/json"
+}
+
+// decodeStrict - decodes single JSON value without unknown fields
+func decodeStrict(reader io.Reader, body Body) error {
+	decoder := json.NewDecoder(reader)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(body); err != nil {
+		return err
+	}
+	if decoder.Decode(&json.RawMessage{}) != io.EOF {
+		return errors.New("body has to contain single JSON value")
+	}
+	return nil
+}
+
+// writeBodyError - responds with 413 when body exceeded MaxBytes, otherwise with 400
+func writeBodyError(w http.ResponseWriter, err error) {
+	// http.MaxBytesReader reports the limit only by message
+	if strings.Contains(err.Error(), "request body too large") {
+		errHandler.HandleError(w, errHandler.New(http.StatusRequestEntityTooLarge, CodeBodyTooLarge, "body is larger than 1 MiB"))
+		return
+	}
+	errHandler.HandleError(w, errHandler.New(http.StatusBadRequest, CodeInvalidBody, err.Error()))
+}
+
+// JSONString - returns JSON value as string, JSON strings are unquoted so both {"a": 1} and "{\"a\": 1}" give {"a": 1},
+// missing value gives empty string
+func JSONString(value json.RawMessage) string {
+	if len(value) == 0 || string(value) == "null" {
+		return ""
+	}
+	var unquoted string
+	if err := json.Unmarshal(value, &unquoted); err == nil {
+		return unquoted
+	}
+	return string(value)
+}
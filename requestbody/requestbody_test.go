@@ -0,0 +1,92 @@
+package requestbody_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	errHandler "sfr-backend/error"
+	"sfr-backend/requestbody"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testBody struct {
+	Machine string `json:"machine"`
+}
+
+func (body *testBody) Form() (url.Values, error) {
+	return url.Values{"machine": {body.Machine}}, nil
+}
+
+// decode - serves request through Decode, returns recorder and form seen by handler
+func decode(contentType string, target string, body string) (*httptest.ResponseRecorder, url.Values) {
+	var form url.Values
+	handler := requestbody.Decode(func() requestbody.Body { return &testBody{} }, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		form = url.Values{"machine": {r.FormValue("machine")}, "region": {r.FormValue("region")}}
+	}))
+	req := httptest.NewRequest("POST", target, strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr, form
+}
+
+func TestDecode(t *testing.T) {
+	testTable := []struct {
+		contentType  string
+		body         string
+		expectedForm url.Values
+	}{
+		{"application/json", `{"machine": "json"}`, url.Values{"machine": {"json"}, "region": {"eu-west-1"}}},
+		{"application/json; charset=utf-8", `{"machine": "json"}`, url.Values{"machine": {"json"}, "region": {"eu-west-1"}}},
+		{"application/x-www-form-urlencoded", "machine=form", url.Values{"machine": {"form"}, "region": {"eu-west-1"}}},
+	}
+
+	for _, testCase := range testTable {
+		rr, form := decode(testCase.contentType, "/?region=eu-west-1", testCase.body)
+		assert.Equal(t, http.StatusOK, rr.Code, testCase.contentType)
+		assert.Equal(t, testCase.expectedForm, form, testCase.contentType)
+	}
+}
+
+func TestDecodeRejectsBody(t *testing.T) {
+	testTable := []struct {
+		body           string
+		expectedStatus int
+		expectedCode   string
+	}{
+		{`{"machine": "json", "unknown": true}`, http.StatusBadRequest, requestbody.CodeInvalidBody},
+		{`{"machine": "json"} {"machine": "other"}`, http.StatusBadRequest, requestbody.CodeInvalidBody},
+		{`["machine"]`, http.StatusBadRequest, requestbody.CodeInvalidBody},
+		{`{"machine": "` + strings.Repeat("a", requestbody.MaxBytes) + `"}`, http.StatusRequestEntityTooLarge, requestbody.CodeBodyTooLarge},
+	}
+
+	for _, testCase := range testTable {
+		rr, form := decode("application/json", "/", testCase.body)
+		assert.Equal(t, testCase.expectedStatus, rr.Code)
+		assert.Nil(t, form)
+		var problem errHandler.Problem
+		json.NewDecoder(rr.Body).Decode(&problem)
+		assert.Equal(t, testCase.expectedCode, problem.Code)
+	}
+}
+
+func TestJSONString(t *testing.T) {
+	testTable := []struct {
+		value    string
+		expected string
+	}{
+		{`{"a": 1}`, `{"a": 1}`},
+		{`"{\"a\": 1}"`, `{"a": 1}`},
+		{`null`, ``},
+		{``, ``},
+	}
+
+	for _, testCase := range testTable {
+		assert.Equal(t, testCase.expected, requestbody.JSONString(json.RawMessage(testCase.value)))
+	}
+}
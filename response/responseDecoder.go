@@ -14,8 +14,20 @@ func WriteResponse(w http.ResponseWriter, result interface{}) {
 
 	js, err := json.Marshal(result)
 	if err != nil {
-		error.HandleError(w, err)
+		error.HandleError(w, &error.Error{Status: http.StatusInternalServerError, Code: error.CodeInternal, Message: err.Error(), Err: err})
 		return
 	}
 	w.Write(js)
 }
+
+// WriteResponseWithStatus - Writes response encoded as json with given status code
+func WriteResponseWithStatus(w http.ResponseWriter, status int, result interface{}) {
+	js, err := json.Marshal(result)
+	if err != nil {
+		error.HandleError(w, &error.Error{Status: http.StatusInternalServerError, Code: error.CodeInternal, Message: err.Error(), Err: err})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(js)
+}
@@ -1,10 +1,11 @@
 package response_test
 
 import (
-	"bytes"
 	"encoding/json"
 	"math"
+	"net/http"
 	"net/http/httptest"
+	errHandler "sfr-backend/error"
 	"sfr-backend/response"
 	"testing"
 
@@ -28,10 +29,9 @@ func TestWriteResponseWithError(t *testing.T) {
 	_, error := json.Marshal(errorProne)
 	response.WriteResponse(rr, errorProne)
 
-	var b bytes.Buffer
-	b.Write([]byte(error.Error()))
-	//Adding new line becouse buffer is flushing in WriteResponse
-	b.WriteString("\n")
-
-	assert.Equal(t, &b, rr.Body)
+	var problem errHandler.Problem
+	json.NewDecoder(rr.Body).Decode(&problem)
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Equal(t, error.Error(), problem.Detail)
+	assert.Equal(t, errHandler.CodeInternal, problem.Code)
 }
@@ -0,0 +1,141 @@
+package revocation
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrRevoked - token or its family was revoked
+	ErrRevoked = errors.New("token was revoked")
+	// ErrReused - refresh token was already exchanged, its family is revoked
+	ErrReused = errors.New("refresh token was already used")
+)
+
+// Store - revoked token ids and token families, entries are needed only until tokens they revoke expire
+type Store interface {
+	// Revoke - marks id as revoked until expiresAt, returns ErrRevoked when it already is revoked
+	Revoke(ctx context.Context, id string, expiresAt time.Time) error
+	IsRevoked(ctx context.Context, id string) (bool, error)
+}
+
+var store Store = NewMemoryStore()
+
+// SetStore - sets storage of revoked tokens
+func SetStore(revocationStore Store) {
+	store = revocationStore
+}
+
+// NewID - random id of token or token family
+func NewID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// RevokeToken - revokes single token until it expires
+func RevokeToken(ctx context.Context, id string, expiresAt time.Time) error {
+	return ignoreRevoked(store.Revoke(ctx, tokenKey(id), expiresAt))
+}
+
+// RevokeFamily - revokes all tokens issued since login, expiresAt has to be after expiration of the last of them
+func RevokeFamily(ctx context.Context, family string, expiresAt time.Time) error {
+	return ignoreRevoked(store.Revoke(ctx, familyKey(family), expiresAt))
+}
+
+// UseToken - marks single use token as used, returns ErrRevoked when it was used before
+func UseToken(ctx context.Context, id string, expiresAt time.Time) error {
+	return store.Revoke(ctx, tokenKey(id), expiresAt)
+}
+
+// Check - returns ErrRevoked when token or its family was revoked
+func Check(ctx context.Context, id string, family string) error {
+	for _, key := range []string{tokenKey(id), familyKey(family)} {
+		revoked, err := store.IsRevoked(ctx, key)
+		if err != nil {
+			return err
+		}
+		if revoked {
+			return ErrRevoked
+		}
+	}
+	return nil
+}
+
+// UseRefreshToken - marks refresh token as used, so it can be exchanged only once. Second use means the token
+// leaked, whole family is revoked until familyExpiresAt and ErrReused is returned.
+func UseRefreshToken(ctx context.Context, id string, family string, expiresAt time.Time, familyExpiresAt time.Time) error {
+	revoked, err := store.IsRevoked(ctx, familyKey(family))
+	if err != nil {
+		return err
+	}
+	if revoked {
+		return ErrRevoked
+	}
+	err = store.Revoke(ctx, tokenKey(id), expiresAt)
+	if err != ErrRevoked {
+		return err
+	}
+	log.Warn("Refresh token of family ", family, " was used twice, revoking family")
+	if err := RevokeFamily(ctx, family, familyExpiresAt); err != nil {
+		return err
+	}
+	return ErrReused
+}
+
+func tokenKey(id string) string {
+	return "token#" + id
+}
+
+func familyKey(family string) string {
+	return "family#" + family
+}
+
+func ignoreRevoked(err error) error {
+	if err == ErrRevoked {
+		return nil
+	}
+	return err
+}
+
+// MemoryStore - revocations kept in memory, not shared by instances and lost on restart
+type MemoryStore struct {
+	mutex   sync.Mutex
+	revoked map[string]time.Time
+}
+
+// NewMemoryStore - creates empty memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{revoked: map[string]time.Time{}}
+}
+
+// Revoke - stores id until expiresAt, expired entries are dropped on every call
+func (memoryStore *MemoryStore) Revoke(ctx context.Context, id string, expiresAt time.Time) error {
+	memoryStore.mutex.Lock()
+	defer memoryStore.mutex.Unlock()
+	now := time.Now()
+	for key, expiration := range memoryStore.revoked {
+		if expiration.Before(now) {
+			delete(memoryStore.revoked, key)
+		}
+	}
+	if _, ok := memoryStore.revoked[id]; ok {
+		return ErrRevoked
+	}
+	memoryStore.revoked[id] = expiresAt
+	return nil
+}
+
+// IsRevoked - checks if id is stored and not expired
+func (memoryStore *MemoryStore) IsRevoked(ctx context.Context, id string) (bool, error) {
+	memoryStore.mutex.Lock()
+	defer memoryStore.mutex.Unlock()
+	expiration, ok := memoryStore.revoked[id]
+	return ok && expiration.After(time.Now()), nil
+}
@@ -0,0 +1,57 @@
+package revocation_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"sfr-backend/revocation"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRevokeToken(t *testing.T) {
+	revocation.SetStore(revocation.NewMemoryStore())
+	expiresAt := time.Now().Add(time.Hour)
+
+	assert.Nil(t, revocation.Check(context.Background(), "token", "family"))
+	assert.Nil(t, revocation.RevokeToken(context.Background(), "token", expiresAt))
+	assert.Nil(t, revocation.RevokeToken(context.Background(), "token", expiresAt))
+	assert.Equal(t, revocation.ErrRevoked, revocation.Check(context.Background(), "token", "family"))
+	assert.Nil(t, revocation.Check(context.Background(), "other", "family"))
+
+	assert.Nil(t, revocation.RevokeFamily(context.Background(), "family", expiresAt))
+	assert.Equal(t, revocation.ErrRevoked, revocation.Check(context.Background(), "other", "family"))
+}
+
+func TestUseRefreshToken(t *testing.T) {
+	revocation.SetStore(revocation.NewMemoryStore())
+	expiresAt := time.Now().Add(time.Hour)
+
+	assert.Nil(t, revocation.UseRefreshToken(context.Background(), "first", "family", expiresAt, expiresAt))
+	assert.Nil(t, revocation.UseRefreshToken(context.Background(), "second", "family", expiresAt, expiresAt))
+	// replaying first token revokes tokens issued by rotation as well
+	assert.Equal(t, revocation.ErrReused, revocation.UseRefreshToken(context.Background(), "first", "family", expiresAt, expiresAt))
+	assert.Equal(t, revocation.ErrRevoked, revocation.Check(context.Background(), "third", "family"))
+	assert.Equal(t, revocation.ErrRevoked, revocation.UseRefreshToken(context.Background(), "third", "family", expiresAt, expiresAt))
+}
+
+func TestUseToken(t *testing.T) {
+	revocation.SetStore(revocation.NewMemoryStore())
+	expiresAt := time.Now().Add(time.Hour)
+
+	assert.Nil(t, revocation.UseToken(context.Background(), "challenge", expiresAt))
+	assert.Equal(t, revocation.ErrRevoked, revocation.UseToken(context.Background(), "challenge", expiresAt))
+	assert.Nil(t, revocation.UseToken(context.Background(), "other", expiresAt))
+}
+
+func TestMemoryStoreExpiration(t *testing.T) {
+	memoryStore := revocation.NewMemoryStore()
+
+	assert.Nil(t, memoryStore.Revoke(context.Background(), "expired", time.Now().Add(-time.Second)))
+	revoked, _ := memoryStore.IsRevoked(context.Background(), "expired")
+	assert.False(t, revoked)
+	assert.Nil(t, memoryStore.Revoke(context.Background(), "expired", time.Now().Add(time.Hour)))
+	revoked, _ = memoryStore.IsRevoked(context.Background(), "expired")
+	assert.True(t, revoked)
+}
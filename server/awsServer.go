@@ -1,18 +1,28 @@
 package server
 
 import (
-	"fmt"
+	"context"
 	"net/http"
 	"os"
-	"strings"
 
+	"sfr-backend/apikey"
+	"sfr-backend/approval"
+	"sfr-backend/audit"
 	"sfr-backend/authentication"
 	awsprovider "sfr-backend/awsProvider"
+	"sfr-backend/emulator"
 	"sfr-backend/execution"
+	"sfr-backend/failure"
 	"sfr-backend/healthcheck"
+	"sfr-backend/logging"
 	"sfr-backend/machine"
+	"sfr-backend/metrics"
+	"sfr-backend/ratelimit"
+	"sfr-backend/rbac"
 	"sfr-backend/region"
+	"sfr-backend/response"
 	"sfr-backend/tid"
+	"sfr-backend/tracing"
 
 	"github.com/gorilla/mux"
 	log "github.com/sirupsen/logrus"
@@ -22,95 +32,194 @@ import (
 func CORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		tid := tid.GetTid(r)
-		requestLogger := log.WithFields(log.Fields{"transaction_id": tid})
 		// Set headers
 		w.Header().Set("Access-Control-Allow-Origin", os.Getenv("BASE_URL"))
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PATCH, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, Cache-Control, X-API-Key, Idempotency-Key")
+		w.Header().Set("Access-Control-Expose-Headers", "Retry-After, X-RateLimit-Limit, X-RateLimit-Remaining, X-Request-ID")
 		r.Header.Add("X-Request-ID", tid)
+		// clients report it with errors, problem documents contain it as well
+		w.Header().Set("X-Request-ID", tid)
 
+		requestLogger := logging.FromRequest(r)
 		if r.Method == "OPTIONS" {
 			requestLogger.Info("OPTIONS operation received, will send response and end...")
 			w.WriteHeader(http.StatusOK)
 			return
 		}
-		requestLogger.Info("Operation received, will process operation")
-		requestLogger.Info(formatRequest(r))
+		// credentials and execution inputs are redacted
+		requestLogger.WithFields(logging.RequestFields(r)).Info("Operation received, will process operation")
 		next.ServeHTTP(w, r)
 		return
 	})
 }
 
-func formatRequest(r *http.Request) string {
-	var request []string
-	url := fmt.Sprintf("%v %v %v", r.Method, r.URL, r.Proto)
-	request = append(request, url)
-	request = append(request, fmt.Sprintf("Host: %v", r.Host))
-	for name, headers := range r.Header {
-		name = strings.ToLower(name)
-		for _, h := range headers {
-			request = append(request, fmt.Sprintf("%v: %v", name, h))
-		}
+// StepFunctionsProviderFromEnv - returns in memory emulator when STEP_FUNCTIONS_PROVIDER is set to emulator,
+// otherwise real AWS provider. Running executions of emulator are aborted when ctx is cancelled.
+func StepFunctionsProviderFromEnv(ctx context.Context) (awsprovider.AwsStepFunctionsProvider, error) {
+	if os.Getenv("STEP_FUNCTIONS_PROVIDER") != "emulator" {
+		return withCache(awsprovider.NewInstrumentedStepFunctionsProvider(&awsprovider.AwsStepFunctionsRealProvider{})), nil
+	}
+	emulatorInstance, err := emulator.NewFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	log.Warn("Using in memory Step Functions emulator, executions are not sent to AWS")
+	go func() {
+		<-ctx.Done()
+		emulatorInstance.Stop()
+	}()
+	return withCache(&emulator.Provider{Emulator: emulatorInstance}), nil
+}
+
+// withCache - wraps provider with read cache unless STEP_FUNCTIONS_CACHE is set to false
+func withCache(provider awsprovider.AwsStepFunctionsProvider) awsprovider.AwsStepFunctionsProvider {
+	if os.Getenv("STEP_FUNCTIONS_CACHE") == "false" {
+		return provider
 	}
-	if r.Method == "POST" {
-		r.ParseForm()
-		request = append(request, "\n")
-		request = append(request, r.Form.Encode())
+	return awsprovider.NewCachingStepFunctionsProvider(provider, awsprovider.StepFunctionsCacheConfigFromEnv())
+}
+
+// GetCacheStatsHandler - returns hit and miss counters of step functions cache per operation
+func GetCacheStatsHandler(w http.ResponseWriter, r *http.Request, stepFunctionsProvider awsprovider.AwsStepFunctionsProvider) {
+	stats := map[string]awsprovider.CacheStats{}
+	if cachingProvider, ok := stepFunctionsProvider.(*awsprovider.CachingStepFunctionsProvider); ok {
+		stats = cachingProvider.Stats()
 	}
-	// Return the request as a string
-	return strings.Join(request, "\n")
+	response.WriteResponse(w, stats)
 }
 
 // StartServer - starts server and setups possible routes for server
-func StartServer() http.Handler {
-	fmt.Println("Starting server.")
+func StartServer(stepFunctionsProvider awsprovider.AwsStepFunctionsProvider, limits *ratelimit.Limits) http.Handler {
+	log.Info("Starting server.")
 	router := mux.NewRouter()
+	// Authenticated routes are limited per user, authentication routes per client address
+	byUser := limits.ByUser(authentication.UserFromRequest)
+	byClientIP := limits.ByClientIP()
 
+	// Requests are measured before CORS so measured latency covers whole handling
+	router.Use(metrics.Middleware)
 	// We use our custom CORS Middleware
 	router.Use(CORS)
+	// Spans are started after CORS so they carry transaction id
+	router.Use(tracing.Middleware)
 
-	router.Handle("/aws/machines", authentication.CheckAuthentication(
+	router.Handle("/aws/machines", limits.Handler(ratelimit.GroupRead, byUser, authentication.CheckScopedPermission(apikey.ScopeRead, rbac.Anywhere(rbac.PermissionRead),
 		func(w http.ResponseWriter, r *http.Request) {
-			machine.GetMachinesHandler(w, r, &awsprovider.AwsStepFunctionsRealProvider{})
-		})).Methods("GET")
+			machine.GetMachinesHandler(w, r, stepFunctionsProvider)
+		}))).Methods("GET")
 
-	router.Handle("/aws/regions", authentication.CheckAuthentication(region.GetRegionsHandler)).Methods("GET")
+	router.Handle("/aws/machines/{machine}/failures", limits.Handler(ratelimit.GroupRead, byUser, authentication.CheckScopedPermission(apikey.ScopeRead, rbac.MachineVar(rbac.PermissionRead, "machine"),
+		func(w http.ResponseWriter, r *http.Request) {
+			failure.GetFailuresHandler(w, r, stepFunctionsProvider)
+		}))).Methods("GET")
 
-	router.Handle("/aws/executions", authentication.CheckAuthentication(
+	router.Handle("/aws/cache", limits.Handler(ratelimit.GroupRead, byUser, authentication.CheckPermission(rbac.AnyRegion(rbac.PermissionAdmin),
 		func(w http.ResponseWriter, r *http.Request) {
-			execution.GetExecutionsHandler(w, r, &awsprovider.AwsStepFunctionsRealProvider{})
-		})).Methods("GET").Queries("machine", "{machine}")
+			GetCacheStatsHandler(w, r, stepFunctionsProvider)
+		}))).Methods("GET")
 
-	router.Handle("/aws/execution/{execution}", authentication.CheckAuthentication(
+	router.Handle("/aws/regions", limits.Handler(ratelimit.GroupRead, byUser, authentication.CheckScopedPermission(apikey.ScopeRead, rbac.AnyRegion(rbac.PermissionRead), region.GetRegionsHandler))).Methods("GET")
+
+	router.Handle("/aws/executions", limits.Handler(ratelimit.GroupRead, byUser, authentication.CheckScopedPermission(apikey.ScopeRead, rbac.MachineQuery(rbac.PermissionRead, "machine"),
+		func(w http.ResponseWriter, r *http.Request) {
+			execution.GetExecutionsHandler(w, r, stepFunctionsProvider)
+		}))).Methods("GET").Queries("machine", "{machine}")
+
+	router.Handle("/aws/execution/{execution}", limits.Handler(ratelimit.GroupRead, byUser, authentication.CheckScopedPermission(apikey.ScopeRead, rbac.ExecutionVar(rbac.PermissionRead, "execution"),
 		func(w http.ResponseWriter, r *http.Request) {
-			execution.GetExecutionHandler(w, r, &awsprovider.AwsStepFunctionsRealProvider{})
-		})).Methods("GET")
+			execution.GetExecutionHandler(w, r, stepFunctionsProvider)
+		}))).Methods("GET")
 
-	router.Handle("/aws/execution", authentication.CheckAuthentication(
+	router.Handle("/aws/execution", limits.Handler(ratelimit.GroupWrite, byUser, authentication.CheckScopedPermissionWithBody(apikey.ScopeExecute, execution.NewStartBody(audit.ActionStartExecution), rbac.MachineForm(rbac.PermissionExecute, "machine"),
 		func(w http.ResponseWriter, r *http.Request) {
-			execution.PostStartExecution(w, r, &awsprovider.AwsStepFunctionsRealProvider{})
-		})).Methods("POST")
+			approval.Guard(audit.ActionStartExecution, stepFunctionsProvider, execution.PostStartExecution)(w, r)
+		}))).Methods("POST")
 
-	router.Handle("/aws/execution/restart", authentication.CheckAuthentication(
+	router.Handle("/aws/execution/restart", limits.Handler(ratelimit.GroupWrite, byUser, authentication.CheckScopedPermissionWithBody(apikey.ScopeExecute, execution.NewStartBody(audit.ActionRestartExecution),
+		rbac.All(rbac.MachineForm(rbac.PermissionExecute, "machine"), rbac.ExecutionForm(rbac.PermissionRead, "execution")),
 		func(w http.ResponseWriter, r *http.Request) {
-			execution.PostRestartExecution(w, r, &awsprovider.AwsStepFunctionsRealProvider{})
-		})).Methods("POST")
+			approval.Guard(audit.ActionRestartExecution, stepFunctionsProvider, execution.PostRestartExecution)(w, r)
+		}))).Methods("POST")
+
+	router.Handle("/aws/execution/batch", limits.Handler(ratelimit.GroupBatch, byUser, authentication.CheckScopedPermissionWithBody(apikey.ScopeBatch, execution.NewStartBody(audit.ActionBatchRestart),
+		rbac.All(rbac.MachineForm(rbac.PermissionExecute, "machine"), rbac.ExecutionsForm(rbac.PermissionRead, "executions")),
+		func(w http.ResponseWriter, r *http.Request) {
+			approval.Guard(audit.ActionBatchRestart, stepFunctionsProvider, execution.PostRestartBatch)(w, r)
+		}))).Methods("POST")
+
+	router.Handle("/approvals", limits.Handler(ratelimit.GroupRead, byUser, authentication.CheckScopedPermission(apikey.ScopeRead, rbac.AnyRegion(rbac.PermissionRead), approval.GetApprovalsHandler))).Methods("GET")
+
+	router.Handle("/approvals/{id}", limits.Handler(ratelimit.GroupRead, byUser, authentication.CheckScopedPermission(apikey.ScopeRead, rbac.AnyRegion(rbac.PermissionRead), approval.GetApprovalHandler))).Methods("GET")
 
-	router.Handle("/aws/execution/batch", authentication.CheckAuthentication(
+	router.Handle("/approvals/{id}/approve", limits.Handler(ratelimit.GroupWrite, byUser, authentication.CheckPermissionWithBody(approval.NewDecisionBody, rbac.AnyRegion(rbac.PermissionExecute),
 		func(w http.ResponseWriter, r *http.Request) {
-			execution.PostRestartBatch(w, r, &awsprovider.AwsStepFunctionsRealProvider{})
-		})).Methods("POST")
+			approval.PostApproveHandler(w, r, stepFunctionsProvider)
+		}))).Methods("POST")
+
+	router.Handle("/approvals/{id}/reject", limits.Handler(ratelimit.GroupWrite, byUser, authentication.CheckPermissionWithBody(approval.NewDecisionBody, rbac.AnyRegion(rbac.PermissionExecute), approval.PostRejectHandler))).Methods("POST")
+
+	router.Handle("/protected-machines", limits.Handler(ratelimit.GroupRead, byUser, authentication.CheckPermission(rbac.AnyRegion(rbac.PermissionRead), approval.GetProtectedMachinesHandler))).Methods("GET")
+
+	router.Handle("/protected-machines/{machine}", limits.Handler(ratelimit.GroupWrite, byUser, authentication.CheckPermission(rbac.MachineVar(rbac.PermissionAdmin, "machine"), approval.PutProtectedMachineHandler))).Methods("PUT")
+
+	router.Handle("/protected-machines/{machine}", limits.Handler(ratelimit.GroupWrite, byUser, authentication.CheckPermission(rbac.MachineVar(rbac.PermissionAdmin, "machine"), approval.DeleteProtectedMachineHandler))).Methods("DELETE")
+
+	router.Handle("/service-accounts", limits.Handler(ratelimit.GroupRead, byUser, authentication.CheckPermission(rbac.AnyRegion(rbac.PermissionAdmin), apikey.GetServiceAccountsHandler))).Methods("GET")
+
+	router.Handle("/service-accounts", limits.Handler(ratelimit.GroupWrite, byUser, authentication.CheckPermissionWithBody(apikey.NewServiceAccountBody, rbac.AnyRegion(rbac.PermissionAdmin), apikey.PostServiceAccountHandler))).Methods("POST")
+
+	router.Handle("/service-accounts/{name}/rotate", limits.Handler(ratelimit.GroupWrite, byUser, authentication.CheckPermission(rbac.AnyRegion(rbac.PermissionAdmin), apikey.PostRotateKeyHandler))).Methods("POST")
+
+	router.Handle("/service-accounts/{name}/revoke", limits.Handler(ratelimit.GroupWrite, byUser, authentication.CheckPermission(rbac.AnyRegion(rbac.PermissionAdmin), apikey.PostRevokeHandler))).Methods("POST")
+
+	router.Handle("/audit", limits.Handler(ratelimit.GroupRead, byUser, authentication.CheckPermission(rbac.AnyRegion(rbac.PermissionAdmin), audit.GetAuditHandler))).Methods("GET")
+
+	router.Handle("/logout", limits.Handler(ratelimit.GroupAuth, byUser, http.HandlerFunc(authentication.Logout))).Methods("GET", "OPTIONS")
+
+	router.Handle("/login", limits.Handler(ratelimit.GroupAuth, byClientIP, http.HandlerFunc(authentication.LoginHandler))).Methods("POST", "OPTIONS")
+
+	router.Handle("/login/mfa", limits.Handler(ratelimit.GroupAuth, byClientIP, http.HandlerFunc(authentication.MFALoginHandler))).Methods("POST", "OPTIONS")
+
+	router.Handle("/oidc/login", limits.Handler(ratelimit.GroupAuth, byClientIP, http.HandlerFunc(authentication.OIDCLoginHandler))).Methods("GET", "OPTIONS")
+
+	router.Handle("/oidc/callback", limits.Handler(ratelimit.GroupAuth, byClientIP, http.HandlerFunc(authentication.OIDCCallbackHandler))).Methods("POST", "OPTIONS")
 
-	router.HandleFunc("/logout", authentication.Logout).Methods("GET", "OPTIONS")
+	router.Handle("/createuser", limits.Handler(ratelimit.GroupWrite, byUser, authentication.CheckPermission(rbac.AnyRegion(rbac.PermissionAdmin), authentication.CreateUser))).Methods("POST", "OPTIONS")
 
-	router.HandleFunc("/login", authentication.LoginHandler).Methods("POST", "OPTIONS")
+	router.Handle("/users", limits.Handler(ratelimit.GroupRead, byUser, authentication.CheckPermission(rbac.AnyRegion(rbac.PermissionAdmin), authentication.ListUsersHandler))).Methods("GET")
+	router.Handle("/users", limits.Handler(ratelimit.GroupWrite, byUser, authentication.CheckPermission(rbac.AnyRegion(rbac.PermissionAdmin), authentication.CreateUser))).Methods("POST")
+	router.Handle("/users/{username}", limits.Handler(ratelimit.GroupRead, byUser, authentication.CheckPermission(rbac.AnyRegion(rbac.PermissionAdmin), authentication.GetUserHandler))).Methods("GET")
+	router.Handle("/users/{username}", limits.Handler(ratelimit.GroupWrite, byUser, authentication.CheckPermission(rbac.AnyRegion(rbac.PermissionAdmin), authentication.UpdateUserHandler))).Methods("PATCH")
+	router.Handle("/users/{username}", limits.Handler(ratelimit.GroupWrite, byUser, authentication.CheckPermission(rbac.AnyRegion(rbac.PermissionAdmin), authentication.DeleteUserHandler))).Methods("DELETE")
+	router.Handle("/users/{username}/grants", limits.Handler(ratelimit.GroupWrite, byUser, authentication.CheckPermission(rbac.AnyRegion(rbac.PermissionAdmin), authentication.SetGrantsHandler))).Methods("PUT")
+	router.Handle("/users/{username}/identity", limits.Handler(ratelimit.GroupWrite, byUser, authentication.CheckPermission(rbac.AnyRegion(rbac.PermissionAdmin), authentication.LinkIdentityHandler))).Methods("PUT")
+	router.Handle("/users/{username}/disable", limits.Handler(ratelimit.GroupWrite, byUser, authentication.CheckPermission(rbac.AnyRegion(rbac.PermissionAdmin), authentication.DisableUserHandler))).Methods("POST")
+	router.Handle("/users/{username}/enable", limits.Handler(ratelimit.GroupWrite, byUser, authentication.CheckPermission(rbac.AnyRegion(rbac.PermissionAdmin), authentication.EnableUserHandler))).Methods("POST")
+	router.Handle("/users/{username}/sessions", limits.Handler(ratelimit.GroupRead, byUser, authentication.CheckPermission(rbac.AnyRegion(rbac.PermissionAdmin), authentication.ListUserSessionsHandler))).Methods("GET")
+	router.Handle("/users/{username}/sessions", limits.Handler(ratelimit.GroupWrite, byUser, authentication.CheckPermission(rbac.AnyRegion(rbac.PermissionAdmin), authentication.RevokeUserSessionsHandler))).Methods("DELETE")
+	router.Handle("/invites", limits.Handler(ratelimit.GroupWrite, byUser, authentication.CheckPermission(rbac.AnyRegion(rbac.PermissionAdmin), authentication.CreateInviteHandler))).Methods("POST")
+	router.Handle("/invites/{id}", limits.Handler(ratelimit.GroupWrite, byUser, authentication.CheckPermission(rbac.AnyRegion(rbac.PermissionAdmin), authentication.RevokeInviteHandler))).Methods("DELETE")
+	router.Handle("/invites/{token}/accept", limits.Handler(ratelimit.GroupAuth, byClientIP, http.HandlerFunc(authentication.AcceptInviteHandler))).Methods("POST", "OPTIONS")
 
-	router.HandleFunc("/createuser", authentication.CreateUser).Methods("POST", "OPTIONS")
+	router.Handle("/me/sessions", limits.Handler(ratelimit.GroupRead, byUser, authentication.CheckAuthentication(authentication.ListSessionsHandler))).Methods("GET", "OPTIONS")
+	router.Handle("/me/sessions/{id}", limits.Handler(ratelimit.GroupWrite, byUser, authentication.CheckAuthentication(authentication.RevokeSessionHandler))).Methods("DELETE", "OPTIONS")
+	router.Handle("/me/password", limits.Handler(ratelimit.GroupAuth, byUser, authentication.CheckAuthentication(authentication.ChangePasswordHandler))).Methods("POST", "OPTIONS")
+	router.Handle("/password-reset", limits.Handler(ratelimit.GroupAuth, byClientIP, http.HandlerFunc(authentication.RequestPasswordResetHandler))).Methods("POST", "OPTIONS")
+	router.Handle("/password-reset/confirm", limits.Handler(ratelimit.GroupAuth, byClientIP, http.HandlerFunc(authentication.ResetPasswordHandler))).Methods("POST", "OPTIONS")
+	router.Handle("/users/{username}/password-reset", limits.Handler(ratelimit.GroupWrite, byUser, authentication.CheckPermission(rbac.AnyRegion(rbac.PermissionAdmin), authentication.AdminPasswordResetHandler))).Methods("POST")
+	router.Handle("/users/{username}/lockout", limits.Handler(ratelimit.GroupWrite, byUser, authentication.CheckPermission(rbac.AnyRegion(rbac.PermissionAdmin), authentication.UnlockUserHandler))).Methods("DELETE")
+	router.Handle("/me/mfa", limits.Handler(ratelimit.GroupAuth, byUser, authentication.CheckAuthentication(authentication.EnrollMFAHandler))).Methods("POST", "OPTIONS")
+	router.Handle("/me/mfa/confirm", limits.Handler(ratelimit.GroupAuth, byUser, authentication.CheckAuthentication(authentication.ConfirmMFAHandler))).Methods("POST", "OPTIONS")
+	router.Handle("/me/mfa/disable", limits.Handler(ratelimit.GroupAuth, byUser, authentication.CheckAuthentication(authentication.DisableMFAHandler))).Methods("POST", "OPTIONS")
+	router.Handle("/users/{username}/mfa", limits.Handler(ratelimit.GroupWrite, byUser, authentication.CheckPermission(rbac.AnyRegion(rbac.PermissionAdmin), authentication.ResetMFAHandler))).Methods("DELETE")
+	router.Handle("/refreshtoken", limits.Handler(ratelimit.GroupAuth, byClientIP, http.HandlerFunc(authentication.RefreshTokenCheck))).Methods("POST", "OPTIONS")
 
-	router.HandleFunc("/refreshtoken", authentication.RefreshTokenCheck).Methods("POST", "OPTIONS")
+	router.Handle("/.well-known/jwks.json", limits.Handler(ratelimit.GroupRead, byClientIP, http.HandlerFunc(authentication.JWKSHandler))).Methods("GET")
 
 	router.HandleFunc("/healthcheck", healthcheck.Healthcheck).Methods("GET")
+	router.Handle("/metrics", metrics.Handler()).Methods("GET")
 	http.Handle("/", router)
 	return router
 
@@ -31,5 +31,6 @@ func TestCorsMiddlewareTest(t *testing.T) {
 		for _, responseHeader := range rr.HeaderMap {
 			assert.NotEqual(t, "", responseHeader)
 		}
+		assert.Contains(t, rr.Header().Get("Access-Control-Allow-Headers"), "Idempotency-Key")
 	}
 }
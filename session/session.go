@@ -0,0 +1,151 @@
+package session
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxUserAgentLength - longer user agents are cut, they are shown only to identify the device
+const maxUserAgentLength = 256
+
+// Session - login of user, id is the family shared by all tokens issued since the login
+type Session struct {
+	ID         string    `json:"id" dynamodbav:"id"`
+	Username   string    `json:"-" dynamodbav:"username"`
+	UserAgent  string    `json:"userAgent" dynamodbav:"userAgent"`
+	IP         string    `json:"ip" dynamodbav:"ip"`
+	CreatedAt  time.Time `json:"createdAt" dynamodbav:"createdAt"`
+	LastUsedAt time.Time `json:"lastUsedAt" dynamodbav:"lastUsedAt"`
+	// ExpiresAt - unix time when last refresh token of the session expires, TTL attribute of sessions table
+	ExpiresAt int64 `json:"-" dynamodbav:"expiresAt"`
+}
+
+// Store - storage of sessions by user
+type Store interface {
+	Save(ctx context.Context, session Session) error
+	// Get - returns session of user, nil when it doesn't exist
+	Get(ctx context.Context, username string, id string) (*Session, error)
+	List(ctx context.Context, username string) ([]Session, error)
+	Delete(ctx context.Context, username string, id string) error
+}
+
+var store Store = NewMemoryStore()
+var now = time.Now
+
+// SetStore - sets storage of sessions
+func SetStore(sessionStore Store) {
+	store = sessionStore
+}
+
+// Use - records login or refresh of session from userAgent and ip, session is kept until expiresAt
+func Use(ctx context.Context, username string, id string, userAgent string, ip string, expiresAt time.Time) error {
+	used := Session{ID: id, Username: username, CreatedAt: now().UTC()}
+	existing, err := store.Get(ctx, username, id)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		used.CreatedAt = existing.CreatedAt
+	}
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	used.UserAgent = userAgent
+	used.IP = ip
+	used.LastUsedAt = now().UTC()
+	used.ExpiresAt = expiresAt.Unix()
+	return store.Save(ctx, used)
+}
+
+// Get - returns session of user which didn't expire, nil otherwise
+func Get(ctx context.Context, username string, id string) (*Session, error) {
+	found, err := store.Get(ctx, username, id)
+	if err != nil || found == nil || found.ExpiresAt <= now().Unix() {
+		return nil, err
+	}
+	return found, nil
+}
+
+// List - returns sessions of user which didn't expire, most recently used first
+func List(ctx context.Context, username string) ([]Session, error) {
+	sessions, err := store.List(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	active := []Session{}
+	for _, listed := range sessions {
+		if listed.ExpiresAt > now().Unix() {
+			active = append(active, listed)
+		}
+	}
+	sort.Slice(active, func(i, j int) bool {
+		return active[i].LastUsedAt.After(active[j].LastUsedAt)
+	})
+	return active, nil
+}
+
+// Delete - removes session record, tokens of the session have to be revoked separately
+func Delete(ctx context.Context, username string, id string) error {
+	return store.Delete(ctx, username, id)
+}
+
+// MemoryStore - sessions kept in memory, not shared by instances and lost on restart
+type MemoryStore struct {
+	mutex    sync.Mutex
+	sessions map[string]map[string]Session
+}
+
+// NewMemoryStore - creates empty memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{sessions: map[string]map[string]Session{}}
+}
+
+// Save - stores session, expired sessions of the user are dropped
+func (memoryStore *MemoryStore) Save(ctx context.Context, session Session) error {
+	memoryStore.mutex.Lock()
+	defer memoryStore.mutex.Unlock()
+	sessions, ok := memoryStore.sessions[session.Username]
+	if !ok {
+		sessions = map[string]Session{}
+		memoryStore.sessions[session.Username] = sessions
+	}
+	for id, stored := range sessions {
+		if stored.ExpiresAt <= now().Unix() {
+			delete(sessions, id)
+		}
+	}
+	sessions[session.ID] = session
+	return nil
+}
+
+// Get - returns stored session
+func (memoryStore *MemoryStore) Get(ctx context.Context, username string, id string) (*Session, error) {
+	memoryStore.mutex.Lock()
+	defer memoryStore.mutex.Unlock()
+	stored, ok := memoryStore.sessions[username][id]
+	if !ok {
+		return nil, nil
+	}
+	return &stored, nil
+}
+
+// List - returns stored sessions of user
+func (memoryStore *MemoryStore) List(ctx context.Context, username string) ([]Session, error) {
+	memoryStore.mutex.Lock()
+	defer memoryStore.mutex.Unlock()
+	sessions := []Session{}
+	for _, stored := range memoryStore.sessions[username] {
+		sessions = append(sessions, stored)
+	}
+	return sessions, nil
+}
+
+// Delete - removes stored session
+func (memoryStore *MemoryStore) Delete(ctx context.Context, username string, id string) error {
+	memoryStore.mutex.Lock()
+	defer memoryStore.mutex.Unlock()
+	delete(memoryStore.sessions[username], id)
+	return nil
+}
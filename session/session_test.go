@@ -0,0 +1,51 @@
+package session_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"sfr-backend/session"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUse(t *testing.T) {
+	session.SetStore(session.NewMemoryStore())
+
+	assert.Nil(t, session.Use(context.Background(), "jdoe", "first", "browser", "192.0.2.1", time.Now().Add(time.Hour)))
+	started, _ := session.Get(context.Background(), "jdoe", "first")
+	assert.Nil(t, session.Use(context.Background(), "jdoe", "second", strings.Repeat("a", 1000), "192.0.2.2", time.Now().Add(time.Hour)))
+	time.Sleep(10 * time.Millisecond)
+	assert.Nil(t, session.Use(context.Background(), "jdoe", "first", "browser", "192.0.2.3", time.Now().Add(time.Hour)))
+
+	sessions, err := session.List(context.Background(), "jdoe")
+	assert.Nil(t, err)
+	assert.Len(t, sessions, 2)
+	// most recently used first, creation is kept
+	assert.Equal(t, "first", sessions[0].ID)
+	assert.Equal(t, "192.0.2.3", sessions[0].IP)
+	assert.Equal(t, started.CreatedAt, sessions[0].CreatedAt)
+	assert.True(t, sessions[0].LastUsedAt.After(started.LastUsedAt))
+	assert.Len(t, sessions[1].UserAgent, 256)
+
+	found, err := session.Get(context.Background(), "other", "first")
+	assert.Nil(t, err)
+	assert.Nil(t, found)
+	assert.Nil(t, session.Delete(context.Background(), "jdoe", "first"))
+	sessions, _ = session.List(context.Background(), "jdoe")
+	assert.Len(t, sessions, 1)
+}
+
+func TestExpiredSessions(t *testing.T) {
+	session.SetStore(session.NewMemoryStore())
+
+	session.Use(context.Background(), "jdoe", "expired", "browser", "192.0.2.1", time.Now().Add(-time.Second))
+	found, err := session.Get(context.Background(), "jdoe", "expired")
+	assert.Nil(t, err)
+	assert.Nil(t, found)
+	sessions, err := session.List(context.Background(), "jdoe")
+	assert.Nil(t, err)
+	assert.Empty(t, sessions)
+}
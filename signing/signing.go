@@ -0,0 +1,274 @@
+package signing
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	log "github.com/sirupsen/logrus"
+)
+
+// minSecretLength - HMAC secrets shorter than SHA-256 output are rejected
+const minSecretLength = 32
+
+// KeyConfig - key in JWT_KEYS_FILE, HMAC keys need secretFile, RSA and ECDSA keys need privateKeyFile
+// for signing or publicKeyFile for keys only used to verify tokens issued before rotation
+type KeyConfig struct {
+	ID             string `json:"kid"`
+	Algorithm      string `json:"alg"`
+	SecretFile     string `json:"secretFile,omitempty"`
+	PrivateKeyFile string `json:"privateKeyFile,omitempty"`
+	PublicKeyFile  string `json:"publicKeyFile,omitempty"`
+}
+
+// Config - content of JWT_KEYS_FILE, all keys verify tokens, only SigningKey signs new ones
+type Config struct {
+	SigningKey string      `json:"signingKey"`
+	Keys       []KeyConfig `json:"keys"`
+}
+
+// Key - loaded key, HMAC keys are never published
+type Key struct {
+	ID        string
+	Algorithm string
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// Manager - signs tokens with current key and verifies them with all configured keys
+type Manager struct {
+	signing *Key
+	keys    map[string]*Key
+}
+
+// NewManagerFromEnv - loads keys from JWT_KEYS_FILE, without it generates random HMAC key valid until restart
+func NewManagerFromEnv() (*Manager, error) {
+	path := os.Getenv("JWT_KEYS_FILE")
+	if path == "" {
+		log.Warn("JWT_KEYS_FILE is not set, tokens are signed with random key and are not accepted after restart or by other instances")
+		return NewEphemeralManager(), nil
+	}
+	return LoadManager(path)
+}
+
+// LoadManager - loads keys listed in JSON config file
+func LoadManager(path string) (*Manager, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config Config
+	if err := json.Unmarshal(content, &config); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %s", path, err)
+	}
+	return NewManager(config)
+}
+
+// NewManager - loads keys of config, signing key has to be able to sign
+func NewManager(config Config) (*Manager, error) {
+	manager := &Manager{keys: map[string]*Key{}}
+	for _, keyConfig := range config.Keys {
+		key, err := loadKey(keyConfig)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %s", keyConfig.ID, err)
+		}
+		if _, ok := manager.keys[key.ID]; ok {
+			return nil, fmt.Errorf("key %q is configured twice", key.ID)
+		}
+		manager.keys[key.ID] = key
+	}
+	signing, ok := manager.keys[config.SigningKey]
+	if !ok {
+		return nil, fmt.Errorf("signing key %q is not configured", config.SigningKey)
+	}
+	if signing.signKey == nil {
+		return nil, fmt.Errorf("signing key %q has no private key", config.SigningKey)
+	}
+	manager.signing = signing
+	return manager, nil
+}
+
+// NewEphemeralManager - manager with random HS256 key, used in tests and when no keys are configured
+func NewEphemeralManager() *Manager {
+	secret := make([]byte, minSecretLength)
+	rand.Read(secret)
+	key := &Key{ID: "ephemeral", Algorithm: "HS256", method: jwt.SigningMethodHS256, signKey: secret, verifyKey: secret}
+	return &Manager{signing: key, keys: map[string]*Key{key.ID: key}}
+}
+
+// Sign - signs claims with signing key and stamps its kid into token header
+func (manager *Manager) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(manager.signing.method, claims)
+	token.Header["kid"] = manager.signing.ID
+	return token.SignedString(manager.signing.signKey)
+}
+
+// Parse - parses token and validates it with key of its kid, algorithm has to match the key
+func (manager *Manager) Parse(tokenString string) (*jwt.Token, error) {
+	return jwt.Parse(tokenString, manager.Keyfunc)
+}
+
+// Keyfunc - returns verification key of token for jwt-go, tokens with unknown kid or other algorithm are rejected
+func (manager *Manager) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := manager.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	// never let token choose algorithm, otherwise public RSA key could be used as HMAC secret
+	if token.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("unexpected signing method %v for key %q", token.Header["alg"], kid)
+	}
+	return key.verifyKey, nil
+}
+
+// JSONWebKey - public key published in JWKS
+type JSONWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JSONWebKeySet - response of /.well-known/jwks.json
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// JWKS - public keys of all RSA and ECDSA keys, so other services can verify our tokens
+func (manager *Manager) JWKS() JSONWebKeySet {
+	jwks := JSONWebKeySet{Keys: []JSONWebKey{}}
+	for _, key := range manager.keys {
+		jwk := JSONWebKey{Kid: key.ID, Alg: key.Algorithm, Use: "sig"}
+		switch publicKey := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = encode(publicKey.N.Bytes())
+			jwk.E = encode(big.NewInt(int64(publicKey.E)).Bytes())
+		case *ecdsa.PublicKey:
+			size := (publicKey.Curve.Params().BitSize + 7) / 8
+			jwk.Kty = "EC"
+			jwk.Crv = publicKey.Curve.Params().Name
+			jwk.X = encode(padded(publicKey.X.Bytes(), size))
+			jwk.Y = encode(padded(publicKey.Y.Bytes(), size))
+		default:
+			continue
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	sort.Slice(jwks.Keys, func(i, j int) bool { return jwks.Keys[i].Kid < jwks.Keys[j].Kid })
+	return jwks
+}
+
+// JWKSHandler - publishes public keys at /.well-known/jwks.json
+func (manager *Manager) JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	js, err := json.Marshal(manager.JWKS())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.Write(js)
+}
+
+func loadKey(config KeyConfig) (*Key, error) {
+	if config.ID == "" {
+		return nil, errors.New("kid is required")
+	}
+	method := jwt.GetSigningMethod(config.Algorithm)
+	key := &Key{ID: config.ID, Algorithm: config.Algorithm, method: method}
+	switch {
+	case strings.HasPrefix(config.Algorithm, "HS") && method != nil:
+		secret, err := ioutil.ReadFile(config.SecretFile)
+		if err != nil {
+			return nil, err
+		}
+		secret = []byte(strings.TrimSpace(string(secret)))
+		if len(secret) < minSecretLength {
+			return nil, fmt.Errorf("secret has to be at least %d bytes long", minSecretLength)
+		}
+		key.signKey = secret
+		key.verifyKey = secret
+	case strings.HasPrefix(config.Algorithm, "RS") && method != nil:
+		return loadAsymmetricKey(key, config, func(pem []byte) (interface{}, interface{}, error) {
+			private, err := jwt.ParseRSAPrivateKeyFromPEM(pem)
+			if err != nil {
+				return nil, nil, err
+			}
+			return private, &private.PublicKey, nil
+		}, func(pem []byte) (interface{}, error) {
+			return jwt.ParseRSAPublicKeyFromPEM(pem)
+		})
+	case strings.HasPrefix(config.Algorithm, "ES") && method != nil:
+		return loadAsymmetricKey(key, config, func(pem []byte) (interface{}, interface{}, error) {
+			private, err := jwt.ParseECPrivateKeyFromPEM(pem)
+			if err != nil {
+				return nil, nil, err
+			}
+			if private.Curve.Params().BitSize != method.(*jwt.SigningMethodECDSA).CurveBits {
+				return nil, nil, fmt.Errorf("curve %s doesn't match %s", private.Curve.Params().Name, config.Algorithm)
+			}
+			return private, &private.PublicKey, nil
+		}, func(pem []byte) (interface{}, error) {
+			return jwt.ParseECPublicKeyFromPEM(pem)
+		})
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", config.Algorithm)
+	}
+	return key, nil
+}
+
+// loadAsymmetricKey - loads private key, or only public key for keys which can't sign anymore
+func loadAsymmetricKey(key *Key, config KeyConfig,
+	parsePrivate func([]byte) (interface{}, interface{}, error), parsePublic func([]byte) (interface{}, error)) (*Key, error) {
+	if config.PrivateKeyFile != "" {
+		pem, err := ioutil.ReadFile(config.PrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		key.signKey, key.verifyKey, err = parsePrivate(pem)
+		if err != nil {
+			return nil, err
+		}
+		return key, nil
+	}
+	pem, err := ioutil.ReadFile(config.PublicKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	key.verifyKey, err = parsePublic(pem)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func encode(value []byte) string {
+	return base64.RawURLEncoding.EncodeToString(value)
+}
+
+// padded - EC coordinates in JWK have fixed length of the curve
+func padded(value []byte, size int) []byte {
+	if len(value) >= size {
+		return value
+	}
+	return append(make([]byte, size-len(value)), value...)
+}
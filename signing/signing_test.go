@@ -0,0 +1,189 @@
+package signing_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"sfr-backend/signing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+type keyFiles struct {
+	dir        string
+	rsaPublic  string
+	rsaPrivate string
+	ecPrivate  string
+	secret     string
+}
+
+func writeFile(t *testing.T, dir string, name string, blockType string, content []byte) string {
+	path := filepath.Join(dir, name)
+	if blockType != "" {
+		content = pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: content})
+	}
+	if err := ioutil.WriteFile(path, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func newKeyFiles(t *testing.T) keyFiles {
+	dir, err := ioutil.TempDir("", "signing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	rsaPublic, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ecPrivate, _ := x509.MarshalECPrivateKey(ecKey)
+	return keyFiles{
+		dir:        dir,
+		rsaPrivate: writeFile(t, dir, "rsa.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey)),
+		rsaPublic:  writeFile(t, dir, "rsa.pub", "PUBLIC KEY", rsaPublic),
+		ecPrivate:  writeFile(t, dir, "ec.pem", "EC PRIVATE KEY", ecPrivate),
+		secret:     writeFile(t, dir, "secret", "", []byte("0123456789abcdef0123456789abcdef\n")),
+	}
+}
+
+func claims() jwt.MapClaims {
+	return jwt.MapClaims{"user": "username"}
+}
+
+func TestSignAndParse(t *testing.T) {
+	files := newKeyFiles(t)
+	defer os.RemoveAll(files.dir)
+	testTable := []signing.KeyConfig{
+		{ID: "hmac", Algorithm: "HS256", SecretFile: files.secret},
+		{ID: "rsa", Algorithm: "RS256", PrivateKeyFile: files.rsaPrivate},
+		{ID: "ec", Algorithm: "ES256", PrivateKeyFile: files.ecPrivate},
+	}
+
+	for _, keyConfig := range testTable {
+		manager, err := signing.NewManager(signing.Config{SigningKey: keyConfig.ID, Keys: []signing.KeyConfig{keyConfig}})
+		assert.Nil(t, err, keyConfig.ID)
+
+		tokenString, err := manager.Sign(claims())
+		assert.Nil(t, err, keyConfig.ID)
+		token, err := manager.Parse(tokenString)
+
+		assert.Nil(t, err, keyConfig.ID)
+		assert.True(t, token.Valid, keyConfig.ID)
+		assert.Equal(t, keyConfig.ID, token.Header["kid"])
+		assert.Equal(t, keyConfig.Algorithm, token.Header["alg"])
+	}
+}
+
+func TestRotation(t *testing.T) {
+	files := newKeyFiles(t)
+	defer os.RemoveAll(files.dir)
+	old, _ := signing.NewManager(signing.Config{SigningKey: "2021-01", Keys: []signing.KeyConfig{
+		{ID: "2021-01", Algorithm: "RS256", PrivateKeyFile: files.rsaPrivate},
+	}})
+	oldToken, _ := old.Sign(claims())
+	// old private key was removed, its public key verifies tokens issued before rotation
+	rotated, err := signing.NewManager(signing.Config{SigningKey: "2021-02", Keys: []signing.KeyConfig{
+		{ID: "2021-01", Algorithm: "RS256", PublicKeyFile: files.rsaPublic},
+		{ID: "2021-02", Algorithm: "ES256", PrivateKeyFile: files.ecPrivate},
+	}})
+	assert.Nil(t, err)
+	newToken, _ := rotated.Sign(claims())
+
+	_, err = rotated.Parse(oldToken)
+	assert.Nil(t, err)
+	_, err = rotated.Parse(newToken)
+	assert.Nil(t, err)
+	_, err = old.Parse(newToken)
+	assert.NotNil(t, err)
+
+	_, err = signing.NewManager(signing.Config{SigningKey: "2021-01", Keys: []signing.KeyConfig{
+		{ID: "2021-01", Algorithm: "RS256", PublicKeyFile: files.rsaPublic},
+	}})
+	assert.NotNil(t, err)
+}
+
+func TestParseRejectsForgedTokens(t *testing.T) {
+	files := newKeyFiles(t)
+	defer os.RemoveAll(files.dir)
+	manager, _ := signing.NewManager(signing.Config{SigningKey: "rsa", Keys: []signing.KeyConfig{
+		{ID: "rsa", Algorithm: "RS256", PrivateKeyFile: files.rsaPrivate},
+	}})
+	publicPEM, _ := ioutil.ReadFile(files.rsaPublic)
+	// public key used as HMAC secret must not be accepted
+	confused := jwt.NewWithClaims(jwt.SigningMethodHS256, claims())
+	confused.Header["kid"] = "rsa"
+	confusedToken, _ := confused.SignedString(publicPEM)
+	unknown := jwt.NewWithClaims(jwt.SigningMethodHS256, claims())
+	unknown.Header["kid"] = "other"
+	unknownToken, _ := unknown.SignedString([]byte("0123456789abcdef0123456789abcdef"))
+	withoutKid, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims()).SignedString([]byte("singinKey"))
+
+	for _, tokenString := range []string{confusedToken, unknownToken, withoutKid} {
+		_, err := manager.Parse(tokenString)
+
+		assert.NotNil(t, err)
+	}
+}
+
+func TestLoadManagerValidation(t *testing.T) {
+	files := newKeyFiles(t)
+	defer os.RemoveAll(files.dir)
+	short := writeFile(t, files.dir, "short", "", []byte("singinKey"))
+	testTable := []signing.Config{
+		{SigningKey: "missing", Keys: []signing.KeyConfig{{ID: "hmac", Algorithm: "HS256", SecretFile: files.secret}}},
+		{SigningKey: "hmac", Keys: []signing.KeyConfig{{ID: "hmac", Algorithm: "HS256", SecretFile: short}}},
+		{SigningKey: "hmac", Keys: []signing.KeyConfig{{ID: "hmac", Algorithm: "none", SecretFile: files.secret}}},
+		{SigningKey: "ec", Keys: []signing.KeyConfig{{ID: "ec", Algorithm: "ES384", PrivateKeyFile: files.ecPrivate}}},
+		{SigningKey: "rsa", Keys: []signing.KeyConfig{{ID: "rsa", Algorithm: "RS256", PrivateKeyFile: files.ecPrivate}}},
+		{SigningKey: "rsa", Keys: []signing.KeyConfig{
+			{ID: "rsa", Algorithm: "RS256", PrivateKeyFile: files.rsaPrivate},
+			{ID: "rsa", Algorithm: "RS256", PublicKeyFile: files.rsaPublic},
+		}},
+	}
+
+	for _, config := range testTable {
+		content, _ := json.Marshal(config)
+		path := writeFile(t, files.dir, "keys.json", "", content)
+
+		_, err := signing.LoadManager(path)
+
+		assert.NotNil(t, err, string(content))
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	files := newKeyFiles(t)
+	defer os.RemoveAll(files.dir)
+	manager, _ := signing.NewManager(signing.Config{SigningKey: "ec", Keys: []signing.KeyConfig{
+		{ID: "hmac", Algorithm: "HS256", SecretFile: files.secret},
+		{ID: "rsa", Algorithm: "RS256", PublicKeyFile: files.rsaPublic},
+		{ID: "ec", Algorithm: "ES256", PrivateKeyFile: files.ecPrivate},
+	}})
+	rr := httptest.NewRecorder()
+
+	manager.JWKSHandler(rr, httptest.NewRequest("GET", "/.well-known/jwks.json", nil))
+
+	var jwks signing.JSONWebKeySet
+	json.Unmarshal(rr.Body.Bytes(), &jwks)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	assert.Len(t, jwks.Keys, 2)
+	assert.Equal(t, "ec", jwks.Keys[0].Kid)
+	assert.Equal(t, "EC", jwks.Keys[0].Kty)
+	assert.Equal(t, "P-256", jwks.Keys[0].Crv)
+	assert.Len(t, jwks.Keys[0].X, 43)
+	assert.Equal(t, "rsa", jwks.Keys[1].Kid)
+	assert.Equal(t, "RSA", jwks.Keys[1].Kty)
+	assert.Equal(t, "AQAB", jwks.Keys[1].E)
+	assert.NotContains(t, rr.Body.String(), "0123456789abcdef")
+}
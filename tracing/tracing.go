@@ -0,0 +1,180 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+
+	"sfr-backend/tid"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName - name of tracer creating all spans of the service
+const instrumentationName = "sfr-backend"
+
+// exporters selected by TRACES_EXPORTER
+const (
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+)
+
+// TransactionIDKey - attribute with transaction id of request, equal to X-Request-ID header
+const TransactionIDKey = attribute.Key("transaction_id")
+
+// InitFromEnv - installs tracer provider exporting to exporter in TRACES_EXPORTER, tracing is disabled when it is empty.
+// Returned function flushes spans which were not exported yet and has to be called before exit.
+func InitFromEnv() (func(context.Context) error, error) {
+	exporter, err := exporterFromEnv(os.Getenv("TRACES_EXPORTER"))
+	if err != nil || exporter == nil {
+		return func(context.Context) error { return nil }, err
+	}
+	ratio := 1.0
+	if value := os.Getenv("TRACES_SAMPLE_RATIO"); value != "" {
+		ratio, err = strconv.ParseFloat(value, 64)
+		if err != nil || ratio < 0 || ratio > 1 {
+			return nil, errors.New("TRACES_SAMPLE_RATIO has to be number between 0 and 1")
+		}
+	}
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override default service name
+	serviceResource, err := resource.New(context.Background(),
+		resource.WithAttributes(semconv.ServiceNameKey.String(instrumentationName)),
+		resource.WithTelemetrySDK(),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(serviceResource),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
+
+// exporterFromEnv - creates span exporter by name, OTLP exporter is configured by standard OTEL_EXPORTER_OTLP_* variables
+func exporterFromEnv(name string) (sdktrace.SpanExporter, error) {
+	switch name {
+	case "":
+		return nil, nil
+	case ExporterOTLP:
+		return otlptracehttp.New(context.Background())
+	case ExporterStdout:
+		return stdouttrace.New()
+	case ExporterFile:
+		path := os.Getenv("TRACES_FILE")
+		if path == "" {
+			return nil, errors.New("TRACES_FILE has to be set when TRACES_EXPORTER is file")
+		}
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, err
+		}
+		return stdouttrace.New(stdouttrace.WithWriter(file))
+	default:
+		return nil, errors.New("TRACES_EXPORTER has to be otlp, stdout or file")
+	}
+}
+
+func tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Middleware - starts server span of request named by method and route template, continues trace of traceparent header.
+// Has to be registered after CORS so transaction id is known, user is added by user.WithUsername once authenticated.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := r.URL.Path
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer().Start(ctx, r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPMethodKey.String(r.Method),
+				semconv.HTTPRouteKey.String(route),
+				TransactionIDKey.String(tid.GetTid(r)),
+			),
+		)
+		defer span.End()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+		span.SetAttributes(semconv.HTTPStatusCodeKey.Int(recorder.status))
+		if recorder.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(recorder.status))
+		}
+	})
+}
+
+// statusRecorder - remembers status written by handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (recorder *statusRecorder) WriteHeader(status int) {
+	recorder.status = status
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+// awsSpanKey - marks AWS request context holding span started by InstrumentSession
+type awsSpanKey struct{}
+
+// InstrumentSession - adds handlers creating client span of every AWS call made by clients of sess. Calls without
+// span in their own context become children of span in parent, so calls of request sessions belong to request trace.
+// Clients copy handlers when they are created, so it has to be called before session is passed to provider.
+func InstrumentSession(parent context.Context, sess *session.Session) {
+	sess.Handlers.Validate.PushFrontNamed(request.NamedHandler{Name: "tracing.Start", Fn: func(r *request.Request) {
+		ctx := r.Context()
+		if !trace.SpanContextFromContext(ctx).IsValid() {
+			ctx = trace.ContextWithSpan(ctx, trace.SpanFromContext(parent))
+		}
+		ctx, span := tracer().Start(ctx, r.ClientInfo.ServiceName+"."+r.Operation.Name,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				semconv.RPCSystemKey.String("aws-api"),
+				semconv.RPCServiceKey.String(r.ClientInfo.ServiceName),
+				semconv.RPCMethodKey.String(r.Operation.Name),
+				attribute.String("aws.region", aws.StringValue(r.Config.Region)),
+			),
+		)
+		r.SetContext(context.WithValue(ctx, awsSpanKey{}, span))
+	}})
+	sess.Handlers.Complete.PushBackNamed(request.NamedHandler{Name: "tracing.End", Fn: func(r *request.Request) {
+		span, ok := r.Context().Value(awsSpanKey{}).(trace.Span)
+		if !ok {
+			return
+		}
+		span.SetAttributes(attribute.String("aws.request_id", r.RequestID), attribute.Int("aws.retries", r.RetryCount))
+		if r.HTTPResponse != nil {
+			span.SetAttributes(semconv.HTTPStatusCodeKey.Int(r.HTTPResponse.StatusCode))
+		}
+		if r.Error != nil {
+			span.RecordError(r.Error)
+			span.SetStatus(codes.Error, r.Error.Error())
+		}
+		span.End()
+	}})
+}
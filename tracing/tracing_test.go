@@ -0,0 +1,124 @@
+package tracing_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"sfr-backend/tracing"
+	"sfr-backend/user"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sfn"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// recordSpans - installs tracer provider recording spans until returned function restores previous provider
+func recordSpans() (*tracetest.SpanRecorder, func()) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return recorder, func() { otel.SetTracerProvider(previous) }
+}
+
+func attributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	values := map[attribute.Key]attribute.Value{}
+	for _, keyValue := range span.Attributes() {
+		values[keyValue.Key] = keyValue.Value
+	}
+	return values
+}
+
+func TestMiddleware(t *testing.T) {
+	recorder, restore := recordSpans()
+	defer restore()
+	router := mux.NewRouter()
+	router.Use(tracing.Middleware)
+	router.HandleFunc("/aws/execution/{execution}", func(w http.ResponseWriter, r *http.Request) {
+		user.WithUsername(r.Context(), "operator")
+		w.WriteHeader(http.StatusBadGateway)
+	}).Methods("GET")
+	req := httptest.NewRequest("GET", "/aws/execution/arn", nil)
+	req.Header.Set("X-Request-ID", "tid")
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 1)
+	span := spans[0]
+	assert.Equal(t, "GET /aws/execution/{execution}", span.Name())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+	assert.Equal(t, codes.Error, span.Status().Code)
+	values := attributes(span)
+	assert.Equal(t, "/aws/execution/{execution}", values["http.route"].AsString())
+	assert.Equal(t, int64(http.StatusBadGateway), values["http.status_code"].AsInt64())
+	assert.Equal(t, "tid", values[tracing.TransactionIDKey].AsString())
+	assert.Equal(t, "operator", values["enduser.id"].AsString())
+}
+
+func TestInstrumentSession(t *testing.T) {
+	recorder, restore := recordSpans()
+	defer restore()
+	awsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Amz-Target") == "AWSStepFunctions.DescribeExecution" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type": "ExecutionDoesNotExist", "message": "missing"}`))
+			return
+		}
+		w.Write([]byte(`{"stateMachines": []}`))
+	}))
+	defer awsServer.Close()
+	sess, _ := session.NewSession(&aws.Config{
+		Region:      aws.String("eu-west-1"),
+		Endpoint:    aws.String(awsServer.URL),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+	})
+	parent, parentSpan := otel.Tracer("test").Start(context.Background(), "request")
+	tracing.InstrumentSession(parent, sess)
+	client := sfn.New(sess)
+
+	_, err := client.ListStateMachines(&sfn.ListStateMachinesInput{})
+	assert.Nil(t, err)
+	_, err = client.DescribeExecution(&sfn.DescribeExecutionInput{ExecutionArn: aws.String("arn")})
+	assert.NotNil(t, err)
+	parentSpan.End()
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 3)
+	list, describe := spans[0], spans[1]
+	assert.Equal(t, "states.ListStateMachines", list.Name())
+	assert.Equal(t, parentSpan.SpanContext().SpanID(), list.Parent().SpanID())
+	assert.Equal(t, "eu-west-1", attributes(list)["aws.region"].AsString())
+	assert.Equal(t, codes.Unset, list.Status().Code)
+	assert.Equal(t, "states.DescribeExecution", describe.Name())
+	assert.Equal(t, codes.Error, describe.Status().Code)
+	assert.Equal(t, int64(http.StatusBadRequest), attributes(describe)["http.status_code"].AsInt64())
+}
+
+func TestInitFromEnv(t *testing.T) {
+	shutdown, err := tracing.InitFromEnv()
+	assert.Nil(t, err)
+	assert.Nil(t, shutdown(context.Background()))
+
+	os.Setenv("TRACES_EXPORTER", "zipkin")
+	defer os.Unsetenv("TRACES_EXPORTER")
+	_, err = tracing.InitFromEnv()
+	assert.NotNil(t, err)
+
+	os.Setenv("TRACES_EXPORTER", tracing.ExporterFile)
+	_, err = tracing.InitFromEnv()
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,24 @@
+package user
+
+import (
+	"context"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type contextKey string
+
+const usernameKey contextKey = "username"
+
+// WithUsername - returns context carrying name of authenticated user, the user is added to request span as well
+func WithUsername(ctx context.Context, username string) context.Context {
+	trace.SpanFromContext(ctx).SetAttributes(semconv.EnduserIDKey.String(username))
+	return context.WithValue(ctx, usernameKey, username)
+}
+
+// UsernameFromContext - returns name of authenticated user stored by WithUsername
+func UsernameFromContext(ctx context.Context) string {
+	username, _ := ctx.Value(usernameKey).(string)
+	return username
+}
@@ -1,5 +1,17 @@
 package user
 
+import (
+	"errors"
+
+	"sfr-backend/rbac"
+)
+
+// ErrNotFound - user doesn't exist
+var ErrNotFound = errors.New("user not found")
+
+// ErrExists - user with the same username already exists
+var ErrExists = errors.New("user already exists")
+
 // User = Used to store User Details
 type User struct {
 	Username string `json:"username"`
@@ -13,4 +25,57 @@ type UserDetails struct {
 	Username  string `json:"username"`
 	Password  string `json:"password"`
 	Email     string `json:"email"`
+	// Grants - roles of user on machines, managed by admins
+	Grants []rbac.Grant `json:"grants,omitempty" dynamodbav:"grants,omitempty"`
+	// GroupGrants - roles mapped from identity provider groups, replaced on every single sign-on
+	GroupGrants []rbac.Grant `json:"groupGrants,omitempty" dynamodbav:"groupGrants,omitempty"`
+	// MFA - TOTP enrollment of user, never sent to clients
+	MFA *MFA `json:"-" dynamodbav:"mfa,omitempty"`
+	// Disabled - user can't log in or refresh tokens, set by admins
+	Disabled bool `json:"-" dynamodbav:"disabled,omitempty"`
+	// EmailVerified - user proved the email is theirs by accepting invite sent to it
+	EmailVerified bool `json:"-" dynamodbav:"emailVerified,omitempty"`
+	// OIDCIssuer, OIDCSubject - account at identity provider linked to user, single sign-on logs in as the linked user
+	OIDCIssuer  string `json:"-" dynamodbav:"oidcIssuer,omitempty"`
+	OIDCSubject string `json:"-" dynamodbav:"oidcSubject,omitempty"`
+}
+
+// Update - attributes of existing user changed by admins or single sign-on, nil fields are kept
+type Update struct {
+	Firstname *string
+	Lastname  *string
+	Email     *string
+	// EmailVerified - has to be set to false when Email changes
+	EmailVerified *bool
+	Grants        *[]rbac.Grant
+	GroupGrants   *[]rbac.Grant
+	Disabled      *bool
+	OIDCIssuer    *string
+	OIDCSubject   *string
+}
+
+// MFA - TOTP second factor of user
+type MFA struct {
+	// Secret - TOTP secret encrypted with MFA_ENCRYPTION_KEY
+	Secret string `dynamodbav:"secret"`
+	// Enabled - false until user confirms enrollment with first code
+	Enabled bool `dynamodbav:"enabled"`
+	// RecoveryCodes - sha256 of recovery codes not used yet
+	RecoveryCodes []string `dynamodbav:"recoveryCodes,omitempty"`
+	// LastUsedStep - time step of last accepted code, codes can't be replayed
+	LastUsedStep int64 `dynamodbav:"lastUsedStep"`
+}
+
+// MFAEnabled - checks if login requires second factor
+func (userDetails UserDetails) MFAEnabled() bool {
+	return userDetails.MFA != nil && userDetails.MFA.Enabled
+}
+
+// DisabledPassword - stored instead of bcrypt hash for users provisioned by single sign-on,
+// it is not a valid hash, so it never matches any password
+const DisabledPassword = "!"
+
+// AllGrants - grants managed by admins and grants mapped from identity provider groups
+func (userDetails UserDetails) AllGrants() []rbac.Grant {
+	return append(append([]rbac.Grant{}, userDetails.Grants...), userDetails.GroupGrants...)
 }